@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ba0f3/qmd-go/internal/answer"
+	"github.com/ba0f3/qmd-go/internal/llm"
+	"github.com/ba0f3/qmd-go/internal/store"
+	"github.com/spf13/cobra"
+)
+
+// askMaxTokens bounds the length of an answer.
+const askMaxTokens = 1024
+
+// askResult is the outcome of askQuestion, also the `qmd ask --json` output.
+type askResult struct {
+	Question  string        `json:"question"`
+	Answer    string        `json:"answer"`
+	Citations []askCitation `json:"citations"`
+	Rejected  []string      `json:"rejected,omitempty"`
+	Passages  []askPassage  `json:"passages"`
+}
+
+type askCitation struct {
+	Ref       string `json:"ref"`
+	File      string `json:"file"`
+	StartLine int    `json:"startLine"`
+	EndLine   int    `json:"endLine"`
+	Passage   int    `json:"passage"`
+}
+
+type askPassage struct {
+	N         int     `json:"n"`
+	Docid     string  `json:"docid"`
+	File      string  `json:"file"`
+	Title     string  `json:"title"`
+	StartLine int     `json:"startLine"`
+	EndLine   int     `json:"endLine"`
+	Score     float64 `json:"score"`
+	Text      string  `json:"text"`
+}
+
+// askQuestion retrieves passages with the hybrid query pipeline and has the answer
+// model (QMD_ANSWER_MODEL, or the default) answer from them. onToken, if non-nil,
+// receives the answer as it streams, a line at a time. Citations that do not point
+// into a retrieved passage are listed in Rejected and replaced, in Answer and in the
+// streamed text alike.
+func askQuestion(ctx context.Context, s *store.Store, question string, opts hybridOptions, onToken func(string) error) (*askResult, error) {
+	model := os.Getenv("QMD_ANSWER_MODEL")
+	if model == "" {
+		model = llm.DefaultAnswerModel()
+	}
+	if model == "" {
+		return nil, fmt.Errorf("no answer model configured: set QMD_ANSWER_MODEL to a chat model served at OLLAMA_HOST")
+	}
+
+	results, err := hybridSearch(ctx, s, question, opts)
+	if err != nil {
+		return nil, err
+	}
+	res := &askResult{Question: question, Citations: []askCitation{}, Passages: []askPassage{}}
+	if len(results) == 0 {
+		res.Answer = "No matching documents found."
+		return res, nil
+	}
+
+	var passages []answer.Passage
+	for i, r := range results {
+		p := answer.Passage{File: r.Filepath, Title: r.Title, StartLine: r.StartLine, Text: r.Snippet}
+		if p.Text == "" || p.StartLine == 0 {
+			p.StartLine, p.Text = 1, headBytes(r.Body, store.ChunkSizeChars)
+		}
+		passages = append(passages, p)
+		res.Passages = append(res.Passages, askPassage{
+			N: i + 1, Docid: "#" + docid(r.Hash), File: r.Filepath, Title: r.Title,
+			StartLine: p.StartLine, EndLine: p.EndLine(), Score: roundScore(r.Score), Text: p.Text,
+		})
+	}
+
+	client, err := getGenerateClient(model)
+	if err != nil {
+		return nil, err
+	}
+	// Streamed text is held back until each line is complete, so a rejected citation
+	// can be replaced before it is shown: citations never span lines.
+	var pending strings.Builder
+	emit := func(line string) error {
+		return onToken(answer.RemoveRejected(line, passages))
+	}
+	var streamTo func(string) error
+	if onToken != nil {
+		streamTo = func(tok string) error {
+			pending.WriteString(tok)
+			buf := pending.String()
+			i := strings.LastIndexByte(buf, '\n')
+			if i < 0 {
+				return nil
+			}
+			pending.Reset()
+			pending.WriteString(buf[i+1:])
+			return emit(buf[:i+1])
+		}
+	}
+	system, user := answer.Prompt(question, passages)
+	text, err := client.GenerateWithOptions(ctx, user, llm.GenerateOptions{
+		System: system, MaxTokens: askMaxTokens, OnToken: streamTo,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if onToken != nil && pending.Len() > 0 {
+		if err := emit(pending.String()); err != nil {
+			return nil, err
+		}
+	}
+
+	valid, rejected := answer.Citations(text, passages)
+	for _, c := range valid {
+		res.Citations = append(res.Citations, askCitation{
+			Ref: c.Ref, File: c.File, StartLine: c.Line, EndLine: c.EndLine, Passage: c.Passage,
+		})
+	}
+	for _, c := range rejected {
+		res.Rejected = append(res.Rejected, c.Ref)
+	}
+	res.Answer = strings.TrimSpace(answer.RemoveRejected(text, passages))
+	return res, nil
+}
+
+var askCmd = &cobra.Command{
+	Use:   "ask [question]",
+	Short: "Answer a question from your documents, with citations",
+	Long: `Runs the hybrid query pipeline, gives the top passages to a chat model and streams its
+answer line by line. Claims are cited as qmd://collection/path:line; citations that do
+not point into a retrieved passage are replaced with "[unsupported citation]" and
+reported.
+
+The model is QMD_ANSWER_MODEL (any chat model at the OpenAI-compatible OLLAMA_HOST
+endpoint, e.g. Ollama or llama-server), or a local Qwen3 model in GGUF builds.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initRoot()
+		question := strings.Join(args, " ")
+		limit, _ := cmd.Flags().GetInt("n")
+		collection, _ := cmd.Flags().GetString("collection")
+		noExpand, _ := cmd.Flags().GetBool("no-expand")
+		noRerank, _ := cmd.Flags().GetBool("no-rerank")
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		s, err := openStore()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening store: %v\n", err)
+			os.Exit(1)
+		}
+		defer s.Close()
+
+		opts := hybridOptions{
+			Collection: collection, Limit: limit, Aggregate: store.AggregateMax, Expand: !noExpand, Rerank: !noRerank,
+		}
+		var onToken func(string) error
+		if !asJSON {
+			onToken = func(tok string) error {
+				_, err := fmt.Print(tok)
+				return err
+			}
+		}
+		ctx, stop := interruptContext()
+		defer stop()
+		res, err := askQuestion(ctx, s, question, opts, onToken)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\nError: %v\n", err)
+			os.Exit(1)
+		}
+
+		if asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			_ = enc.Encode(res)
+			return
+		}
+		if len(res.Passages) == 0 {
+			fmt.Println(res.Answer)
+			return
+		}
+		fmt.Println()
+		fmt.Println()
+		fmt.Println("Sources:")
+		for _, p := range res.Passages {
+			fmt.Printf("  [%d] %s:%d-%d %s\n", p.N, p.File, p.StartLine, p.EndLine, p.Title)
+		}
+		if len(res.Rejected) > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: %d citation(s) do not point to retrieved text: %s\n",
+				len(res.Rejected), strings.Join(res.Rejected, ", "))
+		}
+	},
+}
+
+func init() {
+	askCmd.Flags().IntP("n", "n", 5, "Number of passages to answer from")
+	askCmd.Flags().StringP("collection", "c", "", "Restrict to collection")
+	askCmd.Flags().Bool("no-expand", false, "Skip query expansion")
+	askCmd.Flags().Bool("no-rerank", false, "Skip reranking")
+	askCmd.Flags().Bool("json", false, "JSON output: answer, citations and passages")
+	rootCmd.AddCommand(askCmd)
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/ba0f3/qmd-go/internal/config"
+	"github.com/ba0f3/qmd-go/internal/llm"
 	"github.com/spf13/cobra"
 )
 
@@ -31,11 +33,36 @@ var cleanupCmd = &cobra.Command{
 		}
 
 		_, _ = s.DB.Exec(`DELETE FROM content_vectors WHERE hash NOT IN (SELECT hash FROM documents WHERE active = 1)`)
-		_, _ = s.DB.Exec(`DELETE FROM embedding_blobs WHERE hash_seq NOT IN (
-			SELECT hash || '_' || seq FROM content_vectors
+		_, _ = s.DB.Exec(`DELETE FROM embedding_blobs WHERE NOT EXISTS (
+			SELECT 1 FROM content_vectors cv
+			WHERE cv.model = embedding_blobs.model AND cv.hash || '_' || cv.seq = embedding_blobs.hash_seq
+		)`)
+		_, _ = s.DB.Exec(`DELETE FROM embedding_full WHERE NOT EXISTS (
+			SELECT 1 FROM embedding_blobs eb
+			WHERE eb.model = embedding_full.model AND eb.hash_seq = embedding_full.hash_seq
 		)`)
 		fmt.Println("Cleaned orphaned vectors")
 
+		// Vectors from models neither the index nor any collection uses any more, such
+		// as the old model after 'qmd embed --migrate'.
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			fmt.Printf("Error loading config, keeping vectors of all models: %v\n", err)
+		} else if inUse, err := embedModelsInUse(cfg); err != nil {
+			fmt.Printf("Keeping vectors of all models: %v\n", err)
+		} else if models, err := s.EmbeddingModels(); err == nil {
+			for _, m := range models {
+				if inUse[m.Model] {
+					continue
+				}
+				if n, err := s.DeleteModelEmbeddings(m.Model); err != nil {
+					fmt.Printf("Error removing vectors from %s: %v\n", m.Model, err)
+				} else {
+					fmt.Printf("Removed %d vector(s) from unused model %s\n", n, m.Model)
+				}
+			}
+		}
+
 		_, err = s.DB.Exec(`VACUUM`)
 		if err != nil {
 			fmt.Printf("Vacuum failed: %v\n", err)
@@ -45,6 +72,23 @@ var cleanupCmd = &cobra.Command{
 	},
 }
 
+// embedModelsInUse returns the model specs the index and its collections embed with.
+func embedModelsInUse(cfg *config.Config) (map[string]bool, error) {
+	inUse := make(map[string]bool)
+	collections := []string{""}
+	for name := range cfg.Collections {
+		collections = append(collections, name)
+	}
+	for _, c := range collections {
+		m, err := llm.ResolveEmbedModel(cfg, c)
+		if err != nil {
+			return nil, err
+		}
+		inUse[m.Model] = true
+	}
+	return inUse, nil
+}
+
 func init() {
 	rootCmd.AddCommand(cleanupCmd)
 }
@@ -4,9 +4,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/ba0f3/qmd-go/internal/config"
 	"github.com/ba0f3/qmd-go/internal/indexer"
+	"github.com/ba0f3/qmd-go/internal/store"
 	"github.com/spf13/cobra"
 )
 
@@ -33,7 +36,14 @@ var collectionListCmd = &cobra.Command{
 
 		fmt.Println("Collections:")
 		for name, col := range cfg.Collections {
-			fmt.Printf("- %s (%s) [%s]\n", name, col.Path, col.Pattern)
+			line := fmt.Sprintf("- %s (%s) [%s]", name, col.Path, col.Pattern)
+			if col.Tokenizer != "" {
+				line += " tokenizer=" + col.Tokenizer
+			}
+			if len(col.Exclude) > 0 {
+				line += " exclude=" + strings.Join(col.Exclude, ",")
+			}
+			fmt.Println(line)
 		}
 	},
 }
@@ -62,6 +72,21 @@ var collectionAddCmd = &cobra.Command{
 		if pattern == "" {
 			pattern = "**/*.md"
 		}
+		tokName, _ := cmd.Flags().GetString("tokenizer")
+		jobs, _ := cmd.Flags().GetInt("jobs")
+		exclude, _ := cmd.Flags().GetStringArray("exclude")
+		if _, err := indexer.NewFilter(absPath, pattern, exclude); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		tok, err := store.ParseTokenizer(tokName)
+		if err != nil {
+			fmt.Printf("Invalid tokenizer: %v\n", err)
+			os.Exit(1)
+		}
+		if tok == store.TokenizerUnicode {
+			tokName = ""
+		}
 
 		cfg, err := config.LoadConfig()
 		if err != nil {
@@ -75,8 +100,10 @@ var collectionAddCmd = &cobra.Command{
 		}
 
 		cfg.Collections[name] = config.Collection{
-			Path:    absPath,
-			Pattern: pattern,
+			Path:      absPath,
+			Pattern:   pattern,
+			Tokenizer: tokName,
+			Exclude:   exclude,
 		}
 
 		if err := config.SaveConfig(cfg); err != nil {
@@ -90,8 +117,12 @@ var collectionAddCmd = &cobra.Command{
 			os.Exit(1)
 		}
 		defer s.Close()
+		if err := s.SetCollectionTokenizer(name, tok); err != nil {
+			fmt.Printf("Error setting tokenizer: %v\n", err)
+			os.Exit(1)
+		}
 		fmt.Printf("Indexing collection '%s'...\n", name)
-		if err := indexer.IndexFiles(s, name, absPath, pattern); err != nil {
+		if err := indexer.IndexFiles(s, name, absPath, pattern, indexer.Options{Jobs: jobs, Exclude: exclude}); err != nil {
 			fmt.Printf("Error indexing: %v\n", err)
 			os.Exit(1)
 		}
@@ -126,6 +157,7 @@ var collectionRemoveCmd = &cobra.Command{
 		s, err := openStore()
 		if err == nil {
 			_, _ = s.DB.Exec(`DELETE FROM documents WHERE collection = ?`, name)
+			_ = s.SetCollectionTokenizer(name, store.TokenizerUnicode)
 			s.Close()
 		}
 		fmt.Printf("Collection '%s' removed.\n", name)
@@ -170,17 +202,114 @@ var collectionRenameCmd = &cobra.Command{
 			fmt.Printf("Error updating documents: %v\n", err)
 			os.Exit(1)
 		}
+		_, err = s.DB.Exec(`UPDATE collection_tokenizers SET collection = ? WHERE collection = ?`, newName, oldName)
+		if err != nil {
+			fmt.Printf("Error updating tokenizer: %v\n", err)
+			os.Exit(1)
+		}
 		fmt.Printf("Renamed '%s' to '%s' (qmd://%s/)\n", oldName, newName, newName)
 	},
 }
 
+var collectionExplainCmd = &cobra.Command{
+	Use:   "explain <path>",
+	Short: "Explain why a file is included in or excluded from its collection",
+	Long: `Explain why a file or directory is included in or excluded from the collections
+whose root contains it: the pattern it matches or not, or the exclude entry or
+.gitignore / .qmdignore line that decides it. The path is a file system path or
+qmd://collection/path.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initRoot()
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			fmt.Printf("Error loading config: %v\n", err)
+			os.Exit(1)
+		}
+		type target struct{ name, rel string }
+		var targets []target
+		if rest, ok := strings.CutPrefix(args[0], "qmd://"); ok {
+			name, rel, _ := strings.Cut(rest, "/")
+			if _, exists := cfg.Collections[name]; !exists {
+				fmt.Printf("Collection '%s' not found.\n", name)
+				os.Exit(1)
+			}
+			targets = append(targets, target{name, rel})
+		} else {
+			abs, err := filepath.Abs(args[0])
+			if err != nil {
+				fmt.Printf("Invalid path: %v\n", err)
+				os.Exit(1)
+			}
+			names := make([]string, 0, len(cfg.Collections))
+			for name := range cfg.Collections {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				rel, err := filepath.Rel(cfg.Collections[name].Path, abs)
+				if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+					continue
+				}
+				targets = append(targets, target{name, filepath.ToSlash(rel)})
+			}
+			if len(targets) == 0 {
+				fmt.Printf("%s is not inside any collection.\n", abs)
+				os.Exit(1)
+			}
+		}
+
+		s, err := openStore()
+		if err != nil {
+			fmt.Printf("Error opening store: %v\n", err)
+			os.Exit(1)
+		}
+		defer s.Close()
+		for _, t := range targets {
+			col := cfg.Collections[t.name]
+			filter, err := indexer.NewFilter(col.Path, col.Pattern, col.Exclude)
+			if err != nil {
+				fmt.Printf("Collection '%s': %v\n", t.name, err)
+				continue
+			}
+			info, statErr := os.Stat(filepath.Join(col.Path, filepath.FromSlash(t.rel)))
+			v := filter.Explain(t.rel, statErr == nil && info.IsDir())
+			verdict := "excluded"
+			if v.Included {
+				verdict = "included"
+			}
+			shown := t.rel
+			if shown == "." {
+				shown = ""
+			}
+			fmt.Printf("qmd://%s/%s: %s, %s\n", t.name, shown, verdict, v.Reason)
+			if statErr == nil && info.IsDir() {
+				continue
+			}
+			_, indexErr := s.FindActiveDocument(t.name, t.rel)
+			switch {
+			case statErr != nil:
+				fmt.Println("  (no such file)")
+			case v.Included && indexErr != nil:
+				fmt.Println("  (not indexed yet; run 'qmd update')")
+			case !v.Included && indexErr == nil:
+				fmt.Println("  (still indexed; 'qmd update' removes it)")
+			}
+		}
+	},
+}
+
 func init() {
 	collectionAddCmd.Flags().String("name", "", "Collection name")
 	collectionAddCmd.Flags().String("mask", "**/*.md", "File pattern mask")
+	collectionAddCmd.Flags().String("tokenizer", "", "Full-text tokenizer: unicode61 (default) or trigram for CJK and other unsegmented text")
+	collectionAddCmd.Flags().Int("jobs", 0, "Files to read and hash in parallel (default: number of CPUs)")
+	collectionAddCmd.Flags().StringArray("exclude", nil, "Gitignore-style pattern of files or directories to leave out (repeatable)")
 
 	collectionCmd.AddCommand(collectionListCmd)
 	collectionCmd.AddCommand(collectionAddCmd)
 	collectionCmd.AddCommand(collectionRemoveCmd)
 	collectionCmd.AddCommand(collectionRenameCmd)
+	collectionCmd.AddCommand(collectionExplainCmd)
 	rootCmd.AddCommand(collectionCmd)
 }
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ba0f3/qmd-go/internal/config"
+	"github.com/ba0f3/qmd-go/internal/store"
+	"github.com/spf13/cobra"
+)
+
+// errNoDaemon means no daemon can answer for this index: none is running, it runs
+// with other model settings, or it failed. Callers then search in-process.
+var errNoDaemon = errors.New("no qmd daemon available")
+
+// daemonRequest is one request to the daemon; each connection carries one request
+// and one daemonResponse, as a JSON line each way.
+type daemonRequest struct {
+	Op     string              `json:"op"` // vsearch, query, status or stop
+	Env    string              `json:"env"`
+	Query  string              `json:"query,omitempty"`
+	Vector vectorSearchOptions `json:"vector"`
+	Hybrid hybridOptions       `json:"hybrid"`
+}
+
+type daemonResponse struct {
+	Error    string                  `json:"error,omitempty"`
+	Mismatch bool                    `json:"mismatch,omitempty"`
+	Vector   []store.VecSearchResult `json:"vector,omitempty"`
+	Hybrid   []hybridResult          `json:"hybrid,omitempty"`
+	Status   *daemonStatus           `json:"status,omitempty"`
+}
+
+type daemonStatus struct {
+	PID         int           `json:"pid"`
+	Index       string        `json:"index"`
+	Started     time.Time     `json:"started"`
+	Requests    int           `json:"requests"`
+	IdleTimeout time.Duration `json:"idleTimeout"`
+	EnvMatches  bool          `json:"envMatches"` // the caller's modelEnv is the daemon's
+}
+
+// daemonSocketPath is the Unix socket for the current index: the index file with a
+// .sock extension, e.g. ~/.cache/qmd/index.sock.
+func daemonSocketPath() (string, error) {
+	path, err := getStorePath()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".sock", nil
+}
+
+// modelEnv fingerprints the environment and the index config (models:, profiles: and
+// per-collection models), which together pick models and endpoints. The daemon keeps
+// the fingerprint it was started with, so it only answers clients whose fingerprint
+// matches; anyone else searches in-process.
+func modelEnv() string {
+	var vars []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if name == "QMD_NO_DAEMON" {
+			continue
+		}
+		for _, prefix := range []string{"QMD_", "OLLAMA_", "OPENAI_", "LLAMA_GO_", "HF_", "XDG_CONFIG_HOME"} {
+			if strings.HasPrefix(name, prefix) {
+				vars = append(vars, kv)
+				break
+			}
+		}
+	}
+	sort.Strings(vars)
+	h := sha256.New()
+	io.WriteString(h, strings.Join(vars, "\n"))
+	h.Write([]byte{0})
+	if cfg, err := config.LoadConfig(); err != nil {
+		io.WriteString(h, "config error: "+err.Error())
+	} else {
+		// Only the model settings: adding a collection or context needs no restart.
+		collectionModels := make(map[string]string)
+		for name, col := range cfg.Collections {
+			if col.EmbedModel != "" {
+				collectionModels[name] = col.EmbedModel
+			}
+		}
+		json.NewEncoder(h).Encode([]any{cfg.EmbedModel, cfg.Models, cfg.Profiles, collectionModels}) // maps encode sorted
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// callDaemon sends req to the daemon for the current index. Cancelling ctx closes the
+// connection, which cancels the search in the daemon. It returns errNoDaemon when the
+// caller should fall back to searching in-process (always, if QMD_NO_DAEMON is set).
+func callDaemon(ctx context.Context, req daemonRequest) (*daemonResponse, error) {
+	if os.Getenv("QMD_NO_DAEMON") != "" && req.Op != "status" && req.Op != "stop" {
+		return nil, errNoDaemon
+	}
+	path, err := daemonSocketPath()
+	if err != nil {
+		return nil, errNoDaemon
+	}
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return nil, errNoDaemon
+	}
+	defer conn.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	req.Env = modelEnv()
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("%w: %v", errNoDaemon, err)
+	}
+	var resp daemonResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("%w: %v", errNoDaemon, err)
+	}
+	if resp.Mismatch {
+		return nil, errNoDaemon
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return &resp, nil
+}
+
+// daemonVectorSearch runs vectorSearch in the daemon.
+func daemonVectorSearch(ctx context.Context, query string, opts vectorSearchOptions) ([]store.VecSearchResult, error) {
+	resp, err := callDaemon(ctx, daemonRequest{Op: "vsearch", Query: query, Vector: opts})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Vector, nil
+}
+
+// daemonHybridSearch runs hybridSearch in the daemon.
+func daemonHybridSearch(ctx context.Context, query string, opts hybridOptions) ([]hybridResult, error) {
+	resp, err := callDaemon(ctx, daemonRequest{Op: "query", Query: query, Hybrid: opts})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Hybrid, nil
+}
+
+// runVectorSearch runs vectorSearch in the daemon, or in-process on the current index
+// when no daemon answers.
+func runVectorSearch(ctx context.Context, query string, opts vectorSearchOptions) ([]store.VecSearchResult, error) {
+	results, err := daemonVectorSearch(ctx, query, opts)
+	if !errors.Is(err, errNoDaemon) {
+		return results, err
+	}
+	s, err := openStore()
+	if err != nil {
+		return nil, fmt.Errorf("opening store: %w", err)
+	}
+	defer s.Close()
+	return vectorSearch(ctx, s, query, opts)
+}
+
+// runHybridSearch runs hybridSearch in the daemon, or in-process on the current index
+// when no daemon answers.
+func runHybridSearch(ctx context.Context, query string, opts hybridOptions) ([]hybridResult, error) {
+	results, err := daemonHybridSearch(ctx, query, opts)
+	if !errors.Is(err, errNoDaemon) {
+		return results, err
+	}
+	s, err := openStore()
+	if err != nil {
+		return nil, fmt.Errorf("opening store: %w", err)
+	}
+	defer s.Close()
+	return hybridSearch(ctx, s, query, opts)
+}
+
+// daemon serves searches from one open store, keeping its ANN indexes and the model
+// clients (cached per process by getEmbedClient, getGenerateClient and getReranker)
+// loaded between requests.
+type daemon struct {
+	s      *store.Store
+	env    string
+	status daemonStatus
+
+	searchMu sync.Mutex // one search at a time: local models are not safe for concurrent use
+
+	mu       sync.Mutex
+	active   int
+	lastUsed time.Time
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newDaemon(s *store.Store, idleTimeout time.Duration) *daemon {
+	return &daemon{
+		s: s, env: modelEnv(), lastUsed: time.Now(), stop: make(chan struct{}),
+		status: daemonStatus{PID: os.Getpid(), Index: getIndexName(), Started: time.Now(), IdleTimeout: idleTimeout},
+	}
+}
+
+// run serves connections from ln until ctx is done, a stop request arrives or no
+// request has been in flight for the idle timeout (0 = never), and says which.
+func (d *daemon) run(ctx context.Context, ln net.Listener) string {
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go d.serve(conn)
+		}
+	}()
+
+	idleTimeout := d.status.IdleTimeout
+	interval := time.Second
+	if idleTimeout > 0 && idleTimeout/4 < interval {
+		interval = idleTimeout / 4
+	}
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return "interrupted, shutting down"
+		case <-d.stop:
+			return "stopped"
+		case <-tick.C:
+			if idleTimeout > 0 && d.idleFor() >= idleTimeout {
+				return fmt.Sprintf("idle for %s, shutting down", idleTimeout)
+			}
+		}
+	}
+}
+
+func (d *daemon) serve(conn net.Conn) {
+	defer conn.Close()
+	d.track(1)
+	defer d.track(-1)
+
+	var req daemonRequest
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// The client closes its end when it is interrupted; that cancels the search.
+	go func() {
+		io.Copy(io.Discard, conn)
+		cancel()
+	}()
+	json.NewEncoder(conn).Encode(d.handle(ctx, req))
+}
+
+func (d *daemon) handle(ctx context.Context, req daemonRequest) *daemonResponse {
+	switch req.Op {
+	case "status":
+		d.mu.Lock()
+		st := d.status
+		d.mu.Unlock()
+		st.EnvMatches = req.Env == d.env
+		return &daemonResponse{Status: &st}
+	case "stop":
+		d.stopOnce.Do(func() { close(d.stop) })
+		return &daemonResponse{}
+	case "vsearch", "query":
+	default:
+		return &daemonResponse{Error: fmt.Sprintf("unknown daemon op %q", req.Op)}
+	}
+	if req.Env != d.env {
+		return &daemonResponse{Mismatch: true}
+	}
+
+	d.searchMu.Lock()
+	defer d.searchMu.Unlock()
+	d.mu.Lock()
+	d.status.Requests++
+	d.mu.Unlock()
+	var resp daemonResponse
+	var err error
+	if req.Op == "vsearch" {
+		resp.Vector, err = vectorSearch(ctx, d.s, req.Query, req.Vector)
+	} else {
+		resp.Hybrid, err = hybridSearch(ctx, d.s, req.Query, req.Hybrid)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	return &resp
+}
+
+// track counts requests in flight; the idle timeout runs from the end of the last one.
+func (d *daemon) track(delta int) {
+	d.mu.Lock()
+	d.active += delta
+	d.lastUsed = time.Now()
+	d.mu.Unlock()
+}
+
+// idleFor is how long the daemon has had no request in flight (0 while busy).
+func (d *daemon) idleFor() time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.active > 0 {
+		return 0
+	}
+	return time.Since(d.lastUsed)
+}
+
+// listenDaemonSocket listens on path, replacing a stale socket left by a daemon that
+// died, but not one that is still answering.
+func listenDaemonSocket(path string) (net.Listener, error) {
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("a daemon is already listening on %s", path)
+	}
+	os.Remove(path)
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Keep the index and models loaded for fast CLI searches",
+	Long: `Runs in the foreground, holding the index and the embedding, expansion and reranking
+models in memory, and serves 'qmd vsearch' and 'qmd query' over a Unix socket next to
+the index (e.g. ~/.cache/qmd/index.sock). Those commands use a running daemon
+automatically and search in-process otherwise, or when their model environment
+(QMD_*, OLLAMA_*, OPENAI_*, HF_* variables) or index config differs from the daemon's;
+restart the daemon after editing models or profiles. Set QMD_NO_DAEMON=1 to bypass it. The daemon exits after --idle-timeout without requests.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		initRoot()
+		idleTimeout, _ := cmd.Flags().GetDuration("idle-timeout")
+		path, err := daemonSocketPath()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		s, err := openStore()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening store: %v\n", err)
+			os.Exit(1)
+		}
+		defer s.Close()
+		ln, err := listenDaemonSocket(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer os.Remove(path)
+		defer ln.Close()
+
+		d := newDaemon(s, idleTimeout)
+		ctx, stop := interruptContext()
+		defer stop()
+
+		// Load the embedding model and the ANN index now rather than on the first search.
+		if s.HasEmbeddings() {
+			start := time.Now()
+			if _, err := vectorSearch(ctx, s, "warm up", vectorSearchOptions{Limit: 1, Aggregate: store.AggregateMax}); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: warm-up search failed: %v\n", err)
+			} else {
+				fmt.Fprintf(os.Stderr, "Loaded embedding model and vector index in %s\n", time.Since(start).Round(time.Millisecond))
+			}
+		}
+		fmt.Fprintf(os.Stderr, "qmd daemon serving index %q on %s (pid %d)\n", getIndexName(), path, os.Getpid())
+
+		fmt.Fprintf(os.Stderr, "qmd daemon: %s\n", d.run(ctx, ln))
+	},
+}
+
+var daemonStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether a daemon is serving the index",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		initRoot()
+		resp, err := callDaemon(context.Background(), daemonRequest{Op: "status"})
+		if err != nil {
+			fmt.Println("No daemon running for this index.")
+			return
+		}
+		st := resp.Status
+		fmt.Printf("Daemon running: pid %d, index %q, up %s, %d search(es)\n",
+			st.PID, st.Index, time.Since(st.Started).Round(time.Second), st.Requests)
+		if st.IdleTimeout > 0 {
+			fmt.Printf("Idle timeout: %s\n", st.IdleTimeout)
+		}
+		if !st.EnvMatches {
+			fmt.Println("Note: this shell's model environment or index config differs from the daemon's; searches here run in-process.")
+		} else if os.Getenv("QMD_NO_DAEMON") != "" {
+			fmt.Println("Note: QMD_NO_DAEMON is set; searches here run in-process.")
+		}
+	},
+}
+
+var daemonStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the daemon serving the index",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		initRoot()
+		if _, err := callDaemon(context.Background(), daemonRequest{Op: "stop"}); err != nil {
+			fmt.Println("No daemon running for this index.")
+			return
+		}
+		fmt.Println("Daemon stopped.")
+	},
+}
+
+func init() {
+	daemonCmd.Flags().Duration("idle-timeout", 30*time.Minute, "Exit after this long without requests (0 = never)")
+	daemonCmd.AddCommand(daemonStatusCmd)
+	daemonCmd.AddCommand(daemonStopCmd)
+	rootCmd.AddCommand(daemonCmd)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ba0f3/qmd-go/internal/config"
+	"github.com/ba0f3/qmd-go/internal/indexer"
+	"github.com/ba0f3/qmd-go/internal/store"
+)
+
+// setupDaemonIndex points the index and its config at a temp directory and indexes a
+// small collection into it.
+func setupDaemonIndex(t *testing.T) *store.Store {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("INDEX_PATH", filepath.Join(dir, "index.sqlite"))
+	t.Setenv("QMD_CONFIG_DIR", filepath.Join(dir, "config"))
+	t.Setenv("QMD_NO_DAEMON", "")
+	initRoot()
+
+	notes := filepath.Join(dir, "notes")
+	os.Mkdir(notes, 0755)
+	os.WriteFile(filepath.Join(notes, "apple.md"), []byte("# Apple\n\nApples grow on trees.\n"), 0644)
+	os.WriteFile(filepath.Join(notes, "banana.md"), []byte("# Banana\n\nBananas are yellow.\n"), 0644)
+	s, err := openStore()
+	if err != nil {
+		t.Fatalf("openStore failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	if err := indexer.IndexFiles(s, "notes", notes, "**/*.md", indexer.Options{}); err != nil {
+		t.Fatalf("IndexFiles failed: %v", err)
+	}
+	return s
+}
+
+// startDaemon serves s on the index's socket until the test ends; the returned channel
+// receives the reason run stopped.
+func startDaemon(t *testing.T, s *store.Store, idleTimeout time.Duration) (*daemon, <-chan string) {
+	t.Helper()
+	path, err := daemonSocketPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := listenDaemonSocket(path)
+	if err != nil {
+		t.Fatalf("listenDaemonSocket failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	d := newDaemon(s, idleTimeout)
+	done := make(chan string, 1)
+	go func() { done <- d.run(ctx, ln) }()
+	t.Cleanup(func() {
+		cancel()
+		ln.Close()
+		os.Remove(path)
+	})
+	return d, done
+}
+
+var daemonTestSearch = hybridOptions{Limit: 5, Aggregate: store.AggregateMax}
+
+func daemonRequests(t *testing.T) int {
+	t.Helper()
+	resp, err := callDaemon(context.Background(), daemonRequest{Op: "status"})
+	if err != nil {
+		t.Fatalf("status failed: %v", err)
+	}
+	return resp.Status.Requests
+}
+
+func TestDaemonServesSearches(t *testing.T) {
+	s := setupDaemonIndex(t)
+	_, done := startDaemon(t, s, 0)
+	ctx := context.Background()
+
+	results, err := daemonHybridSearch(ctx, "apples", daemonTestSearch)
+	if err != nil {
+		t.Fatalf("daemonHybridSearch failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Filepath != "qmd://notes/apple.md" {
+		t.Errorf("Expected apple.md from the daemon, got %+v", results)
+	}
+	resp, err := callDaemon(ctx, daemonRequest{Op: "status"})
+	if err != nil {
+		t.Fatalf("status failed: %v", err)
+	}
+	if st := resp.Status; st.Requests != 1 || !st.EnvMatches || st.PID != os.Getpid() {
+		t.Errorf("Unexpected status %+v", st)
+	}
+
+	// A second daemon for the same index is refused while the first answers.
+	path, _ := daemonSocketPath()
+	if ln, err := listenDaemonSocket(path); err == nil {
+		ln.Close()
+		t.Error("Expected a second daemon on the same socket to be refused")
+	}
+
+	if _, err := callDaemon(ctx, daemonRequest{Op: "stop"}); err != nil {
+		t.Fatalf("stop failed: %v", err)
+	}
+	select {
+	case reason := <-done:
+		if reason != "stopped" {
+			t.Errorf("run returned %q, want stopped", reason)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Daemon did not stop")
+	}
+}
+
+func TestDaemonFallback(t *testing.T) {
+	setupDaemonIndex(t)
+	ctx := context.Background()
+
+	// Without a daemon, searches run in-process.
+	if _, err := daemonHybridSearch(ctx, "apples", daemonTestSearch); !errors.Is(err, errNoDaemon) {
+		t.Fatalf("Expected errNoDaemon without a daemon, got %v", err)
+	}
+	results, err := runHybridSearch(ctx, "bananas", daemonTestSearch)
+	if err != nil || len(results) != 1 || results[0].Filepath != "qmd://notes/banana.md" {
+		t.Errorf("Expected banana.md in-process, got %+v (%v)", results, err)
+	}
+
+	// A stale socket left by a daemon that died is replaced.
+	path, _ := daemonSocketPath()
+	os.WriteFile(path, nil, 0600)
+	if _, err := daemonHybridSearch(ctx, "apples", daemonTestSearch); !errors.Is(err, errNoDaemon) {
+		t.Errorf("Expected errNoDaemon with a stale socket, got %v", err)
+	}
+	ln, err := listenDaemonSocket(path)
+	if err != nil {
+		t.Fatalf("Expected the stale socket to be replaced: %v", err)
+	}
+	ln.Close()
+}
+
+func TestDaemonFingerprintMismatch(t *testing.T) {
+	s := setupDaemonIndex(t)
+	startDaemon(t, s, 0)
+	ctx := context.Background()
+
+	// QMD_NO_DAEMON bypasses a running daemon.
+	t.Setenv("QMD_NO_DAEMON", "1")
+	if _, err := daemonHybridSearch(ctx, "apples", daemonTestSearch); !errors.Is(err, errNoDaemon) {
+		t.Errorf("Expected errNoDaemon with QMD_NO_DAEMON, got %v", err)
+	}
+	t.Setenv("QMD_NO_DAEMON", "")
+
+	// Another model environment searches in-process, as the daemon would use other models.
+	t.Setenv("QMD_EMBED_MODEL", "other-model")
+	if _, err := daemonHybridSearch(ctx, "apples", daemonTestSearch); !errors.Is(err, errNoDaemon) {
+		t.Errorf("Expected errNoDaemon for another environment, got %v", err)
+	}
+	if results, err := runHybridSearch(ctx, "apples", daemonTestSearch); err != nil || len(results) != 1 {
+		t.Errorf("Expected an in-process result, got %+v (%v)", results, err)
+	}
+	os.Unsetenv("QMD_EMBED_MODEL")
+	if n := daemonRequests(t); n != 0 {
+		t.Errorf("Expected the daemon to serve no search, served %d", n)
+	}
+
+	// So does editing the models in the index config, but not adding a collection.
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Collections["more"] = config.Collection{Path: t.TempDir(), Pattern: "**/*.md"}
+	if err := config.SaveConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := daemonHybridSearch(ctx, "apples", daemonTestSearch); err != nil {
+		t.Errorf("Expected the daemon to answer after adding a collection, got %v", err)
+	}
+	cfg.EmbedModel = "house"
+	cfg.Models = map[string]config.ModelConfig{"house": {Kind: "ollama", Model: "house-embed"}}
+	if err := config.SaveConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := daemonHybridSearch(ctx, "apples", daemonTestSearch); !errors.Is(err, errNoDaemon) {
+		t.Errorf("Expected errNoDaemon after editing models, got %v", err)
+	}
+	resp, err := callDaemon(ctx, daemonRequest{Op: "status"})
+	if err != nil || resp.Status.EnvMatches {
+		t.Errorf("Expected status to report the mismatch, got %+v (%v)", resp, err)
+	}
+}
+
+func TestDaemonIdleTimeout(t *testing.T) {
+	s := setupDaemonIndex(t)
+	d, done := startDaemon(t, s, 200*time.Millisecond)
+
+	// A request in flight keeps the daemon up.
+	d.track(1)
+	select {
+	case reason := <-done:
+		t.Fatalf("Daemon exited while busy: %s", reason)
+	case <-time.After(400 * time.Millisecond):
+	}
+	d.track(-1)
+
+	select {
+	case reason := <-done:
+		if reason != "idle for 200ms, shutting down" {
+			t.Errorf("run returned %q, want the idle timeout", reason)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Daemon did not exit when idle")
+	}
+}
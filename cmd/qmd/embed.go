@@ -1,50 +1,53 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
-	"strings"
+	"path"
+	"sync"
 	"time"
 
+	"github.com/ba0f3/qmd-go/internal/config"
 	"github.com/ba0f3/qmd-go/internal/llm"
 	"github.com/ba0f3/qmd-go/internal/store"
 	"github.com/spf13/cobra"
 )
 
-func formatDocForEmbedding(text, title string) string {
-	if title == "" {
-		title = "none"
-	}
-	return "title: " + title + " | text: " + text
-}
-
-func extractTitle(body string) string {
-	lines := strings.Split(strings.TrimSpace(body), "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-		if strings.HasPrefix(line, "#") {
-			return strings.TrimSpace(strings.TrimLeft(line, "#"))
-		}
-		return line
-	}
-	return ""
-}
-
 var embedCmd = &cobra.Command{
 	Use:   "embed",
 	Short: "Generate vector embeddings",
-	Long:  "Generate vector embeddings for indexed documents using Ollama or OpenAI-compatible API.",
+	Long: `Generate vector embeddings for indexed documents using Ollama or OpenAI-compatible API.
+
+The model comes from the index config (embed_model and models:, per collection or for
+the whole index) or else from QMD_EMBED_MODEL and QMD_EMBED_BACKEND. Vectors are kept
+per model, and only documents without vectors from their model are embedded.
+
+--model embeds with another model (a models: entry or a model spec) instead of the
+index-wide one. With --migrate, the index's embed_model is switched to it once every
+document has vectors; until then searches keep using the current model. The command
+blocks until the re-embed is done, so run it in another terminal (or under nohup) to
+keep searching the live index meanwhile; if interrupted, run it again to resume.
+
+--storage int8 or binary (with --force, to re-embed existing vectors) stores quantized
+codes, 4 or 32 times smaller than float32 vectors, and searches on them alone.
+--keep-full also keeps the float32 vectors to rescore the top results: full precision,
+but an index larger than with float32 storage. qmd status shows the bytes per table.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		force, _ := cmd.Flags().GetBool("force")
-		model := os.Getenv("QMD_EMBED_MODEL")
-		if model == "" {
-			model = llm.DefaultEmbedModel()
-		}
+		storageFlag, _ := cmd.Flags().GetString("storage")
+		batchSize, _ := cmd.Flags().GetInt("batch-size")
+		concurrency, _ := cmd.Flags().GetInt("concurrency")
+		modelFlag, _ := cmd.Flags().GetString("model")
+		migrate, _ := cmd.Flags().GetBool("migrate")
 
 		initRoot()
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+			os.Exit(1)
+		}
 		s, err := openStore()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error opening store: %v\n", err)
@@ -57,86 +60,406 @@ var embedCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		if force {
-			fmt.Fprintln(os.Stderr, "Force re-embedding: clearing all vectors...")
-			if err := s.ClearAllEmbeddings(); err != nil {
-				fmt.Fprintf(os.Stderr, "Error clearing embeddings: %v\n", err)
+		var override *llm.EmbedModel
+		if modelFlag != "" {
+			m, err := llm.LookupEmbedModel(cfg, modelFlag)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 				os.Exit(1)
 			}
+			override = &m
+		}
+		current, err := llm.ResolveEmbedModel(cfg, "")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if migrate {
+			if override == nil || override.Name == "" {
+				fmt.Fprintln(os.Stderr, "Error: --migrate needs --model naming an entry under models: in the index config")
+				os.Exit(1)
+			}
+			fmt.Printf("Migrating from %s to %s; searches use %s until the migration completes.\n",
+				current, override, current)
 		}
 
-		hashes, err := s.GetHashesForEmbedding()
+		groups, err := planEmbedding(s, cfg, override)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error getting hashes: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
-		if len(hashes) == 0 {
+		if force {
+			// Only the models this run embeds lose their vectors (with --model, only that
+			// model), so the others stay searchable.
+			for _, g := range groups {
+				if override != nil && g.model.Model != override.Model {
+					continue
+				}
+				fmt.Fprintf(os.Stderr, "Force re-embedding: clearing vectors from %s...\n", g.model.Model)
+				if _, err := s.DeleteModelEmbeddings(g.model.Model); err != nil {
+					fmt.Fprintf(os.Stderr, "Error clearing embeddings: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			if groups, err = planEmbedding(s, cfg, override); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if cmd.Flags().Changed("keep-full") {
+			keepFull, _ := cmd.Flags().GetBool("keep-full")
+			if err := s.SetKeepFullVectors(keepFull); err != nil {
+				fmt.Fprintf(os.Stderr, "Error setting full-precision vectors: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if storageFlag != "" {
+			mode, err := store.ParseVectorStorage(storageFlag)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			if err := s.SetVectorStorage(mode); err != nil {
+				fmt.Fprintf(os.Stderr, "Error setting vector storage: %v\n", err)
+				if force {
+					fmt.Fprintln(os.Stderr, "Vectors from models this run does not embed remain; 'qmd cleanup' removes those no collection uses.")
+				}
+				os.Exit(1)
+			}
+		}
+
+		docs := 0
+		for _, g := range groups {
+			docs += len(g.hashes)
+		}
+		if docs == 0 {
 			fmt.Println("All content hashes already have embeddings.")
+			if migrate {
+				switchEmbedModel(current, *override)
+			}
 			return
 		}
 
-		backend := os.Getenv("QMD_EMBED_BACKEND")
-		if backend == "" {
-			if llm.GGUFEnabled() {
-				backend = "gguf (default)"
-			} else {
-				backend = "api (default)"
+		ctx, stop := interruptContext()
+		defer stop()
+		if batchSize < 1 {
+			batchSize = 1
+		}
+		embedded, failed, total := 0, 0, 0
+		now := time.Now()
+		for _, g := range groups {
+			if len(g.hashes) == 0 {
+				continue
+			}
+			n, e, chunks := embedGroupDocs(ctx, s, g, batchSize, concurrency, now, os.Stdout)
+			embedded, failed, total = embedded+n, failed+e, total+chunks
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		elapsed := time.Since(now).Seconds()
+		if ctx.Err() != nil {
+			fmt.Printf("Interrupted. Embedded %d chunks in %.1fs; run qmd embed again to continue.\n", embedded, elapsed)
+			return
+		}
+		fmt.Printf("Done. Embedded %d chunks from %d documents in %.1fs", embedded, docs, elapsed)
+		if failed > 0 {
+			fmt.Printf(" (%d errors)", failed)
+		}
+		fmt.Println()
+		if migrate {
+			if failed > 0 {
+				fmt.Fprintf(os.Stderr, "Not switching to %s while %d chunks are missing; run the command again to retry them.\n",
+					override, failed)
+				os.Exit(1)
 			}
+			switchEmbedModel(current, *override)
+		}
+	},
+}
+
+// planEmbedding groups the documents that have no vectors from their model by that
+// model, one group per model. override, if set, replaces the index-wide model for
+// collections that do not name their own.
+func planEmbedding(s *store.Store, cfg *config.Config, override *llm.EmbedModel) ([]*embedGroup, error) {
+	resolved := make(map[string]llm.EmbedModel)
+	modelFor := func(collection string) (llm.EmbedModel, error) {
+		if m, ok := resolved[collection]; ok {
+			return m, nil
+		}
+		m, err := llm.ResolveEmbedModel(cfg, collection)
+		if override != nil && config.EmbedModelFor(cfg, collection) == cfg.EmbedModel {
+			m, err = *override, nil
 		}
-		client, err := llm.NewEmbedClient(model)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error creating embed client: %v\n", err)
-			os.Exit(1)
+			return m, fmt.Errorf("collection %s: %w", collection, err)
 		}
+		resolved[collection] = m
+		return m, nil
+	}
 
-		var totalChunks int
-		for _, h := range hashes {
-			chunks := store.ChunkDocument(h.Body, store.ChunkSizeChars, store.ChunkOverlapChars)
-			totalChunks += len(chunks)
+	// Vectors are stored under the model spec, so that is what groups documents.
+	var groups []*embedGroup
+	byModel := make(map[string]*embedGroup)
+	collections := []string{""}
+	for name := range cfg.Collections {
+		collections = append(collections, name)
+	}
+	for _, c := range collections {
+		m, err := modelFor(c)
+		if err != nil {
+			return nil, err
 		}
-		fmt.Printf("Embedding %d documents (%d chunks), model: %s, backend: %s\n\n", len(hashes), totalChunks, model, backend)
+		if byModel[m.Model] == nil {
+			byModel[m.Model] = &embedGroup{model: m}
+			groups = append(groups, byModel[m.Model])
+		}
+	}
+	for _, g := range groups {
+		candidates, err := s.GetHashesForEmbedding(g.model.Model)
+		if err != nil {
+			return nil, err
+		}
+		seen := make(map[string]bool)
+		for _, h := range candidates {
+			m, err := modelFor(h.Collection)
+			if err != nil {
+				return nil, err
+			}
+			if m.Model == g.model.Model && !seen[h.Hash] {
+				seen[h.Hash] = true
+				g.hashes = append(g.hashes, h)
+			}
+		}
+	}
+	return groups, nil
+}
 
-		embedded := 0
-		errors := 0
-		now := time.Now()
+// switchEmbedModel points the index's embed_model at to once its vectors are complete.
+// The config is reloaded so edits made while embedding are kept.
+func switchEmbedModel(from, to llm.EmbedModel) {
+	cfg, err := config.LoadConfig()
+	if err == nil {
+		cfg.EmbedModel = to.Name
+		err = config.SaveConfig(cfg)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error switching embed_model to %s: %v\n", to.Name, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Switched the index from %s to %s. Vectors from %s are kept until 'qmd cleanup'.\n",
+		from, to, from.Model)
+}
 
-		for i, h := range hashes {
-			docTitle := extractTitle(h.Body)
-			if docTitle == "" {
-				parts := strings.Split(h.Path, "/")
-				if len(parts) > 0 {
-					docTitle = parts[len(parts)-1]
-				}
+// Defaults of embed's --batch-size and --concurrency, shared with watch --embed.
+const (
+	defaultEmbedBatchSize   = 32
+	defaultEmbedConcurrency = 4
+)
+
+// embedGroup is the documents embedded with one model.
+type embedGroup struct {
+	model  llm.EmbedModel
+	hashes []store.EmbeddingCandidate
+}
+
+// embedGroupDocs embeds a group's documents with a bounded worker pool and returns
+// the chunks embedded, the chunks that failed and the chunks attempted. A client that
+// cannot be created counts every chunk as failed. Progress goes to stderr and the
+// summary lines to out.
+func embedGroupDocs(ctx context.Context, s *store.Store, g *embedGroup, batchSize, concurrency int, now time.Time, out io.Writer) (embedded, failed, total int) {
+	var pending []embedChunk
+	for _, h := range g.hashes {
+		docTitle := h.Title
+		if docTitle == "" {
+			docTitle = path.Base(h.Path)
+		}
+		for seq, ch := range store.ChunkDocument(h.Body, store.ChunkSizeChars, store.ChunkOverlapChars) {
+			pending = append(pending, embedChunk{
+				path: h.Path, text: g.model.FormatDocument(docTitle, ch.Text),
+				emb: store.Embedding{Hash: h.Hash, Seq: seq, Pos: ch.Pos},
+			})
+		}
+	}
+
+	client, err := getEmbedClient(g.model)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating embed client for %s: %v\n", g.model, err)
+		return 0, len(pending), len(pending)
+	}
+	if ollama, ok := client.(*llm.OllamaClient); ok {
+		if err := prepareOllamaModel(ctx, ollama, out); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 0, len(pending), len(pending)
+		}
+	}
+
+	// Local models run one sequence at a time, so extra workers would only queue.
+	switch client.(type) {
+	case *llm.OpenAIClient, *llm.OllamaClient:
+	default:
+		concurrency = 1
+	}
+	concurrency = max(concurrency, 1)
+	backend := g.model.Kind
+	if backend == "" {
+		backend = os.Getenv("QMD_EMBED_BACKEND")
+	}
+	if backend == "" {
+		if llm.GGUFEnabled() {
+			backend = "gguf (default)"
+		} else {
+			backend = "api (default)"
+		}
+	}
+	fmt.Fprintf(out, "Embedding %d documents (%d chunks), model: %s, backend: %s, batch size: %d, concurrency: %d\n\n",
+		len(g.hashes), len(pending), g.model, backend, batchSize, concurrency)
+
+	batches := make(chan []embedChunk)
+	done := make(chan []embedChunk)
+	go func() {
+		defer close(batches)
+		for i := 0; i < len(pending); i += batchSize {
+			select {
+			case batches <- pending[i:min(i+batchSize, len(pending))]:
+			case <-ctx.Done():
+				return
 			}
-			chunks := store.ChunkDocument(h.Body, store.ChunkSizeChars, store.ChunkOverlapChars)
-			for seq, ch := range chunks {
-				formatted := formatDocForEmbedding(ch.Text, docTitle)
-				result, err := client.Embed(formatted)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Error embedding %s chunk %d: %v\n", h.Path, seq, err)
-					errors++
-					continue
-				}
-				if err := s.InsertEmbedding(h.Hash, seq, ch.Pos, result.Embedding, model, now); err != nil {
-					fmt.Fprintf(os.Stderr, "Error inserting embedding: %v\n", err)
-					errors++
-					continue
+		}
+	}()
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				done <- embedBatch(ctx, client, batch)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	// Results are written from this goroutine only, one transaction per batch. A
+	// document's vectors are held back until all its chunks are embedded, so an
+	// interrupted or failed document has none and is picked up by the next run.
+	remaining := make(map[string]int)
+	held := make(map[string][]store.Embedding)
+	for _, c := range pending {
+		remaining[c.emb.Hash]++
+	}
+	for batch := range done {
+		var rows []store.Embedding
+		for _, c := range batch {
+			hash := c.emb.Hash
+			if c.emb.Vector == nil {
+				if ctx.Err() == nil {
+					failed++
 				}
-				embedded++
+				remaining[hash] = -1 // never complete
+				delete(held, hash)
+				continue
+			}
+			if remaining[hash] < 0 {
+				continue
 			}
-			fmt.Fprintf(os.Stderr, "\rEmbedded %d/%d documents (%d chunks)...", i+1, len(hashes), embedded)
+			g.model.Normalize(c.emb.Vector)
+			held[hash] = append(held[hash], c.emb)
+			if remaining[hash]--; remaining[hash] == 0 {
+				rows = append(rows, held[hash]...)
+				delete(held, hash)
+			}
+		}
+		if err := s.InsertEmbeddings(rows, g.model.Model, now); err != nil {
+			fmt.Fprintf(os.Stderr, "Error inserting embeddings: %v\n", err)
+			failed += len(rows)
+		} else {
+			embedded += len(rows)
 		}
+		fmt.Fprintf(os.Stderr, "\rEmbedded %d/%d chunks...", embedded, len(pending))
+	}
+	fmt.Fprintln(os.Stderr)
+	return embedded, failed, len(pending)
+}
+
+// prepareOllamaModel pulls the embedding model on first use and prints its size and
+// context length, so a missing model or a stopped daemon fails before any work starts.
+func prepareOllamaModel(ctx context.Context, c *llm.OllamaClient, out io.Writer) error {
+	pulled, err := c.EnsureModel(ctx, func(status string, completed, total int64) {
+		if total > 0 {
+			fmt.Fprintf(os.Stderr, "\rPulling %s: %s %d%%   ", c.Model, status, completed*100/total)
+		} else {
+			fmt.Fprintf(os.Stderr, "\rPulling %s: %s   ", c.Model, status)
+		}
+	})
+	if pulled {
 		fmt.Fprintln(os.Stderr)
-		elapsed := time.Since(now).Seconds()
-		fmt.Printf("Done. Embedded %d chunks from %d documents in %.1fs", embedded, len(hashes), elapsed)
-		if errors > 0 {
-			fmt.Printf(" (%d errors)", errors)
+	}
+	if err != nil {
+		return fmt.Errorf("ollama model %s: %w", c.Model, err)
+	}
+	info, err := c.ShowModel(ctx)
+	if err != nil {
+		return fmt.Errorf("ollama model %s: %w", c.Model, err)
+	}
+	if info.EmbeddingLength > 0 {
+		fmt.Fprintf(out, "Model %s: %d dimensions, context length %d\n", c.Model, info.EmbeddingLength, info.ContextLength)
+	}
+	return nil
+}
+
+// embedChunk is one chunk queued for embedding; emb.Vector is set once embedded.
+type embedChunk struct {
+	path string
+	text string
+	emb  store.Embedding
+}
+
+// embedBatch embeds a batch with one BatchEmbed call. If that fails (say one chunk is
+// over the model's context), the chunks are retried one by one so a single bad chunk
+// only costs itself; failures are reported on stderr and leave Vector nil. Once ctx is
+// cancelled the batch is returned without vectors.
+func embedBatch(ctx context.Context, client llm.LLM, batch []embedChunk) []embedChunk {
+	texts := make([]string, len(batch))
+	for i, c := range batch {
+		texts[i] = c.text
+	}
+	results, err := client.BatchEmbed(ctx, texts)
+	if ctx.Err() != nil {
+		return batch
+	}
+	if err == nil {
+		for i, r := range results {
+			batch[i].emb.Vector = r.Embedding
 		}
-		fmt.Println()
-	},
+		return batch
+	}
+	if len(batch) > 1 {
+		fmt.Fprintf(os.Stderr, "Warning: batch embedding failed, retrying chunks one by one: %v\n", err)
+	}
+	for i, c := range batch {
+		result, err := client.Embed(ctx, c.text)
+		if ctx.Err() != nil {
+			return batch
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error embedding %s chunk %d: %v\n", c.path, c.emb.Seq, err)
+			continue
+		}
+		batch[i].emb.Vector = result.Embedding
+	}
+	return batch
 }
 
 func init() {
-	embedCmd.Flags().BoolP("force", "f", false, "Force re-embedding (clear all vectors first)")
+	embedCmd.Flags().BoolP("force", "f", false, "Force re-embedding (clear the vectors of the models being embedded first)")
+	embedCmd.Flags().String("model", "", "Embed with this model (a models: entry or model spec) instead of the index's")
+	embedCmd.Flags().Bool("migrate", false, "With --model: switch the index's embed_model to it once all documents are embedded")
+	embedCmd.Flags().String("storage", "", "Vector storage: float32, int8 or binary (changing it requires --force)")
+	embedCmd.Flags().Bool("keep-full", false, "With int8 or binary storage: also keep full-precision vectors to rescore results (larger index)")
+	embedCmd.Flags().Int("batch-size", defaultEmbedBatchSize, "Chunks per embedding request")
+	embedCmd.Flags().Int("concurrency", defaultEmbedConcurrency, "Parallel embedding requests (API backend; local models use 1)")
 	rootCmd.AddCommand(embedCmd)
 }
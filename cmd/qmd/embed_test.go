@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ba0f3/qmd-go/internal/config"
+	"github.com/ba0f3/qmd-go/internal/indexer"
+	"github.com/ba0f3/qmd-go/internal/llm"
+	"github.com/ba0f3/qmd-go/internal/store"
+)
+
+func TestEmbedGroupDocsTitles(t *testing.T) {
+	var mu sync.Mutex
+	var inputs []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		inputs = append(inputs, req.Input...)
+		mu.Unlock()
+		type datum struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		}
+		var out struct {
+			Data []datum `json:"data"`
+		}
+		for i := range req.Input {
+			out.Data = append(out.Data, datum{i, []float32{1, 0}})
+		}
+		json.NewEncoder(w).Encode(out)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	s, err := store.NewStore(filepath.Join(dir, "index.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	notes := filepath.Join(dir, "notes")
+	os.Mkdir(notes, 0755)
+	os.WriteFile(filepath.Join(notes, "meeting.md"), []byte("---\ntitle: Weekly sync\n---\nNotes from the sync.\n"), 0644)
+	os.WriteFile(filepath.Join(notes, "plain.md"), []byte("Just text.\n"), 0644)
+	if err := indexer.IndexFiles(s, "notes", notes, "**/*.md", indexer.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	hashes, err := s.GetHashesForEmbedding("m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &embedGroup{
+		model: llm.EmbedModel{ModelConfig: config.ModelConfig{
+			Kind: "openai", BaseURL: srv.URL, Model: "m", DocumentTemplate: "title: {title} | {text}",
+		}},
+		hashes: hashes,
+	}
+	if n, errs, _ := embedGroupDocs(context.Background(), s, g, 8, 1, time.Now(), io.Discard); n != 2 || errs != 0 {
+		t.Fatalf("embedGroupDocs embedded %d chunks with %d errors", n, errs)
+	}
+
+	// The front matter title is used, not its opening "---"; without a title, the file name.
+	want := map[string]bool{"title: Weekly sync | ": false, "title: plain.md | ": false}
+	for _, in := range inputs {
+		for prefix := range want {
+			if strings.HasPrefix(in, prefix) {
+				want[prefix] = true
+			}
+		}
+	}
+	for prefix, found := range want {
+		if !found {
+			t.Errorf("No input starts with %q; got %q", prefix, inputs)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/ba0f3/qmd-go/internal/llm"
+	"github.com/ba0f3/qmd-go/internal/store"
+)
+
+// rerankCandidates is how many RRF results are passed to the reranker.
+const rerankCandidates = 30
+
+// hybridOptions configures hybridSearch.
+type hybridOptions struct {
+	Collection string
+	Where      store.Where
+	Limit      int
+	Aggregate  store.ChunkAggregation
+	Expand     bool
+	Rerank     bool
+}
+
+// hybridSearch runs the query pipeline shared by `qmd query` and the MCP query tool:
+// optional query expansion, BM25 and vector search for the query and each expansion,
+// weighted RRF (the original query counts double), then reranking of the top
+// candidates when a reranker is available. Vector search, expansion and reranking are
+// skipped (with a warning on stderr for model failures) rather than failing the search;
+// cancelling ctx stops any model request in flight and fails it.
+func hybridSearch(ctx context.Context, s *store.Store, query string, opts hybridOptions) ([]hybridResult, error) {
+	fetchLimit := opts.Limit * 4
+	if fetchLimit < 20 {
+		fetchLimit = 20
+	}
+
+	var expansion llm.Expansion
+	if opts.Expand {
+		var err error
+		expansion, err = expandQuery(ctx, s, query)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil && !errors.Is(err, errNoExpander) {
+			fmt.Fprintf(os.Stderr, "Warning: query expansion skipped: %v\n", err)
+		}
+	}
+
+	ftsResults, err := s.SearchFTS(query, fetchLimit, opts.Collection, opts.Where)
+	if err != nil {
+		return nil, err
+	}
+	ftsLists := []rankedList{ftsList(ftsResults, 2)}
+	for _, lex := range expansion.Lex {
+		// Expansions are model output, so a line the query parser rejects is skipped.
+		if results, err := s.SearchFTS(lex, fetchLimit, opts.Collection, opts.Where); err == nil {
+			ftsLists = append(ftsLists, ftsList(results, 1))
+		}
+	}
+
+	var vecLists []rankedList
+	if s.HasEmbeddings() {
+		// Each model's vectors are only comparable with a query embedded by that model,
+		// so the query is embedded once per model and each model's index searched.
+		targets, _ := loadEmbedTargets(s, opts.Collection)
+		vopts := vectorSearchOptions{Where: opts.Where, Limit: fetchLimit, Aggregate: opts.Aggregate}
+		search := func(text string, weight float64) {
+			for _, t := range targets {
+				if results, err := t.search(ctx, s, text, vopts); err == nil {
+					vecLists = append(vecLists, vecList(results, weight))
+				}
+			}
+		}
+		search(query, 2)
+		for _, text := range append(expansion.Vec, expansion.Hyde...) {
+			search(text, 1)
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+
+	candidates := opts.Limit
+	if opts.Rerank {
+		candidates = max(opts.Limit, rerankCandidates)
+	}
+	merged := reciprocalRankFusion(append(ftsLists, vecLists...), candidates)
+	if opts.Rerank && len(merged) > 1 {
+		err := rerankHybrid(ctx, query, merged)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil && !errors.Is(err, llm.ErrNoReranker) {
+			fmt.Fprintf(os.Stderr, "Warning: reranking skipped: %v\n", err)
+		}
+	}
+	if len(merged) > opts.Limit {
+		merged = merged[:opts.Limit]
+	}
+	return merged, nil
+}
+
+// expandMaxTokens bounds an expansion; the expected seven short lines take ~150 tokens.
+const expandMaxTokens = 300
+
+// errNoExpander means query expansion is not configured (API build without
+// QMD_EXPAND_MODEL).
+var errNoExpander = errors.New("no query expansion model configured")
+
+// expandQuery asks the expansion model (QMD_EXPAND_MODEL, or the default) for lex/vec/
+// hyde lines. Raw model output is cached in llm_cache by model and prompt, so repeated
+// queries skip generation. QMD_EXPAND_PROMPT names a system prompt file (such as
+// finetune/gepa/best_prompt.txt) for models that were not fine-tuned.
+func expandQuery(ctx context.Context, s *store.Store, query string) (llm.Expansion, error) {
+	model := os.Getenv("QMD_EXPAND_MODEL")
+	if model == "" {
+		model = llm.DefaultExpandModel()
+	}
+	if model == "" {
+		return llm.Expansion{}, errNoExpander
+	}
+	var system string
+	if path := os.Getenv("QMD_EXPAND_PROMPT"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return llm.Expansion{}, err
+		}
+		system = string(data)
+	}
+	prompt := llm.ExpansionPrompt(query, system)
+	key := store.LLMCacheKey("expand", model, prompt)
+	if out, ok, err := s.GetLLMCache(key); err != nil {
+		return llm.Expansion{}, err
+	} else if ok {
+		return llm.ParseExpansion(out), nil
+	}
+
+	client, err := getGenerateClient(model)
+	if err != nil {
+		return llm.Expansion{}, err
+	}
+	out, err := client.GenerateWithOptions(ctx, prompt, llm.GenerateOptions{MaxTokens: expandMaxTokens})
+	if err != nil {
+		return llm.Expansion{}, err
+	}
+	expansion := llm.ParseExpansion(out)
+	if expansion.Empty() {
+		return expansion, fmt.Errorf("model %s returned no lex/vec/hyde lines", model)
+	}
+	if err := s.PutLLMCache(key, out); err != nil {
+		return expansion, err
+	}
+	return expansion, nil
+}
+
+var (
+	generateClientsMu sync.Mutex
+	generateClients   = map[string]llm.LLM{}
+)
+
+// getGenerateClient loads a generation model once per process.
+func getGenerateClient(model string) (llm.LLM, error) {
+	generateClientsMu.Lock()
+	defer generateClientsMu.Unlock()
+	if c := generateClients[model]; c != nil {
+		return c, nil
+	}
+	c, err := llm.NewGenerateClient(model)
+	if err != nil {
+		return nil, err
+	}
+	generateClients[model] = c
+	return c, nil
+}
+
+var (
+	rerankerOnce sync.Once
+	reranker     llm.Reranker
+	rerankerErr  error
+)
+
+// getReranker loads the reranker once per process (QMD_RERANK_MODEL, or the default).
+func getReranker() (llm.Reranker, error) {
+	rerankerOnce.Do(func() {
+		model := os.Getenv("QMD_RERANK_MODEL")
+		if model == "" {
+			model = llm.DefaultRerankModel()
+		}
+		reranker, rerankerErr = llm.NewReranker(model)
+	})
+	return reranker, rerankerErr
+}
+
+// rerankHybrid rescores results in place with the reranker and re-sorts them. The
+// reranker sees each document's title and best chunk. Its score is blended with the
+// RRF rank, trusting retrieval more at the top of the list (as in qmd): positions 1-3
+// keep 75% RRF weight, 4-10 keep 60% and the rest 40%.
+func rerankHybrid(ctx context.Context, query string, results []hybridResult) error {
+	rr, err := getReranker()
+	if err != nil {
+		return err
+	}
+	docs := make([]string, len(results))
+	for i, r := range results {
+		text := r.Snippet
+		if text == "" {
+			text = headBytes(r.Body, store.ChunkSizeChars)
+		}
+		docs[i] = r.Title + "\n\n" + text
+	}
+	scores, err := rr.Rerank(ctx, query, docs)
+	if err != nil {
+		return err
+	}
+	for i := range results {
+		w := 0.4
+		switch {
+		case i < 3:
+			w = 0.75
+		case i < 10:
+			w = 0.6
+		}
+		results[i].Score = w/float64(i+1) + (1-w)*scores[i]
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	return nil
+}
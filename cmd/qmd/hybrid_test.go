@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ba0f3/qmd-go/internal/indexer"
+	"github.com/ba0f3/qmd-go/internal/store"
+)
+
+func TestHybridSearchCollection(t *testing.T) {
+	// Every query embeds to the same vector; the stored vectors decide the ranking.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":[{"index":0,"embedding":[1,0]}]}`))
+	}))
+	defer srv.Close()
+	t.Setenv("QMD_EMBED_BACKEND", "api")
+	t.Setenv("OLLAMA_HOST", srv.URL+"/v1")
+	t.Setenv("QMD_EMBED_MODEL", "test-embed")
+
+	s := setupDaemonIndex(t)
+	other := filepath.Join(t.TempDir(), "other")
+	os.Mkdir(other, 0755)
+	os.WriteFile(filepath.Join(other, "orchard.md"), []byte("# Orchard\n\nRows of trees.\n"), 0644)
+	if err := indexer.IndexFiles(s, "other", other, "**/*.md", indexer.Options{}); err != nil {
+		t.Fatalf("IndexFiles failed: %v", err)
+	}
+	// The other collection's document is the closest to the query.
+	for path, vec := range map[string][]float32{
+		"other/orchard.md": {1, 0},
+		"notes/apple.md":   {0.6, 0.8},
+		"notes/banana.md":  {0, 1},
+	} {
+		col, rel := filepath.Split(path)
+		doc, err := s.FindActiveDocument(filepath.Clean(col), rel)
+		if err != nil {
+			t.Fatalf("%s not indexed: %v", path, err)
+		}
+		if err := s.InsertEmbedding(doc.Hash, 0, 0, vec, "test-embed", time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Nothing matches "fruit" by keyword, so every result is a vector hit.
+	results, err := hybridSearch(context.Background(), s, "fruit",
+		hybridOptions{Collection: "notes", Limit: 5, Aggregate: store.AggregateMax})
+	if err != nil {
+		t.Fatalf("hybridSearch failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("Expected both notes documents, got %+v", results)
+	}
+	for _, r := range results {
+		if col, _ := parseVirtualPath(r.Filepath); col != "notes" {
+			t.Errorf("Result %s is outside the notes collection", r.Filepath)
+		}
+	}
+}
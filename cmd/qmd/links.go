@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ba0f3/qmd-go/internal/links"
+	"github.com/ba0f3/qmd-go/internal/store"
+	"github.com/spf13/cobra"
+)
+
+var linksCmd = &cobra.Command{
+	Use:   "links [file]",
+	Short: "List the links in a document, or the broken links of the index",
+	Long: `Lists the [[wikilinks]], ![[embeds]] and relative markdown links in a document (by
+path or docid) and the document each resolves to. With --unresolved, lists the links
+that resolve to no document instead, in every collection or in the one given with -c;
+links to attachments such as images, which are not indexed, are not counted.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		unresolved, _ := cmd.Flags().GetBool("unresolved")
+		collection, _ := cmd.Flags().GetString("collection")
+		useJSON, _ := cmd.Flags().GetBool("json")
+		if unresolved == (len(args) == 1) {
+			fmt.Fprintln(os.Stderr, "Usage: qmd links <file> or qmd links --unresolved [-c collection]")
+			os.Exit(1)
+		}
+
+		initRoot()
+		s, err := openStore()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening store: %v\n", err)
+			os.Exit(1)
+		}
+		defer s.Close()
+
+		if unresolved {
+			ls, err := s.UnresolvedLinks(collection)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			if useJSON {
+				printJSON(linkRows(ls))
+				return
+			}
+			if len(ls) == 0 {
+				fmt.Println("No unresolved links.")
+				return
+			}
+			fmt.Print(formatLinkLines(ls, true))
+			return
+		}
+
+		collection, path := findDocument(s, args[0])
+		ls, err := s.LinksFrom(collection, path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if useJSON {
+			printJSON(linkRows(ls))
+			return
+		}
+		if len(ls) == 0 {
+			fmt.Printf("No links in %s\n", virtualPath(collection, path))
+			return
+		}
+		fmt.Print(formatLinkLines(ls, false))
+	},
+}
+
+var backlinksCmd = &cobra.Command{
+	Use:   "backlinks <file>",
+	Short: "List the documents that link to a document",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		useJSON, _ := cmd.Flags().GetBool("json")
+		initRoot()
+		s, err := openStore()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening store: %v\n", err)
+			os.Exit(1)
+		}
+		defer s.Close()
+
+		collection, path := findDocument(s, args[0])
+		ls, err := s.Backlinks(collection, path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if useJSON {
+			printJSON(linkRows(ls))
+			return
+		}
+		if len(ls) == 0 {
+			fmt.Printf("No links to %s\n", virtualPath(collection, path))
+			return
+		}
+		fmt.Print(formatLinkLines(ls, true))
+	},
+}
+
+var orphansCmd = &cobra.Command{
+	Use:   "orphans",
+	Short: "List the documents no other document links to",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		collection, _ := cmd.Flags().GetString("collection")
+		useJSON, _ := cmd.Flags().GetBool("json")
+		initRoot()
+		s, err := openStore()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening store: %v\n", err)
+			os.Exit(1)
+		}
+		defer s.Close()
+
+		docs, err := s.Orphans(collection)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if useJSON {
+			files := make([]string, len(docs))
+			for i, d := range docs {
+				files[i] = d.Filepath
+			}
+			printJSON(files)
+			return
+		}
+		if len(docs) == 0 {
+			fmt.Println("No orphaned documents.")
+			return
+		}
+		for _, d := range docs {
+			fmt.Println(d.Filepath)
+		}
+	},
+}
+
+func init() {
+	linksCmd.Flags().Bool("unresolved", false, "List links that resolve to no document")
+	linksCmd.Flags().StringP("collection", "c", "", "With --unresolved: restrict to collection")
+	linksCmd.Flags().Bool("json", false, "JSON output")
+	backlinksCmd.Flags().Bool("json", false, "JSON output")
+	orphansCmd.Flags().StringP("collection", "c", "", "Restrict to collection")
+	orphansCmd.Flags().Bool("json", false, "JSON output")
+	rootCmd.AddCommand(linksCmd, backlinksCmd, orphansCmd)
+}
+
+// findDocument resolves a path or docid argument to an active document, exiting if
+// there is none.
+func findDocument(s *store.Store, input string) (collection, path string) {
+	collection, path, ok := mcpFindDocument(s, input)
+	if ok {
+		return collection, path
+	}
+	fmt.Fprintf(os.Stderr, "Document not found: %s\n", input)
+	os.Exit(1)
+	return "", ""
+}
+
+// linkRow is a link as --json and the MCP link tools report it.
+type linkRow struct {
+	Source   string  `json:"source"`
+	Line     int     `json:"line"`
+	Kind     string  `json:"kind"`
+	Target   string  `json:"target"`
+	Fragment string  `json:"fragment,omitempty"`
+	Label    string  `json:"label,omitempty"`
+	Resolved *string `json:"resolved"` // null if unresolved
+}
+
+func linkRows(ls []store.DocLink) []linkRow {
+	rows := make([]linkRow, len(ls))
+	for i, l := range ls {
+		rows[i] = linkRow{
+			Source: virtualPath(l.Collection, l.Source), Line: l.Line,
+			Kind: l.Kind, Target: l.Target, Fragment: l.Fragment, Label: l.Label,
+		}
+		if l.Resolved != "" {
+			p := virtualPath(l.Collection, l.Resolved)
+			rows[i].Resolved = &p
+		}
+	}
+	return rows
+}
+
+// formatLink writes a link back the way it appears in the note.
+func formatLink(l links.Link) string {
+	target := l.Target
+	if l.Fragment != "" {
+		target += "#" + l.Fragment
+	}
+	switch l.Kind {
+	case links.Markdown:
+		return "[" + l.Label + "](" + target + ")"
+	case links.Embed:
+		return "![[" + target + "]]"
+	}
+	if l.Label != "" {
+		target += "|" + l.Label
+	}
+	return "[[" + target + "]]"
+}
+
+func virtualPath(collection, path string) string {
+	return "qmd://" + collection + "/" + path
+}
+
+// formatLinkLines lists links one per line. withSource prefixes each with the document
+// it is in; without it, links are from one document and show where they point instead.
+func formatLinkLines(ls []store.DocLink, withSource bool) string {
+	var b strings.Builder
+	for _, l := range ls {
+		if withSource {
+			fmt.Fprintf(&b, "%s:%d  ", virtualPath(l.Collection, l.Source), l.Line)
+		} else {
+			fmt.Fprintf(&b, "%d  ", l.Line)
+		}
+		b.WriteString(formatLink(l.Link))
+		if !withSource {
+			if l.Resolved != "" {
+				b.WriteString("  -> " + virtualPath(l.Collection, l.Resolved))
+			} else {
+				b.WriteString("  (unresolved)")
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func printJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/ba0f3/qmd-go/internal/config"
@@ -12,8 +14,18 @@ import (
 var lsCmd = &cobra.Command{
 	Use:   "ls [collection[/path]]",
 	Short: "List collections or files in a collection",
+	Long: `Without an argument, lists the collections and how many files each has. With a
+collection (and optionally a path prefix), lists its files. --where keeps only files
+whose front matter matches, e.g. --where tags=go --where status!=draft; --json adds each
+file's title, modification time and front matter.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		initRoot()
+		useJSON, _ := cmd.Flags().GetBool("json")
+		where := getWhereFlag(cmd)
+		cond, condArgs := where.SQL()
+		if cond != "" {
+			cond = " AND " + cond
+		}
 		s, err := openStore()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error opening store: %v\n", err)
@@ -32,13 +44,31 @@ var lsCmd = &cobra.Command{
 				fmt.Println("No collections. Run 'qmd collection add .' to index files.")
 				return
 			}
-			fmt.Println("Collections:")
-			fmt.Println()
+			names := make([]string, 0, len(cfg.Collections))
 			for name := range cfg.Collections {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			var out []map[string]interface{}
+			if !useJSON {
+				fmt.Println("Collections:")
+				fmt.Println()
+			}
+			for _, name := range names {
 				var cnt int
-				_ = s.DB.QueryRow(`SELECT COUNT(*) FROM documents WHERE collection = ? AND active = 1`, name).Scan(&cnt)
+				_ = s.DB.QueryRow(`SELECT COUNT(*) FROM documents d WHERE d.collection = ? AND d.active = 1`+cond,
+					append([]interface{}{name}, condArgs...)...).Scan(&cnt)
+				if useJSON {
+					out = append(out, map[string]interface{}{"collection": name, "uri": "qmd://" + name + "/", "files": cnt})
+					continue
+				}
 				fmt.Printf("  qmd://%s/  (%d files)\n", name, cnt)
 			}
+			if useJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				_ = enc.Encode(out)
+			}
 			return
 		}
 
@@ -66,7 +96,7 @@ var lsCmd = &cobra.Command{
 			return
 		}
 
-		sql := `SELECT d.path, d.title, d.modified_at, LENGTH(content.doc) as size
+		sql := `SELECT d.path, d.title, d.modified_at, LENGTH(content.doc) as size, d.hash
 			FROM documents d
 			JOIN content ON content.hash = d.hash
 			WHERE d.collection = ? AND d.active = 1`
@@ -75,6 +105,8 @@ var lsCmd = &cobra.Command{
 			sql += ` AND d.path LIKE ?`
 			argsQ = append(argsQ, pathPrefix+"%")
 		}
+		sql += cond
+		argsQ = append(argsQ, condArgs...)
 		sql += ` ORDER BY d.path`
 
 		rows, err := s.DB.Query(sql, argsQ...)
@@ -84,17 +116,46 @@ var lsCmd = &cobra.Command{
 		}
 		defer rows.Close()
 
-		var path, title, modified string
+		var path, title, modified, hash string
 		var size int64
 		count := 0
+		var entries []map[string]interface{}
+		var hashes []string
 		for rows.Next() {
-			if err := rows.Scan(&path, &title, &modified, &size); err != nil {
+			if err := rows.Scan(&path, &title, &modified, &size, &hash); err != nil {
 				continue
 			}
 			count++
+			if useJSON {
+				entries = append(entries, map[string]interface{}{
+					"docid": "#" + docid(hash), "file": "qmd://" + collectionName + "/" + path,
+					"title": title, "modified": modified, "size": size,
+				})
+				hashes = append(hashes, hash)
+				continue
+			}
 			sizeStr := formatBytes(size)
 			fmt.Printf("%10s  qmd://%s/%s\n", sizeStr, collectionName, path)
 		}
+		if useJSON {
+			meta, err := s.DocumentMetadata(hashes)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return
+			}
+			for i, e := range entries {
+				if m := meta[hashes[i]]; len(m) > 0 {
+					e["metadata"] = m.Map()
+				}
+			}
+			if entries == nil {
+				entries = []map[string]interface{}{}
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			_ = enc.Encode(entries)
+			return
+		}
 		if count == 0 {
 			if pathPrefix != "" {
 				fmt.Printf("No files under qmd://%s/%s\n", collectionName, pathPrefix)
@@ -106,5 +167,7 @@ var lsCmd = &cobra.Command{
 }
 
 func init() {
+	lsCmd.Flags().StringArray("where", nil, "Only files whose front matter matches key=value (also !=, <, >, or a bare key); repeatable")
+	lsCmd.Flags().Bool("json", false, "JSON output")
 	rootCmd.AddCommand(lsCmd)
 }
@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ba0f3/qmd-go/internal/config"
 	"github.com/ba0f3/qmd-go/internal/llm"
@@ -29,6 +31,7 @@ Best for: Finding documents with specific keywords or phrases.
 - Fast, no LLM required
 - Good for exact matches
 - Use ` + "`collection`" + ` parameter to filter to a specific collection
+- Query syntax: ` + "`\"exact phrase\"`, `-exclude`, `a OR b`, `title:foo`, `path:journals/*`, `collection:notes`, `modified:>2025-01-01`" + `
 
 ### 2. vsearch (Semantic search)
 Best for: Finding conceptually related content even without exact keyword matches.
@@ -39,24 +42,37 @@ Best for: Finding conceptually related content even without exact keyword matche
 
 ### 3. query (Hybrid search - highest quality)
 Best for: Important searches where you want the best results.
-- Combines keyword + semantic search with RRF
+- Expands the query into keyword and semantic variants, combines keyword + semantic search with RRF, then reranks the top results
 - Run 'qmd embed' for vector part
+- Set ` + "`noExpand`" + ` or ` + "`noRerank`" + ` for faster results
 - Use ` + "`collection`" + ` parameter to filter to a specific collection
 
-### 4. get (Retrieve document)
+### 4. ask (Answer a question)
+Best for: Getting a direct answer with sources instead of a result list.
+- Runs the query pipeline and has a chat model answer from the top passages
+- Every claim cites ` + "`qmd://collection/path:line`" + `; citations outside the retrieved text are removed
+- Requires an answer model (QMD_ANSWER_MODEL)
+
+### 5. get (Retrieve document)
 Best for: Getting the full content of a single document you found.
 - Use the file path from search results
 - Supports line ranges: ` + "`file.md:100`" + ` or fromLine/maxLines parameters
 
-### 5. multi_get (Retrieve multiple documents)
+### 6. multi_get (Retrieve multiple documents)
 Best for: Getting content from multiple files at once.
 - Use glob patterns: ` + "`journals/2025-05*.md`" + `
 - Or comma-separated: ` + "`file1.md, file2.md`" + `
 - Skips files over maxBytes (default 10KB) - use get for large files
 
-### 6. status (Index info)
+### 7. status (Index info)
 Shows collection info and document counts.
 
+### 8. links, backlinks, orphans (Link graph)
+Best for: Following ` + "`[[WikiWord]]`" + ` and relative markdown links between notes.
+- links: the links in a document and where they resolve; ` + "`unresolved: true`" + ` lists broken links
+- backlinks: the documents that link to a document
+- orphans: the documents nothing links to
+
 ## Resources
 
 You can also access documents directly via the ` + "`qmd://`" + ` URI scheme:
@@ -69,6 +85,7 @@ You can also access documents directly via the ` + "`qmd://`" + ` URI scheme:
 3. **Use query** for important searches or when you need high confidence
 4. **Use get** to retrieve a single full document
 5. **Use multi_get** to batch retrieve multiple related files
+6. **Use links and backlinks** to follow a note to the notes it references and those that reference it
 
 ## Tips
 
@@ -81,11 +98,13 @@ You can also access documents directly via the ` + "`qmd://`" + ` URI scheme:
 var mcpCmd = &cobra.Command{
 	Use:   "mcp",
 	Short: "Run MCP server (stdio)",
-	Long:  "Start the Model Context Protocol server for QMD. Exposes search, get, and document resources over stdio.",
+	Long:  "Start the Model Context Protocol server for QMD. Exposes search, get, and document resources over stdio. With --watch, collections are re-indexed as files change.",
 	RunE:  runMCPServer,
 }
 
 func init() {
+	mcpCmd.Flags().Bool("watch", false, "Re-index collections as files change (see 'qmd watch')")
+	mcpCmd.Flags().Bool("embed", false, "With --watch: embed changed documents in the background")
 	rootCmd.AddCommand(mcpCmd)
 }
 
@@ -112,7 +131,7 @@ func runMCPServer(cmd *cobra.Command, args []string) error {
 
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "search",
-		Description: "Fast keyword-based full-text search using BM25. Best for finding documents with specific words or phrases.",
+		Description: "Fast keyword-based full-text search using BM25. Best for finding documents with specific words or phrases. Supports \"phrases\", -exclude, a OR b, title:, path:, collection: and modified:>YYYY-MM-DD.",
 	}, searchTool(s))
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "vsearch",
@@ -120,8 +139,12 @@ func runMCPServer(cmd *cobra.Command, args []string) error {
 	}, vsearchTool(s))
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "query",
-		Description: "Hybrid search combining BM25 and vector search with RRF. Best quality when embeddings exist.",
+		Description: "Hybrid search: LLM query expansion, BM25 and vector search fused with RRF, reranked by a cross-encoder when one is available. Best quality when embeddings exist.",
 	}, queryTool(s))
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "ask",
+		Description: "Answer a question from the indexed documents. Retrieves passages with the query pipeline and returns a model-written answer citing qmd://collection/path:line; citations outside the retrieved text are removed.",
+	}, askTool(s))
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "get",
 		Description: "Retrieve the full content of a document by its file path or docid (#abc123).",
@@ -134,8 +157,42 @@ func runMCPServer(cmd *cobra.Command, args []string) error {
 		Name:        "status",
 		Description: "Show the status of the QMD index: collections and document counts.",
 	}, statusTool(s))
-
-	return server.Run(context.Background(), &mcp.StdioTransport{})
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "links",
+		Description: "List the [[wikilinks]], ![[embeds]] and relative markdown links in a document and the documents they resolve to. With unresolved, list the links that resolve to no document instead.",
+	}, linksTool(s))
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "backlinks",
+		Description: "List the links from other documents to a document, by its file path or docid (#abc123).",
+	}, backlinksTool(s))
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "orphans",
+		Description: "List the documents no other document links to.",
+	}, orphansTool(s))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if watch, _ := cmd.Flags().GetBool("watch"); watch {
+		embed, _ := cmd.Flags().GetBool("embed")
+		done := make(chan struct{})
+		// Stop the watcher before the deferred s.Close.
+		defer func() { cancel(); <-done }()
+		go func() {
+			defer close(done)
+			// Stdout carries the protocol, so watch progress goes to stderr.
+			err := runWatch(ctx, s, watchOptions{
+				Debounce:    500 * time.Millisecond,
+				Embed:       embed,
+				BatchSize:   defaultEmbedBatchSize,
+				Concurrency: defaultEmbedConcurrency,
+				Log:         os.Stderr,
+			})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Watch: %v\n", err)
+			}
+		}()
+	}
+	defer cancel()
+	return server.Run(ctx, &mcp.StdioTransport{})
 }
 
 func resourceHandler(s *store.Store) mcp.ResourceHandler {
@@ -184,10 +241,11 @@ func resourceHandler(s *store.Store) mcp.ResourceHandler {
 }
 
 type searchArgs struct {
-	Query      string  `json:"query" jsonschema:"required,description=Search query - keywords or phrases to find"`
-	Limit      int     `json:"limit" jsonschema:"description=Maximum number of results (default 10)"`
-	MinScore   float64 `json:"minScore" jsonschema:"description=Minimum relevance score 0-1 (default 0)"`
-	Collection string  `json:"collection" jsonschema:"description=Filter to a specific collection by name"`
+	Query      string   `json:"query" jsonschema:"required,description=Search query - keywords or quoted phrases; supports -exclude, a OR b, title:, path:, collection:, modified:>YYYY-MM-DD"`
+	Limit      int      `json:"limit" jsonschema:"description=Maximum number of results (default 10)"`
+	MinScore   float64  `json:"minScore" jsonschema:"description=Minimum relevance score 0-1 (default 0)"`
+	Collection string   `json:"collection" jsonschema:"description=Filter to a specific collection by name"`
+	Where      []string `json:"where" jsonschema:"description=Front matter filters that must all hold: key=value or key!=value or key<value or key>value or a bare key (e.g. tags=go)"`
 }
 
 func searchTool(s *store.Store) func(context.Context, *mcp.CallToolRequest, searchArgs) (*mcp.CallToolResult, any, error) {
@@ -196,7 +254,11 @@ func searchTool(s *store.Store) func(context.Context, *mcp.CallToolRequest, sear
 		if limit <= 0 {
 			limit = 10
 		}
-		results, err := s.SearchFTS(args.Query, limit*2, args.Collection)
+		where, err := store.ParseWhere(args.Where)
+		if err != nil {
+			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}}, IsError: true}, nil, nil
+		}
+		results, err := s.SearchFTS(args.Query, limit*2, args.Collection, where)
 		if err != nil {
 			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "Search failed: " + err.Error()}}, IsError: true}, nil, nil
 		}
@@ -214,7 +276,14 @@ func searchTool(s *store.Store) func(context.Context, *mcp.CallToolRequest, sear
 		for i, r := range filtered {
 			structured[i] = map[string]any{
 				"docid": "#" + docid(r.Hash), "file": r.DisplayPath, "title": r.Title,
-				"score": roundScore(r.Score), "context": getContextForFile(s, r.Filepath), "snippet": snippet(r.Body, args.Query, 300),
+				"score": roundScore(r.Score), "context": getContextForFile(s, r.Filepath),
+				"snippet": chunkSnippet(r.Body, r.Snippet, r.StartLine, 300),
+			}
+			if r.StartLine > 0 {
+				structured[i]["startLine"], structured[i]["endLine"] = r.StartLine, r.EndLine
+			}
+			if len(r.Metadata) > 0 {
+				structured[i]["metadata"] = r.Metadata.Map()
 			}
 		}
 		return &mcp.CallToolResult{
@@ -225,40 +294,37 @@ func searchTool(s *store.Store) func(context.Context, *mcp.CallToolRequest, sear
 }
 
 type vsearchArgs struct {
-	Query      string  `json:"query" jsonschema:"required,description=Natural language query"`
-	Limit      int     `json:"limit" jsonschema:"description=Maximum number of results (default 10)"`
-	MinScore   float64 `json:"minScore" jsonschema:"description=Minimum relevance score 0-1 (default 0.3)"`
-	Collection string  `json:"collection" jsonschema:"description=Filter to a specific collection"`
+	Query      string   `json:"query" jsonschema:"required,description=Natural language query"`
+	Limit      int      `json:"limit" jsonschema:"description=Maximum number of results (default 10)"`
+	MinScore   float64  `json:"minScore" jsonschema:"description=Minimum relevance score 0-1 (default 0.3)"`
+	Collection string   `json:"collection" jsonschema:"description=Filter to a specific collection"`
+	Where      []string `json:"where" jsonschema:"description=Front matter filters that must all hold: key=value or key!=value or key<value or key>value or a bare key (e.g. tags=go)"`
+	Aggregate  string   `json:"aggregate" jsonschema:"description=Combine chunk scores per document: max (default), mean or sum"`
 }
 
 func vsearchTool(s *store.Store) func(context.Context, *mcp.CallToolRequest, vsearchArgs) (*mcp.CallToolResult, any, error) {
 	return func(ctx context.Context, req *mcp.CallToolRequest, args vsearchArgs) (*mcp.CallToolResult, any, error) {
-		var hasVec int
-		_ = s.DB.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='embedding_blobs'`).Scan(&hasVec)
-		if hasVec == 0 {
+		if !s.HasEmbeddings() {
 			return &mcp.CallToolResult{
 				Content: []mcp.Content{&mcp.TextContent{Text: "Vector index not found. Run 'qmd embed' first to create embeddings."}},
 				IsError: true,
 			}, nil, nil
 		}
-		model := os.Getenv("QMD_EMBED_MODEL")
-		if model == "" {
-			model = llm.DefaultEmbedModel()
+		limit := args.Limit
+		if limit <= 0 {
+			limit = 10
 		}
-		client, err := llm.NewEmbedClient(model)
+		agg, err := store.ParseChunkAggregation(args.Aggregate)
 		if err != nil {
-			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "Embed client: " + err.Error()}}, IsError: true}, nil, nil
+			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}}, IsError: true}, nil, nil
 		}
-		formatted := formatQueryForEmbedding(args.Query)
-		emb, err := client.Embed(formatted)
+		where, err := store.ParseWhere(args.Where)
 		if err != nil {
-			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "Embedding failed: " + err.Error()}}, IsError: true}, nil, nil
+			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}}, IsError: true}, nil, nil
 		}
-		limit := args.Limit
-		if limit <= 0 {
-			limit = 10
-		}
-		vecResults, err := s.SearchVectorsBrute(emb.Embedding, limit*2)
+		vecResults, err := vectorSearch(ctx, s, args.Query, vectorSearchOptions{
+			Collection: args.Collection, Where: where, Limit: limit * 2, Aggregate: agg,
+		})
 		if err != nil {
 			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "Vector search failed: " + err.Error()}}, IsError: true}, nil, nil
 		}
@@ -276,7 +342,14 @@ func vsearchTool(s *store.Store) func(context.Context, *mcp.CallToolRequest, vse
 		for i, r := range filtered {
 			structured[i] = map[string]any{
 				"docid": "#" + docid(r.Hash), "file": r.DisplayPath, "title": r.Title,
-				"score": roundScore(r.Score), "context": getContextForFile(s, r.Filepath), "snippet": snippet(r.Body, args.Query, 300),
+				"score": roundScore(r.Score), "context": getContextForFile(s, r.Filepath),
+				"snippet": chunkSnippet(r.Body, r.Snippet, r.StartLine, 300),
+			}
+			if r.StartLine > 0 {
+				structured[i]["startLine"], structured[i]["endLine"] = r.StartLine, r.EndLine
+			}
+			if len(r.Metadata) > 0 {
+				structured[i]["metadata"] = r.Metadata.Map()
 			}
 		}
 		return &mcp.CallToolResult{
@@ -287,10 +360,14 @@ func vsearchTool(s *store.Store) func(context.Context, *mcp.CallToolRequest, vse
 }
 
 type queryArgs struct {
-	Query      string  `json:"query" jsonschema:"required,description=Natural language query"`
-	Limit      int     `json:"limit" jsonschema:"description=Maximum number of results (default 10)"`
-	MinScore   float64 `json:"minScore" jsonschema:"description=Minimum relevance score 0-1"`
-	Collection string  `json:"collection" jsonschema:"description=Filter to a specific collection"`
+	Query      string   `json:"query" jsonschema:"required,description=Natural language query"`
+	Limit      int      `json:"limit" jsonschema:"description=Maximum number of results (default 10)"`
+	MinScore   float64  `json:"minScore" jsonschema:"description=Minimum relevance score 0-1"`
+	Collection string   `json:"collection" jsonschema:"description=Filter to a specific collection"`
+	Where      []string `json:"where" jsonschema:"description=Front matter filters that must all hold: key=value or key!=value or key<value or key>value or a bare key (e.g. tags=go)"`
+	Aggregate  string   `json:"aggregate" jsonschema:"description=Combine vector chunk scores per document: max (default), mean or sum"`
+	NoExpand   bool     `json:"noExpand" jsonschema:"description=Skip LLM query expansion and search the query as typed"`
+	NoRerank   bool     `json:"noRerank" jsonschema:"description=Skip reranking and order by RRF only (faster)"`
 }
 
 func queryTool(s *store.Store) func(context.Context, *mcp.CallToolRequest, queryArgs) (*mcp.CallToolResult, any, error) {
@@ -299,32 +376,20 @@ func queryTool(s *store.Store) func(context.Context, *mcp.CallToolRequest, query
 		if limit <= 0 {
 			limit = 10
 		}
-		fetchLimit := limit * 4
-		if fetchLimit < 20 {
-			fetchLimit = 20
+		agg, err := store.ParseChunkAggregation(args.Aggregate)
+		if err != nil {
+			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}}, IsError: true}, nil, nil
 		}
-		ftsResults, err := s.SearchFTS(args.Query, fetchLimit, args.Collection)
+		where, err := store.ParseWhere(args.Where)
 		if err != nil {
-			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "Search failed: " + err.Error()}}, IsError: true}, nil, nil
+			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}}, IsError: true}, nil, nil
 		}
-		var vecResults []store.VecSearchResult
-		var hasVec int
-		_ = s.DB.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='embedding_blobs'`).Scan(&hasVec)
-		if hasVec > 0 {
-			model := os.Getenv("QMD_EMBED_MODEL")
-			if model == "" {
-				model = llm.DefaultEmbedModel()
-			}
-			client, err := llm.NewEmbedClient(model)
-			if err == nil {
-				formatted := formatQueryForEmbedding(args.Query)
-				emb, err := client.Embed(formatted)
-				if err == nil {
-					vecResults, _ = s.SearchVectorsBrute(emb.Embedding, fetchLimit)
-				}
-			}
+		merged, err := hybridSearch(ctx, s, args.Query, hybridOptions{
+			Collection: args.Collection, Where: where, Limit: limit, Aggregate: agg, Expand: !args.NoExpand, Rerank: !args.NoRerank,
+		})
+		if err != nil {
+			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "Search failed: " + err.Error()}}, IsError: true}, nil, nil
 		}
-		merged := reciprocalRankFusion(ftsResults, vecResults, limit)
 		var filtered []hybridResult
 		for _, r := range merged {
 			if r.Score >= args.MinScore {
@@ -336,7 +401,14 @@ func queryTool(s *store.Store) func(context.Context, *mcp.CallToolRequest, query
 		for i, r := range filtered {
 			structured[i] = map[string]any{
 				"docid": "#" + docid(r.Hash), "file": r.DisplayPath, "title": r.Title,
-				"score": roundScore(r.Score), "context": getContextForFile(s, r.Filepath), "snippet": snippet(r.Body, args.Query, 300),
+				"score": roundScore(r.Score), "context": getContextForFile(s, r.Filepath),
+				"snippet": chunkSnippet(r.Body, r.Snippet, r.StartLine, 300),
+			}
+			if r.StartLine > 0 {
+				structured[i]["startLine"], structured[i]["endLine"] = r.StartLine, r.EndLine
+			}
+			if len(r.Metadata) > 0 {
+				structured[i]["metadata"] = r.Metadata.Map()
 			}
 		}
 		return &mcp.CallToolResult{
@@ -346,6 +418,35 @@ func queryTool(s *store.Store) func(context.Context, *mcp.CallToolRequest, query
 	}
 }
 
+type askArgs struct {
+	Question   string `json:"question" jsonschema:"required,description=Question to answer from the indexed documents"`
+	Limit      int    `json:"limit" jsonschema:"description=Number of passages to answer from (default 5)"`
+	Collection string `json:"collection" jsonschema:"description=Filter to a specific collection"`
+}
+
+func askTool(s *store.Store) func(context.Context, *mcp.CallToolRequest, askArgs) (*mcp.CallToolResult, any, error) {
+	return func(ctx context.Context, req *mcp.CallToolRequest, args askArgs) (*mcp.CallToolResult, any, error) {
+		limit := args.Limit
+		if limit <= 0 {
+			limit = 5
+		}
+		res, err := askQuestion(ctx, s, args.Question, hybridOptions{
+			Collection: args.Collection, Limit: limit, Aggregate: store.AggregateMax, Expand: true, Rerank: true,
+		}, nil)
+		if err != nil {
+			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "Ask failed: " + err.Error()}}, IsError: true}, nil, nil
+		}
+		structured := map[string]any{"answer": res.Answer, "citations": res.Citations, "passages": res.Passages}
+		if len(res.Rejected) > 0 {
+			structured["rejected"] = res.Rejected
+		}
+		return &mcp.CallToolResult{
+			Content:           []mcp.Content{&mcp.TextContent{Text: res.Answer}},
+			StructuredContent: structured,
+		}, nil, nil
+	}
+}
+
 type getArgs struct {
 	File        string `json:"file" jsonschema:"required,description=File path or docid (e.g. pages/meeting.md or #abc123)"`
 	FromLine    int    `json:"fromLine" jsonschema:"description=Start from this line number (1-indexed)"`
@@ -447,16 +548,20 @@ func statusTool(s *store.Store) func(context.Context, *mcp.CallToolRequest, stru
 		if err != nil {
 			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "Failed to get status: " + err.Error()}}, IsError: true}, nil, nil
 		}
+		// Embedding progress is reported for the index-wide model.
 		var needsEmbed int
-		_ = s.DB.QueryRow(`SELECT COUNT(DISTINCT d.hash) FROM documents d LEFT JOIN content_vectors v ON d.hash = v.hash AND v.seq = 0 WHERE d.active = 1 AND v.hash IS NULL`).Scan(&needsEmbed)
-		var n int
-		_ = s.DB.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='embedding_blobs'`).Scan(&n)
-		hasVec := n > 0
+		var hasVec bool
+		cfg, _ := config.LoadConfig()
+		if m, err := llm.ResolveEmbedModel(cfg, ""); err == nil {
+			needsEmbed, _ = s.GetHashesNeedingEmbeddingCount(m.Model)
+			hasVec = s.HasModelEmbeddings(m.Model)
+		}
 		lines := []string{
 			"QMD Index Status:",
 			"  Total documents: " + strconv.Itoa(st.DocCount),
 			"  Needs embedding: " + strconv.Itoa(needsEmbed),
 			"  Vector index: " + strconv.FormatBool(hasVec),
+			"  Vector storage: " + string(st.VectorStorage),
 			"  Collections: " + strconv.Itoa(len(st.Collections)),
 		}
 		for _, c := range st.Collections {
@@ -466,6 +571,7 @@ func statusTool(s *store.Store) func(context.Context, *mcp.CallToolRequest, stru
 			"totalDocuments": st.DocCount,
 			"needsEmbedding": needsEmbed,
 			"hasVectorIndex": hasVec,
+			"vectorStorage":  st.VectorStorage,
 			"collections":    st.Collections,
 		}
 		return &mcp.CallToolResult{
@@ -475,6 +581,104 @@ func statusTool(s *store.Store) func(context.Context, *mcp.CallToolRequest, stru
 	}
 }
 
+type linksArgs struct {
+	File       string `json:"file" jsonschema:"description=File path or docid of the document whose links to list"`
+	Unresolved bool   `json:"unresolved" jsonschema:"description=List links that resolve to no document instead of those of file"`
+	Collection string `json:"collection" jsonschema:"description=With unresolved: restrict to a collection"`
+}
+
+func linksTool(s *store.Store) func(context.Context, *mcp.CallToolRequest, linksArgs) (*mcp.CallToolResult, any, error) {
+	return func(ctx context.Context, req *mcp.CallToolRequest, args linksArgs) (*mcp.CallToolResult, any, error) {
+		var ls []store.DocLink
+		var err error
+		var empty string
+		switch {
+		case args.Unresolved:
+			ls, err = s.UnresolvedLinks(args.Collection)
+			empty = "No unresolved links."
+		case args.File != "":
+			collection, path, ok := mcpFindDocument(s, args.File)
+			if !ok {
+				return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "Document not found: " + args.File}}, IsError: true}, nil, nil
+			}
+			ls, err = s.LinksFrom(collection, path)
+			empty = "No links in " + virtualPath(collection, path)
+		default:
+			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "Give a file, or set unresolved"}}, IsError: true}, nil, nil
+		}
+		if err != nil {
+			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "Failed to list links: " + err.Error()}}, IsError: true}, nil, nil
+		}
+		return linksResult(ls, args.Unresolved, empty), nil, nil
+	}
+}
+
+type backlinksArgs struct {
+	File string `json:"file" jsonschema:"required,description=File path or docid (e.g. pages/meeting.md or #abc123)"`
+}
+
+func backlinksTool(s *store.Store) func(context.Context, *mcp.CallToolRequest, backlinksArgs) (*mcp.CallToolResult, any, error) {
+	return func(ctx context.Context, req *mcp.CallToolRequest, args backlinksArgs) (*mcp.CallToolResult, any, error) {
+		collection, path, ok := mcpFindDocument(s, args.File)
+		if !ok {
+			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "Document not found: " + args.File}}, IsError: true}, nil, nil
+		}
+		ls, err := s.Backlinks(collection, path)
+		if err != nil {
+			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "Failed to list backlinks: " + err.Error()}}, IsError: true}, nil, nil
+		}
+		return linksResult(ls, true, "No links to "+virtualPath(collection, path)), nil, nil
+	}
+}
+
+type orphansArgs struct {
+	Collection string `json:"collection" jsonschema:"description=Restrict to a collection"`
+}
+
+func orphansTool(s *store.Store) func(context.Context, *mcp.CallToolRequest, orphansArgs) (*mcp.CallToolResult, any, error) {
+	return func(ctx context.Context, req *mcp.CallToolRequest, args orphansArgs) (*mcp.CallToolResult, any, error) {
+		docs, err := s.Orphans(args.Collection)
+		if err != nil {
+			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "Failed to list orphans: " + err.Error()}}, IsError: true}, nil, nil
+		}
+		files := make([]string, len(docs))
+		for i, d := range docs {
+			files[i] = d.Filepath
+		}
+		text := "No orphaned documents."
+		if len(files) > 0 {
+			text = strings.Join(files, "\n")
+		}
+		return &mcp.CallToolResult{
+			Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+			StructuredContent: map[string]any{"files": files},
+		}, nil, nil
+	}
+}
+
+// mcpFindDocument resolves a path or docid to an active document.
+func mcpFindDocument(s *store.Store, input string) (collection, path string, ok bool) {
+	collection, path = resolveInputToDoc(s, input)
+	if path == "" {
+		return "", "", false
+	}
+	if _, err := s.FindActiveDocument(collection, path); err != nil {
+		return "", "", false
+	}
+	return collection, path, true
+}
+
+func linksResult(ls []store.DocLink, withSource bool, empty string) *mcp.CallToolResult {
+	text := empty
+	if len(ls) > 0 {
+		text = formatLinkLines(ls, withSource)
+	}
+	return &mcp.CallToolResult{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: map[string]any{"links": linkRows(ls)},
+	}
+}
+
 func getContextForFile(s *store.Store, filepath string) string {
 	col, path := parseVirtualPath(filepath)
 	if col == "" {
@@ -504,6 +708,10 @@ func formatSearchSummary(results []store.SearchResult, query string, s *store.St
 		b.WriteString(strconv.FormatFloat(r.Score*100, 'f', 0, 64))
 		b.WriteString("% ")
 		b.WriteString(r.DisplayPath)
+		if r.StartLine > 0 {
+			b.WriteString(":")
+			b.WriteString(strconv.Itoa(r.StartLine))
+		}
 		b.WriteString(" - ")
 		b.WriteString(r.Title)
 		b.WriteString("\n")
@@ -528,6 +736,10 @@ func formatVecSearchSummary(results []store.VecSearchResult, query string, s *st
 		b.WriteString(strconv.FormatFloat(r.Score*100, 'f', 0, 64))
 		b.WriteString("% ")
 		b.WriteString(r.DisplayPath)
+		if r.StartLine > 0 {
+			b.WriteString(":")
+			b.WriteString(strconv.Itoa(r.StartLine))
+		}
 		b.WriteString(" - ")
 		b.WriteString(r.Title)
 		b.WriteString("\n")
@@ -552,6 +764,10 @@ func formatHybridSummary(results []hybridResult, query string, s *store.Store) s
 		b.WriteString(strconv.FormatFloat(r.Score*100, 'f', 0, 64))
 		b.WriteString("% ")
 		b.WriteString(r.DisplayPath)
+		if r.StartLine > 0 {
+			b.WriteString(":")
+			b.WriteString(strconv.Itoa(r.StartLine))
+		}
 		b.WriteString(" - ")
 		b.WriteString(r.Title)
 		b.WriteString("\n")
@@ -559,21 +775,31 @@ func formatHybridSummary(results []hybridResult, query string, s *store.Store) s
 	return b.String()
 }
 
-func snippet(body, query string, maxLen int) string {
-	if body == "" {
+// chunkSnippet numbers the matching chunk from its own first line, falling back to the
+// start of body when there is no chunk.
+func chunkSnippet(body, chunk string, startLine, maxLen int) string {
+	if chunk == "" {
+		return snippet(body, 1, maxLen)
+	}
+	return snippet(chunk, startLine, maxLen)
+}
+
+// snippet returns up to maxLen bytes of whole lines from text, numbered from firstLine.
+func snippet(text string, firstLine, maxLen int) string {
+	if text == "" {
 		return ""
 	}
-	if len(body) <= maxLen {
-		return addLineNumbers(body, 1)
+	if len(text) <= maxLen {
+		return addLineNumbers(text, firstLine)
 	}
-	lines := strings.Split(body, "\n")
+	lines := strings.Split(text, "\n")
 	var out []string
 	n := 0
 	for i, line := range lines {
 		if n+len(line)+1 > maxLen {
 			break
 		}
-		out = append(out, strconv.Itoa(i+1)+": "+line)
+		out = append(out, strconv.Itoa(firstLine+i)+": "+line)
 		n += len(line) + 1
 	}
 	return strings.Join(out, "\n")
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ba0f3/qmd-go/internal/huggingface"
+	"github.com/spf13/cobra"
+)
+
+var modelsCmd = &cobra.Command{
+	Use:   "models",
+	Short: "Manage cached GGUF models from Hugging Face",
+	Long: `Manage the GGUF models in the model cache (QMD_MODEL_CACHE, default ~/.cache/qmd/models).
+
+Specs look like "org/repo:file.gguf"; pin a branch, tag or commit with
+"org/repo@revision:file.gguf". HF_TOKEN authenticates gated repos, HF_ENDPOINT
+selects a mirror and HF_HUB_OFFLINE=1 keeps qmd off the network.`,
+}
+
+var modelsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List cached model files",
+	Run: func(cmd *cobra.Command, args []string) {
+		dir, err := huggingface.ModelCacheDir()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		files, err := huggingface.ListCache()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", dir, err)
+			os.Exit(1)
+		}
+		if len(files) == 0 {
+			fmt.Printf("No models cached in %s\n", dir)
+			return
+		}
+		fmt.Printf("Models in %s:\n", dir)
+		var total int64
+		for _, f := range files {
+			note := ""
+			if f.Partial {
+				note = "  (partial; 'qmd models pull' resumes it)"
+			}
+			fmt.Printf("  %-70s %10s%s\n", f.Spec, formatBytes(f.Size), note)
+			total += f.Size
+		}
+		fmt.Printf("Total: %s\n", formatBytes(total))
+	},
+}
+
+var modelsPullCmd = &cobra.Command{
+	Use:   "pull <spec>...",
+	Short: "Download models, resuming interrupted downloads",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		revision, _ := cmd.Flags().GetString("revision")
+		specs := parseModelSpecs(args)
+		if revision != "" {
+			for i := range specs {
+				specs[i].Revision = revision
+			}
+		}
+		ctx, stop := interruptContext()
+		defer stop()
+		for _, s := range specs {
+			if p, err := s.LocalPath(); err == nil {
+				if _, err := os.Stat(p); err == nil {
+					fmt.Printf("%s is already cached at %s\n", s, p)
+					continue
+				}
+			}
+			drawn, bar := false, huggingface.ProgressBar(os.Stderr, s.File)
+			path, err := huggingface.Pull(ctx, s, func(done, total int64) { drawn = true; bar(done, total) })
+			if err != nil {
+				if drawn {
+					fmt.Fprintln(os.Stderr)
+				}
+				if ctx.Err() != nil {
+					fmt.Fprintf(os.Stderr, "Interrupted; run 'qmd models pull %s' again to resume.\n", s)
+				} else {
+					fmt.Fprintf(os.Stderr, "Error pulling %s: %v\n", s, err)
+				}
+				os.Exit(1)
+			}
+			fmt.Printf("Pulled %s to %s\n", s, path)
+		}
+	},
+}
+
+var modelsVerifyCmd = &cobra.Command{
+	Use:   "verify [spec...]",
+	Short: "Check cached models against the sha256 in the Hugging Face LFS metadata",
+	Long:  "Check cached models against the sha256 in the Hugging Face LFS metadata. Without arguments every cached model is checked.",
+	Run: func(cmd *cobra.Command, args []string) {
+		var specs []huggingface.Spec
+		if len(args) > 0 {
+			specs = parseModelSpecs(args)
+		} else {
+			files, err := huggingface.ListCache()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			for _, f := range files {
+				if !f.Partial {
+					specs = append(specs, f.Spec)
+				}
+			}
+			if len(specs) == 0 {
+				fmt.Println("No models cached.")
+				return
+			}
+		}
+		if huggingface.Offline() {
+			fmt.Fprintln(os.Stderr, "Error: verify compares against the Hub and cannot run in offline mode (HF_HUB_OFFLINE).")
+			os.Exit(1)
+		}
+
+		ctx, stop := interruptContext()
+		defer stop()
+		failed := false
+		for _, s := range specs {
+			path, err := s.LocalPath()
+			if err == nil {
+				_, err = os.Stat(path)
+			}
+			if err != nil {
+				fmt.Printf("MISSING   %s\n", s)
+				failed = true
+				continue
+			}
+			meta, err := huggingface.FetchMetadata(ctx, s)
+			if err != nil {
+				fmt.Printf("ERROR     %s: %v\n", s, err)
+				failed = true
+				continue
+			}
+			if meta.SHA256 == "" {
+				fmt.Printf("UNKNOWN   %s (not stored in LFS, no sha256 to compare)\n", s)
+				continue
+			}
+			sum, err := huggingface.FileSHA256(path)
+			if err != nil {
+				fmt.Printf("ERROR     %s: %v\n", s, err)
+				failed = true
+				continue
+			}
+			if sum != meta.SHA256 {
+				fmt.Printf("MISMATCH  %s (sha256 %s, expected %s)\n", s, sum, meta.SHA256)
+				failed = true
+				continue
+			}
+			fmt.Printf("OK        %s\n", s)
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+var modelsRmCmd = &cobra.Command{
+	Use:   "rm <spec>...",
+	Short: "Delete cached models, including partial downloads",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		failed := false
+		for _, s := range parseModelSpecs(args) {
+			freed, err := huggingface.RemoveCached(s)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				failed = true
+				continue
+			}
+			fmt.Printf("Removed %s (%s)\n", s, formatBytes(freed))
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// parseModelSpecs parses Hugging Face specs, exiting on the first one that is not.
+func parseModelSpecs(args []string) []huggingface.Spec {
+	specs := make([]huggingface.Spec, 0, len(args))
+	for _, a := range args {
+		s, ok := huggingface.ParseSpec(a)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Error: %q is not a Hugging Face model spec (want org/repo:file.gguf)\n", a)
+			os.Exit(1)
+		}
+		specs = append(specs, s)
+	}
+	return specs
+}
+
+func init() {
+	modelsPullCmd.Flags().String("revision", "", "Branch, tag or commit to download from (default "+huggingface.DefaultRevision+")")
+
+	modelsCmd.AddCommand(modelsListCmd)
+	modelsCmd.AddCommand(modelsPullCmd)
+	modelsCmd.AddCommand(modelsVerifyCmd)
+	modelsCmd.AddCommand(modelsRmCmd)
+	rootCmd.AddCommand(modelsCmd)
+}
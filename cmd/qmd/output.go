@@ -7,6 +7,9 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"unicode/utf8"
+
+	"github.com/ba0f3/qmd-go/internal/frontmatter"
 )
 
 // SearchOutputRow is one row for search output (all formats).
@@ -18,6 +21,10 @@ type SearchOutputRow struct {
 	Score    float64
 	Context  string
 	Full     bool
+	// StartLine/EndLine locate Body in the document when it is a matching chunk (0 otherwise).
+	StartLine int
+	EndLine   int
+	Metadata  frontmatter.Metadata // front matter, shown in JSON output
 }
 
 func docid(hash string) string {
@@ -27,6 +34,14 @@ func docid(hash string) string {
 	return hash
 }
 
+// lineRange formats a 1-based line span as "start-end", or "" when unknown.
+func lineRange(start, end int) string {
+	if start <= 0 {
+		return ""
+	}
+	return strconv.Itoa(start) + "-" + strconv.Itoa(end)
+}
+
 func escapeXML(s string) string {
 	s = strings.ReplaceAll(s, "&", "&amp;")
 	s = strings.ReplaceAll(s, "<", "&lt;")
@@ -49,7 +64,11 @@ func WriteSearchOutput(rows []SearchOutputRow, format string, full bool, lineNum
 			rows[i].Full = true
 		}
 		if lineNumbers {
-			rows[i].Body = addLineNumbers(rows[i].Body, 1)
+			start := 1
+			if !rows[i].Full && rows[i].StartLine > 0 {
+				start = rows[i].StartLine
+			}
+			rows[i].Body = addLineNumbers(rows[i].Body, start)
 		}
 	}
 	switch format {
@@ -65,6 +84,13 @@ func WriteSearchOutput(rows []SearchOutputRow, format string, full bool, lineNum
 			if r.Context != "" {
 				m["context"] = r.Context
 			}
+			if r.StartLine > 0 {
+				m["startLine"] = r.StartLine
+				m["endLine"] = r.EndLine
+			}
+			if len(r.Metadata) > 0 {
+				m["metadata"] = r.Metadata.Map()
+			}
 			if r.Full {
 				m["body"] = r.Body
 			} else if r.Body != "" {
@@ -106,6 +132,9 @@ func WriteSearchOutput(rows []SearchOutputRow, format string, full bool, lineNum
 			fmt.Println("---")
 			fmt.Printf("# %s\n\n", r.Title)
 			fmt.Printf("**docid:** `#%s`\n", r.Docid)
+			if lines := lineRange(r.StartLine, r.EndLine); lines != "" {
+				fmt.Printf("**lines:** %s\n", lines)
+			}
 			if r.Context != "" {
 				fmt.Printf("**context:** %s\n", r.Context)
 			}
@@ -122,6 +151,9 @@ func WriteSearchOutput(rows []SearchOutputRow, format string, full bool, lineNum
 			fmt.Printf("    <score>%.4f</score>\n", r.Score)
 			fmt.Printf("    <file>%s</file>\n", escapeXML(r.Filepath))
 			fmt.Printf("    <title>%s</title>\n", escapeXML(r.Title))
+			if lines := lineRange(r.StartLine, r.EndLine); lines != "" {
+				fmt.Printf("    <lines>%s</lines>\n", lines)
+			}
 			if r.Context != "" {
 				fmt.Printf("    <context>%s</context>\n", escapeXML(r.Context))
 			}
@@ -138,6 +170,9 @@ func WriteSearchOutput(rows []SearchOutputRow, format string, full bool, lineNum
 			if r.Context != "" {
 				fmt.Println("Context:", r.Context)
 			}
+			if lines := lineRange(r.StartLine, r.EndLine); lines != "" {
+				fmt.Println("Lines:", lines)
+			}
 			fmt.Printf("Score: %.0f%%\n\n", r.Score*100)
 			fmt.Println(r.Body)
 			fmt.Println()
@@ -149,6 +184,17 @@ func roundScore(s float64) float64 {
 	return float64(int(s*100+0.5)) / 100
 }
 
+// headBytes returns at most the first n bytes of s, cut back to a UTF-8 rune boundary.
+func headBytes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
 func truncateSnippet(s string, maxLen int) string {
 	s = strings.TrimSpace(s)
 	if len(s) <= maxLen {
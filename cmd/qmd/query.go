@@ -3,10 +3,11 @@ package main
 import (
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/ba0f3/qmd-go/internal/config"
-	"github.com/ba0f3/qmd-go/internal/llm"
+	"github.com/ba0f3/qmd-go/internal/frontmatter"
 	"github.com/ba0f3/qmd-go/internal/store"
 	"github.com/spf13/cobra"
 )
@@ -21,58 +22,82 @@ type hybridResult struct {
 	Body        string
 	Hash        string
 	Score       float64
+	Snippet     string // best-matching chunk from full-text search, if any
+	StartLine   int
+	EndLine     int
+	Metadata    frontmatter.Metadata
 }
 
-// reciprocalRankFusion merges FTS and vector results by filepath using RRF.
-func reciprocalRankFusion(fts []store.SearchResult, vec []store.VecSearchResult, limit int) []hybridResult {
-	scores := make(map[string]*hybridResult)
-	for rank, r := range fts {
-		rrf := 1.0 / (float64(rrfK) + float64(rank) + 1)
-		if scores[r.Filepath] == nil {
-			scores[r.Filepath] = &hybridResult{
-				Filepath: r.Filepath, DisplayPath: r.DisplayPath, Title: r.Title, Body: r.Body, Hash: r.Hash, Score: rrf,
-			}
-		} else {
-			scores[r.Filepath].Score += rrf
-		}
-	}
-	for rank, r := range vec {
-		rrf := 1.0 / (float64(rrfK) + float64(rank) + 1)
-		if scores[r.Filepath] == nil {
-			scores[r.Filepath] = &hybridResult{
-				Filepath: r.Filepath, DisplayPath: r.DisplayPath, Title: r.Title, Body: r.Body, Hash: r.Hash, Score: rrf,
-			}
-		} else {
-			scores[r.Filepath].Score += rrf
-		}
+// rankedList is one ranked result list fed to RRF, holding one entry per document.
+type rankedList struct {
+	results []hybridResult
+	weight  float64
+}
+
+func ftsList(results []store.SearchResult, weight float64) rankedList {
+	l := rankedList{weight: weight}
+	for _, r := range results {
+		l.results = append(l.results, hybridResult{
+			Filepath: r.Filepath, DisplayPath: r.DisplayPath, Title: r.Title, Body: r.Body, Hash: r.Hash,
+			Snippet: r.Snippet, StartLine: r.StartLine, EndLine: r.EndLine, Metadata: r.Metadata,
+		})
 	}
-	// Sort by score descending and take top limit
-	var list []*hybridResult
-	for _, v := range scores {
-		list = append(list, v)
+	return l
+}
+
+func vecList(results []store.VecSearchResult, weight float64) rankedList {
+	l := rankedList{weight: weight}
+	for _, r := range results {
+		l.results = append(l.results, hybridResult{
+			Filepath: r.Filepath, DisplayPath: r.DisplayPath, Title: r.Title, Body: r.Body, Hash: r.Hash,
+			Snippet: r.Snippet, StartLine: r.StartLine, EndLine: r.EndLine, Metadata: r.Metadata,
+		})
 	}
-	for i := 0; i < len(list); i++ {
-		for j := i + 1; j < len(list); j++ {
-			if list[j].Score > list[i].Score {
-				list[i], list[j] = list[j], list[i]
+	return l
+}
+
+// reciprocalRankFusion merges ranked lists by filepath using weighted RRF. A document
+// keeps the snippet of the first list that has one, so full-text lists should come
+// first to prefer their passages.
+func reciprocalRankFusion(lists []rankedList, limit int) []hybridResult {
+	scores := make(map[string]*hybridResult)
+	var order []*hybridResult
+	for _, l := range lists {
+		for rank, r := range l.results {
+			rrf := l.weight / (float64(rrfK) + float64(rank) + 1)
+			h := scores[r.Filepath]
+			if h == nil {
+				h = &hybridResult{}
+				*h = r
+				scores[r.Filepath] = h
+				order = append(order, h)
+			} else if h.Snippet == "" {
+				h.Snippet, h.StartLine, h.EndLine = r.Snippet, r.StartLine, r.EndLine
 			}
+			h.Score += rrf
 		}
 	}
-	if limit <= 0 || limit > len(list) {
-		limit = len(list)
+	sort.SliceStable(order, func(i, j int) bool { return order[i].Score > order[j].Score })
+	if limit <= 0 || limit > len(order) {
+		limit = len(order)
 	}
-	out := make([]hybridResult, 0, limit)
-	for i := 0; i < limit && i < len(list); i++ {
-		out = append(out, *list[i])
+	out := make([]hybridResult, limit)
+	for i := range out {
+		out[i] = *order[i]
 	}
 	return out
 }
 
 var queryCmd = &cobra.Command{
 	Use:   "query [query]",
-	Short: "Hybrid search (BM25 + vector)",
-	Long:  "Combines BM25 and vector search with RRF. Run 'qmd embed' for vector results. No reranker in Go build.",
-	Args:  cobra.MinimumNArgs(1),
+	Short: "Hybrid search (expansion + BM25 + vector + reranking)",
+	Long: `Expands the query with the fine-tuned expansion model (lex: lines go to BM25, vec: and
+hyde: lines to vector search), combines all result lists with RRF, then reranks the top 30
+with a cross-encoder. Run 'qmd embed' for vector results. Expansion runs locally in GGUF
+builds and needs QMD_EXPAND_MODEL otherwise; expansions are cached in the index. GGUF builds rerank locally (QMD_RERANK_MODEL, default
+Qwen3-Reranker-0.6B); other builds call a /rerank endpoint at QMD_RERANK_URL and skip
+reranking when it is unset.`,
+	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		initRoot()
 		query := strings.Join(args, " ")
@@ -81,51 +106,26 @@ var queryCmd = &cobra.Command{
 		minScore, _ := cmd.Flags().GetFloat64("min-score")
 		full, _ := cmd.Flags().GetBool("full")
 		lineNumbers, _ := cmd.Flags().GetBool("line-numbers")
+		aggName, _ := cmd.Flags().GetString("aggregate")
+		noRerank, _ := cmd.Flags().GetBool("no-rerank")
+		noExpand, _ := cmd.Flags().GetBool("no-expand")
 		format := getFormatFlag(cmd)
-
-		s, err := openStore()
+		where := getWhereFlag(cmd)
+		agg, err := store.ParseChunkAggregation(aggName)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error opening store: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
-		defer s.Close()
 
-		fetchLimit := limit * 4
-		if fetchLimit < 20 {
-			fetchLimit = 20
-		}
-
-		// 1) BM25
-		ftsResults, err := s.SearchFTS(query, fetchLimit, collection)
+		ctx, stop := interruptContext()
+		defer stop()
+		opts := hybridOptions{Collection: collection, Where: where, Limit: limit, Aggregate: agg, Expand: !noExpand, Rerank: !noRerank}
+		merged, err := runHybridSearch(ctx, query, opts)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Search failed: %v\n", err)
 			os.Exit(1)
 		}
 
-		var vecResults []store.VecSearchResult
-		var hasVec int
-		_ = s.DB.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='embedding_blobs'`).Scan(&hasVec)
-		if hasVec > 0 {
-			model := os.Getenv("QMD_EMBED_MODEL")
-			if model == "" {
-				model = llm.DefaultEmbedModel()
-			}
-			client, err := llm.NewEmbedClient(model)
-			if err == nil {
-				formatted := formatQueryForEmbedding(query)
-				result, err := client.Embed(formatted)
-				if err == nil {
-					vecResults, err = s.SearchVectorsBrute(result.Embedding, fetchLimit)
-					if err != nil {
-						vecResults = nil
-					}
-				}
-			}
-		}
-
-		// 2) Merge with RRF
-		merged := reciprocalRankFusion(ftsResults, vecResults, limit)
-
 		if len(merged) == 0 {
 			fmt.Println("No results found.")
 			fmt.Fprintln(os.Stderr, "Tip: Run 'qmd collection add' and 'qmd update' to index documents; run 'qmd embed' for vector search.")
@@ -145,13 +145,19 @@ var queryCmd = &cobra.Command{
 					ctx = config.FindContextForPath(cfg, col, path)
 				}
 			}
-			body := r.Body
-			if !full && len(body) > 500 {
-				body = body[:500] + "..."
+			row := SearchOutputRow{
+				Docid: docid(r.Hash), Filepath: r.Filepath, Title: r.Title, Body: r.Body, Score: r.Score, Context: ctx, Full: full,
+				Metadata: r.Metadata,
+			}
+			if !full {
+				if r.Snippet != "" {
+					row.Body, row.StartLine, row.EndLine = r.Snippet, r.StartLine, r.EndLine
+				}
+				if len(row.Body) > 500 {
+					row.Body = row.Body[:500] + "..."
+				}
 			}
-			rows = append(rows, SearchOutputRow{
-				Docid: docid(r.Hash), Filepath: r.Filepath, Title: r.Title, Body: body, Score: r.Score, Context: ctx, Full: full,
-			})
+			rows = append(rows, row)
 		}
 		WriteSearchOutput(rows, format, full, lineNumbers)
 	},
@@ -169,6 +175,17 @@ func parseVirtualPath(v string) (collection, path string) {
 	return rest[:idx], rest[idx+1:]
 }
 
+// getWhereFlag parses the --where flags, exiting on an invalid one.
+func getWhereFlag(cmd *cobra.Command) store.Where {
+	exprs, _ := cmd.Flags().GetStringArray("where")
+	where, err := store.ParseWhere(exprs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return where
+}
+
 func getFormatFlag(cmd *cobra.Command) string {
 	if ok, _ := cmd.Flags().GetBool("json"); ok {
 		return "json"
@@ -195,7 +212,11 @@ func getFormatFlag(cmd *cobra.Command) string {
 func init() {
 	queryCmd.Flags().IntP("n", "n", 5, "Number of results")
 	queryCmd.Flags().StringP("collection", "c", "", "Restrict to collection")
+	queryCmd.Flags().StringArray("where", nil, "Only documents whose front matter matches key=value (also !=, <, >, or a bare key); repeatable")
 	queryCmd.Flags().Float64("min-score", 0, "Minimum score threshold")
+	queryCmd.Flags().String("aggregate", "max", "Combine vector chunk scores per document: max, mean (top 3) or sum")
+	queryCmd.Flags().Bool("no-expand", false, "Skip query expansion; search the query as typed")
+	queryCmd.Flags().Bool("no-rerank", false, "Skip reranking; order by RRF only")
 	queryCmd.Flags().Bool("full", false, "Show full document content")
 	queryCmd.Flags().Bool("line-numbers", false, "Add line numbers")
 	queryCmd.Flags().String("format", "cli", "Output: cli, json, csv, md, xml, files")
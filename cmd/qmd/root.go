@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/ba0f3/qmd-go/internal/config"
+	"github.com/ba0f3/qmd-go/internal/indexer"
 	"github.com/ba0f3/qmd-go/internal/llm"
 	"github.com/ba0f3/qmd-go/internal/store"
 	"github.com/spf13/cobra"
@@ -44,18 +48,39 @@ func getStorePath() (string, error) {
 	return store.GetDefaultDbPath(getIndexName())
 }
 
+// openStore opens the current index. An index last written by an older qmd has its
+// front matter and links re-derived first, so that commands reading them (links,
+// backlinks, orphans, --where) do not see them missing until the next update.
 func openStore() (*store.Store, error) {
 	path, err := getStorePath()
 	if err != nil {
 		return nil, err
 	}
-	return store.NewStore(path)
+	s, err := store.NewStore(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := indexer.ReparseIfStale(s); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v; run 'qmd update' to retry\n", err)
+	}
+	return s, nil
 }
 
 func initRoot() {
 	config.CurrentIndexName = getIndexName()
 }
 
+// interruptContext returns a context cancelled by the first Ctrl-C or SIGTERM, for
+// commands that stop model requests cleanly. A second signal kills the process as usual.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
+}
+
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
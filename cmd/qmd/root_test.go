@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestOpenStoreReparsesStaleIndex(t *testing.T) {
+	s := setupDaemonIndex(t)
+	// As an index last written before titles came from the content.
+	if _, err := s.DB.Exec(`UPDATE documents SET title = path`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.DB.Exec(`DELETE FROM store_settings WHERE key = 'content_parse_version'`); err != nil {
+		t.Fatal(err)
+	}
+
+	s2, err := openStore()
+	if err != nil {
+		t.Fatalf("openStore failed: %v", err)
+	}
+	defer s2.Close()
+	if stale, err := s2.NeedsReparse(); err != nil || stale {
+		t.Errorf("Expected openStore to reparse, NeedsReparse = %v (%v)", stale, err)
+	}
+	if doc, err := s2.FindActiveDocument("notes", "apple.md"); err != nil || doc.Title != "Apple" {
+		t.Errorf("Expected the title re-read from the content, got %+v (%v)", doc, err)
+	}
+}
@@ -12,7 +12,21 @@ import (
 var searchCmd = &cobra.Command{
 	Use:   "search [query]",
 	Short: "Full-text search (BM25)",
-	Args:  cobra.MinimumNArgs(1),
+	Long: `Full-text search (BM25) over document chunks.
+
+Query syntax:
+  word               prefix match ("auth" matches "authentication")
+  "exact phrase"     phrase match
+  -word, -"phrase"   exclude
+  a OR b             either term (terms are otherwise ANDed)
+  title:foo          term in the title
+  path:journals/*    path glob (collection/path also matches)
+  collection:notes   restrict to a collection
+  modified:>2025-01-01   file modification date (>, >=, <, <=, or a bare date for that day)
+
+A query of filters alone, such as "collection:notes modified:>2025-01-01", lists the
+matching documents, most recently modified first.`,
+	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		initRoot()
 		query := strings.Join(args, " ")
@@ -28,6 +42,7 @@ var searchCmd = &cobra.Command{
 		useMD, _ := cmd.Flags().GetBool("md")
 		useXML, _ := cmd.Flags().GetBool("xml")
 		useFiles, _ := cmd.Flags().GetBool("files")
+		where := getWhereFlag(cmd)
 		if useJSON {
 			format = "json"
 		} else if useCSV {
@@ -54,7 +69,7 @@ var searchCmd = &cobra.Command{
 		}
 		defer s.Close()
 
-		results, err := s.SearchFTS(query, limit, collection)
+		results, err := s.SearchFTS(query, limit, collection, where)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Search failed: %v\n", err)
 			os.Exit(1)
@@ -74,19 +89,25 @@ var searchCmd = &cobra.Command{
 				}
 				ctx = config.FindContextForPath(cfg, r.CollectionName, path)
 			}
-			body := r.Body
-			if !full && len(body) > 500 {
-				body = body[:500] + "..."
-			}
-			rows = append(rows, SearchOutputRow{
+			row := SearchOutputRow{
 				Docid:    docid(r.Hash),
 				Filepath: r.Filepath,
 				Title:    r.Title,
-				Body:     body,
+				Body:     r.Body,
 				Score:    r.Score,
 				Context:  ctx,
 				Full:     full,
-			})
+				Metadata: r.Metadata,
+			}
+			if !full {
+				if r.Snippet != "" {
+					row.Body, row.StartLine, row.EndLine = r.Snippet, r.StartLine, r.EndLine
+				}
+				if len(row.Body) > 500 {
+					row.Body = row.Body[:500] + "..."
+				}
+			}
+			rows = append(rows, row)
 		}
 
 		if len(rows) == 0 {
@@ -100,6 +121,7 @@ var searchCmd = &cobra.Command{
 func init() {
 	searchCmd.Flags().IntP("n", "n", 5, "Number of results")
 	searchCmd.Flags().StringP("collection", "c", "", "Restrict to collection")
+	searchCmd.Flags().StringArray("where", nil, "Only documents whose front matter matches key=value (also !=, <, >, or a bare key); repeatable")
 	searchCmd.Flags().Bool("all", false, "Return all matches (use with --min-score)")
 	searchCmd.Flags().Float64("min-score", 0, "Minimum score threshold")
 	searchCmd.Flags().Bool("full", false, "Show full document content")
@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/ba0f3/qmd-go/internal/config"
+	"github.com/ba0f3/qmd-go/internal/llm"
+	"github.com/ba0f3/qmd-go/internal/store"
 	"github.com/spf13/cobra"
 )
 
@@ -37,12 +39,43 @@ var statusCmd = &cobra.Command{
 		fmt.Println()
 		fmt.Println("Index:", st.DBPath)
 		fmt.Println("Size:", sizeStr)
+		fmt.Printf("Schema: v%d\n", st.SchemaVersion)
 		fmt.Println()
 		fmt.Println("Documents")
 		fmt.Printf("  Total:    %d files indexed\n", st.DocCount)
-		fmt.Printf("  Vectors:  %d embedded\n\n", st.VectorCount)
-
+		storage := string(st.VectorStorage)
+		if st.KeepFull && st.VectorStorage != store.StorageFloat32 {
+			storage += ", full-precision copies for rescoring"
+		}
+		fmt.Printf("  Vectors:  %d embedded (storage: %s)\n", st.VectorCount, storage)
 		cfg, _ := config.LoadConfig()
+		inUse, _ := embedModelsInUse(cfg)
+		if models, err := s.EmbeddingModels(); err == nil && (len(models) > 1 || len(models) == 1 && !inUse[models[0].Model]) {
+			for _, m := range models {
+				unused := ""
+				if !inUse[m.Model] {
+					unused = " (unused; removed by qmd cleanup)"
+				}
+				fmt.Printf("            %s: %d chunks from %d documents%s\n", m.Model, m.Chunks, m.Hashes, unused)
+			}
+		}
+		if m, err := llm.ResolveEmbedModel(cfg, ""); err != nil {
+			fmt.Printf("  Model:    %v\n\n", err)
+		} else {
+			fmt.Printf("  Model:    %s\n", m)
+			fmt.Printf("  Profile:  %s\n", m.Profile.Name)
+			if n, err := s.GetHashesNeedingEmbeddingCount(m.Model); err == nil && n > 0 {
+				fmt.Printf("  Pending:  %d documents without vectors from this model\n", n)
+			}
+			fmt.Println()
+		}
+
+		fmt.Println("Storage")
+		for _, t := range st.Tables {
+			fmt.Printf("  %-16s %10s  (%d rows)\n", t.Table+":", formatBytes(t.Bytes), t.Rows)
+		}
+		fmt.Println()
+
 		fmt.Println("Collections")
 		if len(cfg.Collections) == 0 && len(st.Collections) == 0 {
 			fmt.Println("  No collections. Run 'qmd collection add .' to index files.")
@@ -63,6 +96,9 @@ var statusCmd = &cobra.Command{
 			}
 			fmt.Printf("  %s (qmd://%s/)\n", name, name)
 			fmt.Printf("    Pattern: %s\n", col.Pattern)
+			if col.EmbedModel != "" {
+				fmt.Printf("    Model:   %s\n", col.EmbedModel)
+			}
 			fmt.Printf("    Files:   %d", cnt)
 			if lastMod != "" {
 				fmt.Printf(" (updated %s)", lastMod)
@@ -8,12 +8,16 @@ import (
 
 	"github.com/ba0f3/qmd-go/internal/config"
 	"github.com/ba0f3/qmd-go/internal/indexer"
+	"github.com/ba0f3/qmd-go/internal/store"
 	"github.com/spf13/cobra"
 )
 
 var updateCmd = &cobra.Command{
 	Use:   "update",
 	Short: "Re-index all collections",
+	Long: `Re-indexes every collection. Files whose size, modification time and inode are
+unchanged since they were last indexed are skipped without being read; --full reads
+and hashes every file again.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		initRoot()
 		cfg, err := config.LoadConfig()
@@ -27,7 +31,8 @@ var updateCmd = &cobra.Command{
 		}
 
 		pull, _ := cmd.Flags().GetBool("pull")
-		_, _ = cmd.Flags().GetBool("full") // accept for compatibility; full re-index is the default
+		full, _ := cmd.Flags().GetBool("full")
+		jobs, _ := cmd.Flags().GetInt("jobs")
 		s, err := openStore()
 		if err != nil {
 			fmt.Printf("Error opening store: %v\n", err)
@@ -48,8 +53,14 @@ var updateCmd = &cobra.Command{
 					}
 				}
 			}
+			// The tokenizer may have been edited in the config since the last update.
+			if tok, err := store.ParseTokenizer(col.Tokenizer); err != nil {
+				fmt.Printf("Warning: collection '%s': %v\n", name, err)
+			} else if err := s.SetCollectionTokenizer(name, tok); err != nil {
+				fmt.Printf("Error setting tokenizer for '%s': %v\n", name, err)
+			}
 			fmt.Printf("Updating collection '%s'...\n", name)
-			if err := indexer.IndexFiles(s, name, col.Path, col.Pattern); err != nil {
+			if err := indexer.IndexFiles(s, name, col.Path, col.Pattern, indexer.Options{Full: full, Jobs: jobs, Exclude: col.Exclude}); err != nil {
 				fmt.Printf("Error indexing collection '%s': %v\n", name, err)
 			}
 		}
@@ -59,6 +70,7 @@ var updateCmd = &cobra.Command{
 
 func init() {
 	updateCmd.Flags().Bool("pull", false, "Run git pull in each collection root before re-indexing")
-	updateCmd.Flags().Bool("full", false, "Full re-index (default behavior; accepted for compatibility)")
+	updateCmd.Flags().Bool("full", false, "Read every file, even those whose stat is unchanged")
+	updateCmd.Flags().Int("jobs", 0, "Files to read and hash in parallel (default: number of CPUs)")
 	rootCmd.AddCommand(updateCmd)
 }
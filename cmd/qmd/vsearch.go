@@ -1,17 +1,201 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/ba0f3/qmd-go/internal/config"
 	"github.com/ba0f3/qmd-go/internal/llm"
+	"github.com/ba0f3/qmd-go/internal/store"
 	"github.com/spf13/cobra"
 )
 
-func formatQueryForEmbedding(query string) string {
-	return "task: search result | query: " + query
+// embedTarget is an embedding model to search, with its client and the collections
+// whose vectors it made.
+type embedTarget struct {
+	model       llm.EmbedModel
+	client      llm.LLM
+	collections []string // nil: every collection
+}
+
+// loadEmbedTargets resolves the embedding models to search for collection. With a
+// collection it is that collection's model, restricted to it. Without one, collections
+// can each name their own model, so they are grouped by model and every model with
+// vectors in the index is searched, restricted to the collections that use it.
+// Collections whose model has no vectors yet are skipped with a warning.
+func loadEmbedTargets(s *store.Store, collection string) ([]embedTarget, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if collection != "" || len(cfg.Collections) == 0 {
+		m, err := llm.ResolveEmbedModel(cfg, collection)
+		if err != nil {
+			return nil, err
+		}
+		if !s.HasModelEmbeddings(m.Model) {
+			return nil, fmt.Errorf("no vectors from %s; the index only has vectors from other models. Run 'qmd embed' first", m.Model)
+		}
+		client, err := getEmbedClient(m)
+		if err != nil {
+			return nil, err
+		}
+		t := embedTarget{model: m, client: client}
+		if collection != "" {
+			t.collections = []string{collection}
+		}
+		return []embedTarget{t}, nil
+	}
+
+	names := make([]string, 0, len(cfg.Collections))
+	for name := range cfg.Collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var targets []embedTarget
+	byModel := make(map[string]int)
+	var missing []string
+	skipped := make(map[string][]string) // collections by model without vectors
+	for _, name := range names {
+		m, err := llm.ResolveEmbedModel(cfg, name)
+		if err != nil {
+			return nil, fmt.Errorf("collection %s: %w", name, err)
+		}
+		if i, ok := byModel[m.Model]; ok {
+			targets[i].collections = append(targets[i].collections, name)
+			continue
+		}
+		if _, ok := skipped[m.Model]; ok || !s.HasModelEmbeddings(m.Model) {
+			if !ok {
+				missing = append(missing, m.Model)
+			}
+			skipped[m.Model] = append(skipped[m.Model], name)
+			continue
+		}
+		client, err := getEmbedClient(m)
+		if err != nil {
+			return nil, err
+		}
+		byModel[m.Model] = len(targets)
+		targets = append(targets, embedTarget{model: m, client: client, collections: []string{name}})
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no vectors from %s; run 'qmd embed' first", strings.Join(missing, ", "))
+	}
+	for _, model := range missing {
+		fmt.Fprintf(os.Stderr, "Warning: not searching %s: no vectors from %s yet; run 'qmd embed'\n",
+			strings.Join(skipped[model], ", "), model)
+	}
+	return targets, nil
+}
+
+// search embeds text with the target's model and searches that model's vectors in the
+// target's collections.
+func (t embedTarget) search(ctx context.Context, s *store.Store, text string, opts vectorSearchOptions) ([]store.VecSearchResult, error) {
+	vec, err := embedQuery(ctx, t.model, t.client, text)
+	if err != nil {
+		return nil, fmt.Errorf("embedding query: %w", err)
+	}
+	if opts.Exact {
+		return s.SearchVectorsBrute(t.model.Model, vec, opts.Limit, opts.Aggregate, t.collections, opts.Where)
+	}
+	return s.SearchVectors(t.model.Model, vec, opts.Limit, opts.Aggregate, t.collections, opts.Where)
+}
+
+var (
+	embedClientsMu sync.Mutex
+	embedClients   = map[string]llm.LLM{}
+)
+
+// getEmbedClient creates the client for m once per process, so long-running servers
+// (mcp, daemon) load a local model only once.
+func getEmbedClient(m llm.EmbedModel) (llm.LLM, error) {
+	key := fmt.Sprintf("%s|%s|%s|%s|%d|%d", m.Kind, m.BaseURL, m.APIKeyEnv, m.Model, m.Dimensions, m.ContextSize)
+	embedClientsMu.Lock()
+	defer embedClientsMu.Unlock()
+	if c := embedClients[key]; c != nil {
+		return c, nil
+	}
+	c, err := m.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	embedClients[key] = c
+	return c, nil
+}
+
+// embedQuery embeds a search query in the model's query format. The vector can only be
+// compared with vectors stored under m.Model.
+func embedQuery(ctx context.Context, m llm.EmbedModel, client llm.LLM, query string) ([]float32, error) {
+	result, err := client.Embed(ctx, m.FormatQuery(query))
+	if err != nil {
+		return nil, err
+	}
+	m.Normalize(result.Embedding)
+	return result.Embedding, nil
+}
+
+// vectorSearchOptions configures vectorSearch.
+type vectorSearchOptions struct {
+	Collection string // restricts results to this collection, searched with its model
+	Where      store.Where
+	Limit      int
+	Aggregate  store.ChunkAggregation
+	Exact      bool
+}
+
+// vectorSearch embeds query with each embedding model in use (see loadEmbedTargets) and
+// searches that model's vectors. Results from several models are merged by score. It
+// backs `qmd vsearch`, both in-process and in the daemon.
+func vectorSearch(ctx context.Context, s *store.Store, query string, opts vectorSearchOptions) ([]store.VecSearchResult, error) {
+	if !s.HasEmbeddings() {
+		return nil, errors.New("vector index not found; run 'qmd embed' first")
+	}
+	targets, err := loadEmbedTargets(s, opts.Collection)
+	if err != nil {
+		return nil, fmt.Errorf("creating embed client: %w", err)
+	}
+	var lists [][]store.VecSearchResult
+	for _, t := range targets {
+		results, err := t.search(ctx, s, query, opts)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, results)
+	}
+	return mergeVecResults(lists, opts.Limit), nil
+}
+
+// mergeVecResults merges result lists by score, keeping the best score of a document
+// found by several models.
+func mergeVecResults(lists [][]store.VecSearchResult, limit int) []store.VecSearchResult {
+	if len(lists) == 1 {
+		return lists[0]
+	}
+	best := make(map[string]int)
+	var out []store.VecSearchResult
+	for _, l := range lists {
+		for _, r := range l {
+			if i, ok := best[r.Filepath]; ok {
+				if r.Score > out[i].Score {
+					out[i] = r
+				}
+				continue
+			}
+			best[r.Filepath] = len(out)
+			out = append(out, r)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Score > out[j].Score })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
 }
 
 var vsearchCmd = &cobra.Command{
@@ -26,41 +210,23 @@ var vsearchCmd = &cobra.Command{
 		minScore, _ := cmd.Flags().GetFloat64("min-score")
 		full, _ := cmd.Flags().GetBool("full")
 		lineNumbers, _ := cmd.Flags().GetBool("line-numbers")
+		exact, _ := cmd.Flags().GetBool("exact")
+		collection, _ := cmd.Flags().GetString("collection")
+		aggName, _ := cmd.Flags().GetString("aggregate")
 		format := getFormatFlag(cmd)
-
-		s, err := openStore()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error opening store: %v\n", err)
-			os.Exit(1)
-		}
-		defer s.Close()
-
-		var hasTable int
-		if err := s.DB.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='embedding_blobs'`).Scan(&hasTable); err != nil || hasTable == 0 {
-			fmt.Fprintln(os.Stderr, "Vector index not found. Run 'qmd embed' first.")
-			os.Exit(1)
-		}
-
-		model := os.Getenv("QMD_EMBED_MODEL")
-		if model == "" {
-			model = llm.DefaultEmbedModel()
-		}
-		client, err := llm.NewEmbedClient(model)
+		where := getWhereFlag(cmd)
+		agg, err := store.ParseChunkAggregation(aggName)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error creating embed client: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
 
-		formatted := formatQueryForEmbedding(query)
-		result, err := client.Embed(formatted)
+		ctx, stop := interruptContext()
+		defer stop()
+		opts := vectorSearchOptions{Collection: collection, Where: where, Limit: limit, Aggregate: agg, Exact: exact}
+		results, err := runVectorSearch(ctx, query, opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error embedding query: %v\n", err)
-			os.Exit(1)
-		}
-
-		results, err := s.SearchVectorsBrute(result.Embedding, limit)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error searching: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
 
@@ -77,13 +243,19 @@ var vsearchCmd = &cobra.Command{
 					ctx = config.FindContextForPath(cfg, col, path)
 				}
 			}
-			body := r.Body
-			if !full && len(body) > 500 {
-				body = body[:500] + "..."
+			row := SearchOutputRow{
+				Docid: docid(r.Hash), Filepath: r.Filepath, Title: r.Title, Body: r.Body, Score: r.Score, Context: ctx, Full: full,
+				Metadata: r.Metadata,
+			}
+			if !full {
+				if r.Snippet != "" {
+					row.Body, row.StartLine, row.EndLine = r.Snippet, r.StartLine, r.EndLine
+				}
+				if len(row.Body) > 500 {
+					row.Body = row.Body[:500] + "..."
+				}
 			}
-			rows = append(rows, SearchOutputRow{
-				Docid: docid(r.Hash), Filepath: r.Filepath, Title: r.Title, Body: body, Score: r.Score, Context: ctx, Full: full,
-			})
+			rows = append(rows, row)
 		}
 		if len(rows) == 0 {
 			fmt.Println("No results found.")
@@ -95,10 +267,13 @@ var vsearchCmd = &cobra.Command{
 
 func init() {
 	vsearchCmd.Flags().IntP("n", "n", 5, "Number of results")
-	vsearchCmd.Flags().StringP("collection", "c", "", "Restrict to collection (not yet implemented)")
+	vsearchCmd.Flags().StringP("collection", "c", "", "Restrict to collection")
 	vsearchCmd.Flags().Float64("min-score", 0.3, "Minimum score threshold")
 	vsearchCmd.Flags().Bool("full", false, "Show full document content")
 	vsearchCmd.Flags().Bool("line-numbers", false, "Add line numbers")
+	vsearchCmd.Flags().String("aggregate", "max", "Combine chunk scores per document: max, mean (top 3) or sum")
+	vsearchCmd.Flags().StringArray("where", nil, "Only documents whose front matter matches key=value (also !=, <, >, or a bare key); repeatable")
+	vsearchCmd.Flags().Bool("exact", false, "Exact brute-force search instead of the ANN index (slow; for verification)")
 	vsearchCmd.Flags().String("format", "cli", "Output: cli, json, csv, md, xml, files")
 	vsearchCmd.Flags().Bool("json", false, "JSON output")
 	vsearchCmd.Flags().Bool("csv", false, "CSV output")
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ba0f3/qmd-go/internal/config"
+	"github.com/ba0f3/qmd-go/internal/indexer"
+	"github.com/ba0f3/qmd-go/internal/store"
+	"github.com/spf13/cobra"
+)
+
+// watchOptions configures runWatch.
+type watchOptions struct {
+	Debounce time.Duration
+	Embed    bool      // queue changed documents for embedding
+	Log      io.Writer // progress lines; stderr under mcp, whose stdout is the protocol
+
+	// BatchSize and Concurrency are as for embed's --batch-size and --concurrency.
+	BatchSize, Concurrency int
+}
+
+// runWatch re-indexes files of every collection as they change, until ctx is done.
+// Collections added after it starts are not watched.
+func runWatch(ctx context.Context, s *store.Store, opts watchOptions) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+	if len(cfg.Collections) == 0 {
+		return fmt.Errorf("no collections to watch; run 'qmd collection add' first")
+	}
+	names := make([]string, 0, len(cfg.Collections))
+	for name := range cfg.Collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var roots []indexer.WatchRoot
+	for _, name := range names {
+		col := cfg.Collections[name]
+		roots = append(roots, indexer.WatchRoot{Collection: name, Path: col.Path, Pattern: col.Pattern, Exclude: col.Exclude})
+	}
+	w, err := indexer.NewWatcher(roots, opts.Debounce)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	var queue *embedQueue
+	if opts.Embed {
+		if err := s.EnsureEmbeddingBlobTable(); err != nil {
+			return err
+		}
+		queue = &embedQueue{
+			hashes:      make(map[string]bool),
+			wake:        make(chan struct{}, 1),
+			batchSize:   opts.BatchSize,
+			concurrency: opts.Concurrency,
+		}
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			queue.run(ctx, s, opts.Log)
+		}()
+		defer wg.Wait()
+	}
+
+	for _, r := range roots {
+		fmt.Fprintf(opts.Log, "Watching '%s' (%s) [%s]\n", r.Collection, r.Path, r.Pattern)
+	}
+	return w.Run(ctx, func(batch map[string][]string) {
+		for _, r := range roots {
+			paths := batch[r.Collection]
+			if len(paths) == 0 {
+				continue
+			}
+			c, err := indexer.IndexPaths(s, r.Collection, r.Path, r.Pattern, r.Exclude, paths)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error re-indexing '%s': %v\n", r.Collection, err)
+				continue
+			}
+			if c.Empty() {
+				continue
+			}
+			fmt.Fprintf(opts.Log, "%s '%s': %d new, %d updated, %d removed\n",
+				time.Now().Format("15:04:05"), r.Collection, c.Added, c.Updated, c.Removed)
+			if queue != nil {
+				queue.add(c.Hashes)
+			}
+		}
+	})
+}
+
+// embedQueue embeds changed documents in the background, so a slow model does not hold
+// up indexing. Changes that arrive while a pass runs are embedded by the next one.
+type embedQueue struct {
+	mu     sync.Mutex
+	hashes map[string]bool
+	wake   chan struct{}
+
+	batchSize, concurrency int
+}
+
+func (q *embedQueue) add(hashes []string) {
+	if len(hashes) == 0 {
+		return
+	}
+	q.mu.Lock()
+	for _, h := range hashes {
+		q.hashes[h] = true
+	}
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *embedQueue) run(ctx context.Context, s *store.Store, log io.Writer) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		}
+		q.mu.Lock()
+		want := q.hashes
+		q.hashes = make(map[string]bool)
+		q.mu.Unlock()
+
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading config, not embedding: %v\n", err)
+			continue
+		}
+		groups, err := planEmbedding(s, cfg, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error planning embeddings: %v\n", err)
+			continue
+		}
+		for _, g := range groups {
+			// Only the changed documents; anything else pending is left to 'qmd embed'.
+			var queued []store.EmbeddingCandidate
+			for _, h := range g.hashes {
+				if want[h.Hash] {
+					queued = append(queued, h)
+				}
+			}
+			if len(queued) == 0 {
+				continue
+			}
+			g.hashes = queued
+			embedGroupDocs(ctx, s, g, q.batchSize, q.concurrency, time.Now(), log)
+			if ctx.Err() != nil {
+				return
+			}
+		}
+	}
+}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Re-index collections as files change",
+	Long: `Watches each collection's directory and re-indexes files matching its pattern as they
+are created, modified, renamed or deleted. Events are debounced, and only the affected
+files are read. With --embed, changed documents are also embedded in the background
+(unchanged documents that still lack vectors are left to 'qmd embed').
+
+Collections added while watch runs are picked up on restart. Directories are watched
+when 'qmd update' would index them, including hidden ones such as .obsidian; only .git
+and excluded directories are skipped.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		initRoot()
+		debounce, _ := cmd.Flags().GetDuration("debounce")
+		embed, _ := cmd.Flags().GetBool("embed")
+		batchSize, _ := cmd.Flags().GetInt("batch-size")
+		concurrency, _ := cmd.Flags().GetInt("concurrency")
+		s, err := openStore()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening store: %v\n", err)
+			os.Exit(1)
+		}
+		defer s.Close()
+
+		ctx, stop := interruptContext()
+		defer stop()
+		opts := watchOptions{
+			Debounce:    debounce,
+			Embed:       embed,
+			BatchSize:   batchSize,
+			Concurrency: concurrency,
+			Log:         os.Stdout,
+		}
+		if err := runWatch(ctx, s, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	watchCmd.Flags().Duration("debounce", 500*time.Millisecond, "Wait this long after the last change before re-indexing")
+	watchCmd.Flags().Bool("embed", false, "Embed changed documents in the background")
+	watchCmd.Flags().Int("batch-size", defaultEmbedBatchSize, "With --embed: chunks per embedding request")
+	watchCmd.Flags().Int("concurrency", defaultEmbedConcurrency, "With --embed: parallel embedding requests (API backend; local models use 1)")
+	rootCmd.AddCommand(watchCmd)
+}
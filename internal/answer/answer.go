@@ -0,0 +1,105 @@
+// Package answer builds retrieval-augmented prompts from search passages and checks
+// the line citations in the model's answer against them.
+package answer
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Passage is retrieved text shown to the model. Lines are numbered from StartLine.
+type Passage struct {
+	File      string // qmd://collection/path
+	Title     string
+	StartLine int
+	Text      string
+}
+
+// EndLine is the last line number covered by the passage.
+func (p Passage) EndLine() int {
+	return p.StartLine + strings.Count(strings.TrimRight(p.Text, "\n"), "\n")
+}
+
+// Citation is a qmd://collection/path:line[-line] reference found in an answer.
+type Citation struct {
+	Ref     string // as written in the answer
+	File    string
+	Line    int
+	EndLine int // equal to Line for single-line citations
+	Passage int // 1-based index of the passage containing the lines; 0 if rejected
+}
+
+const systemPrompt = `You answer questions using only the numbered passages provided. Each passage shows its source file and numbered lines.
+
+Rules:
+- Cite every claim with the source and line it comes from, written exactly as qmd://collection/path:LINE (or qmd://collection/path:START-END for several lines), using the line numbers shown in the passages.
+- Only cite lines that appear in the passages. Never invent files or line numbers.
+- If the passages do not contain the answer, say that you could not find it in the indexed documents.
+- Be concise.`
+
+// Prompt returns the system and user prompts for answering question from passages.
+func Prompt(question string, passages []Passage) (system, user string) {
+	var b strings.Builder
+	for i, p := range passages {
+		fmt.Fprintf(&b, "[%d] %s:%d-%d", i+1, p.File, p.StartLine, p.EndLine())
+		if p.Title != "" {
+			fmt.Fprintf(&b, " (%s)", p.Title)
+		}
+		b.WriteString("\n")
+		for j, line := range strings.Split(strings.TrimRight(p.Text, "\n"), "\n") {
+			fmt.Fprintf(&b, "%d: %s\n", p.StartLine+j, line)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("Question: ")
+	b.WriteString(question)
+	return systemPrompt, b.String()
+}
+
+// citationRe matches qmd://collection/path:LINE or :START-END. Paths end at whitespace,
+// brackets, quotes or backticks; trailing punctuation is not part of the line number.
+var citationRe = regexp.MustCompile("qmd://[^\\s()\\[\\]<>\"'`]+?:(\\d+)(?:-(\\d+))?")
+
+// Citations finds the citations in answer and checks each against passages. A
+// citation is valid when all its lines lie within one passage of the cited file;
+// anything else (unknown file, lines outside the retrieved text) is rejected.
+func Citations(answer string, passages []Passage) (valid, rejected []Citation) {
+	for _, ref := range citationRe.FindAllString(answer, -1) {
+		if c := check(ref, passages); c.Passage > 0 {
+			valid = append(valid, c)
+		} else {
+			rejected = append(rejected, c)
+		}
+	}
+	return valid, rejected
+}
+
+// RemoveRejected replaces the rejected citations in answer with "[unsupported citation]".
+func RemoveRejected(answer string, passages []Passage) string {
+	return citationRe.ReplaceAllStringFunc(answer, func(ref string) string {
+		if check(ref, passages).Passage == 0 {
+			return "[unsupported citation]"
+		}
+		return ref
+	})
+}
+
+// check parses a citation matched by citationRe and finds the passage it points into.
+func check(ref string, passages []Passage) Citation {
+	m := citationRe.FindStringSubmatch(ref)
+	c := Citation{Ref: ref, File: ref[:strings.LastIndex(ref, ":")]}
+	c.Line, _ = strconv.Atoi(m[1])
+	c.EndLine = c.Line
+	if m[2] != "" {
+		c.EndLine, _ = strconv.Atoi(m[2])
+	}
+	for i, p := range passages {
+		if p.File == c.File && c.Line >= p.StartLine && c.EndLine >= c.Line && c.EndLine <= p.EndLine() {
+			c.Passage = i + 1
+			break
+		}
+	}
+	return c
+}
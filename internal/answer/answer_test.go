@@ -0,0 +1,50 @@
+package answer
+
+import (
+	"strings"
+	"testing"
+)
+
+var passages = []Passage{
+	{File: "qmd://notes/deploy.md", Title: "Deploy", StartLine: 10, Text: "Deploys run nightly.\nRollbacks use the previous tag.\n"},
+	{File: "qmd://notes/team.md", StartLine: 1, Text: "Alice owns deploys."},
+}
+
+func TestPrompt(t *testing.T) {
+	system, user := Prompt("Who owns deploys?", passages)
+	if !strings.Contains(system, "qmd://collection/path:LINE") {
+		t.Errorf("System prompt lacks citation format: %q", system)
+	}
+	for _, want := range []string{
+		"[1] qmd://notes/deploy.md:10-11 (Deploy)\n10: Deploys run nightly.\n11: Rollbacks use the previous tag.\n",
+		"[2] qmd://notes/team.md:1-1\n1: Alice owns deploys.\n",
+		"Question: Who owns deploys?",
+	} {
+		if !strings.Contains(user, want) {
+			t.Errorf("User prompt missing %q:\n%s", want, user)
+		}
+	}
+}
+
+func TestCitations(t *testing.T) {
+	text := "Alice owns deploys (qmd://notes/team.md:1). They run nightly [qmd://notes/deploy.md:10-11], " +
+		"see qmd://notes/deploy.md:1. Also qmd://notes/other.md:3 and `qmd://notes/deploy.md:11`; " +
+		"backwards qmd://notes/deploy.md:11-10."
+	valid, rejected := Citations(text, passages)
+	if len(valid) != 3 || valid[0].Passage != 2 || valid[1].Passage != 1 || valid[1].EndLine != 11 || valid[2].Line != 11 {
+		t.Errorf("Valid citations = %+v", valid)
+	}
+	var refs []string
+	for _, c := range rejected {
+		refs = append(refs, c.Ref)
+	}
+	if strings.Join(refs, " ") != "qmd://notes/deploy.md:1 qmd://notes/other.md:3 qmd://notes/deploy.md:11-10" {
+		t.Errorf("Rejected citations = %v", refs)
+	}
+
+	cleaned := RemoveRejected(text, passages)
+	if strings.Contains(cleaned, "other.md") || !strings.Contains(cleaned, "qmd://notes/deploy.md:10-11") ||
+		strings.Count(cleaned, "[unsupported citation]") != 3 {
+		t.Errorf("RemoveRejected = %q", cleaned)
+	}
+}
@@ -121,6 +121,16 @@ func RemoveContext(cfg *Config, collectionName, pathPrefix string) bool {
 	return true
 }
 
+// EmbedModelFor returns the name of the embedding model configured for a collection:
+// its own embed_model, else the index-wide one, else "" (use the environment).
+// collectionName "" asks for the index-wide model.
+func EmbedModelFor(cfg *Config, collectionName string) string {
+	if col, ok := cfg.Collections[collectionName]; ok && col.EmbedModel != "" {
+		return col.EmbedModel
+	}
+	return cfg.EmbedModel
+}
+
 // ContextEntry is a single context listing entry.
 type ContextEntry struct {
 	Collection string
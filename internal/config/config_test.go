@@ -63,3 +63,50 @@ func TestLoadSaveConfig(t *testing.T) {
 		}
 	}
 }
+
+func TestModelsConfig(t *testing.T) {
+	t.Setenv("QMD_CONFIG_DIR", t.TempDir())
+	data := `embed_model: nomic
+models:
+  nomic:
+    kind: ollama
+    model: nomic-embed-text
+    dimensions: 768
+    query_template: "search_query: {query}"
+    profile: house
+profiles:
+  house:
+    match: [house-embed]
+    query_template: "q: {query}"
+    normalize: true
+    max_tokens: 1024
+collections:
+  notes:
+    path: /notes
+    pattern: "**/*.md"
+  docs:
+    path: /docs
+    pattern: "**/*.md"
+    embed_model: small
+`
+	path, _ := GetConfigFilePath()
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if m := cfg.Models["nomic"]; m.Kind != "ollama" || m.Dimensions != 768 || m.QueryTemplate != "search_query: {query}" {
+		t.Errorf("Unexpected model config %+v", m)
+	}
+	if p := cfg.Profiles["house"]; cfg.Models["nomic"].Profile != "house" || len(p.Match) != 1 || !p.Normalize || p.MaxTokens != 1024 {
+		t.Errorf("Unexpected profile config %+v", p)
+	}
+	if got := EmbedModelFor(cfg, "notes"); got != "nomic" {
+		t.Errorf("EmbedModelFor(notes) = %q, want the index default", got)
+	}
+	if got := EmbedModelFor(cfg, "docs"); got != "small" {
+		t.Errorf("EmbedModelFor(docs) = %q, want the collection override", got)
+	}
+}
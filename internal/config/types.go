@@ -5,9 +5,62 @@ type Collection struct {
 	Pattern string            `yaml:"pattern"`
 	Context map[string]string `yaml:"context,omitempty"`
 	Update  string            `yaml:"update,omitempty"`
+	// Tokenizer is "trigram" for collections searched by substring (CJK and other
+	// unsegmented scripts); empty means the default unicode61 word tokenizer.
+	Tokenizer string `yaml:"tokenizer,omitempty"`
+	// EmbedModel names an entry in Config.Models used for this collection instead of
+	// the index-wide Config.EmbedModel.
+	EmbedModel string `yaml:"embed_model,omitempty"`
+	// Exclude lists gitignore-style patterns, relative to Path, of files and directories
+	// to leave out. .gitignore and .qmdignore files in the tree are honored as well.
+	Exclude []string `yaml:"exclude,omitempty"`
+}
+
+// ModelConfig is a named model provider in the index's models: section.
+type ModelConfig struct {
+	// Kind is the backend: "openai" (any OpenAI-compatible API), "ollama" (Ollama's
+	// native API) or "gguf" (local GGUF file or Hugging Face spec).
+	Kind    string `yaml:"kind"`
+	BaseURL string `yaml:"base_url,omitempty"`
+	// APIKeyEnv names the environment variable holding the API key, so the file can be
+	// shared without secrets.
+	APIKeyEnv string `yaml:"api_key_env,omitempty"`
+	Model     string `yaml:"model"`
+	// Dimensions is the vector size, requested from APIs that can shorten vectors
+	// (OpenAI text-embedding-3, Ollama) and checked on their results; 0 = the model's own.
+	Dimensions int `yaml:"dimensions,omitempty"`
+	// ContextSize is the context length for local backends (gguf n_ctx, Ollama num_ctx).
+	ContextSize int `yaml:"context_size,omitempty"`
+	// Profile names the embedding profile (see ProfileConfig) to use instead of the one
+	// matched from Model.
+	Profile string `yaml:"profile,omitempty"`
+	// QueryTemplate and DocumentTemplate wrap text before embedding; {query}, {title}
+	// and {text} are replaced. Empty means the profile's format.
+	QueryTemplate    string `yaml:"query_template,omitempty"`
+	DocumentTemplate string `yaml:"document_template,omitempty"`
+}
+
+// ProfileConfig describes how a family of embedding models expects its input: the
+// task prefixes it was trained with, whether its vectors should be L2-normalized and
+// how much text it accepts.
+type ProfileConfig struct {
+	// Match lists case-insensitive substrings of model specs the profile applies to.
+	Match            []string `yaml:"match,omitempty"`
+	QueryTemplate    string   `yaml:"query_template,omitempty"`
+	DocumentTemplate string   `yaml:"document_template,omitempty"`
+	Normalize        bool     `yaml:"normalize,omitempty"`
+	// MaxTokens is the model's input limit; longer text is truncated. 0 = no limit.
+	MaxTokens int `yaml:"max_tokens,omitempty"`
 }
 
 type Config struct {
-	GlobalContext string                `yaml:"global_context,omitempty"`
-	Collections   map[string]Collection `yaml:"collections"`
+	GlobalContext string `yaml:"global_context,omitempty"`
+	// EmbedModel names the entry in Models that embeds this index; empty falls back to
+	// QMD_EMBED_MODEL and QMD_EMBED_BACKEND.
+	EmbedModel string                 `yaml:"embed_model,omitempty"`
+	Models     map[string]ModelConfig `yaml:"models,omitempty"`
+	// Profiles adds embedding profiles to the built-in ones; a profile with a built-in
+	// name replaces it.
+	Profiles    map[string]ProfileConfig `yaml:"profiles,omitempty"`
+	Collections map[string]Collection    `yaml:"collections"`
 }
@@ -0,0 +1,261 @@
+// Package frontmatter parses the YAML (---) or TOML (+++) block at the top of a note
+// into flat key/value metadata, and finds the note's title.
+package frontmatter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Field is one front matter key with its values: one per element for a list, a single
+// value otherwise. Keys are lowercased; keys of nested tables are joined with dots
+// ("author.name").
+type Field struct {
+	Key    string
+	Values []string
+	List   bool
+}
+
+// Metadata is the flattened front matter of a note, in the order keys appear.
+type Metadata []Field
+
+// Get returns the first value of key.
+func (m Metadata) Get(key string) (string, bool) {
+	for _, f := range m {
+		if f.Key == key && len(f.Values) > 0 {
+			return f.Values[0], true
+		}
+	}
+	return "", false
+}
+
+// Map returns the metadata for JSON output: a string per key, or a list of strings for
+// keys that held a list.
+func (m Metadata) Map() map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for _, f := range m {
+		if f.List {
+			out[f.Key] = f.Values
+		} else if len(f.Values) > 0 {
+			out[f.Key] = f.Values[0]
+		}
+	}
+	return out
+}
+
+// Parse splits content into its front matter and the body after it. A note without
+// front matter returns nil metadata and content unchanged; a block that does not parse
+// returns an error along with content unchanged.
+func Parse(content string) (Metadata, string, error) {
+	text := strings.TrimPrefix(content, "\ufeff")
+	first, rest, ok := strings.Cut(text, "\n")
+	if !ok {
+		return nil, content, nil
+	}
+	var closers []string
+	switch strings.TrimRight(first, " \t\r") {
+	case "---":
+		closers = []string{"---", "..."}
+	case "+++":
+		closers = []string{"+++"}
+	default:
+		return nil, content, nil
+	}
+	closes := func(line string) bool {
+		line = strings.TrimRight(line, " \t\r")
+		for _, c := range closers {
+			if line == c {
+				return true
+			}
+		}
+		return false
+	}
+	block, body, found := "", "", false
+	for pos := 0; pos < len(rest); {
+		line, next := rest[pos:], len(rest)
+		if i := strings.IndexByte(line, '\n'); i >= 0 {
+			line, next = line[:i], pos+i+1
+		}
+		if closes(line) {
+			block, body, found = rest[:pos], rest[next:], true
+			break
+		}
+		pos = next
+	}
+	if !found {
+		return nil, content, nil
+	}
+
+	var meta Metadata
+	var err error
+	if closers[0] == "+++" {
+		meta, err = parseTOML(block)
+	} else {
+		meta, err = parseYAML(block)
+	}
+	if err != nil {
+		return nil, content, err
+	}
+	return meta, body, nil
+}
+
+// builder collects fields, merging values given for the same key.
+type builder struct {
+	fields Metadata
+	index  map[string]int
+}
+
+func (b *builder) add(key, value string, list bool) {
+	i, ok := b.index[key]
+	if !ok {
+		if b.index == nil {
+			b.index = make(map[string]int)
+		}
+		i = len(b.fields)
+		b.index[key] = i
+		b.fields = append(b.fields, Field{Key: key})
+	}
+	f := &b.fields[i]
+	f.Values = append(f.Values, value)
+	f.List = f.List || list || len(f.Values) > 1
+}
+
+func joinKey(prefix, key string) string {
+	key = strings.ToLower(strings.TrimSpace(key))
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+func parseYAML(block string) (Metadata, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(block), &doc); err != nil {
+		return nil, fmt.Errorf("front matter: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil // empty block
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("front matter is not a mapping")
+	}
+	var b builder
+	b.yaml("", root, false)
+	return b.fields, nil
+}
+
+// yaml adds node under key. Scalars keep their text as written, so dates and numbers
+// are stored the way the note spells them; nulls are left out.
+func (b *builder) yaml(key string, n *yaml.Node, list bool) {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			b.yaml(joinKey(key, n.Content[i].Value), n.Content[i+1], list)
+		}
+	case yaml.SequenceNode:
+		for _, c := range n.Content {
+			b.yaml(key, c, true)
+		}
+	case yaml.ScalarNode:
+		if n.Tag == "!!null" || key == "" {
+			return
+		}
+		b.add(key, n.Value, list)
+	}
+}
+
+func parseTOML(block string) (Metadata, error) {
+	var m map[string]interface{}
+	if _, err := toml.Decode(block, &m); err != nil {
+		return nil, fmt.Errorf("front matter: %w", err)
+	}
+	var b builder
+	b.toml("", m, false)
+	return b.fields, nil
+}
+
+// toml adds v under key. TOML tables are unordered once decoded, so their keys are
+// added in sorted order.
+func (b *builder) toml(key string, v interface{}, list bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			b.toml(joinKey(key, k), v[k], list)
+		}
+	case []map[string]interface{}:
+		for _, t := range v {
+			b.toml(key, t, true)
+		}
+	case []interface{}:
+		for _, e := range v {
+			b.toml(key, e, true)
+		}
+	case time.Time:
+		b.add(key, tomlTime(v), list)
+	case nil:
+	default:
+		b.add(key, fmt.Sprint(v), list)
+	}
+}
+
+// tomlTime formats a TOML date or time the way it is written. The decoder marks local
+// (offset-less) values with zones of these names.
+func tomlTime(t time.Time) string {
+	switch t.Location().String() {
+	case "date-local":
+		return t.Format("2006-01-02")
+	case "datetime-local":
+		return t.Format("2006-01-02T15:04:05.999999999")
+	case "time-local":
+		return t.Format("15:04:05.999999999")
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// Title returns the title of a note from its metadata and body: the front matter
+// title, or else the text of the first level-1 ATX heading outside code fences, or ""
+// if there is neither.
+func Title(meta Metadata, body string) string {
+	if t, ok := meta.Get("title"); ok && strings.TrimSpace(t) != "" {
+		return strings.TrimSpace(t)
+	}
+	fence := ""
+	for _, line := range strings.Split(body, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+		if trimmed == "#" || strings.HasPrefix(trimmed, "# ") || strings.HasPrefix(trimmed, "#\t") {
+			// A closing sequence of #s is not part of the heading.
+			t := strings.TrimSpace(trimmed[1:])
+			if s := strings.TrimRight(t, "#"); s == "" || strings.HasSuffix(s, " ") {
+				t = strings.TrimSpace(s)
+			}
+			if t != "" {
+				return t
+			}
+		}
+	}
+	return ""
+}
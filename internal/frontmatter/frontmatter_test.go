@@ -0,0 +1,89 @@
+package frontmatter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	content := "---\ntitle: Deploy Runbook\nTags: [ops, deploy]\ndate: 2025-03-01\naliases:\n  - runbook\n  - deploys\nstatus: draft\ndraft: ~\nauthor:\n  name: Sam\n---\n# Heading\n\nBody.\n"
+	meta, body, err := Parse(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Metadata{
+		{Key: "title", Values: []string{"Deploy Runbook"}},
+		{Key: "tags", Values: []string{"ops", "deploy"}, List: true},
+		{Key: "date", Values: []string{"2025-03-01"}},
+		{Key: "aliases", Values: []string{"runbook", "deploys"}, List: true},
+		{Key: "status", Values: []string{"draft"}},
+		{Key: "author.name", Values: []string{"Sam"}},
+	}
+	if !reflect.DeepEqual(meta, want) {
+		t.Errorf("Metadata = %#v, want %#v", meta, want)
+	}
+	if body != "# Heading\n\nBody.\n" {
+		t.Errorf("Body = %q", body)
+	}
+	if got := Title(meta, body); got != "Deploy Runbook" {
+		t.Errorf("Title = %q", got)
+	}
+	m := meta.Map()
+	if m["status"] != "draft" || !reflect.DeepEqual(m["tags"], []string{"ops", "deploy"}) {
+		t.Errorf("Map = %v", m)
+	}
+}
+
+func TestParseTOML(t *testing.T) {
+	content := "+++\ntitle = \"Notes\"\ntags = [\"a\"]\ndate = 2025-03-01\nweight = 3\n[extra]\nfeatured = true\n+++\nBody\n"
+	meta, body, err := Parse(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Metadata{
+		{Key: "date", Values: []string{"2025-03-01"}},
+		{Key: "extra.featured", Values: []string{"true"}},
+		{Key: "tags", Values: []string{"a"}, List: true},
+		{Key: "title", Values: []string{"Notes"}},
+		{Key: "weight", Values: []string{"3"}},
+	}
+	if !reflect.DeepEqual(meta, want) {
+		t.Errorf("Metadata = %#v, want %#v", meta, want)
+	}
+	if body != "Body\n" {
+		t.Errorf("Body = %q", body)
+	}
+}
+
+func TestParseWithout(t *testing.T) {
+	for _, content := range []string{
+		"# Title\n\ntext\n",
+		"---\nnot closed\n",
+		"",
+		"text\n---\ntitle: x\n---\n",
+	} {
+		meta, body, err := Parse(content)
+		if err != nil || meta != nil || body != content {
+			t.Errorf("Parse(%q) = %v, %q, %v; want no front matter", content, meta, body, err)
+		}
+	}
+	if _, body, err := Parse("---\n[unclosed\n---\ntext\n"); err == nil || body != "---\n[unclosed\n---\ntext\n" {
+		t.Errorf("Malformed front matter: body %q, err %v", body, err)
+	}
+	if meta, body, err := Parse("---\n---\ntext"); err != nil || meta != nil || body != "text" {
+		t.Errorf("Empty front matter: %v, %q, %v", meta, body, err)
+	}
+}
+
+func TestTitle(t *testing.T) {
+	for _, tt := range []struct{ body, want string }{
+		{"intro\n\n# First #\n# Second\n", "First"},
+		{"```\n# not a title\n```\n# Real\n", "Real"},
+		{"## Sub\n#hashtag\n", ""},
+		{"# C# tips\n", "C# tips"},
+	} {
+		if got := Title(nil, tt.body); got != tt.want {
+			t.Errorf("Title(%q) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package huggingface
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// CachedFile is a model file in ModelCacheDir.
+type CachedFile struct {
+	Spec    Spec
+	Path    string
+	Size    int64
+	Partial bool // an interrupted download that the next Pull resumes
+}
+
+// ListCache returns the files in ModelCacheDir, sorted by spec.
+func ListCache() ([]CachedFile, error) {
+	base, err := ModelCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	dirs, err := os.ReadDir(base)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []CachedFile
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(base, d.Name()))
+		if err != nil {
+			return nil, err
+		}
+		repo := specFromDir(filepath.Join(base, d.Name()))
+		for _, f := range files {
+			info, err := f.Info()
+			if err != nil || !info.Mode().IsRegular() || f.Name() == repoFileName {
+				continue
+			}
+			name, partial := strings.CutSuffix(f.Name(), ".part")
+			s := repo
+			s.File = name
+			out = append(out, CachedFile{
+				Spec: s, Path: filepath.Join(base, d.Name(), f.Name()), Size: info.Size(), Partial: partial,
+			})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Spec.String() < out[j].Spec.String() })
+	return out, nil
+}
+
+// repoFileName is the file in each repo directory that records the repo and revision
+// it caches. Directory names cannot be reversed: "a_b_c" may be "a_b/c" or "a/b_c".
+const repoFileName = ".qmd-repo.json"
+
+type repoFile struct {
+	Repo     string `json:"repo"`
+	Revision string `json:"revision,omitempty"`
+}
+
+// writeRepoFile records s's repo and revision in its cache directory.
+func writeRepoFile(s Spec) error {
+	path, err := s.LocalPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(repoFile{Repo: s.Repo, Revision: s.Revision})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(filepath.Dir(path), repoFileName), data, 0644)
+}
+
+// specFromDir returns the repo and revision cached in dir, from its repo file. Caches
+// written before there was one fall back to reversing the directory name, taking the
+// first underscore to be the slash of "org/name".
+func specFromDir(dir string) Spec {
+	if data, err := os.ReadFile(filepath.Join(dir, repoFileName)); err == nil {
+		var rf repoFile
+		if json.Unmarshal(data, &rf) == nil && rf.Repo != "" {
+			return Spec{Repo: rf.Repo, Revision: rf.Revision}
+		}
+	}
+	var s Spec
+	name := filepath.Base(dir)
+	if i := strings.LastIndex(name, "@"); i >= 0 {
+		name, s.Revision = name[:i], name[i+1:]
+	}
+	s.Repo = strings.Replace(name, "_", "/", 1)
+	return s
+}
+
+// RemoveCached deletes the cached file for s, along with any partial download, and
+// returns the bytes freed. It is an error if neither exists.
+func RemoveCached(s Spec) (int64, error) {
+	path, err := s.LocalPath()
+	if err != nil {
+		return 0, err
+	}
+	var freed int64
+	found := false
+	for _, p := range []string{path, path + ".part"} {
+		info, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		if err := os.Remove(p); err != nil {
+			return freed, err
+		}
+		found = true
+		freed += info.Size()
+	}
+	if !found {
+		return 0, fmt.Errorf("%s is not cached", s)
+	}
+	// Drop the repo directory once only its repo file is left.
+	dir := filepath.Dir(path)
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) == 1 && entries[0].Name() == repoFileName {
+		os.Remove(filepath.Join(dir, repoFileName))
+	}
+	os.Remove(dir) // only succeeds once the repo directory is empty
+	return freed, nil
+}
@@ -2,24 +2,65 @@ package huggingface
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // DefaultRevision is the default branch to resolve files from.
 const DefaultRevision = "main"
 
+// DefaultEndpoint is the Hugging Face Hub; HF_ENDPOINT points qmd at a mirror instead.
+const DefaultEndpoint = "https://huggingface.co"
+
+// ErrOffline is returned when a model is not cached and offline mode forbids fetching it.
+var ErrOffline = errors.New("offline mode (HF_HUB_OFFLINE) is on")
+
+// Endpoint returns the Hub base URL: HF_ENDPOINT, or DefaultEndpoint.
+func Endpoint() string {
+	if e := strings.TrimSpace(os.Getenv("HF_ENDPOINT")); e != "" {
+		return strings.TrimSuffix(e, "/")
+	}
+	return DefaultEndpoint
+}
+
+// Offline reports whether network access is disabled (HF_HUB_OFFLINE or QMD_OFFLINE set
+// to 1/true/yes). Cached models still resolve; anything else fails with ErrOffline.
+func Offline() bool {
+	for _, name := range []string{"HF_HUB_OFFLINE", "QMD_OFFLINE"} {
+		switch strings.ToLower(strings.TrimSpace(os.Getenv(name))) {
+		case "1", "true", "yes", "on":
+			return true
+		}
+	}
+	return false
+}
+
+// token is the access token for gated and private repos.
+func token() string {
+	if t := os.Getenv("HF_TOKEN"); t != "" {
+		return t
+	}
+	return os.Getenv("HUGGING_FACE_HUB_TOKEN")
+}
+
 // ResolveURL returns the direct download URL for a file in a Hugging Face repo.
 // repo is e.g. "ggml-org/embeddinggemma-300M-GGUF", revision e.g. "main", file e.g. "embeddinggemma-300M-Q8_0.gguf".
 func ResolveURL(repo, revision, file string) string {
 	if revision == "" {
 		revision = DefaultRevision
 	}
-	return fmt.Sprintf("https://huggingface.co/%s/resolve/%s/%s", strings.TrimPrefix(repo, "https://huggingface.co/"), revision, file)
+	return fmt.Sprintf("%s/%s/resolve/%s/%s", Endpoint(), strings.TrimPrefix(repo, "https://huggingface.co/"),
+		url.PathEscape(revision), file)
 }
 
 // ModelCacheDir returns the directory where GGUF models are cached (~/.cache/qmd/models or QMD_MODEL_CACHE).
@@ -40,86 +81,375 @@ func ModelCacheDir() (string, error) {
 
 // LocalPath returns the path where a repo/file would be cached.
 func LocalPath(repo, file string) (string, error) {
+	return Spec{Repo: repo, File: file}.LocalPath()
+}
+
+// Spec is a GGUF file in a Hugging Face repo, pinned to a revision (branch, tag or
+// commit; "" means DefaultRevision).
+type Spec struct {
+	Repo     string
+	Revision string
+	File     string
+}
+
+// ParseSpec parses a Hugging Face model spec:
+//   - "repo:file.gguf" or "hf:repo:file.gguf"
+//   - "org/repo/file.gguf" (last component is the file)
+//
+// Either form takes a revision after the repo: "repo@v1.0:file.gguf",
+// "org/repo@<commit>/file.gguf". ok is false for anything else, such as a local path.
+func ParseSpec(spec string) (s Spec, ok bool) {
+	spec = strings.TrimPrefix(strings.TrimSpace(spec), "hf:")
+	if !strings.HasSuffix(spec, ".gguf") {
+		return Spec{}, false
+	}
+	if i := strings.Index(spec, ":"); i >= 0 {
+		s.Repo, s.File = spec[:i], spec[i+1:]
+	} else if strings.Count(spec, "/") >= 2 && !filepath.IsAbs(spec) && !strings.HasPrefix(spec, ".") {
+		last := strings.LastIndex(spec, "/")
+		s.Repo, s.File = spec[:last], spec[last+1:]
+	}
+	if i := strings.LastIndex(s.Repo, "@"); i >= 0 {
+		s.Repo, s.Revision = s.Repo[:i], s.Repo[i+1:]
+	}
+	if s.Validate() != nil {
+		return Spec{}, false
+	}
+	return s, true
+}
+
+// Validate checks that the spec names a file inside a repo: a repo id of one or two
+// names ("org/repo"), a file path relative to the repo, and a revision, none with
+// empty, "." or ".." path elements or backslashes. Specs come from the command line
+// and config, and LocalPath joins them under the cache directory.
+func (s Spec) Validate() error {
+	for _, part := range []struct{ name, value string }{{"repo", s.Repo}, {"file", s.File}, {"revision", s.Revision}} {
+		if part.value == "" && part.name == "revision" {
+			continue
+		}
+		if part.value == "" || strings.Contains(part.value, `\`) {
+			return fmt.Errorf("invalid model spec %s: bad %s %q", s, part.name, part.value)
+		}
+		for _, elem := range strings.Split(part.value, "/") {
+			if elem == "" || elem == "." || elem == ".." {
+				return fmt.Errorf("invalid model spec %s: bad %s %q", s, part.name, part.value)
+			}
+		}
+	}
+	if strings.Count(s.Repo, "/") > 1 {
+		return fmt.Errorf("invalid model spec %s: repo %q is not org/name", s, s.Repo)
+	}
+	return nil
+}
+
+// String formats the spec as "repo[@revision]:file".
+func (s Spec) String() string {
+	if s.Revision != "" && s.Revision != DefaultRevision {
+		return s.Repo + "@" + s.Revision + ":" + s.File
+	}
+	return s.Repo + ":" + s.File
+}
+
+// URL is the file's download URL at the spec's revision.
+func (s Spec) URL() string {
+	return ResolveURL(s.Repo, s.Revision, s.File)
+}
+
+// LocalPath is where the file is cached: <cache>/<org>_<repo>/<file>, with
+// "@<revision>" appended to the directory for revisions other than DefaultRevision.
+// It is an error if the spec is invalid or the path would fall outside the cache.
+func (s Spec) LocalPath() (string, error) {
+	if err := s.Validate(); err != nil {
+		return "", err
+	}
 	base, err := ModelCacheDir()
 	if err != nil {
 		return "", err
 	}
-	// Sanitize repo for use as dir name
-	safeRepo := strings.ReplaceAll(repo, "/", "_")
-	return filepath.Join(base, safeRepo, file), nil
+	dir := s.dirName()
+	path := filepath.Join(base, dir, filepath.FromSlash(s.File))
+	if rel, err := filepath.Rel(filepath.Join(base, dir), path); err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("invalid model spec %s: %s is outside the model cache", s, path)
+	}
+	return path, nil
+}
+
+// dirName is the cache directory of the spec's repo and revision.
+func (s Spec) dirName() string {
+	dir := strings.ReplaceAll(s.Repo, "/", "_")
+	if s.Revision != "" && s.Revision != DefaultRevision {
+		dir += "@" + strings.ReplaceAll(s.Revision, "/", "_")
+	}
+	return dir
+}
+
+// Metadata is what the Hub reports about a file without downloading it.
+type Metadata struct {
+	Size   int64
+	SHA256 string // from the LFS pointer; "" for files not stored in LFS
+	Commit string // commit the revision resolved to
 }
 
-// Download fetches url to destPath. Creates parent dirs. Uses ctx for timeout/cancel.
-func Download(ctx context.Context, url, destPath string) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+// FetchMetadata asks the Hub (HEAD on the resolve URL) for the file's size, LFS sha256
+// and commit.
+func FetchMetadata(ctx context.Context, s Spec) (*Metadata, error) {
+	if Offline() {
+		return nil, fmt.Errorf("metadata for %s: %w", s, ErrOffline)
+	}
+	// The Hub answers LFS files with a redirect to the CDN that carries the LFS headers,
+	// so redirects are not followed, except a relative one (a renamed repo).
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	target := s.URL()
+	for hops := 0; ; hops++ {
+		req, err := newRequest(ctx, http.MethodHead, target)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+		loc := resp.Header.Get("Location")
+		if resp.StatusCode/100 == 3 && resp.Header.Get("X-Linked-Size") == "" && strings.HasPrefix(loc, "/") && hops < 3 {
+			target = Endpoint() + loc
+			continue
+		}
+		if resp.StatusCode != http.StatusOK && resp.StatusCode/100 != 3 {
+			return nil, statusError(s, resp)
+		}
+		m := &Metadata{Commit: resp.Header.Get("X-Repo-Commit")}
+		size := resp.Header.Get("X-Linked-Size")
+		if size == "" {
+			size = resp.Header.Get("Content-Length")
+		}
+		m.Size, _ = strconv.ParseInt(size, 10, 64)
+		if etag := strings.Trim(strings.TrimPrefix(resp.Header.Get("X-Linked-Etag"), "W/"), `"`); len(etag) == 64 {
+			m.SHA256 = strings.ToLower(etag)
+		}
+		return m, nil
+	}
+}
+
+func newRequest(ctx context.Context, method, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	req.Header.Set("User-Agent", "qmd/1.0")
-	resp, err := http.DefaultClient.Do(req)
+	if t := token(); t != "" {
+		req.Header.Set("Authorization", "Bearer "+t)
+	}
+	return req, nil
+}
+
+func statusError(s Spec, resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		if token() == "" {
+			return fmt.Errorf("%s: %s (gated or private repo: set HF_TOKEN)", s, resp.Status)
+		}
+		return fmt.Errorf("%s: %s (does HF_TOKEN have access to %s?)", s, resp.Status, s.Repo)
+	case http.StatusNotFound:
+		return fmt.Errorf("%s: not found at %s", s, s.URL())
+	}
+	return fmt.Errorf("%s: %s", s, resp.Status)
+}
+
+// Progress is called as a download advances with the bytes on disk so far and the
+// total size (0 if unknown).
+type Progress func(done, total int64)
+
+// Pull downloads s into the cache unless it is already there, and returns its path.
+// The download goes to a ".part" file that a later Pull resumes with an HTTP Range
+// request, and is checked against the LFS sha256 before being moved into place.
+func Pull(ctx context.Context, s Spec, progress Progress) (string, error) {
+	dest, err := s.LocalPath()
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(dest); err == nil {
+		return dest, nil
+	}
+	if Offline() {
+		return "", fmt.Errorf("%s is not cached (%s): %w", s, dest, ErrOffline)
+	}
+	meta, err := FetchMetadata(ctx, s)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", err
+	}
+	if err := writeRepoFile(s); err != nil {
+		return "", err
+	}
+	part := dest + ".part"
+	if err := download(ctx, s, part, meta.Size, progress); err != nil {
+		return "", err
+	}
+	if meta.SHA256 != "" {
+		sum, err := FileSHA256(part)
+		if err != nil {
+			return "", err
+		}
+		if sum != meta.SHA256 {
+			os.Remove(part)
+			return "", fmt.Errorf("%s: sha256 mismatch (got %s, want %s); the partial download was removed", s, sum, meta.SHA256)
+		}
+	}
+	return dest, os.Rename(part, dest)
+}
+
+// download fetches s into part, continuing from the bytes already there.
+func download(ctx context.Context, s Spec, part string, total int64, progress Progress) error {
+	f, err := os.OpenFile(part, os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("download %s: %s", url, resp.Status)
+	defer f.Close()
+	have, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
 	}
-	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+	if total > 0 && have > total {
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+		have, _ = f.Seek(0, io.SeekStart)
+	}
+	if total > 0 && have == total {
+		return nil
+	}
+
+	req, err := newRequest(ctx, http.MethodGet, s.URL())
+	if err != nil {
 		return err
 	}
-	f, err := os.Create(destPath)
+	if have > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", have))
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// No range support (or nothing to resume): start over.
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+		if have, err = f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		return nil // already complete; the checksum decides
+	default:
+		return statusError(s, resp)
+	}
+	if total <= 0 && resp.ContentLength > 0 {
+		total = have + resp.ContentLength
+	}
+
+	w := io.Writer(f)
+	if progress != nil {
+		progress(have, total)
+		w = &progressWriter{w: f, done: have, total: total, fn: progress}
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("download %s: %w", s, err)
+	}
+	if progress != nil {
+		st, _ := f.Stat()
+		progress(st.Size(), total)
+	}
+	return nil
+}
+
+type progressWriter struct {
+	w           io.Writer
+	done, total int64
+	fn          Progress
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.done += int64(n)
+	p.fn(p.done, p.total)
+	return n, err
+}
+
+// FileSHA256 returns the hex sha256 of the file at path.
+func FileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
 	defer f.Close()
-	_, err = io.Copy(f, resp.Body)
-	return err
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ProgressBar returns a Progress that draws a one-line bar for name on w, redrawn a few
+// times a second and finished with a newline once the download completes.
+func ProgressBar(w io.Writer, name string) Progress {
+	start := time.Now()
+	var last time.Time
+	var startDone int64 = -1
+	return func(done, total int64) {
+		if startDone < 0 {
+			startDone = done
+		}
+		complete := total > 0 && done >= total
+		if !complete && time.Since(last) < 200*time.Millisecond {
+			return
+		}
+		last = time.Now()
+		rate := float64(done-startDone) / max(time.Since(start).Seconds(), 0.001)
+		if total <= 0 {
+			fmt.Fprintf(w, "\r%s  %s  %s/s", name, formatSize(done), formatSize(int64(rate)))
+			return
+		}
+		const width = 30
+		filled := int(float64(width) * float64(done) / float64(total))
+		bar := strings.Repeat("=", filled) + strings.Repeat(" ", width-filled)
+		fmt.Fprintf(w, "\r%s [%s] %3d%%  %s / %s  %s/s ", name, bar, done*100/total,
+			formatSize(done), formatSize(total), formatSize(int64(rate)))
+		if complete {
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
 }
 
 // ResolveModel resolves model spec to a local GGUF path, downloading from Hugging Face if needed.
 // spec can be:
-//   - local path to a .gguf file (returned as-is; created if missing for later use)
-//   - "repo:file.gguf" (Hugging Face; download to cache)
-//   - "org/repo/file.gguf" (Hugging Face; last component is file)
+//   - local path to a .gguf file (returned as-is)
+//   - a Hugging Face spec accepted by ParseSpec (downloaded to the cache, with a
+//     progress bar on stderr)
 func ResolveModel(ctx context.Context, spec string) (string, error) {
-	spec = strings.TrimSpace(spec)
-	// Hugging Face: "repo:filename"
-	if idx := strings.Index(spec, ":"); idx >= 0 {
-		repo := strings.TrimPrefix(spec[:idx], "hf:")
-		file := spec[idx+1:]
-		if repo != "" && file != "" && strings.HasSuffix(file, ".gguf") {
-			dest, err := LocalPath(repo, file)
-			if err != nil {
-				return "", err
-			}
-			if _, err := os.Stat(dest); err == nil {
-				return dest, nil
-			}
-			url := ResolveURL(repo, DefaultRevision, file)
-			if err := Download(ctx, url, dest); err != nil {
-				return "", fmt.Errorf("download %s: %w", url, err)
-			}
-			return dest, nil
-		}
-	}
-	// Hugging Face: "org/repo/filename.gguf" (no colon; path with .gguf)
-	if strings.HasSuffix(spec, ".gguf") && strings.Count(spec, "/") >= 2 && !filepath.IsAbs(spec) && !strings.HasPrefix(spec, ".") {
-		last := strings.LastIndex(spec, "/")
-		repo := spec[:last]
-		file := spec[last+1:]
-		dest, err := LocalPath(repo, file)
+	if s, ok := ParseSpec(spec); ok {
+		path, err := Pull(ctx, s, ProgressBar(os.Stderr, "Downloading "+s.File))
 		if err != nil {
-			return "", err
-		}
-		if _, err := os.Stat(dest); err == nil {
-			return dest, nil
+			return "", fmt.Errorf("download %s: %w", s, err)
 		}
-		url := ResolveURL(repo, DefaultRevision, file)
-		if err := Download(ctx, url, dest); err != nil {
-			return "", fmt.Errorf("download %s: %w", url, err)
-		}
-		return dest, nil
+		return path, nil
 	}
-	// Local path
-	return spec, nil
+	return strings.TrimSpace(spec), nil
 }
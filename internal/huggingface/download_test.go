@@ -0,0 +1,208 @@
+package huggingface
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSpec(t *testing.T) {
+	for in, want := range map[string]Spec{
+		"ggml-org/embeddinggemma-300M-GGUF:model-Q8_0.gguf": {Repo: "ggml-org/embeddinggemma-300M-GGUF", File: "model-Q8_0.gguf"},
+		"hf:org/repo:model.gguf":                            {Repo: "org/repo", File: "model.gguf"},
+		"org/repo@v1.2:model.gguf":                          {Repo: "org/repo", Revision: "v1.2", File: "model.gguf"},
+		"org/repo/model.gguf":                               {Repo: "org/repo", File: "model.gguf"},
+		"org/repo@0123abcd/model.gguf":                      {Repo: "org/repo", Revision: "0123abcd", File: "model.gguf"},
+		"/models/local.gguf":                                {},
+		"./models/sub/local.gguf":                           {},
+		"nomic-embed-text":                                  {},
+		"repo:../../../x.gguf":                              {},
+		"..:x.gguf":                                         {},
+		"org/..:x.gguf":                                     {},
+		"org/repo@..:x.gguf":                                {},
+		"a/b/c:x.gguf":                                      {},
+		"/etc:x.gguf":                                       {},
+	} {
+		got, ok := ParseSpec(in)
+		if got != want || ok != (want.Repo != "") {
+			t.Errorf("ParseSpec(%q) = %+v, %v; want %+v", in, got, ok, want)
+		}
+	}
+}
+
+// fakeHub serves one LFS file the way the Hub does: HEAD on the resolve URL is a
+// redirect carrying X-Linked-* headers, and GET honours Range.
+func fakeHub(t *testing.T, content []byte, sha string) (*httptest.Server, *[]string) {
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gated/repo/resolve/main/m.gguf" && r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if !strings.HasSuffix(r.URL.Path, "/resolve/main/m.gguf") && !strings.HasSuffix(r.URL.Path, "/resolve/v2/m.gguf") {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == http.MethodHead {
+			w.Header().Set("X-Linked-Etag", `"`+sha+`"`)
+			w.Header().Set("X-Linked-Size", fmt.Sprint(len(content)))
+			w.Header().Set("X-Repo-Commit", "abc123")
+			w.Header().Set("Location", "https://cdn.example.com/blob")
+			w.WriteHeader(http.StatusFound)
+			return
+		}
+		ranges = append(ranges, r.Header.Get("Range"))
+		var from int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &from); err == nil {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", from, len(content)-1, len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+		}
+		w.Write(content[from:])
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &ranges
+}
+
+func TestPullResumesAndVerifies(t *testing.T) {
+	content := []byte(strings.Repeat("gguf-weights ", 1000))
+	sum := sha256.Sum256(content)
+	srv, ranges := fakeHub(t, content, hex.EncodeToString(sum[:]))
+	t.Setenv("HF_ENDPOINT", srv.URL+"/")
+	t.Setenv("QMD_MODEL_CACHE", t.TempDir())
+	t.Setenv("HF_HUB_OFFLINE", "")
+	t.Setenv("QMD_OFFLINE", "")
+	ctx := context.Background()
+
+	s, _ := ParseSpec("org/repo:m.gguf")
+	dest, _ := s.LocalPath()
+	os.MkdirAll(filepath.Dir(dest), 0755)
+	os.WriteFile(dest+".part", content[:4000], 0644)
+
+	var last int64
+	path, err := Pull(ctx, s, func(done, total int64) { last = done })
+	if err != nil || path != dest {
+		t.Fatalf("Pull = %q, %v", path, err)
+	}
+	if len(*ranges) != 1 || (*ranges)[0] != "bytes=4000-" {
+		t.Errorf("Requests sent Range %q, want one resume from 4000", *ranges)
+	}
+	if got, _ := os.ReadFile(dest); string(got) != string(content) || last != int64(len(content)) {
+		t.Errorf("Pulled %d bytes (progress %d), want %d", len(got), last, len(content))
+	}
+	if _, err := os.Stat(dest + ".part"); !os.IsNotExist(err) {
+		t.Errorf("Partial file left behind: %v", err)
+	}
+
+	files, err := ListCache()
+	if err != nil || len(files) != 1 || files[0].Spec != s || files[0].Size != int64(len(content)) {
+		t.Errorf("ListCache = %+v, %v", files, err)
+	}
+	meta, err := FetchMetadata(ctx, s)
+	if err != nil || meta.SHA256 != hex.EncodeToString(sum[:]) || meta.Commit != "abc123" {
+		t.Errorf("FetchMetadata = %+v, %v", meta, err)
+	}
+
+	// Cached files resolve offline; anything else is refused without a request.
+	t.Setenv("HF_HUB_OFFLINE", "1")
+	if path, err := ResolveModel(ctx, "org/repo:m.gguf"); err != nil || path != dest {
+		t.Errorf("Offline ResolveModel = %q, %v", path, err)
+	}
+	pinned, _ := ParseSpec("org/repo@v2:m.gguf")
+	if _, err := Pull(ctx, pinned, nil); !errors.Is(err, ErrOffline) {
+		t.Errorf("Offline Pull of uncached file = %v, want ErrOffline", err)
+	}
+	if len(*ranges) != 1 {
+		t.Errorf("Offline mode made %d requests", len(*ranges)-1)
+	}
+	t.Setenv("HF_HUB_OFFLINE", "")
+
+	if path, err := Pull(ctx, pinned, nil); err != nil || !strings.Contains(path, "org_repo@v2") {
+		t.Errorf("Pinned Pull = %q, %v", path, err)
+	}
+	if freed, err := RemoveCached(s); err != nil || freed != int64(len(content)) {
+		t.Errorf("RemoveCached = %d, %v", freed, err)
+	}
+	if _, err := RemoveCached(s); err == nil {
+		t.Error("Expected an error removing a file that is not cached")
+	}
+}
+
+func TestCacheStaysInside(t *testing.T) {
+	root := t.TempDir()
+	cache := filepath.Join(root, "models")
+	t.Setenv("QMD_MODEL_CACHE", cache)
+	outside := filepath.Join(root, "x.gguf")
+	os.WriteFile(outside, []byte("not a model"), 0644)
+
+	for _, s := range []Spec{
+		{Repo: "repo", File: "../../x.gguf"},
+		{Repo: "..", File: "x.gguf"},
+		{Repo: "org/repo", Revision: "../..", File: "x.gguf"},
+	} {
+		if p, err := s.LocalPath(); err == nil {
+			t.Errorf("LocalPath(%+v) = %q, want an error", s, p)
+		}
+		if _, err := RemoveCached(s); err == nil {
+			t.Errorf("RemoveCached(%+v) succeeded", s)
+		}
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Fatalf("File outside the cache was removed: %v", err)
+	}
+
+	// The repo file names the repo, which the directory name cannot for orgs with "_".
+	s := Spec{Repo: "my_org/model", Revision: "refs/pr/1", File: "m.gguf"}
+	dest, err := s.LocalPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(filepath.Dir(dest), 0755)
+	os.WriteFile(dest, []byte("weights"), 0644)
+	if err := writeRepoFile(s); err != nil {
+		t.Fatal(err)
+	}
+	files, err := ListCache()
+	if err != nil || len(files) != 1 || files[0].Spec != s {
+		t.Fatalf("ListCache = %+v, %v; want %+v", files, err, s)
+	}
+	if _, err := RemoveCached(s); err != nil {
+		t.Fatalf("RemoveCached = %v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(dest)); !os.IsNotExist(err) {
+		t.Errorf("Repo directory left behind: %v", err)
+	}
+}
+
+func TestPullChecksumMismatch(t *testing.T) {
+	srv, _ := fakeHub(t, []byte("tampered"), strings.Repeat("0", 64))
+	t.Setenv("HF_ENDPOINT", srv.URL)
+	t.Setenv("QMD_MODEL_CACHE", t.TempDir())
+	t.Setenv("HF_TOKEN", "")
+	t.Setenv("HF_HUB_OFFLINE", "")
+
+	s, _ := ParseSpec("org/repo:m.gguf")
+	if _, err := Pull(context.Background(), s, nil); err == nil || !strings.Contains(err.Error(), "sha256 mismatch") {
+		t.Errorf("Expected sha256 mismatch, got %v", err)
+	}
+	files, _ := ListCache()
+	if len(files) != 0 {
+		t.Errorf("Mismatched download kept: %+v", files)
+	}
+
+	gated, _ := ParseSpec("gated/repo:m.gguf")
+	if _, err := Pull(context.Background(), gated, nil); err == nil || !strings.Contains(err.Error(), "HF_TOKEN") {
+		t.Errorf("Expected a hint to set HF_TOKEN, got %v", err)
+	}
+	t.Setenv("HF_TOKEN", "secret")
+	if _, err := FetchMetadata(context.Background(), gated); err != nil {
+		t.Errorf("FetchMetadata with token = %v", err)
+	}
+}
@@ -0,0 +1,273 @@
+package indexer
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// IgnoreFiles are read from every directory of a collection, with gitignore syntax.
+// Rules in .qmdignore come after those in .gitignore, so it can re-include with "!".
+var IgnoreFiles = []string{".gitignore", ".qmdignore"}
+
+// Filter decides which files under a collection root belong to the collection: those
+// matching its pattern that are not excluded by its exclude list or by the ignore files
+// in the tree. It caches the ignore files it reads; Reset drops them. A Filter is not
+// safe for concurrent use.
+type Filter struct {
+	root    string
+	pattern string
+	exclude []ignoreRule
+	rules   map[string][]ignoreRule // ignore file rules by directory ("" is the root)
+	dirs    map[string]*ignoreRule  // last rule matching each directory, nil if none
+}
+
+// NewFilter returns the filter of a collection. exclude lists gitignore-style patterns
+// relative to root; they are applied after every ignore file, so they always win.
+func NewFilter(root, pattern string, exclude []string) (*Filter, error) {
+	f := &Filter{root: root, pattern: pattern}
+	for _, line := range exclude {
+		r, ok := parseIgnoreRule(line)
+		if !ok {
+			return nil, fmt.Errorf("invalid exclude pattern %q", line)
+		}
+		r.source = "config exclude"
+		f.exclude = append(f.exclude, r)
+	}
+	f.Reset()
+	return f, nil
+}
+
+// Reset forgets the ignore files read so far, for when one of them changed.
+func (f *Filter) Reset() {
+	f.rules = make(map[string][]ignoreRule)
+	f.dirs = make(map[string]*ignoreRule)
+}
+
+// ignoreRule is one line of an ignore file or exclude list.
+type ignoreRule struct {
+	source  string // where the rule came from, e.g. "notes/.gitignore:3"
+	text    string // the line as written
+	dir     string // directory the rule is relative to, "" for the root
+	glob    string // doublestar pattern for paths relative to dir
+	negate  bool
+	dirOnly bool
+}
+
+// parseIgnoreRule parses a line with gitignore syntax; ok is false for blank lines,
+// comments and patterns doublestar cannot match.
+func parseIgnoreRule(line string) (r ignoreRule, ok bool) {
+	line = strings.TrimSuffix(line, "\r")
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if line == "" || line[0] == '#' {
+		return r, false
+	}
+	r.text = line
+	switch {
+	case line[0] == '!':
+		r.negate = true
+		line = line[1:]
+	case strings.HasPrefix(line, `\!`), strings.HasPrefix(line, `\#`):
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	// A slash anywhere but the end anchors the pattern to the ignore file's directory;
+	// otherwise it matches at any depth below it.
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return r, false
+	}
+	if !anchored {
+		line = "**/" + line
+	}
+	if !doublestar.ValidatePattern(line) {
+		return r, false
+	}
+	r.glob = line
+	return r, true
+}
+
+func (r *ignoreRule) match(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.dir != "" {
+		if !strings.HasPrefix(rel, r.dir+"/") {
+			return false
+		}
+		rel = rel[len(r.dir)+1:]
+	}
+	// "dir/**" matches what is inside dir, not dir itself.
+	if base, ok := strings.CutSuffix(r.glob, "/**"); ok && rel == base {
+		return false
+	}
+	ok, _ := doublestar.Match(r.glob, rel)
+	return ok
+}
+
+func (r *ignoreRule) String() string {
+	return fmt.Sprintf("%q (%s)", r.text, r.source)
+}
+
+// dirRules returns the rules of the ignore files in dir, reading them on first use.
+func (f *Filter) dirRules(dir string) []ignoreRule {
+	if rules, ok := f.rules[dir]; ok {
+		return rules
+	}
+	var rules []ignoreRule
+	for _, name := range IgnoreFiles {
+		p := path.Join(dir, name)
+		file, err := os.Open(filepath.Join(f.root, filepath.FromSlash(p)))
+		if err != nil {
+			continue
+		}
+		sc := bufio.NewScanner(file)
+		for n := 1; sc.Scan(); n++ {
+			if r, ok := parseIgnoreRule(sc.Text()); ok {
+				r.source = fmt.Sprintf("%s:%d", p, n)
+				r.dir = dir
+				rules = append(rules, r)
+			}
+		}
+		file.Close()
+	}
+	f.rules[dir] = rules
+	return rules
+}
+
+// lastMatch returns the rule that decides rel, not counting excluded parent
+// directories: the last one matching it from the ignore files of the directories above
+// it, outermost first, then the exclude list. nil means no rule matches.
+func (f *Filter) lastMatch(rel string, isDir bool) *ignoreRule {
+	var last *ignoreRule
+	check := func(rules []ignoreRule) {
+		for i := range rules {
+			if rules[i].match(rel, isDir) {
+				last = &rules[i]
+			}
+		}
+	}
+	check(f.dirRules(""))
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		check(f.dirRules(strings.Join(parts[:i], "/")))
+	}
+	check(f.exclude)
+	return last
+}
+
+// excludedDir returns the rule excluding directory rel, or one of the directories
+// above it, and which directory that is.
+func (f *Filter) excludedDir(rel string) (*ignoreRule, string) {
+	parts := strings.Split(rel, "/")
+	for i := 1; i <= len(parts); i++ {
+		dir := strings.Join(parts[:i], "/")
+		r, ok := f.dirs[dir]
+		if !ok {
+			r = f.lastMatch(dir, true)
+			f.dirs[dir] = r
+		}
+		if r != nil && !r.negate {
+			return r, dir
+		}
+	}
+	return nil, ""
+}
+
+// Verdict says whether a path belongs to a collection, and why.
+type Verdict struct {
+	Included bool
+	Reason   string
+}
+
+// Explain decides whether the file or directory rel (slash-separated, relative to the
+// root) is part of the collection.
+func (f *Filter) Explain(rel string, isDir bool) Verdict {
+	rel = path.Clean(rel)
+	if rel == "." {
+		return Verdict{true, "collection root"}
+	}
+	if dir := path.Dir(rel); dir != "." {
+		// Like git, a file in an excluded directory cannot be re-included.
+		if r, d := f.excludedDir(dir); r != nil {
+			return Verdict{false, fmt.Sprintf("directory %s/ is excluded by %s", d, r)}
+		}
+	}
+	r := f.lastMatch(rel, isDir)
+	if r != nil && !r.negate {
+		return Verdict{false, "excluded by " + r.String()}
+	}
+	var note string
+	if r != nil {
+		note = ", re-included by " + r.String()
+	}
+	if isDir {
+		return Verdict{true, "directory is searched" + note}
+	}
+	if ok, _ := doublestar.Match(f.pattern, rel); !ok {
+		return Verdict{false, fmt.Sprintf("does not match pattern %q", f.pattern)}
+	}
+	return Verdict{true, fmt.Sprintf("matches pattern %q%s", f.pattern, note)}
+}
+
+// Includes reports whether the file rel is part of the collection.
+func (f *Filter) Includes(rel string) bool { return f.Explain(rel, false).Included }
+
+// ExcludesDir reports whether nothing below the directory rel can be part of the
+// collection, so it need not be walked or watched.
+func (f *Filter) ExcludesDir(rel string) bool { return !f.Explain(rel, true).Included }
+
+// Walk calls fn, in lexical order, for every file of the collection at or below the
+// directory dir ("." for the root). Excluded directories are not entered; symlinks to
+// directories are followed, each directory being walked once.
+func (f *Filter) Walk(dir string, fn func(rel string, info fs.FileInfo)) error {
+	dir = path.Clean(dir)
+	if dir != "." && f.ExcludesDir(dir) {
+		return nil
+	}
+	visited := make(map[string]bool)
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		full := filepath.Join(f.root, filepath.FromSlash(dir))
+		if real, err := filepath.EvalSymlinks(full); err == nil {
+			if visited[real] {
+				return nil
+			}
+			visited[real] = true
+		}
+		entries, err := os.ReadDir(full)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			rel := path.Join(dir, e.Name())
+			info, err := os.Stat(filepath.Join(full, e.Name())) // follows symlinks
+			if err != nil {
+				continue
+			}
+			if info.IsDir() {
+				if !f.ExcludesDir(rel) {
+					walk(rel) // unreadable subdirectories are skipped
+				}
+				continue
+			}
+			if f.Includes(rel) {
+				fn(rel, info)
+			}
+		}
+		return nil
+	}
+	return walk(dir)
+}
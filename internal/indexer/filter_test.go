@@ -0,0 +1,74 @@
+package indexer
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	root := t.TempDir()
+	write := func(rel, body string) {
+		p := filepath.Join(root, rel)
+		os.MkdirAll(filepath.Dir(p), 0755)
+		os.WriteFile(p, []byte(body), 0644)
+	}
+	for _, rel := range []string{
+		"a.md", "keep.log.md", "drafts/d.md", "notes/n.md", "notes/scratch.md",
+		"notes/sub/s.md", "notes/sub/build/b.md", "node_modules/pkg/readme.md",
+		"build/out.md", "docs/build/guide.md", "vendor/v.md", "vendor/keep/k.md",
+		"notes/private/p.md", "notes/private/public.md", "x.txt",
+	} {
+		write(rel, "#")
+	}
+	write(".gitignore", "# comment\n\n*.log.md\nnode_modules/\n/build\nvendor/*\n!vendor/keep/\n")
+	write(".qmdignore", "!keep.log.md\n")
+	write("notes/.gitignore", "scratch.md\nbuild/\nprivate/\n!private/public.md\n")
+
+	f, err := NewFilter(root, "**/*.md", []string{"drafts/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	if err := f.Walk(".", func(rel string, _ fs.FileInfo) { got = append(got, rel) }); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a.md", "docs/build/guide.md", "keep.log.md", "notes/n.md", "notes/sub/s.md", "vendor/keep/k.md"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Walk found %v, want %v", got, want)
+	}
+
+	for _, tc := range []struct {
+		rel      string
+		included bool
+		reason   string
+	}{
+		{"a.md", true, `matches pattern "**/*.md"`},
+		{"x.txt", false, `does not match pattern`},
+		{"keep.log.md", true, `re-included by "!keep.log.md" (.qmdignore:1)`},
+		{"drafts/d.md", false, `directory drafts/ is excluded by "drafts/" (config exclude)`},
+		{"build/out.md", false, `"/build" (.gitignore:5)`},
+		{"notes/scratch.md", false, `excluded by "scratch.md" (notes/.gitignore:1)`},
+		{"notes/sub/build/b.md", false, `directory notes/sub/build/ is excluded by "build/" (notes/.gitignore:2)`},
+		// A file in an excluded directory cannot be re-included.
+		{"notes/private/public.md", false, `directory notes/private/`},
+		{"vendor/v.md", false, `"vendor/*" (.gitignore:6)`},
+		{"vendor/keep/k.md", true, `matches pattern`},
+		{"node_modules/pkg/readme.md", false, `directory node_modules/ is excluded`},
+	} {
+		v := f.Explain(tc.rel, false)
+		if v.Included != tc.included || !strings.Contains(v.Reason, tc.reason) {
+			t.Errorf("Explain(%s) = %+v, want included=%v and reason containing %q", tc.rel, v, tc.included, tc.reason)
+		}
+	}
+	if v := f.Explain("vendor/keep", true); !v.Included || !strings.Contains(v.Reason, `re-included by "!vendor/keep/"`) {
+		t.Errorf("Explain(vendor/keep/) = %+v, want re-included", v)
+	}
+
+	if _, err := NewFilter(root, "**/*.md", []string{"[unclosed"}); err == nil {
+		t.Error("Expected an invalid exclude pattern to be rejected")
+	}
+}
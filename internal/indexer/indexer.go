@@ -1,22 +1,62 @@
 package indexer
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/ba0f3/qmd-go/internal/store"
-	"github.com/bmatcuk/doublestar/v4"
 )
 
-func IndexFiles(s *store.Store, collectionName, rootPath, pattern string) error {
-	fsys := os.DirFS(rootPath)
+// Options controls a collection pass of IndexFiles.
+type Options struct {
+	// Full reads every file, including those whose size, mtime and inode still match
+	// what was recorded when they were last indexed.
+	Full bool
+	// Jobs is how many files are read, hashed and chunked at once; 0 means one per CPU.
+	Jobs int
+	// Exclude lists gitignore-style patterns of files and directories to leave out, on
+	// top of the .gitignore and .qmdignore files in the tree (see NewFilter).
+	Exclude []string
+}
+
+// IndexFiles brings a collection in line with the files under rootPath that match
+// pattern and are not excluded, in a single transaction. Files whose stat is unchanged
+// since they were last indexed are not read, unless opts.Full is set.
+//
+// Files are read on opts.Jobs goroutines, but written in the order they were found,
+// so the resulting index does not depend on the number of jobs.
+func IndexFiles(s *store.Store, collectionName, rootPath, pattern string, opts Options) error {
+	filter, err := NewFilter(rootPath, pattern, opts.Exclude)
+	if err != nil {
+		return err
+	}
+	if err := ReparseIfStale(s); err != nil {
+		return err
+	}
 
 	now := time.Now()
 
-	// Use doublestar to find files
-	files, err := doublestar.Glob(fsys, pattern)
+	var files []foundFile
+	if err := filter.Walk(".", func(rel string, info fs.FileInfo) {
+		files = append(files, foundFile{rel, info})
+	}); err != nil {
+		return err
+	}
+
+	tx, err := s.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	active, err := tx.ActiveFiles(collectionName)
 	if err != nil {
 		return err
 	}
@@ -25,79 +65,355 @@ func IndexFiles(s *store.Store, collectionName, rootPath, pattern string) error
 	updatedCount := 0
 	seenPaths := make(map[string]bool)
 
-	for _, relPath := range files {
-		fullPath := filepath.Join(rootPath, relPath)
-		info, err := os.Stat(fullPath)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error stating file %s: %v\n", fullPath, err)
-			continue
+	scanFiles(rootPath, files, active, opts, func(sc scanned) {
+		seenPaths[sc.relPath] = true
+		switch writeFile(tx, collectionName, sc, now) {
+		case fileAdded:
+			indexedCount++
+		case fileUpdated:
+			updatedCount++
 		}
-		if info.IsDir() {
-			continue
+	})
+
+	// Handle deletions, including documents whose files are now excluded
+	removedCount := 0
+	for path := range active {
+		if !seenPaths[path] {
+			if err := tx.DeactivateDocument(collectionName, path); err != nil {
+				fmt.Fprintf(os.Stderr, "Error deactivating document %s: %v\n", path, err)
+				continue
+			}
+			removedCount++
 		}
+	}
 
-		seenPaths[relPath] = true
+	if indexedCount+updatedCount+removedCount > 0 {
+		resolveLinks(tx, collectionName)
+	}
 
-		contentBytes, err := os.ReadFile(fullPath)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading file %s: %v\n", fullPath, err)
-			continue
-		}
-		content := string(contentBytes)
-		hash := store.HashContent(content)
-		title := filepath.Base(relPath) // Simplified title extraction
-
-		// Check if exists
-		doc, err := s.FindActiveDocument(collectionName, relPath)
-		if err == nil {
-			// Update if changed
-			if doc.Hash != hash {
-				if err := s.InsertContent(hash, content, now); err != nil {
-					fmt.Fprintf(os.Stderr, "Error inserting content for %s: %v\n", relPath, err)
-					continue
-				}
-				if err := s.UpdateDocument(doc.ID, title, hash, now); err != nil {
-					fmt.Fprintf(os.Stderr, "Error updating document %s: %v\n", relPath, err)
-					continue
+	// Cleanup orphans
+	if _, err := tx.CleanupOrphanedContent(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error cleaning up orphans: %v\n", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Collection '%s': Indexed %d new, Updated %d, Removed %d.\n", collectionName, indexedCount, updatedCount, removedCount)
+	return nil
+}
+
+// ReparseIfStale re-derives front matter and links from the content already indexed
+// when it was indexed by an older qmd (see store.Reparse), reporting it on stderr. It
+// does the work once per index; afterwards it is a settings lookup.
+func ReparseIfStale(s *store.Store) error {
+	stale, err := s.NeedsReparse()
+	if err != nil || !stale {
+		return err
+	}
+	n, err := s.Reparse()
+	if err != nil {
+		return fmt.Errorf("re-reading indexed documents: %w", err)
+	}
+	if n > 0 {
+		fmt.Fprintf(os.Stderr, "Re-read the front matter and links of %d documents indexed by an older qmd.\n", n)
+	}
+	return nil
+}
+
+// foundFile is a file of the collection, as Filter.Walk found it.
+type foundFile struct {
+	relPath string
+	info    fs.FileInfo
+}
+
+// scanned is a file as read by a worker, ready for writeFile.
+type scanned struct {
+	relPath  string
+	fullPath string
+	info     fs.FileInfo
+	prev     *store.IndexedFile
+	stat     store.FileStat
+	hash     string
+	content  *store.Content // nil if the file was not read or its content is unchanged
+	err      error
+}
+
+// scanFiles reads, hashes and chunks files on opts.Jobs goroutines and passes the
+// results to write, in the order of files, on the calling goroutine: the only one that
+// touches the database. Only a few files per worker are in memory at a time.
+func scanFiles(rootPath string, files []foundFile, active map[string]store.IndexedFile, opts Options, write func(scanned)) {
+	jobs := opts.Jobs
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	type job struct {
+		foundFile
+		out chan<- scanned
+	}
+	work := make(chan job)
+	// Each file's result slot, queued in order before the file is handed to a worker.
+	order := make(chan chan scanned, 2*jobs)
+
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range work {
+				var prev *store.IndexedFile
+				if f, ok := active[j.relPath]; ok {
+					prev = &f
 				}
-				updatedCount++
+				j.out <- scanFile(rootPath, j.relPath, j.info, prev, opts.Full)
+			}
+		}()
+	}
+	go func() {
+		defer close(order)
+		defer close(work)
+		for _, f := range files {
+			out := make(chan scanned, 1)
+			order <- out
+			work <- job{f, out}
+		}
+	}()
+
+	for out := range order {
+		write(<-out)
+	}
+	wg.Wait()
+}
+
+type fileChange int
+
+const (
+	fileUnchanged fileChange = iota
+	fileAdded
+	fileUpdated
+	fileFailed
+)
+
+// racyWindow is how recently a file may have been modified for its stat not to be
+// recorded: a second write within the same mtime tick (2s on FAT) would leave size and
+// mtime as they were. Such files are read again by the next pass.
+const racyWindow = 2 * time.Second
+
+func fileStat(info fs.FileInfo) store.FileStat {
+	return store.FileStat{Size: info.Size(), Mtime: info.ModTime().UnixNano(), Inode: inode(info)}
+}
+
+// scanFile reads relPath unless, without full, its stat matches prev, its active
+// document. Content is only prepared if it differs from prev's.
+func scanFile(rootPath, relPath string, info fs.FileInfo, prev *store.IndexedFile, full bool) scanned {
+	sc := scanned{relPath: relPath, fullPath: filepath.Join(rootPath, relPath), info: info, prev: prev, stat: fileStat(info)}
+	if prev != nil && !full && prev.Stat.Known() && prev.Stat == sc.stat {
+		sc.hash = prev.Hash
+		return sc
+	}
+
+	contentBytes, err := os.ReadFile(sc.fullPath)
+	if err != nil {
+		sc.err = err
+		return sc
+	}
+	content := string(contentBytes)
+	sc.hash = store.HashContent(content)
+	if time.Since(info.ModTime()) < racyWindow {
+		sc.stat = store.FileStat{}
+	}
+	if prev == nil || prev.Hash != sc.hash {
+		sc.content = store.PrepareContent(sc.hash, content)
+	}
+	return sc
+}
+
+// writeFile adds a scanned file to the collection or updates its document. Errors are
+// reported on stderr, as IndexFiles carries on with the other files.
+func writeFile(tx *store.Tx, collectionName string, sc scanned, now time.Time) fileChange {
+	if sc.err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading file %s: %v\n", sc.fullPath, sc.err)
+		return fileFailed
+	}
+	relPath, prev := sc.relPath, sc.prev
+	if sc.content == nil {
+		if prev.Stat != sc.stat {
+			if err := tx.SetFileStat(prev.ID, sc.stat); err != nil {
+				fmt.Fprintf(os.Stderr, "Error updating document %s: %v\n", relPath, err)
 			}
-		} else {
-			// Insert new
-			if err := s.InsertContent(hash, content, now); err != nil {
-				fmt.Fprintf(os.Stderr, "Error inserting content for %s: %v\n", relPath, err)
+		}
+		return fileUnchanged
+	}
+	if sc.content.MetaErr != nil {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring front matter of %s: %v\n", relPath, sc.content.MetaErr)
+	}
+	title := sc.content.Title
+	if title == "" {
+		title = filepath.Base(relPath)
+	}
+
+	if prev != nil {
+		if err := tx.InsertContent(sc.content, now); err != nil {
+			fmt.Fprintf(os.Stderr, "Error inserting content for %s: %v\n", relPath, err)
+			return fileFailed
+		}
+		if err := tx.UpdateDocument(prev.ID, title, sc.hash, now, sc.stat); err != nil {
+			fmt.Fprintf(os.Stderr, "Error updating document %s: %v\n", relPath, err)
+			return fileFailed
+		}
+		setLinks(tx, collectionName, relPath, sc.content)
+		return fileUpdated
+	}
+	// Insert new
+	if err := tx.InsertContent(sc.content, now); err != nil {
+		fmt.Fprintf(os.Stderr, "Error inserting content for %s: %v\n", relPath, err)
+		return fileFailed
+	}
+	if err := tx.InsertDocument(collectionName, relPath, title, sc.hash, sc.info.ModTime(), now, sc.stat); err != nil {
+		fmt.Fprintf(os.Stderr, "Error inserting document %s: %v\n", relPath, err)
+		return fileFailed
+	}
+	setLinks(tx, collectionName, relPath, sc.content)
+	return fileAdded
+}
+
+// setLinks records the links of a written document. A failure leaves the document
+// indexed without them, so it is only reported.
+func setLinks(tx *store.Tx, collectionName, relPath string, content *store.Content) {
+	if err := tx.SetLinks(collectionName, relPath, content.Links); err != nil {
+		fmt.Fprintf(os.Stderr, "Error recording links of %s: %v\n", relPath, err)
+	}
+}
+
+// resolveLinks re-resolves the links of a collection that a pass can have changed.
+func resolveLinks(tx *store.Tx, collectionName string) {
+	if err := tx.ResolveLinks(collectionName); err != nil {
+		fmt.Fprintf(os.Stderr, "Error resolving links: %v\n", err)
+	}
+}
+
+// Changes is what IndexPaths did to a collection.
+type Changes struct {
+	Added, Updated, Removed int
+	Hashes                  []string // content of the added and updated documents
+}
+
+func (c Changes) Empty() bool { return c.Added+c.Updated+c.Removed == 0 }
+
+// IndexPaths re-indexes only the given paths of a collection (slash-separated and
+// relative to rootPath; "." is the whole root), as reported by a Watcher. A file is
+// indexed if the collection's Filter includes it; a directory is indexed recursively;
+// a path that no longer exists, or is now excluded, removes its document, or every
+// document below it if it was a directory.
+func IndexPaths(s *store.Store, collectionName, rootPath, pattern string, exclude []string, paths []string) (Changes, error) {
+	var c Changes
+	now := time.Now()
+	// A new filter each time, so edits to ignore files take effect.
+	filter, err := NewFilter(rootPath, pattern, exclude)
+	if err != nil {
+		return c, err
+	}
+	if err := ReparseIfStale(s); err != nil {
+		return c, err
+	}
+	tx, err := s.Begin()
+	if err != nil {
+		return c, err
+	}
+	defer tx.Rollback()
+
+	var active map[string]store.IndexedFile
+	removed := make(map[string]bool)
+	// removeMissing deactivates documents at or below prefix that were not seen.
+	removeMissing := func(prefix string, seen map[string]bool) error {
+		if active == nil {
+			var err error
+			if active, err = tx.ActiveFiles(collectionName); err != nil {
+				return err
+			}
+		}
+		for p := range active {
+			under := prefix == "." || p == prefix || strings.HasPrefix(p, prefix+"/")
+			if !under || seen[p] || removed[p] {
 				continue
 			}
-			if err := s.InsertDocument(collectionName, relPath, title, hash, info.ModTime(), now); err != nil {
-				fmt.Fprintf(os.Stderr, "Error inserting document %s: %v\n", relPath, err)
+			if err := tx.DeactivateDocument(collectionName, p); err != nil {
+				fmt.Fprintf(os.Stderr, "Error deactivating document %s: %v\n", p, err)
 				continue
 			}
-			indexedCount++
+			removed[p] = true
+			c.Removed++
+		}
+		return nil
+	}
+	index := func(relPath string, info fs.FileInfo, seen map[string]bool) {
+		seen[relPath] = true
+		f, ok, err := tx.ActiveFile(collectionName, relPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error looking up document %s: %v\n", relPath, err)
+			return
+		}
+		var prev *store.IndexedFile
+		if ok {
+			prev = &f
 		}
+		sc := scanFile(rootPath, relPath, info, prev, false)
+		switch writeFile(tx, collectionName, sc, now) {
+		case fileAdded:
+			c.Added++
+		case fileUpdated:
+			c.Updated++
+		default:
+			return
+		}
+		c.Hashes = append(c.Hashes, sc.hash)
 	}
 
-	// Handle deletions
-	activePaths, err := s.GetActiveDocumentPaths(collectionName)
-	removedCount := 0
-	if err == nil {
-		for _, path := range activePaths {
-			if !seenPaths[path] {
-				if err := s.DeactivateDocument(collectionName, path); err != nil {
-					fmt.Fprintf(os.Stderr, "Error deactivating document %s: %v\n", path, err)
-					continue
-				}
-				removedCount++
+	done := make(map[string]bool)
+	for _, p := range paths {
+		p = path.Clean(p)
+		if done[p] {
+			continue
+		}
+		done[p] = true
+		full := filepath.Join(rootPath, filepath.FromSlash(p))
+		info, err := os.Stat(full)
+		seen := make(map[string]bool)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			err = removeMissing(p, seen)
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "Error stating file %s: %v\n", full, err)
+			continue
+		case info.IsDir():
+			err = filter.Walk(p, func(rel string, info fs.FileInfo) {
+				index(rel, info, seen)
+			})
+			if err == nil {
+				err = removeMissing(p, seen)
 			}
+		default:
+			if filter.Includes(p) {
+				index(p, info, seen)
+			} else {
+				err = removeMissing(p, seen)
+			}
+		}
+		if err != nil {
+			return Changes{}, err
 		}
-	} else {
-		fmt.Fprintf(os.Stderr, "Error getting active documents: %v\n", err)
 	}
 
-	// Cleanup orphans
-	if _, err := s.CleanupOrphanedContent(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error cleaning up orphans: %v\n", err)
+	if !c.Empty() {
+		resolveLinks(tx, collectionName)
 	}
-
-	fmt.Printf("Collection '%s': Indexed %d new, Updated %d, Removed %d.\n", collectionName, indexedCount, updatedCount, removedCount)
-	return nil
+	if c.Removed > 0 || c.Updated > 0 {
+		if _, err := tx.CleanupOrphanedContent(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error cleaning up orphans: %v\n", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Changes{}, err
+	}
+	return c, nil
 }
@@ -1,8 +1,13 @@
 package indexer
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -33,7 +38,7 @@ func TestIndexFiles(t *testing.T) {
 	}
 	defer s.Close()
 
-	if err := IndexFiles(s, "testcol", tmpDir, "*.md"); err != nil {
+	if err := IndexFiles(s, "testcol", tmpDir, "*.md", Options{}); err != nil {
 		t.Fatalf("IndexFiles failed: %v", err)
 	}
 
@@ -42,16 +47,16 @@ func TestIndexFiles(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Document not found: %v", err)
 	}
-	if doc.Title != "test.md" {
-		t.Errorf("Expected title 'test.md', got '%s'", doc.Title)
+	if doc.Title != "Hello World" {
+		t.Errorf("Expected title 'Hello World', got '%s'", doc.Title)
 	}
 
-	// Update file
-	os.WriteFile(filepath.Join(tmpDir, "test.md"), []byte("# Hello World Updated"), 0644)
+	// Update file; a front matter title wins over the heading
+	os.WriteFile(filepath.Join(tmpDir, "test.md"), []byte("---\ntitle: Greeting\n---\n# Hello World Updated"), 0644)
 
 	// Re-index
 	time.Sleep(10 * time.Millisecond)
-	if err := IndexFiles(s, "testcol", tmpDir, "*.md"); err != nil {
+	if err := IndexFiles(s, "testcol", tmpDir, "*.md", Options{}); err != nil {
 		t.Fatalf("IndexFiles failed: %v", err)
 	}
 
@@ -60,13 +65,16 @@ func TestIndexFiles(t *testing.T) {
 	if doc2.Hash == doc.Hash {
 		t.Error("Hash should have changed")
 	}
+	if doc2.Title != "Greeting" {
+		t.Errorf("Expected title 'Greeting', got '%s'", doc2.Title)
+	}
 
 	// Delete file
 	os.Remove(filepath.Join(tmpDir, "test.md"))
 
 	// Re-index
 	time.Sleep(10 * time.Millisecond)
-	if err := IndexFiles(s, "testcol", tmpDir, "*.md"); err != nil {
+	if err := IndexFiles(s, "testcol", tmpDir, "*.md", Options{}); err != nil {
 		t.Fatalf("IndexFiles failed: %v", err)
 	}
 
@@ -76,3 +84,425 @@ func TestIndexFiles(t *testing.T) {
 		t.Error("Document should be deactivated")
 	}
 }
+
+func TestIndexFilesSkipsUnchanged(t *testing.T) {
+	root := t.TempDir()
+	s, err := store.NewStore(filepath.Join(t.TempDir(), "index.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Files modified within racyWindow are always read, so date them back.
+	old := time.Now().Add(-time.Hour)
+	write := func(rel, body string) {
+		p := filepath.Join(root, rel)
+		os.WriteFile(p, []byte(body), 0644)
+		os.Chtimes(p, old, old)
+	}
+	write("a.md", "# A")
+	write("b.md", "# B")
+	if err := IndexFiles(s, "col", root, "*.md", Options{}); err != nil {
+		t.Fatal(err)
+	}
+	hash := func(rel string) string {
+		doc, err := s.FindActiveDocument("col", rel)
+		if err != nil {
+			t.Fatalf("%s not indexed: %v", rel, err)
+		}
+		return doc.Hash
+	}
+	a := hash("a.md")
+
+	// Same size and mtime: the edit goes unnoticed without --full.
+	write("a.md", "# Z")
+	if err := IndexFiles(s, "col", root, "*.md", Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if hash("a.md") != a {
+		t.Error("a.md was re-read although its stat did not change")
+	}
+	if err := IndexFiles(s, "col", root, "*.md", Options{Full: true}); err != nil {
+		t.Fatal(err)
+	}
+	if hash("a.md") != store.HashContent("# Z") {
+		t.Error("Full pass did not pick up the edit to a.md")
+	}
+
+	// A changed mtime alone is enough to re-read.
+	os.WriteFile(filepath.Join(root, "b.md"), []byte("# Y"), 0644)
+	if err := IndexFiles(s, "col", root, "*.md", Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if hash("b.md") != store.HashContent("# Y") {
+		t.Error("b.md was not re-read after its mtime changed")
+	}
+}
+
+func TestIndexFilesModifiedFilter(t *testing.T) {
+	root := t.TempDir()
+	s, err := store.NewStore(filepath.Join(t.TempDir(), "index.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// old.md was last edited long before it is indexed; new.md just now.
+	edited := time.Date(2020, 5, 1, 12, 0, 0, 0, time.Local)
+	os.WriteFile(filepath.Join(root, "old.md"), []byte("# Old\n\nRelease notes."), 0644)
+	os.Chtimes(filepath.Join(root, "old.md"), edited, edited)
+	os.WriteFile(filepath.Join(root, "new.md"), []byte("# New\n\nRelease notes."), 0644)
+	if err := IndexFiles(s, "col", root, "*.md", Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	today := time.Now().Format("2006-01-02")
+	cases := map[string][]string{
+		"release modified:2020-05-01":   {"col/old.md"},
+		"release modified:<2021-01-01":  {"col/old.md"},
+		"release modified:>2021-01-01":  {"col/new.md"},
+		"release modified:" + today:     {"col/new.md"},
+		"release -modified:2020-05-01":  {"col/new.md"},
+		"release modified:>=2020-05-01": {"col/new.md", "col/old.md"},
+	}
+	for query, want := range cases {
+		results, err := s.SearchFTS(query, 10, "", nil)
+		if err != nil {
+			t.Fatalf("SearchFTS(%q) failed: %v", query, err)
+		}
+		var got []string
+		for _, r := range results {
+			got = append(got, r.DisplayPath)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("SearchFTS(%q) = %v, want %v", query, got, want)
+		}
+	}
+}
+
+func TestIndexFilesParallelDeterministic(t *testing.T) {
+	root := t.TempDir()
+	const n = 3000
+	for i := 0; i < n; i++ {
+		dir := filepath.Join(root, fmt.Sprintf("d%02d", i%37))
+		os.MkdirAll(dir, 0755)
+		// Every tenth file repeats another's body, so content is shared between documents,
+		// and every hundredth is long enough to span several chunks.
+		body := fmt.Sprintf("# Doc %d\n\nBody of document %d.\n", i, i)
+		if i%10 == 0 {
+			body = fmt.Sprintf("# Shared %d\n", i%50)
+		}
+		if i%100 == 1 {
+			body = strings.Repeat(body, 400)
+		}
+		os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%04d.md", i)), []byte(body), 0644)
+	}
+
+	// snapshot lists documents and chunks by row id, which follows write order.
+	snapshot := func(s *store.Store) string {
+		var b strings.Builder
+		for _, q := range []string{
+			`SELECT id || ' ' || path || ' ' || hash || ' ' || active FROM documents ORDER BY id`,
+			`SELECT id || ' ' || hash || ' ' || seq || ' ' || start_line FROM content_chunks ORDER BY id`,
+		} {
+			rows, err := s.DB.Query(q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for rows.Next() {
+				var line string
+				rows.Scan(&line)
+				b.WriteString(line + "\n")
+			}
+			rows.Close()
+		}
+		return b.String()
+	}
+	index := func(s *store.Store, jobs int) string {
+		if err := IndexFiles(s, "col", root, "**/*.md", Options{Jobs: jobs}); err != nil {
+			t.Fatal(err)
+		}
+		return snapshot(s)
+	}
+
+	stores := make([]*store.Store, 3)
+	for i := range stores {
+		s, err := store.NewStore(filepath.Join(t.TempDir(), "index.sqlite"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		stores[i] = s
+	}
+	jobs := []int{1, 8, 64}
+	check := func(step string) {
+		want := index(stores[0], jobs[0])
+		for i, s := range stores[1:] {
+			if got := index(s, jobs[i+1]); got != want {
+				t.Fatalf("%s: index with %d jobs differs from 1 job", step, jobs[i+1])
+			}
+		}
+	}
+	check("initial pass")
+
+	removed := 0
+	for i := 0; i < n; i += 7 {
+		p := filepath.Join(root, fmt.Sprintf("d%02d", i%37), fmt.Sprintf("f%04d.md", i))
+		if i%2 == 0 {
+			os.Remove(p)
+			removed++
+		} else {
+			os.WriteFile(p, []byte(fmt.Sprintf("# Edited %d\n", i)), 0644)
+		}
+	}
+	check("after edits")
+
+	var count int
+	stores[0].DB.QueryRow(`SELECT COUNT(*) FROM documents WHERE active = 1`).Scan(&count)
+	if want := n - removed; count != want {
+		t.Errorf("Active documents = %d, want %d", count, want)
+	}
+}
+
+func TestIndexFilesExclude(t *testing.T) {
+	root := t.TempDir()
+	s, err := store.NewStore(filepath.Join(t.TempDir(), "index.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for _, rel := range []string{"a.md", "drafts/d.md", "notes/n.md", "notes/tmp.md"} {
+		os.MkdirAll(filepath.Dir(filepath.Join(root, rel)), 0755)
+		os.WriteFile(filepath.Join(root, rel), []byte("# "+rel), 0644)
+	}
+	os.WriteFile(filepath.Join(root, "notes", ".gitignore"), []byte("tmp.md\n"), 0644)
+
+	active := func() string {
+		paths, _ := s.GetActiveDocumentPaths("col")
+		return strings.Join(sortedCopy(paths), ",")
+	}
+	if err := IndexFiles(s, "col", root, "**/*.md", Options{Exclude: []string{"drafts/"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := active(); got != "a.md,notes/n.md" {
+		t.Errorf("Indexed %s, want a.md and notes/n.md", got)
+	}
+
+	// Documents of files that become excluded are removed, by IndexPaths too.
+	if err := IndexFiles(s, "col", root, "**/*.md", Options{}); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(root, ".qmdignore"), []byte("notes/\n"), 0644)
+	if _, err := IndexPaths(s, "col", root, "**/*.md", []string{"drafts/"}, []string{"."}); err != nil {
+		t.Fatal(err)
+	}
+	if got := active(); got != "a.md" {
+		t.Errorf("Indexed %s after excluding notes/ and drafts/, want a.md", got)
+	}
+}
+
+func TestIndexPaths(t *testing.T) {
+	root := t.TempDir()
+	s, err := store.NewStore(filepath.Join(t.TempDir(), "index.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	write := func(rel, body string) {
+		os.MkdirAll(filepath.Dir(filepath.Join(root, rel)), 0755)
+		os.WriteFile(filepath.Join(root, rel), []byte(body), 0644)
+	}
+	write("a.md", "# A")
+	write("notes/b.md", "# B")
+	write("notes/deep/c.md", "# C")
+	write("notes/skip.txt", "not markdown")
+	if err := IndexFiles(s, "col", root, "**/*.md", Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the listed paths are looked at: d.md is new but not listed.
+	write("a.md", "# A changed\nSee [[b]].")
+	write("d.md", "# D")
+	write("e.md", "# E")
+	c, err := IndexPaths(s, "col", root, "**/*.md", nil, []string{"a.md", "e.md", "notes/skip.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Added != 1 || c.Updated != 1 || c.Removed != 0 || len(c.Hashes) != 2 {
+		t.Errorf("Changes = %+v, want 1 added, 1 updated", c)
+	}
+	if _, err := s.FindActiveDocument("col", "d.md"); err == nil {
+		t.Error("Unlisted d.md should not be indexed")
+	}
+	if back, err := s.Backlinks("col", "notes/b.md"); err != nil || len(back) != 1 {
+		t.Errorf("Expected a link from a.md to notes/b.md, got %+v (%v)", back, err)
+	}
+
+	// A directory moved away removes everything below it; one moved in is walked.
+	os.Rename(filepath.Join(root, "notes"), filepath.Join(root, "archive"))
+	c, err = IndexPaths(s, "col", root, "**/*.md", nil, []string{"notes", "archive"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Added != 2 || c.Removed != 2 {
+		t.Errorf("Changes after moving notes/ = %+v, want 2 added, 2 removed", c)
+	}
+	for path, want := range map[string]bool{"notes/b.md": false, "archive/deep/c.md": true, "archive/skip.txt": false} {
+		if _, err := s.FindActiveDocument("col", path); (err == nil) != want {
+			t.Errorf("%s active = %v, want %v", path, err == nil, want)
+		}
+	}
+	// Links follow the file they point to.
+	if from, err := s.LinksFrom("col", "a.md"); err != nil || len(from) != 1 || from[0].Resolved != "archive/b.md" {
+		t.Errorf("Expected [[b]] resolved to archive/b.md, got %+v (%v)", from, err)
+	}
+
+	// "." rescans the whole root.
+	if c, err := IndexPaths(s, "col", root, "**/*.md", nil, []string{"."}); err != nil || c.Added != 1 {
+		t.Errorf("Rescan = %+v, %v; want d.md added", c, err)
+	}
+
+	// A file deleted while another document has its content keeps an inactive row; the
+	// file re-created is indexed again.
+	write("twin.md", "# D")
+	if _, err := IndexPaths(s, "col", root, "**/*.md", nil, []string{"twin.md"}); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(filepath.Join(root, "twin.md"))
+	if c, err := IndexPaths(s, "col", root, "**/*.md", nil, []string{"twin.md"}); err != nil || c.Removed != 1 {
+		t.Fatalf("Removing twin.md = %+v, %v", c, err)
+	}
+	write("twin.md", "# D")
+	if c, err := IndexPaths(s, "col", root, "**/*.md", nil, []string{"twin.md"}); err != nil || c.Added != 1 {
+		t.Errorf("Re-creating twin.md = %+v, %v; want it added", c, err)
+	}
+	if doc, err := s.FindActiveDocument("col", "twin.md"); err != nil || doc.Title != "D" {
+		t.Errorf("Expected twin.md active again, got %+v (%v)", doc, err)
+	}
+	if results, err := s.SearchFTS("title:d", 10, "", nil); err != nil || len(results) != 2 {
+		t.Errorf("Expected d.md and twin.md to be searchable, got %d results (%v)", len(results), err)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	root := t.TempDir()
+	os.Mkdir(filepath.Join(root, "notes"), 0755)
+	w, err := NewWatcher([]WatchRoot{{Collection: "col", Path: root, Pattern: "**/*.md", Exclude: []string{"drafts/"}}}, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	batches := make(chan map[string][]string, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx, func(b map[string][]string) { batches <- b })
+
+	// A burst of writes arrives as one batch; files outside the pattern and excluded
+	// directories are ignored.
+	os.WriteFile(filepath.Join(root, "notes", "a.md"), []byte("# A"), 0644)
+	os.WriteFile(filepath.Join(root, "notes", "a.md"), []byte("# A again"), 0644)
+	os.WriteFile(filepath.Join(root, "b.txt"), []byte("b"), 0644)
+	os.Mkdir(filepath.Join(root, "new"), 0755)
+	os.Mkdir(filepath.Join(root, "drafts"), 0755)
+	select {
+	case b := <-batches:
+		got := strings.Join(sortedCopy(b["col"]), ",")
+		if got != "new,notes/a.md" {
+			t.Errorf("Batch = %v, want new and notes/a.md", b)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No batch delivered")
+	}
+
+	// The new directory is watched too.
+	os.WriteFile(filepath.Join(root, "new", "c.md"), []byte("# C"), 0644)
+	select {
+	case b := <-batches:
+		if strings.Join(b["col"], ",") != "new/c.md" {
+			t.Errorf("Batch = %v, want new/c.md", b)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No batch for a file in a new directory")
+	}
+
+	// Editing an ignore file rescans its directory.
+	os.WriteFile(filepath.Join(root, "notes", ".qmdignore"), []byte("a.md\n"), 0644)
+	select {
+	case b := <-batches:
+		if strings.Join(b["col"], ",") != "notes" {
+			t.Errorf("Batch = %v, want notes", b)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No batch for an ignore file")
+	}
+}
+
+func TestWatcherSharedRoots(t *testing.T) {
+	root := t.TempDir()
+	for _, d := range []string{"sub", ".obsidian", ".git"} {
+		os.Mkdir(filepath.Join(root, d), 0755)
+	}
+	w, err := NewWatcher([]WatchRoot{
+		{Collection: "md", Path: root, Pattern: "**/*.md"},
+		{Collection: "all", Path: root, Pattern: "**/*"},
+		{Collection: "sub", Path: filepath.Join(root, "sub"), Pattern: "**/*.md"},
+	}, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	batches := make(chan map[string][]string, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx, func(b map[string][]string) { batches <- b })
+
+	// Every collection containing a file gets the event, dot directories other than .git
+	// included, as update indexes them.
+	os.WriteFile(filepath.Join(root, "sub", "a.md"), []byte("# A"), 0644)
+	os.WriteFile(filepath.Join(root, "b.txt"), []byte("b"), 0644)
+	os.WriteFile(filepath.Join(root, ".obsidian", "c.md"), []byte("# C"), 0644)
+	os.WriteFile(filepath.Join(root, ".git", "d.md"), []byte("# D"), 0644)
+	want := map[string]string{
+		"md":  ".obsidian/c.md,sub/a.md",
+		"all": ".obsidian/c.md,b.txt,sub/a.md",
+		"sub": "a.md",
+	}
+	seen := make(map[string]map[string]bool)
+	got := func() map[string]string {
+		out := make(map[string]string)
+		for c, paths := range seen {
+			var l []string
+			for p := range paths {
+				l = append(l, p)
+			}
+			out[c] = strings.Join(sortedCopy(l), ",")
+		}
+		return out
+	}
+	deadline := time.After(5 * time.Second)
+	for !reflect.DeepEqual(got(), want) {
+		select {
+		case b := <-batches:
+			for c, paths := range b {
+				if seen[c] == nil {
+					seen[c] = make(map[string]bool)
+				}
+				for _, p := range paths {
+					seen[c][p] = true
+				}
+			}
+		case <-deadline:
+			t.Fatalf("Batches = %v, want %v", got(), want)
+		}
+	}
+}
+
+func sortedCopy(s []string) []string {
+	out := append([]string(nil), s...)
+	sort.Strings(out)
+	return out
+}
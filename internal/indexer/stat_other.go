@@ -0,0 +1,8 @@
+//go:build !unix
+
+package indexer
+
+import "io/fs"
+
+// inode is not available from os.Stat here; size and mtime still detect changes.
+func inode(info fs.FileInfo) uint64 { return 0 }
@@ -0,0 +1,225 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// WatchRoot is a collection directory for a Watcher.
+type WatchRoot struct {
+	Collection string
+	Path       string
+	Pattern    string
+	Exclude    []string
+}
+
+// Watcher reports changes below collection roots in debounced batches of paths,
+// suitable for IndexPaths.
+type Watcher struct {
+	fs       *fsnotify.Watcher
+	roots    []watchedRoot
+	debounce time.Duration
+}
+
+type watchedRoot struct {
+	WatchRoot
+	filter *Filter
+}
+
+// NewWatcher watches every directory below the roots that their collections search,
+// which leaves out .git and excluded directories such as node_modules. debounce is how long the file system must be quiet
+// before a batch is delivered.
+func NewWatcher(roots []WatchRoot, debounce time.Duration) (*Watcher, error) {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher{fs: fw, debounce: debounce}
+	for _, r := range roots {
+		abs, err := filepath.Abs(r.Path)
+		if err != nil {
+			fw.Close()
+			return nil, err
+		}
+		r.Path = abs
+		filter, err := NewFilter(abs, r.Pattern, r.Exclude)
+		if err != nil {
+			fw.Close()
+			return nil, fmt.Errorf("collection %s: %w", r.Collection, err)
+		}
+		wr := watchedRoot{r, filter}
+		w.roots = append(w.roots, wr)
+		if err := w.addTree(wr, abs); err != nil {
+			fw.Close()
+			return nil, fmt.Errorf("watch %s: %w", r.Path, err)
+		}
+	}
+	return w, nil
+}
+
+func (w *Watcher) Close() error { return w.fs.Close() }
+
+// addTree watches dir and the directories below it.
+func (w *Watcher) addTree(r watchedRoot, dir string) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == dir {
+				return err
+			}
+			return nil // vanished or unreadable subdirectory
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if rel, err := filepath.Rel(r.Path, p); err == nil && rel != "." && r.filter.ExcludesDir(filepath.ToSlash(rel)) {
+			return filepath.SkipDir
+		}
+		return w.fs.Add(p)
+	})
+}
+
+// rootMatch is a root containing a path, with the path relative to it.
+type rootMatch struct {
+	watchedRoot
+	rel string // slash-separated
+}
+
+// matchRoots returns every root containing p. Collections can share a directory with
+// different patterns, or be nested, so an event can concern several of them.
+func (w *Watcher) matchRoots(p string) []rootMatch {
+	var out []rootMatch
+	for _, r := range w.roots {
+		rel, err := filepath.Rel(r.Path, p)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		out = append(out, rootMatch{r, filepath.ToSlash(rel)})
+	}
+	return out
+}
+
+// relevant reports whether an event at rel can change the collection: a file the
+// filter includes, a directory appearing, or any removal or rename (which may be a
+// directory that held included files).
+func relevant(r watchedRoot, rel string, ev fsnotify.Event, isDir bool) bool {
+	if ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename) {
+		return true
+	}
+	if isDir {
+		return ev.Has(fsnotify.Create) && !r.filter.ExcludesDir(rel)
+	}
+	if !ev.Has(fsnotify.Create) && !ev.Has(fsnotify.Write) {
+		return false // chmod only
+	}
+	return r.filter.Includes(rel)
+}
+
+// handle updates the watches and filter of a root for an event below it, and returns
+// the path the collection must rescan, if any.
+func (w *Watcher) handle(m rootMatch, ev fsnotify.Event, isDir bool) (string, bool) {
+	if m.rel == "." {
+		return "", false
+	}
+	if isIgnoreFile(path.Base(m.rel)) {
+		// What the directory holds may now be in or out of the collection; newly
+		// included subdirectories need watching too.
+		m.filter.Reset()
+		dir := filepath.Dir(ev.Name)
+		if err := w.addTree(m.watchedRoot, dir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error watching %s: %v\n", dir, err)
+		}
+		return path.Dir(m.rel), true
+	}
+	if isDir && ev.Has(fsnotify.Create) {
+		if filepath.Base(ev.Name) == ".git" || m.filter.ExcludesDir(m.rel) {
+			return "", false
+		}
+		// Files created before the watch was added are picked up by IndexPaths
+		// walking the new directory.
+		if err := w.addTree(m.watchedRoot, ev.Name); err != nil {
+			fmt.Fprintf(os.Stderr, "Error watching %s: %v\n", ev.Name, err)
+		}
+	}
+	return m.rel, relevant(m.watchedRoot, m.rel, ev, isDir)
+}
+
+func isIgnoreFile(name string) bool {
+	for _, f := range IgnoreFiles {
+		if name == f {
+			return true
+		}
+	}
+	return false
+}
+
+// Run delivers batches of changed paths, by collection, to onBatch until ctx is done.
+// A batch is sent once no event has arrived for the debounce interval. If the kernel
+// drops events, the next batch asks for the whole root (".") to be rescanned.
+func (w *Watcher) Run(ctx context.Context, onBatch func(map[string][]string)) error {
+	pending := make(map[string]map[string]bool)
+	add := func(collection, rel string) {
+		if pending[collection] == nil {
+			pending[collection] = make(map[string]bool)
+		}
+		pending[collection][rel] = true
+	}
+	timer := time.NewTimer(w.debounce)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-w.fs.Events:
+			if !ok {
+				return nil
+			}
+			matches := w.matchRoots(ev.Name)
+			if len(matches) == 0 {
+				continue
+			}
+			info, err := os.Lstat(ev.Name)
+			isDir := err == nil && info.IsDir()
+			for _, m := range matches {
+				if rel, ok := w.handle(m, ev, isDir); ok {
+					add(m.Collection, rel)
+					timer.Reset(w.debounce)
+				}
+			}
+		case err, ok := <-w.fs.Errors:
+			if !ok {
+				return nil
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				for _, r := range w.roots {
+					add(r.Collection, ".")
+				}
+				timer.Reset(w.debounce)
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "Watch error: %v\n", err)
+		case <-timer.C:
+			batch := make(map[string][]string, len(pending))
+			for collection, paths := range pending {
+				for p := range paths {
+					batch[collection] = append(batch[collection], p)
+				}
+			}
+			pending = make(map[string]map[string]bool)
+			onBatch(batch)
+		}
+	}
+}
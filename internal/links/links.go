@@ -0,0 +1,203 @@
+// Package links finds [[wikilinks]], ![[embeds]] and relative markdown links in a note
+// and resolves them to the files of its collection.
+package links
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Kinds of link.
+const (
+	Wiki     = "wiki"     // [[target]] or [[target|label]]
+	Embed    = "embed"    // ![[target]]
+	Markdown = "markdown" // [label](relative/path.md)
+)
+
+// Link is a reference from a note to another file.
+type Link struct {
+	Kind     string
+	Target   string // as written, without the #fragment or |label
+	Fragment string // heading or ^block after #, if any
+	Label    string
+	Line     int // 1-based
+}
+
+var (
+	wikiLink     = regexp.MustCompile(`(!?)\[\[([^\[\]\n]+)\]\]`)
+	markdownLink = regexp.MustCompile(`(!?)\[((?:[^\[\]]|\[[^\[\]]*\])*)\]\(\s*(<[^>\n]+>|[^\s()]+(?:\([^\s()]*\)[^\s()]*)*)(?:\s+(?:"[^"]*"|'[^']*'))?\s*\)`)
+	inlineCode   = regexp.MustCompile("`+[^`\n]*`+")
+	urlScheme    = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+.-]*:`)
+)
+
+// Extract returns the links of content in order. Links in fenced code blocks and inline
+// code are not links. Markdown images, external URLs and links within the note (#heading)
+// are left out.
+func Extract(content string) []Link {
+	var out []Link
+	fence := ""
+	for i, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+		if !strings.Contains(line, "[") {
+			continue
+		}
+		line = inlineCode.ReplaceAllStringFunc(line, func(s string) string { return strings.Repeat(" ", len(s)) })
+
+		for _, m := range wikiLink.FindAllStringSubmatch(line, -1) {
+			l := Link{Kind: Wiki, Line: i + 1}
+			if m[1] != "" {
+				l.Kind = Embed
+			}
+			target, label, _ := strings.Cut(m[2], "|")
+			target, l.Fragment, _ = strings.Cut(target, "#")
+			l.Target, l.Label = strings.TrimSpace(target), strings.TrimSpace(label)
+			l.Fragment = strings.TrimSpace(l.Fragment)
+			if l.Target != "" {
+				out = append(out, l)
+			}
+		}
+		// Wikilinks were taken; blank them so [[a]](b) is not also read as markdown.
+		line = wikiLink.ReplaceAllStringFunc(line, func(s string) string { return strings.Repeat(" ", len(s)) })
+		for _, m := range markdownLink.FindAllStringSubmatch(line, -1) {
+			if m[1] != "" {
+				continue // image
+			}
+			dest := strings.TrimSuffix(strings.TrimPrefix(m[3], "<"), ">")
+			if dest == "" || dest[0] == '#' || urlScheme.MatchString(dest) || strings.HasPrefix(dest, "//") {
+				continue
+			}
+			target, fragment, _ := strings.Cut(dest, "#")
+			target, _, _ = strings.Cut(target, "?")
+			if t, err := url.PathUnescape(target); err == nil {
+				target = t
+			}
+			out = append(out, Link{Kind: Markdown, Target: target, Fragment: fragment, Label: strings.TrimSpace(m[2]), Line: i + 1})
+		}
+	}
+	return out
+}
+
+// IsAttachment reports whether target names a file other than a note, such as an image
+// or a PDF, by its extension. qmd does not index those, so a link to one resolving to no
+// document is not broken.
+func IsAttachment(target string) bool {
+	ext := strings.ToLower(path.Ext(target))
+	if len(ext) < 2 || len(ext) > 6 || ext == ".md" || ext == ".markdown" {
+		return false
+	}
+	for _, r := range ext[1:] {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return ext[1] >= 'a' && ext[1] <= 'z'
+}
+
+// Resolver resolves links against the files of a collection. Matching ignores case, as
+// on the file systems notes are usually kept on.
+type Resolver struct {
+	paths map[string]string   // lowercased path to path
+	names map[string][]string // lowercased base name, with and without extension, to paths
+}
+
+// NewResolver returns a resolver for a collection with the given paths (slash-separated,
+// relative to its root).
+func NewResolver(paths []string) *Resolver {
+	r := &Resolver{paths: make(map[string]string, len(paths)), names: make(map[string][]string)}
+	for _, p := range paths {
+		r.paths[strings.ToLower(p)] = p
+		for _, name := range Names(p) {
+			r.names[name] = append(r.names[name], p)
+		}
+	}
+	return r
+}
+
+// Names returns the names a link can call the file at p by: its lowercased base name,
+// with and without its extension.
+func Names(p string) []string {
+	base := path.Base(strings.ToLower(p))
+	if ext := path.Ext(base); ext != "" && ext != base {
+		return []string{base, strings.TrimSuffix(base, ext)}
+	}
+	return []string{base}
+}
+
+// Name is the name a link calls its target by, lowercased. A link can only resolve to
+// a file that has it among its Names, so a new file changes only the links named like it.
+func (l Link) Name() string {
+	target := strings.ToLower(strings.Trim(l.Target, "/"))
+	if l.Kind == Markdown {
+		target = path.Clean(target)
+	}
+	return path.Base(target)
+}
+
+// Resolve returns the path a link from source points to. Markdown links are relative to
+// source's directory (or to the root if they start with /). Wikilinks name a file, with
+// or without its extension and optionally with some of its directories, anywhere in the
+// collection; if several files match, the one in source's directory wins, then the one
+// with the shortest path.
+func (r *Resolver) Resolve(source string, l Link) (string, bool) {
+	if l.Kind == Markdown {
+		var p string
+		if strings.HasPrefix(l.Target, "/") {
+			p = path.Clean(strings.TrimLeft(l.Target, "/"))
+		} else {
+			p = path.Join(path.Dir(source), l.Target)
+		}
+		if p == ".." || strings.HasPrefix(p, "../") {
+			return "", false
+		}
+		for _, candidate := range []string{p, p + ".md"} {
+			if found, ok := r.paths[strings.ToLower(candidate)]; ok {
+				return found, true
+			}
+		}
+		return "", false
+	}
+
+	target := strings.ToLower(strings.Trim(l.Target, "/"))
+	if found, ok := r.paths[target]; ok {
+		return found, true
+	}
+	if found, ok := r.paths[target+".md"]; ok {
+		return found, true
+	}
+	dir, name := path.Split(target)
+	var matches []string
+	for _, p := range r.names[name] {
+		pd := path.Dir(strings.ToLower(p)) + "/"
+		if dir == "" || pd == dir || strings.HasSuffix(pd, "/"+dir) {
+			matches = append(matches, p)
+		}
+	}
+	if len(matches) == 0 {
+		return "", false
+	}
+	sourceDir := path.Dir(source)
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if sa, sb := path.Dir(a) == sourceDir, path.Dir(b) == sourceDir; sa != sb {
+			return sa
+		}
+		if na, nb := strings.Count(a, "/"), strings.Count(b, "/"); na != nb {
+			return na < nb
+		}
+		return a < b
+	})
+	return matches[0], true
+}
@@ -0,0 +1,83 @@
+package links
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	content := "# Index\n" +
+		"See [[Deploy Runbook]] and [[ops/Release#Rollback|rolling back]].\n" +
+		"![[diagram.png]] and [setup](../setup/install.md#linux \"Install\").\n" +
+		"Ignore `[[code]]`, [site](https://example.com), [top](#index) and ![img](pic.png).\n" +
+		"```\n[[fenced]]\n```\n" +
+		"[spaces](<My Note.md>) [escaped](My%20Other.md?x=1)\n"
+	want := []Link{
+		{Kind: Wiki, Target: "Deploy Runbook", Line: 2},
+		{Kind: Wiki, Target: "ops/Release", Fragment: "Rollback", Label: "rolling back", Line: 2},
+		{Kind: Embed, Target: "diagram.png", Line: 3},
+		{Kind: Markdown, Target: "../setup/install.md", Fragment: "linux", Label: "setup", Line: 3},
+		{Kind: Markdown, Target: "My Note.md", Label: "spaces", Line: 8},
+		{Kind: Markdown, Target: "My Other.md", Label: "escaped", Line: 8},
+	}
+	if got := Extract(content); !reflect.DeepEqual(got, want) {
+		t.Errorf("Extract =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	r := NewResolver([]string{
+		"index.md",
+		"Deploy Runbook.md",
+		"ops/Release.md",
+		"archive/ops/Release.md",
+		"journal/2025/note.md",
+		"journal/note.md",
+		"setup/install.md",
+		"diagram.png",
+	})
+	for _, tt := range []struct {
+		source string
+		link   Link
+		want   string
+	}{
+		{"index.md", Link{Kind: Wiki, Target: "deploy runbook"}, "Deploy Runbook.md"},
+		{"index.md", Link{Kind: Wiki, Target: "Deploy Runbook.md"}, "Deploy Runbook.md"},
+		{"index.md", Link{Kind: Wiki, Target: "ops/Release"}, "ops/Release.md"},
+		{"index.md", Link{Kind: Wiki, Target: "Release"}, "ops/Release.md"},
+		{"archive/ops/x.md", Link{Kind: Wiki, Target: "Release"}, "archive/ops/Release.md"},
+		{"journal/2025/x.md", Link{Kind: Wiki, Target: "note"}, "journal/2025/note.md"},
+		{"index.md", Link{Kind: Wiki, Target: "note"}, "journal/note.md"},
+		{"index.md", Link{Kind: Wiki, Target: "2025/note"}, "journal/2025/note.md"},
+		{"index.md", Link{Kind: Embed, Target: "diagram.png"}, "diagram.png"},
+		{"index.md", Link{Kind: Wiki, Target: "Missing"}, ""},
+		{"journal/note.md", Link{Kind: Markdown, Target: "../setup/install.md"}, "setup/install.md"},
+		{"journal/note.md", Link{Kind: Markdown, Target: "/setup/install"}, "setup/install.md"},
+		{"journal/note.md", Link{Kind: Markdown, Target: "install.md"}, ""},
+		{"index.md", Link{Kind: Markdown, Target: "../outside.md"}, ""},
+	} {
+		got, ok := r.Resolve(tt.source, tt.link)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("Resolve(%s, %s %q) = %q, %v; want %q", tt.source, tt.link.Kind, tt.link.Target, got, ok, tt.want)
+		}
+		if ok && !slices.Contains(Names(got), tt.link.Name()) {
+			t.Errorf("%s link %q resolves to %s, but its name %q is not among %v", tt.link.Kind, tt.link.Target, got, tt.link.Name(), Names(got))
+		}
+	}
+}
+
+func TestIsAttachment(t *testing.T) {
+	for target, want := range map[string]bool{
+		"diagram.png":        true,
+		"docs/spec.pdf":      true,
+		"Note":               false,
+		"note.md":            false,
+		"Meeting 2025.01.02": false,
+		"Mr. Smith":          false,
+	} {
+		if got := IsAttachment(target); got != want {
+			t.Errorf("IsAttachment(%q) = %v, want %v", target, got, want)
+		}
+	}
+}
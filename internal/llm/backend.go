@@ -25,16 +25,44 @@ func isGGUFSpec(model string) bool {
 // NewEmbedClient returns an LLM implementation for embeddings.
 // When built with -tags gguf, tries purego first, then falls back to go-llama.cpp if purego lib not found.
 // Otherwise use GGUF if QMD_EMBED_BACKEND=gguf or model is a GGUF spec. Uses Ollama/OpenAI API otherwise.
+// QMD_EMBED_BACKEND=ollama selects Ollama's native API (see OllamaClient).
 func NewEmbedClient(model string) (LLM, error) {
 	backend := os.Getenv("QMD_EMBED_BACKEND")
+	if backend == "ollama" {
+		return NewOllamaClient(OllamaBaseURL(), model), nil
+	}
 	useGGUF := backend == "gguf" || isGGUFSpec(model) || (GGUFEnabled() && backend != "api")
 	if useGGUF {
-		// Try purego first (kelindar/search method)
-		if client, err := newPuregoClient(model); err == nil {
-			return client, nil
-		}
-		// Fallback to go-llama.cpp (CGO method)
-		return newGGUFClient(model)
+		return newLocalEmbedClient(model, 0)
+	}
+	baseURL := os.Getenv("OLLAMA_HOST")
+	if baseURL == "" {
+		baseURL = "http://localhost:11434/v1"
+	}
+	return NewOpenAIClient(baseURL, model), nil
+}
+
+// newLocalEmbedClient loads a GGUF embedding model with context size nCtx (0 = default).
+func newLocalEmbedClient(model string, nCtx int) (LLM, error) {
+	// Try purego first (kelindar/search method)
+	if client, err := newPuregoClient(model, nCtx); err == nil {
+		return client, nil
+	}
+	// Fallback to go-llama.cpp (CGO method)
+	return newGGUFClient(model, nCtx)
+}
+
+// NewGenerateClient returns an LLM implementation for text generation with model.
+// QMD_GENERATE_BACKEND=gguf or a GGUF model spec selects the purego library; otherwise
+// the OpenAI-compatible API at OLLAMA_HOST is used, as for embeddings. QMD_GENERATE_BACKEND=ollama
+// selects Ollama's native API.
+func NewGenerateClient(model string) (LLM, error) {
+	backend := os.Getenv("QMD_GENERATE_BACKEND")
+	if backend == "ollama" {
+		return NewOllamaClient(OllamaBaseURL(), model), nil
+	}
+	if backend == "gguf" || isGGUFSpec(model) || (GGUFEnabled() && backend != "api") {
+		return newPuregoGenerateClient(model)
 	}
 	baseURL := os.Getenv("OLLAMA_HOST")
 	if baseURL == "" {
@@ -19,7 +19,10 @@ type ggufClient struct {
 	llama *llama.LLama
 }
 
-func newGGUFClient(model string) (LLM, error) {
+func newGGUFClient(model string, nCtx int) (LLM, error) {
+	if nCtx <= 0 {
+		nCtx = 2048
+	}
 	ctx := context.Background()
 	path, err := huggingface.ResolveModel(ctx, model)
 	if err != nil {
@@ -31,14 +34,17 @@ func newGGUFClient(model string) (LLM, error) {
 	} else if fi.Size() == 0 {
 		return nil, fmt.Errorf("model file is empty: %s", path)
 	}
-	l, err := llama.New(path, llama.EnableEmbeddings, llama.SetContext(2048))
+	l, err := llama.New(path, llama.EnableEmbeddings, llama.SetContext(nCtx))
 	if err != nil {
 		return nil, fmt.Errorf("load GGUF model from %s: %w (hint: use QMD_EMBED_BACKEND=api to use Ollama for embeddings)", path, err)
 	}
 	return &ggufClient{model: model, llama: l}, nil
 }
 
-func (c *ggufClient) Embed(text string) (*EmbeddingResult, error) {
+func (c *ggufClient) Embed(ctx context.Context, text string) (*EmbeddingResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	vec, err := c.llama.Embeddings(text)
@@ -55,6 +61,15 @@ func (c *ggufClient) Embed(text string) (*EmbeddingResult, error) {
 	}, nil
 }
 
-func (c *ggufClient) Generate(prompt string) (string, error) {
+// BatchEmbed embeds texts one at a time; the local model processes a single sequence.
+func (c *ggufClient) BatchEmbed(ctx context.Context, texts []string) ([]*EmbeddingResult, error) {
+	return embedEach(ctx, c.Embed, texts)
+}
+
+func (c *ggufClient) Generate(ctx context.Context, prompt string) (string, error) {
 	return "", fmt.Errorf("Generate not implemented for GGUF embedding client")
 }
+
+func (c *ggufClient) GenerateWithOptions(ctx context.Context, prompt string, opts GenerateOptions) (string, error) {
+	return c.Generate(ctx, prompt)
+}
@@ -4,6 +4,6 @@ package llm
 
 import "fmt"
 
-func newGGUFClient(model string) (LLM, error) {
+func newGGUFClient(model string, nCtx int) (LLM, error) {
 	return nil, fmt.Errorf("GGUF backend not built: build with -tags gguf (requires go-llama.cpp and libbinding.a)")
 }
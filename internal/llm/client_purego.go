@@ -24,9 +24,13 @@ type puregoClient struct {
 	loadFn     func(path *byte, nCtx, nGpuLayers int) unsafe.Pointer
 	freeFn     func(model unsafe.Pointer)
 	embedFn    func(model unsafe.Pointer, text *byte, embedding *float32, maxDims int) int
+	generateFn func(model unsafe.Pointer, system, prompt *byte, temperature float32, out *byte, outSize, maxTokens int) int // nil in older libraries
 	getErrorFn func() string
 }
 
+// generateMaxTokens caps a Generate reply; expansions and answers are short.
+const generateMaxTokens = 512
+
 var (
 	libPath     string
 	libPathOnce sync.Once
@@ -69,15 +73,67 @@ func findLibPath() string {
 	return libPath
 }
 
-func newPuregoClient(model string) (LLM, error) {
+// openLlamaGo loads the llama_go shared library.
+func openLlamaGo() (uintptr, error) {
 	libPath := findLibPath()
 	if libPath == "" {
-		return nil, fmt.Errorf("llama_go shared library not found (set LLAMA_GO_LIB or place libllama_go.so in PATH)")
+		return 0, fmt.Errorf("llama_go shared library not found (set LLAMA_GO_LIB or place libllama_go.so in PATH)")
 	}
-
 	lib, err := purego.Dlopen(libPath, purego.RTLD_NOW|purego.RTLD_GLOBAL)
 	if err != nil {
-		return nil, fmt.Errorf("dlopen %s: %w", libPath, err)
+		return 0, fmt.Errorf("dlopen %s: %w", libPath, err)
+	}
+	return lib, nil
+}
+
+// resolveModelFile resolves a GGUF spec to a local, non-empty model file.
+func resolveModelFile(model string) (string, error) {
+	path, err := huggingface.ResolveModel(context.Background(), model)
+	if err != nil {
+		return "", fmt.Errorf("resolve GGUF model: %w", err)
+	}
+	if fi, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("model file not found: %s: %w", path, err)
+	} else if fi.Size() == 0 {
+		return "", fmt.Errorf("model file is empty: %s", path)
+	}
+	return path, nil
+}
+
+// cString returns s as a NUL-terminated byte slice for C.
+func cString(s string) []byte {
+	return append([]byte(s), 0)
+}
+
+func newPuregoClient(model string, nCtx int) (LLM, error) {
+	c, err := loadPuregoClient(model, true, nCtx)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// newPuregoGenerateClient loads a model for Generate only, skipping the embedding probe.
+func newPuregoGenerateClient(model string) (LLM, error) {
+	c, err := loadPuregoClient(model, false, 0)
+	if err != nil {
+		return nil, err
+	}
+	if c.generateFn == nil {
+		c.Close()
+		return nil, fmt.Errorf("llama_go library has no llama_go_generate; rebuild it with make build-purego")
+	}
+	return c, nil
+}
+
+// loadPuregoClient loads model with context size nCtx (0 = 2048).
+func loadPuregoClient(model string, embed bool, nCtx int) (*puregoClient, error) {
+	if nCtx <= 0 {
+		nCtx = 2048
+	}
+	lib, err := openLlamaGo()
+	if err != nil {
+		return nil, err
 	}
 
 	var loadFn func(path *byte, nCtx, nGpuLayers int) unsafe.Pointer
@@ -89,22 +145,18 @@ func newPuregoClient(model string) (LLM, error) {
 	purego.RegisterLibFunc(&freeFn, lib, "llama_go_free")
 	purego.RegisterLibFunc(&embedFn, lib, "llama_go_embed")
 	purego.RegisterLibFunc(&getErrorFn, lib, "llama_go_get_error")
-
-	ctx := context.Background()
-	path, err := huggingface.ResolveModel(ctx, model)
-	if err != nil {
-		return nil, fmt.Errorf("resolve GGUF model: %w", err)
+	var generateFn func(model unsafe.Pointer, system, prompt *byte, temperature float32, out *byte, outSize, maxTokens int) int
+	if _, err := purego.Dlsym(lib, "llama_go_generate"); err == nil {
+		purego.RegisterLibFunc(&generateFn, lib, "llama_go_generate")
 	}
 
-	if fi, err := os.Stat(path); err != nil {
-		return nil, fmt.Errorf("model file not found: %s: %w", path, err)
-	} else if fi.Size() == 0 {
-		return nil, fmt.Errorf("model file is empty: %s", path)
+	path, err := resolveModelFile(model)
+	if err != nil {
+		return nil, err
 	}
 
-	pathBytes := []byte(path)
-	pathBytes = append(pathBytes, 0)           // null terminator
-	modelPtr := loadFn(&pathBytes[0], 2048, 0) // n_ctx=2048, n_gpu_layers=0
+	pathBytes := cString(path)
+	modelPtr := loadFn(&pathBytes[0], nCtx, 0) // n_gpu_layers=0
 	if modelPtr == nil {
 		if errMsg := getErrorFn(); errMsg != "" {
 			return nil, fmt.Errorf("load model: %s", errMsg)
@@ -113,17 +165,20 @@ func newPuregoClient(model string) (LLM, error) {
 	}
 
 	// Probe embedding dimensions by embedding empty string (or a test string)
-	testText := "test"
-	testBytes := []byte(testText)
-	testBytes = append(testBytes, 0)
-	var probe [1024]float32 // max reasonable dims
-	nDims := embedFn(modelPtr, &testBytes[0], &probe[0], len(probe))
-	if nDims <= 0 {
-		freeFn(modelPtr)
-		if errMsg := getErrorFn(); errMsg != "" {
-			return nil, fmt.Errorf("probe embedding dims: %s", errMsg)
+	var nDims int
+	if embed {
+		testText := "test"
+		testBytes := []byte(testText)
+		testBytes = append(testBytes, 0)
+		var probe [1024]float32 // max reasonable dims
+		nDims = embedFn(modelPtr, &testBytes[0], &probe[0], len(probe))
+		if nDims <= 0 {
+			freeFn(modelPtr)
+			if errMsg := getErrorFn(); errMsg != "" {
+				return nil, fmt.Errorf("probe embedding dims: %s", errMsg)
+			}
+			return nil, fmt.Errorf("probe embedding dims failed")
 		}
-		return nil, fmt.Errorf("probe embedding dims failed")
 	}
 
 	return &puregoClient{
@@ -134,13 +189,20 @@ func newPuregoClient(model string) (LLM, error) {
 		loadFn:     loadFn,
 		freeFn:     freeFn,
 		embedFn:    embedFn,
+		generateFn: generateFn,
 		getErrorFn: getErrorFn,
 	}, nil
 }
 
-func (c *puregoClient) Embed(text string) (*EmbeddingResult, error) {
+func (c *puregoClient) Embed(ctx context.Context, text string) (*EmbeddingResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	if c.nDims == 0 {
+		return nil, fmt.Errorf("model %s was loaded for generation, not embeddings", c.model)
+	}
 
 	textBytes := []byte(text)
 	textBytes = append(textBytes, 0) // null terminator
@@ -164,8 +226,55 @@ func (c *puregoClient) Embed(text string) (*EmbeddingResult, error) {
 	}, nil
 }
 
-func (c *puregoClient) Generate(prompt string) (string, error) {
-	return "", fmt.Errorf("Generate not implemented for purego embedding client")
+// BatchEmbed embeds texts one at a time; the local model processes a single sequence.
+func (c *puregoClient) BatchEmbed(ctx context.Context, texts []string) ([]*EmbeddingResult, error) {
+	return embedEach(ctx, c.Embed, texts)
+}
+
+func (c *puregoClient) Generate(ctx context.Context, prompt string) (string, error) {
+	return c.GenerateWithOptions(ctx, prompt, GenerateOptions{})
+}
+
+// GenerateWithOptions generates locally. Stop sequences are applied to the finished
+// reply, JSON is not enforced, and OnToken receives the whole reply at once. A
+// generation that has started runs to completion even if ctx is cancelled.
+func (c *puregoClient) GenerateWithOptions(ctx context.Context, prompt string, opts GenerateOptions) (string, error) {
+	if c.generateFn == nil {
+		return "", fmt.Errorf("llama_go library has no llama_go_generate; rebuild it with make build-purego")
+	}
+	maxTokens := opts.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = generateMaxTokens
+	}
+
+	c.mu.Lock()
+	if err := ctx.Err(); err != nil {
+		c.mu.Unlock()
+		return "", err
+	}
+	promptBytes := cString(prompt)
+	systemBytes := cString(opts.System)
+	out := make([]byte, maxTokens*16) // generous bytes per token
+	n := c.generateFn(c.modelPtr, &systemBytes[0], &promptBytes[0], float32(opts.Temperature), &out[0], len(out), maxTokens)
+	var errMsg string
+	if n < 0 {
+		errMsg = c.getErrorFn()
+	}
+	c.mu.Unlock()
+	if n < 0 {
+		if errMsg != "" {
+			return "", fmt.Errorf("generate: %s", errMsg)
+		}
+		return "", fmt.Errorf("generation failed")
+	}
+
+	reply := applyStop(string(out[:n]), opts.Stop)
+	if opts.OnToken != nil {
+		if err := opts.OnToken(reply); err != nil {
+			return reply, err
+		}
+	}
+	return reply, nil
 }
 
 func (c *puregoClient) Close() error {
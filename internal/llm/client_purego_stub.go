@@ -4,6 +4,10 @@ package llm
 
 import "fmt"
 
-func newPuregoClient(model string) (LLM, error) {
+func newPuregoClient(model string, nCtx int) (LLM, error) {
+	return nil, fmt.Errorf("purego client not available: build with -tags gguf")
+}
+
+func newPuregoGenerateClient(model string) (LLM, error) {
 	return nil, fmt.Errorf("purego client not available: build with -tags gguf")
 }
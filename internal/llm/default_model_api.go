@@ -6,3 +6,20 @@ package llm
 func DefaultEmbedModel() string {
 	return "nomic-embed-text"
 }
+
+// DefaultRerankModel returns the default reranker model name sent to a /rerank endpoint.
+func DefaultRerankModel() string {
+	return "bge-reranker-v2-m3"
+}
+
+// DefaultExpandModel returns the default query expansion model. API builds have none:
+// set QMD_EXPAND_MODEL (e.g. the fine-tuned model imported into Ollama) to enable it.
+func DefaultExpandModel() string {
+	return ""
+}
+
+// DefaultAnswerModel returns the default model for `qmd ask`. API builds have none: set
+// QMD_ANSWER_MODEL to a chat model served at OLLAMA_HOST.
+func DefaultAnswerModel() string {
+	return ""
+}
@@ -9,3 +9,20 @@ package llm
 func DefaultEmbedModel() string {
 	return "ggml-org/embeddinggemma-300M-GGUF:embeddinggemma-300M-Q8_0.gguf"
 }
+
+// DefaultRerankModel returns the default reranker model for GGUF builds: Qwen3-Reranker
+// 0.6B, as in Tobi's qmd.
+func DefaultRerankModel() string {
+	return "ggml-org/Qwen3-Reranker-0.6B-Q8_0-GGUF:qwen3-reranker-0.6b-q8_0.gguf"
+}
+
+// DefaultExpandModel returns the default query expansion model for GGUF builds: the
+// model fine-tuned by finetune/ to emit lex/vec/hyde lines.
+func DefaultExpandModel() string {
+	return "tobil/qmd-query-expansion-1.7B-gguf:qmd-query-expansion-1.7B-q4_k_m.gguf"
+}
+
+// DefaultAnswerModel returns the default model for `qmd ask` in GGUF builds.
+func DefaultAnswerModel() string {
+	return "Qwen/Qwen3-1.7B-GGUF:Qwen3-1.7B-Q8_0.gguf"
+}
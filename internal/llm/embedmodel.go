@@ -0,0 +1,148 @@
+package llm
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ba0f3/qmd-go/internal/config"
+)
+
+// EmbedModel is the embedding model resolved for an index or collection.
+type EmbedModel struct {
+	Name string // entry in the models: section; "" when taken from the environment
+	config.ModelConfig
+	Profile Profile
+}
+
+// ResolveEmbedModel picks the embedding model for collection ("" for the whole index).
+// Config comes first: the collection's embed_model, then the index's embed_model, then
+// a models: entry named by QMD_EMBED_MODEL. Otherwise QMD_EMBED_MODEL (or the build
+// default) is used as a model spec with the backend chosen by QMD_EMBED_BACKEND.
+func ResolveEmbedModel(cfg *config.Config, collection string) (EmbedModel, error) {
+	var name string
+	if cfg != nil {
+		name = config.EmbedModelFor(cfg, collection)
+	}
+	if name != "" {
+		return configuredEmbedModel(cfg, name)
+	}
+	env := os.Getenv("QMD_EMBED_MODEL")
+	if env == "" {
+		env = DefaultEmbedModel()
+	}
+	return LookupEmbedModel(cfg, env)
+}
+
+// LookupEmbedModel returns the models: entry called nameOrSpec, or else a model with
+// that spec on the backend chosen by QMD_EMBED_BACKEND.
+func LookupEmbedModel(cfg *config.Config, nameOrSpec string) (EmbedModel, error) {
+	if cfg != nil {
+		if _, ok := cfg.Models[nameOrSpec]; ok {
+			return configuredEmbedModel(cfg, nameOrSpec)
+		}
+	}
+	p, err := LookupProfile(cfg, "", nameOrSpec)
+	return EmbedModel{ModelConfig: config.ModelConfig{Model: nameOrSpec}, Profile: p}, err
+}
+
+func configuredEmbedModel(cfg *config.Config, name string) (EmbedModel, error) {
+	m, ok := cfg.Models[name]
+	if !ok {
+		return EmbedModel{}, fmt.Errorf("embed_model %q is not defined under models:", name)
+	}
+	switch m.Kind {
+	case "openai", "ollama", "gguf":
+	default:
+		return EmbedModel{}, fmt.Errorf("models.%s: unknown kind %q (want openai, ollama or gguf)", name, m.Kind)
+	}
+	if m.Model == "" {
+		return EmbedModel{}, fmt.Errorf("models.%s: model is required", name)
+	}
+	p, err := LookupProfile(cfg, m.Profile, m.Model)
+	if err != nil {
+		return EmbedModel{}, fmt.Errorf("models.%s: %w", name, err)
+	}
+	return EmbedModel{Name: name, ModelConfig: m, Profile: p}, nil
+}
+
+// NewClient returns an embedding client for the model.
+func (m EmbedModel) NewClient() (LLM, error) {
+	switch m.Kind {
+	case "openai":
+		baseURL := m.BaseURL
+		if baseURL == "" {
+			baseURL = os.Getenv("OLLAMA_HOST")
+		}
+		c := NewOpenAIClient(baseURL, m.Model)
+		if m.APIKeyEnv != "" {
+			c.APIKey = os.Getenv(m.APIKeyEnv)
+		}
+		c.Dimensions = m.Dimensions
+		return c, nil
+	case "ollama":
+		baseURL := m.BaseURL
+		if baseURL == "" {
+			baseURL = OllamaBaseURL()
+		}
+		c := NewOllamaClient(baseURL, m.Model)
+		c.Dimensions, c.NumCtx = m.Dimensions, m.ContextSize
+		return c, nil
+	case "gguf":
+		return newLocalEmbedClient(m.Model, m.ContextSize)
+	}
+	return NewEmbedClient(m.Model)
+}
+
+// String describes the model for status output, e.g. "docs (ollama nomic-embed-text)".
+func (m EmbedModel) String() string {
+	if m.Name == "" {
+		return m.Model
+	}
+	return fmt.Sprintf("%s (%s %s)", m.Name, m.Kind, m.Model)
+}
+
+// FormatQuery wraps a search query for embedding.
+func (m EmbedModel) FormatQuery(query string) string {
+	tmpl := m.QueryTemplate
+	if tmpl == "" {
+		tmpl = m.profile().QueryTemplate
+	}
+	return truncateTokens(strings.ReplaceAll(tmpl, "{query}", query), m.maxTokens())
+}
+
+// FormatDocument wraps a document chunk for embedding, truncated to the model's input
+// limit.
+func (m EmbedModel) FormatDocument(title, text string) string {
+	if title == "" {
+		title = "none"
+	}
+	tmpl := m.DocumentTemplate
+	if tmpl == "" {
+		tmpl = m.profile().DocumentTemplate
+	}
+	return truncateTokens(strings.NewReplacer("{title}", title, "{text}", text).Replace(tmpl), m.maxTokens())
+}
+
+// Normalize scales vec to unit length in place if the model's profile asks for it.
+func (m EmbedModel) Normalize(vec []float32) {
+	if m.profile().Normalize {
+		normalizeL2(vec)
+	}
+}
+
+func (m EmbedModel) profile() Profile {
+	if m.Profile.Name == "" {
+		return defaultProfile
+	}
+	return m.Profile
+}
+
+// maxTokens is the profile's input limit, lowered to the configured context size.
+func (m EmbedModel) maxTokens() int {
+	n := m.profile().MaxTokens
+	if m.ContextSize > 0 && (n == 0 || m.ContextSize < n) {
+		n = m.ContextSize
+	}
+	return n
+}
@@ -0,0 +1,82 @@
+package llm
+
+import (
+	"testing"
+
+	"github.com/ba0f3/qmd-go/internal/config"
+)
+
+func TestResolveEmbedModel(t *testing.T) {
+	t.Setenv("QMD_EMBED_MODEL", "")
+	cfg := &config.Config{
+		EmbedModel: "nomic",
+		Models: map[string]config.ModelConfig{
+			"nomic": {Kind: "ollama", Model: "nomic-embed-text", ContextSize: 8192,
+				QueryTemplate: "search_query: {query}", DocumentTemplate: "search_document: {title}\n{text}"},
+			"small": {Kind: "openai", BaseURL: "https://api.openai.com/v1", APIKeyEnv: "TEAM_OPENAI_KEY",
+				Model: "text-embedding-3-small", Dimensions: 512},
+			"broken": {Kind: "tfidf", Model: "x"},
+		},
+		Collections: map[string]config.Collection{
+			"notes": {Path: "/n"},
+			"docs":  {Path: "/d", EmbedModel: "small"},
+			"bad":   {Path: "/b", EmbedModel: "missing"},
+		},
+	}
+
+	m, err := ResolveEmbedModel(cfg, "notes")
+	if err != nil || m.Name != "nomic" || m.Kind != "ollama" {
+		t.Fatalf("notes: got %+v, %v; want the index-wide model", m, err)
+	}
+	if q := m.FormatQuery("auth"); q != "search_query: auth" {
+		t.Errorf("FormatQuery = %q", q)
+	}
+	if d := m.FormatDocument("", "body"); d != "search_document: none\nbody" {
+		t.Errorf("FormatDocument = %q", d)
+	}
+
+	t.Setenv("TEAM_OPENAI_KEY", "sk-test")
+	m, err = ResolveEmbedModel(cfg, "docs")
+	if err != nil || m.Name != "small" {
+		t.Fatalf("docs: got %+v, %v; want the collection override", m, err)
+	}
+	client, err := m.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oc, ok := client.(*OpenAIClient)
+	if !ok || oc.APIKey != "sk-test" || oc.Dimensions != 512 || oc.BaseURL != "https://api.openai.com/v1" {
+		t.Errorf("Unexpected client %+v", client)
+	}
+
+	if _, err := ResolveEmbedModel(cfg, "bad"); err == nil {
+		t.Error("Expected an error for an undefined embed_model")
+	}
+	cfg.EmbedModel = "broken"
+	if _, err := ResolveEmbedModel(cfg, ""); err == nil {
+		t.Error("Expected an error for an unknown kind")
+	}
+
+	// Without config, QMD_EMBED_MODEL names a models: entry or a raw model spec.
+	cfg.EmbedModel = ""
+	t.Setenv("QMD_EMBED_MODEL", "small")
+	if m, _ := ResolveEmbedModel(cfg, "notes"); m.Name != "small" {
+		t.Errorf("Expected QMD_EMBED_MODEL to select a configured model, got %+v", m)
+	}
+	t.Setenv("QMD_EMBED_MODEL", "mxbai-embed-large")
+	m, err = ResolveEmbedModel(cfg, "notes")
+	if err != nil || m.Name != "" || m.Model != "mxbai-embed-large" {
+		t.Errorf("Expected env fallback, got %+v, %v", m, err)
+	}
+	if q := m.FormatQuery("auth"); m.Profile.Name != "mxbai" || q != "Represent this sentence for searching relevant passages: auth" {
+		t.Errorf("Expected the mxbai profile, got %q with %q", m.Profile.Name, q)
+	}
+
+	// LookupEmbedModel takes an entry name or a spec, as for qmd embed --model.
+	if m, err := LookupEmbedModel(cfg, "small"); err != nil || m.Name != "small" || m.Kind != "openai" {
+		t.Errorf("LookupEmbedModel(small) = %+v, %v", m, err)
+	}
+	if m, err := LookupEmbedModel(cfg, "bge-m3"); err != nil || m.Name != "" || m.Model != "bge-m3" {
+		t.Errorf("LookupEmbedModel(bge-m3) = %+v, %v", m, err)
+	}
+}
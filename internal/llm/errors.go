@@ -0,0 +1,96 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error kinds that callers can react to with errors.Is, e.g. back off on
+// ErrRateLimited or shorten the prompt on ErrContextLength.
+var (
+	ErrRateLimited   = errors.New("rate limited")
+	ErrContextLength = errors.New("context length exceeded")
+	ErrAuth          = errors.New("authentication failed")
+)
+
+// APIError is an error response from an OpenAI-compatible API.
+type APIError struct {
+	StatusCode int
+	Message    string
+	Code       string        // provider error code or type, if any
+	RetryAfter time.Duration // from the Retry-After header, if any
+	kind       error
+}
+
+func (e *APIError) Error() string {
+	if e.StatusCode == 0 {
+		return "API error: " + e.Message
+	}
+	return fmt.Sprintf("API error (HTTP %d): %s", e.StatusCode, e.Message)
+}
+
+// Unwrap returns the error kind (ErrRateLimited, ErrContextLength or ErrAuth), if known.
+func (e *APIError) Unwrap() error { return e.kind }
+
+// apiErrorBody covers {"error": {"message", "type", "code"}} (OpenAI, llama.cpp) and
+// {"error": "message"} (Ollama).
+type apiErrorBody struct {
+	Error json.RawMessage `json:"error"`
+}
+
+// newAPIError builds an APIError from a non-200 response.
+func newAPIError(resp *http.Response) *APIError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	e := parseAPIError(resp.StatusCode, body)
+	if s := resp.Header.Get("Retry-After"); s != "" {
+		if secs, err := strconv.Atoi(s); err == nil {
+			e.RetryAfter = time.Duration(secs) * time.Second
+		} else if t, err := http.ParseTime(s); err == nil {
+			e.RetryAfter = time.Until(t)
+		}
+	}
+	return e
+}
+
+// parseAPIError classifies an error payload; status is 0 for errors sent mid-stream.
+func parseAPIError(status int, body []byte) *APIError {
+	e := &APIError{StatusCode: status, Message: strings.TrimSpace(string(body))}
+	var b apiErrorBody
+	if json.Unmarshal(body, &b) == nil && len(b.Error) > 0 {
+		var detail struct {
+			Message string          `json:"message"`
+			Type    string          `json:"type"`
+			Code    json.RawMessage `json:"code"`
+		}
+		var msg string
+		if json.Unmarshal(b.Error, &msg) == nil {
+			e.Message = msg
+		} else if json.Unmarshal(b.Error, &detail) == nil {
+			e.Message, e.Code = detail.Message, detail.Type
+			var code string
+			if json.Unmarshal(detail.Code, &code) == nil && code != "" {
+				e.Code = code
+			}
+		}
+	}
+
+	text := strings.ToLower(e.Message + " " + e.Code)
+	switch {
+	case status == http.StatusTooManyRequests || strings.Contains(text, "rate limit") || strings.Contains(text, "rate_limit"):
+		e.kind = ErrRateLimited
+	case status == http.StatusUnauthorized || status == http.StatusForbidden ||
+		strings.Contains(text, "invalid_api_key") || strings.Contains(text, "authentication"):
+		e.kind = ErrAuth
+	case strings.Contains(text, "context length") || strings.Contains(text, "context_length") ||
+		strings.Contains(text, "context size") || strings.Contains(text, "maximum context") ||
+		strings.Contains(text, "too many tokens") || status == http.StatusRequestEntityTooLarge:
+		e.kind = ErrContextLength
+	}
+	return e
+}
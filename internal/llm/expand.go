@@ -0,0 +1,64 @@
+package llm
+
+import (
+	"strings"
+)
+
+// Expansion is a query rewritten by the query expansion model: keyword variants for
+// BM25 (lex), phrasings for vector search (vec) and a hypothetical document passage
+// that would answer the query, also embedded for vector search (hyde).
+type Expansion struct {
+	Lex  []string
+	Vec  []string
+	Hyde []string
+}
+
+// Empty reports whether the expansion has no usable lines.
+func (e Expansion) Empty() bool {
+	return len(e.Lex) == 0 && len(e.Vec) == 0 && len(e.Hyde) == 0
+}
+
+// ExpansionPrompt builds the prompt for expanding query. With no system prompt it uses
+// the format the fine-tuned model was trained on (finetune/); otherwise system (such
+// as finetune/gepa/best_prompt.txt, for general-purpose models) is followed by the
+// query in the GEPA input format.
+func ExpansionPrompt(query, system string) string {
+	if strings.TrimSpace(system) == "" {
+		return "/no_think Expand this search query: " + query
+	}
+	return strings.TrimSpace(system) + "\n\n## Inputs\n### query\n" + query
+}
+
+// ParseExpansion extracts the lex:, vec: and hyde: lines from model output. Other
+// lines (headings, code fences, a <think> block) are ignored, as are duplicates.
+func ParseExpansion(text string) Expansion {
+	if i := strings.Index(text, "</think>"); i >= 0 {
+		text = text[i+len("</think>"):]
+	}
+	var e Expansion
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "-*"))
+		kind, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		kind = strings.ToLower(strings.TrimSpace(kind))
+		value = strings.TrimSpace(value)
+		if value == "" || seen[kind+":"+value] {
+			continue
+		}
+		switch kind {
+		case "lex":
+			e.Lex = append(e.Lex, value)
+		case "vec":
+			e.Vec = append(e.Vec, value)
+		case "hyde":
+			e.Hyde = append(e.Hyde, value)
+		default:
+			continue
+		}
+		seen[kind+":"+value] = true
+	}
+	return e
+}
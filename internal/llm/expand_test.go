@@ -0,0 +1,37 @@
+package llm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseExpansion(t *testing.T) {
+	out := "<think>\nlex: not this\n</think>\n## Generated Outputs\n### expansion\n```\n" +
+		"lex: webmail login\nlex:  web mail sign in \nlex: webmail login\n" +
+		"vec: how to sign in to web mail\n- vec: accessing email in a browser\n" +
+		"hyde: Open the webmail page and enter your username and password to sign in.\n" +
+		"note: ignored\nLEX: Mail\n```"
+	got := ParseExpansion(out)
+	want := Expansion{
+		Lex:  []string{"webmail login", "web mail sign in", "Mail"},
+		Vec:  []string{"how to sign in to web mail", "accessing email in a browser"},
+		Hyde: []string{"Open the webmail page and enter your username and password to sign in."},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseExpansion = %+v, want %+v", got, want)
+	}
+	if !ParseExpansion("no expansion here").Empty() {
+		t.Error("Expected empty expansion")
+	}
+}
+
+func TestExpansionPrompt(t *testing.T) {
+	if got := ExpansionPrompt("web mail", ""); got != "/no_think Expand this search query: web mail" {
+		t.Errorf("Fine-tuned prompt = %q", got)
+	}
+	got := ExpansionPrompt("web mail", "You expand queries.\n")
+	if !strings.HasPrefix(got, "You expand queries.") || !strings.HasSuffix(got, "### query\nweb mail") {
+		t.Errorf("GEPA prompt = %q", got)
+	}
+}
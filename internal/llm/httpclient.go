@@ -0,0 +1,276 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for the API clients; each can be overridden from the environment.
+const (
+	defaultHTTPTimeout = 2 * time.Minute // QMD_HTTP_TIMEOUT
+	defaultMaxRetries  = 3               // QMD_HTTP_RETRIES
+
+	retryMaxDelay = 30 * time.Second
+	// maxRetryAfter is the longest Retry-After we wait out; a server asking for more
+	// gets its error returned instead.
+	maxRetryAfter = 2 * time.Minute
+)
+
+// retryBaseDelay is the first backoff step, doubled on each retry (a var for tests).
+var retryBaseDelay = 500 * time.Millisecond
+
+// httpSettings is the transport shared by the API clients: a per-attempt timeout,
+// retries with exponential backoff for 429 and 5xx responses and network errors, and
+// the process-wide rate limiter.
+type httpSettings struct {
+	HTTPClient *http.Client
+	Timeout    time.Duration // per attempt, including reading the response body; 0 = none
+	MaxRetries int           // retries after the first attempt
+	limiter    *rateLimiter
+}
+
+func defaultHTTPSettings() httpSettings {
+	return httpSettings{
+		HTTPClient: http.DefaultClient,
+		Timeout:    envDuration("QMD_HTTP_TIMEOUT", defaultHTTPTimeout),
+		MaxRetries: envInt("QMD_HTTP_RETRIES", defaultMaxRetries),
+		limiter:    sharedRateLimiter(),
+	}
+}
+
+// post sends body to url and returns the 200 response, retrying transient failures.
+// Any other status is returned as *APIError. tokens is the request's estimated token
+// count for the tokens-per-minute limit. The caller must close the response body.
+func (h *httpSettings) post(ctx context.Context, url, apiKey string, body []byte, stream bool, tokens int) (*http.Response, error) {
+	return h.do(ctx, "POST", url, apiKey, body, stream, tokens)
+}
+
+// do is post for any method; a nil body sends no request body.
+func (h *httpSettings) do(ctx context.Context, method, url, apiKey string, body []byte, stream bool, tokens int) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if err := h.limiter.wait(ctx, tokens); err != nil {
+			return nil, err
+		}
+		resp, err := h.attempt(ctx, method, url, apiKey, body, stream)
+		if err == nil {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		delay, ok := retryDelay(err, attempt)
+		if !ok || attempt >= h.MaxRetries {
+			return nil, err
+		}
+		if err := sleepCtx(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (h *httpSettings) attempt(ctx context.Context, method, url, apiKey string, body []byte, stream bool) (*http.Response, error) {
+	cancel := context.CancelFunc(func() {})
+	if h.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+	}
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if stream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	client := h.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		defer cancel()
+		defer resp.Body.Close()
+		return nil, newAPIError(resp)
+	}
+	resp.Body = cancelOnClose{resp.Body, cancel}
+	return resp, nil
+}
+
+// cancelOnClose releases the attempt's timeout context once the body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// retryDelay reports whether err is worth retrying and how long to wait first: the
+// server's Retry-After if it sent one, otherwise exponential backoff with full jitter.
+func retryDelay(err error, attempt int) (time.Duration, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		default:
+			return 0, false
+		}
+		if apiErr.RetryAfter > maxRetryAfter {
+			return 0, false
+		}
+		if apiErr.RetryAfter > 0 {
+			return apiErr.RetryAfter, true
+		}
+	}
+	// Anything else is a transport error (refused connection, reset, attempt timeout).
+	backoff := min(retryMaxDelay, retryBaseDelay<<min(attempt, 16))
+	return time.Duration(rand.Int63n(int64(backoff)) + 1), true
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// rateLimiter is a client-side token bucket on requests per second and estimated
+// tokens per minute. Callers reserve capacity up front and sleep off any deficit, so
+// concurrent callers queue in arrival order. A nil limiter never waits.
+type rateLimiter struct {
+	mu        sync.Mutex
+	rps, tpm  float64
+	reqs, tok float64 // capacity currently available; negative when reserved ahead
+	last      time.Time
+}
+
+func newRateLimiter(rps, tpm float64) *rateLimiter {
+	if rps <= 0 && tpm <= 0 {
+		return nil
+	}
+	return &rateLimiter{rps: rps, tpm: tpm, reqs: max(rps, 1), tok: tpm, last: time.Now()}
+}
+
+var (
+	rateLimiterOnce sync.Once
+	rateLimiterInst *rateLimiter
+)
+
+// sharedRateLimiter is the limiter configured by QMD_RATE_LIMIT_RPS and
+// QMD_RATE_LIMIT_TPM, shared by every API client in the process.
+func sharedRateLimiter() *rateLimiter {
+	rateLimiterOnce.Do(func() {
+		rateLimiterInst = newRateLimiter(envFloat("QMD_RATE_LIMIT_RPS"), envFloat("QMD_RATE_LIMIT_TPM"))
+	})
+	return rateLimiterInst
+}
+
+func (l *rateLimiter) wait(ctx context.Context, tokens int) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	return sleepCtx(ctx, l.reserve(time.Now(), tokens))
+}
+
+// reserve takes one request and tokens from the buckets at now and returns how long
+// the caller must wait for them. A request larger than the whole per-minute budget
+// waits for a full bucket rather than forever.
+func (l *rateLimiter) reserve(now time.Time, tokens int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	elapsed := now.Sub(l.last).Seconds()
+	if elapsed > 0 {
+		l.last = now
+	} else {
+		elapsed = 0
+	}
+	var wait float64
+	if l.rps > 0 {
+		l.reqs = math.Min(max(l.rps, 1), l.reqs+elapsed*l.rps)
+		l.reqs--
+		if l.reqs < 0 {
+			wait = -l.reqs / l.rps
+		}
+	}
+	if l.tpm > 0 {
+		perSec := l.tpm / 60
+		l.tok = math.Min(l.tpm, l.tok+elapsed*perSec)
+		l.tok -= math.Min(float64(tokens), l.tpm)
+		if l.tok < 0 {
+			wait = max(wait, -l.tok/perSec)
+		}
+	}
+	return time.Duration(wait * float64(time.Second))
+}
+
+// estimateTokens approximates a text's token count (about four bytes per token for
+// English) for the tokens-per-minute limit.
+func estimateTokens(texts ...string) int {
+	n := 0
+	for _, t := range texts {
+		n += len(t)/4 + 1
+	}
+	return n
+}
+
+// envDuration reads a Go duration ("90s", "2m") or a number of seconds.
+func envDuration(name string, def time.Duration) time.Duration {
+	s := strings.TrimSpace(os.Getenv(name))
+	if s == "" {
+		return def
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return d
+	}
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(secs * float64(time.Second))
+	}
+	return def
+}
+
+func envInt(name string, def int) int {
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv(name))); err == nil && n >= 0 {
+		return n
+	}
+	return def
+}
+
+func envFloat(name string) float64 {
+	f, _ := strconv.ParseFloat(strings.TrimSpace(os.Getenv(name)), 64)
+	return max(f, 0)
+}
@@ -0,0 +1,110 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPRetries(t *testing.T) {
+	defer func(d time.Duration) { retryBaseDelay = d }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Write([]byte(`{"data":[{"index":0,"embedding":[1,2]}]}`))
+		}
+	}))
+	defer srv.Close()
+
+	res, err := NewOpenAIClient(srv.URL, "m").Embed(context.Background(), "x")
+	if err != nil {
+		t.Fatalf("Embed failed after retries: %v", err)
+	}
+	if calls.Load() != 3 || len(res.Embedding) != 2 {
+		t.Errorf("Expected success on the third attempt, got %d calls", calls.Load())
+	}
+
+	// Client errors are not retried, and MaxRetries bounds the attempts.
+	calls.Store(0)
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	})
+	if _, err := NewOpenAIClient(srv.URL, "m").Embed(context.Background(), "x"); err == nil || calls.Load() != 1 {
+		t.Errorf("Expected one attempt for HTTP 400, got %d (%v)", calls.Load(), err)
+	}
+	calls.Store(0)
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	client := NewOpenAIClient(srv.URL, "m")
+	client.MaxRetries = 2
+	if _, err := client.Embed(context.Background(), "x"); err == nil || calls.Load() != 3 {
+		t.Errorf("Expected 3 attempts, got %d (%v)", calls.Load(), err)
+	}
+}
+
+func TestHTTPTimeoutAndCancel(t *testing.T) {
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-block:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(block)
+
+	client := NewOpenAIClient(srv.URL, "m")
+	client.Timeout, client.MaxRetries = 20*time.Millisecond, 0
+	if _, err := client.Embed(context.Background(), "x"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+
+	client.Timeout = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err := client.Generate(ctx, "hi"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Error("Cancellation did not stop the request")
+	}
+}
+
+func TestRateLimiterReserve(t *testing.T) {
+	now := time.Now()
+	l := newRateLimiter(2, 600) // 2 req/s, 10 tokens/s
+	l.last = now
+
+	if d := l.reserve(now, 10); d != 0 {
+		t.Errorf("First request waited %v", d)
+	}
+	if d := l.reserve(now, 10); d != 0 {
+		t.Errorf("Burst of 2 should not wait, waited %v", d)
+	}
+	if d := l.reserve(now, 10); d != 500*time.Millisecond {
+		t.Errorf("Third request should wait 500ms for the request bucket, waited %v", d)
+	}
+	// 600 tokens in the bucket, 30 used: the next 600-token request is 30 tokens short.
+	if d := l.reserve(now, 600); d != 3*time.Second {
+		t.Errorf("Large request should wait 3s for tokens, waited %v", d)
+	}
+	if newRateLimiter(0, 0) != nil {
+		t.Error("Expected no limiter when both limits are 0")
+	}
+}
@@ -1,11 +1,70 @@
 package llm
 
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
 type EmbeddingResult struct {
 	Embedding []float32
 	Model     string
 }
 
+// GenerateOptions tunes a generation request. Zero values leave the server defaults,
+// except Temperature, which is always sent (0 is deterministic).
+type GenerateOptions struct {
+	System      string   // system prompt, sent before the user prompt
+	Temperature float64  // sampling temperature
+	MaxTokens   int      // reply length cap; 0 = backend default
+	Stop        []string // stop sequences, excluded from the reply
+	JSON        bool     // constrain the reply to a JSON object where supported
+
+	// OnToken, if set, streams the reply: it is called with each piece of text as it
+	// is generated. Returning an error aborts generation with that error.
+	OnToken func(token string) error
+}
+
+// LLM is an embedding and generation backend. Cancelling ctx abandons the request:
+// API clients stop at once, local models before the next text or generation.
 type LLM interface {
-	Embed(text string) (*EmbeddingResult, error)
-	Generate(prompt string) (string, error)
+	Embed(ctx context.Context, text string) (*EmbeddingResult, error)
+	// BatchEmbed embeds several texts, returning results in the same order.
+	BatchEmbed(ctx context.Context, texts []string) ([]*EmbeddingResult, error)
+	Generate(ctx context.Context, prompt string) (string, error)
+	GenerateWithOptions(ctx context.Context, prompt string, opts GenerateOptions) (string, error)
+}
+
+// applyStop cuts text at the earliest stop sequence, for backends that cannot stop
+// generation themselves.
+func applyStop(text string, stop []string) string {
+	cut := len(text)
+	for _, s := range stop {
+		if i := strings.Index(text, s); s != "" && i >= 0 && i < cut {
+			cut = i
+		}
+	}
+	return text[:cut]
+}
+
+// checkDimensions fails when a model returns vectors of another size than configured,
+// which would otherwise be stored and silently never match anything.
+func checkDimensions(model string, vec []float32, want int) error {
+	if want > 0 && len(vec) != want {
+		return fmt.Errorf("model %s returned %d dimensions, configured for %d", model, len(vec), want)
+	}
+	return nil
+}
+
+// embedEach implements BatchEmbed for backends that embed one text per call.
+func embedEach(ctx context.Context, embed func(context.Context, string) (*EmbeddingResult, error), texts []string) ([]*EmbeddingResult, error) {
+	results := make([]*EmbeddingResult, len(texts))
+	for i, text := range texts {
+		r, err := embed(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = r
+	}
+	return results, nil
 }
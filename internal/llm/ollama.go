@@ -0,0 +1,315 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// OllamaClient talks to Ollama's native API (/api/embed, /api/generate, /api/tags,
+// /api/show, /api/pull). Unlike the OpenAI-compatible endpoint it can tell whether a
+// model is installed, pull it, and report its embedding size and context length.
+type OllamaClient struct {
+	BaseURL    string // e.g. http://localhost:11434, without /v1
+	Model      string
+	Dimensions int // requested vector size and checked on results; 0 = the model's own
+	NumCtx     int // context length (options.num_ctx); 0 = Ollama's default
+	httpSettings
+}
+
+func NewOllamaClient(baseURL, model string) *OllamaClient {
+	return &OllamaClient{
+		BaseURL:      strings.TrimSuffix(baseURL, "/"),
+		Model:        model,
+		httpSettings: defaultHTTPSettings(),
+	}
+}
+
+// OllamaBaseURL is the native API base from OLLAMA_HOST. It accepts the forms Ollama
+// itself does ("localhost:11434", "http://host:11434") as well as a base ending in /v1
+// that was set for the OpenAI-compatible endpoint.
+func OllamaBaseURL() string {
+	host := strings.TrimSpace(os.Getenv("OLLAMA_HOST"))
+	if host == "" {
+		return "http://localhost:11434"
+	}
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	host = strings.TrimSuffix(host, "/")
+	return strings.TrimSuffix(host, "/v1")
+}
+
+// request sends a JSON request to path. Transport failures are reported as Ollama
+// being unreachable, since that is nearly always the cause.
+func (c *OllamaClient) request(ctx context.Context, method, path string, body any, stream bool, tokens int) (io.ReadCloser, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := c.do(ctx, method, c.BaseURL+path, "", data, stream, tokens)
+	if err != nil {
+		var apiErr *APIError
+		if ctx.Err() == nil && !errors.As(err, &apiErr) {
+			return nil, fmt.Errorf("cannot reach Ollama at %s (start it with 'ollama serve' or set OLLAMA_HOST): %w", c.BaseURL, err)
+		}
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+type ollamaEmbedRequest struct {
+	Model      string         `json:"model"`
+	Input      []string       `json:"input"`
+	Dimensions int            `json:"dimensions,omitempty"`
+	Options    map[string]any `json:"options,omitempty"`
+}
+
+type ollamaEmbedResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+func (c *OllamaClient) Embed(ctx context.Context, text string) (*EmbeddingResult, error) {
+	results, err := c.BatchEmbed(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+// BatchEmbed embeds texts with one /api/embed call.
+func (c *OllamaClient) BatchEmbed(ctx context.Context, texts []string) ([]*EmbeddingResult, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	req := ollamaEmbedRequest{Model: c.Model, Input: texts, Dimensions: c.Dimensions}
+	if c.NumCtx > 0 {
+		req.Options = map[string]any{"num_ctx": c.NumCtx}
+	}
+	body, err := c.request(ctx, "POST", "/api/embed", req, false, estimateTokens(texts...))
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	var res ollamaEmbedResponse
+	if err := json.NewDecoder(body).Decode(&res); err != nil {
+		return nil, err
+	}
+	if len(res.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("got %d embeddings for %d inputs", len(res.Embeddings), len(texts))
+	}
+	results := make([]*EmbeddingResult, len(texts))
+	for i, e := range res.Embeddings {
+		if err := checkDimensions(c.Model, e, c.Dimensions); err != nil {
+			return nil, err
+		}
+		results[i] = &EmbeddingResult{Embedding: e, Model: c.Model}
+	}
+	return results, nil
+}
+
+type ollamaGenerateRequest struct {
+	Model   string         `json:"model"`
+	Prompt  string         `json:"prompt"`
+	System  string         `json:"system,omitempty"`
+	Stream  bool           `json:"stream"`
+	Format  string         `json:"format,omitempty"`
+	Options map[string]any `json:"options"`
+}
+
+// ollamaStreamLine is one NDJSON line of a streamed /api/generate or /api/pull reply.
+type ollamaStreamLine struct {
+	Response  string `json:"response"`
+	Done      bool   `json:"done"`
+	Status    string `json:"status"`
+	Total     int64  `json:"total"`
+	Completed int64  `json:"completed"`
+	Error     string `json:"error"`
+}
+
+func (c *OllamaClient) Generate(ctx context.Context, prompt string) (string, error) {
+	return c.GenerateWithOptions(ctx, prompt, GenerateOptions{})
+}
+
+// GenerateWithOptions calls /api/generate. The reply is always streamed so that
+// OnToken, when set, sees each piece as it arrives.
+func (c *OllamaClient) GenerateWithOptions(ctx context.Context, prompt string, opts GenerateOptions) (string, error) {
+	options := map[string]any{"temperature": opts.Temperature}
+	if c.NumCtx > 0 {
+		options["num_ctx"] = c.NumCtx
+	}
+	if opts.MaxTokens > 0 {
+		options["num_predict"] = opts.MaxTokens
+	}
+	if len(opts.Stop) > 0 {
+		options["stop"] = opts.Stop
+	}
+	req := ollamaGenerateRequest{Model: c.Model, Prompt: prompt, System: opts.System, Stream: true, Options: options}
+	if opts.JSON {
+		req.Format = "json"
+	}
+	body, err := c.request(ctx, "POST", "/api/generate", req, true,
+		estimateTokens(opts.System, prompt)+opts.MaxTokens)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	var reply strings.Builder
+	err = readOllamaStream(body, func(line ollamaStreamLine) error {
+		if line.Response == "" {
+			return nil
+		}
+		reply.WriteString(line.Response)
+		if opts.OnToken != nil {
+			return opts.OnToken(line.Response)
+		}
+		return nil
+	})
+	return reply.String(), err
+}
+
+// readOllamaStream calls fn for each NDJSON line until one has done set or the
+// stream ends. An {"error": ...} line ends the stream with an *APIError.
+func readOllamaStream(r io.Reader, fn func(ollamaStreamLine) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		data := scanner.Bytes()
+		if len(strings.TrimSpace(string(data))) == 0 {
+			continue
+		}
+		var line ollamaStreamLine
+		if err := json.Unmarshal(data, &line); err != nil {
+			return fmt.Errorf("decode stream line: %w", err)
+		}
+		if line.Error != "" {
+			return parseAPIError(0, data)
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+		if line.Done {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// OllamaModel is an installed model as listed by /api/tags.
+type OllamaModel struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// ListModels returns the models installed in Ollama.
+func (c *OllamaClient) ListModels(ctx context.Context) ([]OllamaModel, error) {
+	body, err := c.request(ctx, "GET", "/api/tags", nil, false, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	var res struct {
+		Models []OllamaModel `json:"models"`
+	}
+	if err := json.NewDecoder(body).Decode(&res); err != nil {
+		return nil, err
+	}
+	return res.Models, nil
+}
+
+// HasModel reports whether c.Model is installed; a name without a tag matches ":latest".
+func (c *OllamaClient) HasModel(ctx context.Context) (bool, error) {
+	models, err := c.ListModels(ctx)
+	if err != nil {
+		return false, err
+	}
+	want := c.Model
+	if !strings.Contains(want, ":") {
+		want += ":latest"
+	}
+	for _, m := range models {
+		if m.Name == c.Model || m.Name == want {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// OllamaModelInfo is what /api/show reports about a model; zero when unknown.
+type OllamaModelInfo struct {
+	EmbeddingLength int
+	ContextLength   int
+}
+
+// ShowModel reads the model's embedding size and context length from /api/show.
+func (c *OllamaClient) ShowModel(ctx context.Context) (*OllamaModelInfo, error) {
+	body, err := c.request(ctx, "POST", "/api/show", map[string]string{"model": c.Model}, false, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	var res struct {
+		ModelInfo map[string]any `json:"model_info"`
+	}
+	if err := json.NewDecoder(body).Decode(&res); err != nil {
+		return nil, err
+	}
+	// Keys are prefixed with the architecture, e.g. "nomic-bert.embedding_length".
+	info := &OllamaModelInfo{}
+	for k, v := range res.ModelInfo {
+		n, ok := v.(float64)
+		if !ok {
+			continue
+		}
+		switch {
+		case strings.HasSuffix(k, ".embedding_length"):
+			info.EmbeddingLength = int(n)
+		case strings.HasSuffix(k, ".context_length"):
+			info.ContextLength = int(n)
+		}
+	}
+	return info, nil
+}
+
+// PullModel downloads c.Model, calling progress (if non-nil) with each status update.
+// completed and total are byte counts for the layer being downloaded, 0 otherwise.
+func (c *OllamaClient) PullModel(ctx context.Context, progress func(status string, completed, total int64)) error {
+	// A pull can take far longer than one request timeout; ctx still cancels it.
+	pull := *c
+	pull.Timeout = 0
+	body, err := pull.request(ctx, "POST", "/api/pull", map[string]any{"model": c.Model, "stream": true}, true, 0)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	success := false
+	err = readOllamaStream(body, func(line ollamaStreamLine) error {
+		success = line.Status == "success"
+		if progress != nil {
+			progress(line.Status, line.Completed, line.Total)
+		}
+		return nil
+	})
+	if err == nil && !success {
+		err = fmt.Errorf("pull %s: stream ended before success", c.Model)
+	}
+	return err
+}
+
+// EnsureModel pulls c.Model if it is not installed. It reports whether a pull happened.
+func (c *OllamaClient) EnsureModel(ctx context.Context, progress func(status string, completed, total int64)) (bool, error) {
+	ok, err := c.HasModel(ctx)
+	if err != nil || ok {
+		return false, err
+	}
+	return true, c.PullModel(ctx, progress)
+}
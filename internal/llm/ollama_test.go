@@ -0,0 +1,163 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeOllama is a stand-in for the Ollama daemon with a set of installed models.
+func fakeOllama(t *testing.T, installed map[string]bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model  string          `json:"model"`
+			Input  []string        `json:"input"`
+			Prompt string          `json:"prompt"`
+			System string          `json:"system"`
+			Stream bool            `json:"stream"`
+			Opts   map[string]any  `json:"options"`
+			Format json.RawMessage `json:"format"`
+		}
+		if r.Body != nil {
+			json.NewDecoder(r.Body).Decode(&req)
+		}
+		notFound := func() {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"error":"model %q not found, try pulling it first"}`, req.Model)
+		}
+		switch r.URL.Path {
+		case "/api/tags":
+			var models []string
+			for m := range installed {
+				models = append(models, fmt.Sprintf(`{"name":%q,"size":1000}`, m))
+			}
+			fmt.Fprintf(w, `{"models":[%s]}`, strings.Join(models, ","))
+		case "/api/show":
+			if !installed[req.Model+":latest"] {
+				notFound()
+				return
+			}
+			fmt.Fprint(w, `{"model_info":{"general.architecture":"nomic-bert","nomic-bert.embedding_length":768,"nomic-bert.context_length":2048}}`)
+		case "/api/pull":
+			for _, line := range []string{
+				`{"status":"pulling manifest"}`,
+				`{"status":"pulling 970aa74c0a90","digest":"sha256:970aa74c0a90","total":200,"completed":100}`,
+				`{"status":"pulling 970aa74c0a90","digest":"sha256:970aa74c0a90","total":200,"completed":200}`,
+				`{"status":"success"}`,
+			} {
+				fmt.Fprintln(w, line)
+			}
+			installed[req.Model+":latest"] = true
+		case "/api/embed":
+			if !installed[req.Model+":latest"] {
+				notFound()
+				return
+			}
+			vecs := make([]string, len(req.Input))
+			for i, in := range req.Input {
+				vecs[i] = fmt.Sprintf("[%d,1]", len(in))
+			}
+			fmt.Fprintf(w, `{"model":%q,"embeddings":[%s]}`, req.Model, strings.Join(vecs, ","))
+		case "/api/generate":
+			if req.System != "Be brief." || req.Opts["num_predict"] != float64(8) || string(req.Format) != `"json"` {
+				t.Errorf("Unexpected generate request %+v", req)
+			}
+			for _, tok := range []string{"He", "llo"} {
+				fmt.Fprintf(w, "{\"response\":%q,\"done\":false}\n", tok)
+			}
+			fmt.Fprintln(w, `{"response":"","done":true,"done_reason":"stop"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestOllamaEmbedAndPull(t *testing.T) {
+	installed := map[string]bool{"llama3:latest": true}
+	srv := fakeOllama(t, installed)
+	defer srv.Close()
+	c := NewOllamaClient(srv.URL+"/", "nomic-embed-text")
+	ctx := context.Background()
+
+	if _, err := c.Embed(ctx, "x"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected model-not-found error, got %v", err)
+	}
+	if ok, err := c.HasModel(ctx); ok || err != nil {
+		t.Fatalf("HasModel = %v, %v before pull", ok, err)
+	}
+
+	var statuses []string
+	pulled, err := c.EnsureModel(ctx, func(status string, completed, total int64) {
+		statuses = append(statuses, fmt.Sprintf("%s %d/%d", status, completed, total))
+	})
+	if err != nil || !pulled {
+		t.Fatalf("EnsureModel = %v, %v", pulled, err)
+	}
+	if len(statuses) != 4 || statuses[2] != "pulling 970aa74c0a90 200/200" {
+		t.Errorf("Pull progress = %q", statuses)
+	}
+	if pulled, err := c.EnsureModel(ctx, nil); pulled || err != nil {
+		t.Errorf("Second EnsureModel = %v, %v; want no pull", pulled, err)
+	}
+
+	info, err := c.ShowModel(ctx)
+	if err != nil || info.EmbeddingLength != 768 || info.ContextLength != 2048 {
+		t.Errorf("ShowModel = %+v, %v", info, err)
+	}
+	results, err := c.BatchEmbed(ctx, []string{"a", "bbb"})
+	if err != nil || len(results) != 2 || results[1].Embedding[0] != 3 {
+		t.Errorf("BatchEmbed = %+v, %v", results, err)
+	}
+}
+
+func TestOllamaGenerate(t *testing.T) {
+	srv := fakeOllama(t, nil)
+	defer srv.Close()
+
+	var tokens []string
+	out, err := NewOllamaClient(srv.URL, "llama3").GenerateWithOptions(context.Background(), "hi", GenerateOptions{
+		System: "Be brief.", MaxTokens: 8, JSON: true,
+		OnToken: func(tok string) error { tokens = append(tokens, tok); return nil },
+	})
+	if err != nil || out != "Hello" || len(tokens) != 2 {
+		t.Errorf("Generate = %q via %q, %v", out, tokens, err)
+	}
+
+	err = readOllamaStream(strings.NewReader(`{"response":"a"}`+"\n"+`{"error":"rate limit exceeded"}`+"\n"),
+		func(ollamaStreamLine) error { return nil })
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Stream error = %v, want ErrRateLimited", err)
+	}
+}
+
+func TestOllamaUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	c := NewOllamaClient(url, "m")
+	c.MaxRetries = 0
+	_, err := c.ListModels(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "ollama serve") {
+		t.Errorf("Expected a hint to start Ollama, got %v", err)
+	}
+}
+
+func TestOllamaBaseURL(t *testing.T) {
+	for in, want := range map[string]string{
+		"":                            "http://localhost:11434",
+		"0.0.0.0:11434":               "http://0.0.0.0:11434",
+		"http://gpu-box:11434/v1":     "http://gpu-box:11434",
+		"https://ollama.example.com/": "https://ollama.example.com",
+	} {
+		t.Setenv("OLLAMA_HOST", in)
+		if got := OllamaBaseURL(); got != want {
+			t.Errorf("OllamaBaseURL(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -1,18 +1,23 @@
 package llm
 
 import (
-	"bytes"
+	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
+	"strings"
 )
 
 type OpenAIClient struct {
 	BaseURL string
 	APIKey  string
 	Model   string
+	// Dimensions asks for shortened vectors (OpenAI text-embedding-3) and is checked
+	// against every embedding returned; 0 = the model's own size.
+	Dimensions int
+	httpSettings
 }
 
 func NewOpenAIClient(baseURL, model string) *OpenAIClient {
@@ -20,54 +25,55 @@ func NewOpenAIClient(baseURL, model string) *OpenAIClient {
 		baseURL = "http://localhost:11434/v1" // Default to Ollama
 	}
 	return &OpenAIClient{
-		BaseURL: baseURL,
-		APIKey:  os.Getenv("OPENAI_API_KEY"),
-		Model:   model,
+		BaseURL:      baseURL,
+		APIKey:       os.Getenv("OPENAI_API_KEY"),
+		Model:        model,
+		httpSettings: defaultHTTPSettings(),
 	}
 }
 
 type embeddingRequest struct {
-	Input string `json:"input"`
-	Model string `json:"model"`
+	Input      interface{} `json:"input"` // a string, or an array of strings for a batch
+	Model      string      `json:"model"`
+	Dimensions int         `json:"dimensions,omitempty"`
 }
 
 type embeddingResponse struct {
 	Data []struct {
+		Index     int       `json:"index"`
 		Embedding []float32 `json:"embedding"`
 	} `json:"data"`
 }
 
-func (c *OpenAIClient) Embed(text string) (*EmbeddingResult, error) {
-	reqBody := embeddingRequest{
-		Input: text,
-		Model: c.Model,
-	}
-	data, err := json.Marshal(reqBody)
+func (c *OpenAIClient) Embed(ctx context.Context, text string) (*EmbeddingResult, error) {
+	results, err := c.embed(ctx, text, 1, estimateTokens(text))
 	if err != nil {
 		return nil, err
 	}
+	return results[0], nil
+}
+
+// BatchEmbed embeds texts in one request by sending input as an array. Results are
+// returned in the order of texts, whatever order the server lists them in.
+func (c *OpenAIClient) BatchEmbed(ctx context.Context, texts []string) ([]*EmbeddingResult, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	return c.embed(ctx, texts, len(texts), estimateTokens(texts...))
+}
 
-	req, err := http.NewRequest("POST", c.BaseURL+"/embeddings", bytes.NewBuffer(data))
+// embed posts input (a string or []string of n texts) to /embeddings.
+func (c *OpenAIClient) embed(ctx context.Context, input interface{}, n, tokens int) ([]*EmbeddingResult, error) {
+	data, err := json.Marshal(embeddingRequest{Input: input, Model: c.Model, Dimensions: c.Dimensions})
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	if c.APIKey != "" {
-		req.Header.Set("Authorization", "Bearer "+c.APIKey)
-	}
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := c.post(ctx, c.BaseURL+"/embeddings", c.APIKey, data, false, tokens)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error: %s", string(body))
-	}
-
 	var res embeddingResponse
 	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
 		return nil, err
@@ -76,14 +82,138 @@ func (c *OpenAIClient) Embed(text string) (*EmbeddingResult, error) {
 	if len(res.Data) == 0 {
 		return nil, fmt.Errorf("no embedding returned")
 	}
+	if len(res.Data) != n {
+		return nil, fmt.Errorf("got %d embeddings for %d inputs", len(res.Data), n)
+	}
+
+	results := make([]*EmbeddingResult, n)
+	for _, d := range res.Data {
+		if d.Index < 0 || d.Index >= n || results[d.Index] != nil {
+			return nil, fmt.Errorf("embedding response has invalid index %d", d.Index)
+		}
+		if err := checkDimensions(c.Model, d.Embedding, c.Dimensions); err != nil {
+			return nil, err
+		}
+		results[d.Index] = &EmbeddingResult{Embedding: d.Embedding, Model: c.Model}
+	}
+	return results, nil
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model          string          `json:"model"`
+	Messages       []chatMessage   `json:"messages"`
+	Temperature    float64         `json:"temperature"`
+	MaxTokens      int             `json:"max_tokens,omitempty"`
+	Stop           []string        `json:"stop,omitempty"`
+	ResponseFormat *responseFormat `json:"response_format,omitempty"`
+	Stream         bool            `json:"stream,omitempty"`
+}
+
+type responseFormat struct {
+	Type string `json:"type"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+		Delta   chatMessage `json:"delta"`
+	} `json:"choices"`
+	Error json.RawMessage `json:"error"`
+}
 
-	return &EmbeddingResult{
-		Embedding: res.Data[0].Embedding,
-		Model:     c.Model,
-	}, nil
+// Generate sends prompt as a single user message with default options.
+func (c *OpenAIClient) Generate(ctx context.Context, prompt string) (string, error) {
+	return c.GenerateWithOptions(ctx, prompt, GenerateOptions{})
 }
 
-func (c *OpenAIClient) Generate(prompt string) (string, error) {
-	// Stub implementation for Generate
-	return "", fmt.Errorf("not implemented")
+// GenerateWithOptions calls /chat/completions. With opts.OnToken set the response is
+// streamed (SSE) and each content delta is passed to OnToken as it arrives; the full
+// reply is returned either way. Error responses are returned as *APIError.
+func (c *OpenAIClient) GenerateWithOptions(ctx context.Context, prompt string, opts GenerateOptions) (string, error) {
+	var messages []chatMessage
+	if opts.System != "" {
+		messages = append(messages, chatMessage{Role: "system", Content: opts.System})
+	}
+	reqBody := chatRequest{
+		Model:       c.Model,
+		Messages:    append(messages, chatMessage{Role: "user", Content: prompt}),
+		Temperature: opts.Temperature,
+		MaxTokens:   opts.MaxTokens,
+		Stop:        opts.Stop,
+		Stream:      opts.OnToken != nil,
+	}
+	if opts.JSON {
+		reqBody.ResponseFormat = &responseFormat{Type: "json_object"}
+	}
+	data, err := json.Marshal(reqBody)
+	if err != nil {
+		return "", err
+	}
+
+	tokens := estimateTokens(opts.System, prompt) + opts.MaxTokens
+	resp, err := c.post(ctx, c.BaseURL+"/chat/completions", c.APIKey, data, reqBody.Stream, tokens)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if reqBody.Stream {
+		return readChatStream(resp.Body, opts.OnToken)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	var res chatResponse
+	if err := json.Unmarshal(body, &res); err != nil {
+		return "", err
+	}
+	if len(res.Error) > 0 {
+		return "", parseAPIError(0, body)
+	}
+	if len(res.Choices) == 0 {
+		return "", fmt.Errorf("no completion returned")
+	}
+	return res.Choices[0].Message.Content, nil
+}
+
+// readChatStream reads a server-sent event stream of chat completion chunks until
+// "data: [DONE]" or EOF, calling onToken with each content delta.
+func readChatStream(r io.Reader, onToken func(string) error) (string, error) {
+	var reply strings.Builder
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		payload, ok := strings.CutPrefix(line, "data:")
+		if !ok {
+			continue // blank separators, comments, "event:" lines
+		}
+		payload = strings.TrimSpace(payload)
+		if payload == "[DONE]" {
+			break
+		}
+		var chunk chatResponse
+		if err := json.Unmarshal([]byte(payload), &chunk); err != nil {
+			return reply.String(), fmt.Errorf("decode stream chunk: %w", err)
+		}
+		if len(chunk.Error) > 0 {
+			return reply.String(), parseAPIError(0, []byte(payload))
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+		token := chunk.Choices[0].Delta.Content
+		reply.WriteString(token)
+		if err := onToken(token); err != nil {
+			return reply.String(), err
+		}
+	}
+	return reply.String(), scanner.Err()
 }
@@ -0,0 +1,168 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOpenAIGenerate(t *testing.T) {
+	var got chatRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"lex: auth flow"}}]}`))
+	}))
+	defer srv.Close()
+
+	out, err := NewOpenAIClient(srv.URL+"/v1", "expander").Generate(context.Background(), "expand: auth")
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if out != "lex: auth flow" {
+		t.Errorf("Generate = %q", out)
+	}
+	if got.Model != "expander" || len(got.Messages) != 1 || got.Messages[0].Content != "expand: auth" {
+		t.Errorf("Unexpected request %+v", got)
+	}
+}
+
+func TestOpenAIBatchEmbed(t *testing.T) {
+	var got struct {
+		Input []string `json:"input"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		// Listed out of order: results must follow the index field.
+		w.Write([]byte(`{"data":[{"index":1,"embedding":[0,1]},{"index":0,"embedding":[1,0]},{"index":2,"embedding":[1,1]}]}`))
+	}))
+	defer srv.Close()
+
+	results, err := NewOpenAIClient(srv.URL, "m").BatchEmbed(context.Background(), []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatalf("BatchEmbed failed: %v", err)
+	}
+	if len(got.Input) != 3 || got.Input[2] != "c" {
+		t.Errorf("Expected an input array, got %q", got.Input)
+	}
+	if len(results) != 3 || results[0].Embedding[0] != 1 || results[1].Embedding[1] != 1 || results[2].Embedding[0] != 1 {
+		t.Errorf("Results not in input order: %+v", results)
+	}
+
+	if _, err := NewOpenAIClient(srv.URL, "m").BatchEmbed(context.Background(), []string{"a", "b"}); err == nil {
+		t.Error("Expected an error when the result count does not match the inputs")
+	}
+}
+
+func TestOpenAIGenerateStream(t *testing.T) {
+	var got chatRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, tok := range []string{"Hel", "lo", "!"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", tok)
+		}
+		fmt.Fprint(w, ": keep-alive\n\ndata: {\"choices\":[{\"delta\":{},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n")
+	}))
+	defer srv.Close()
+
+	var tokens []string
+	out, err := NewOpenAIClient(srv.URL, "m").GenerateWithOptions(context.Background(), "hi", GenerateOptions{
+		System: "Be brief.", Temperature: 0.7, MaxTokens: 16, Stop: []string{"\n\n"}, JSON: true,
+		OnToken: func(tok string) error { tokens = append(tokens, tok); return nil },
+	})
+	if err != nil {
+		t.Fatalf("GenerateWithOptions failed: %v", err)
+	}
+	if out != "Hello!" || len(tokens) != 3 {
+		t.Errorf("Stream = %q via %q", out, tokens)
+	}
+	if !got.Stream || got.MaxTokens != 16 || got.Temperature != 0.7 || len(got.Stop) != 1 ||
+		got.ResponseFormat == nil || got.ResponseFormat.Type != "json_object" ||
+		len(got.Messages) != 2 || got.Messages[0].Role != "system" || got.Messages[1].Content != "hi" {
+		t.Errorf("Unexpected request %+v", got)
+	}
+
+	stop := errors.New("enough")
+	out, err = NewOpenAIClient(srv.URL, "m").GenerateWithOptions(context.Background(), "hi", GenerateOptions{
+		OnToken: func(string) error { return stop },
+	})
+	if !errors.Is(err, stop) || out != "Hel" {
+		t.Errorf("Aborted stream = %q, %v", out, err)
+	}
+}
+
+func TestOpenAIErrors(t *testing.T) {
+	cases := []struct {
+		status  int
+		header  string
+		body    string
+		want    error
+		message string
+	}{
+		{429, "7", `{"error":{"message":"Slow down","type":"rate_limit_error"}}`, ErrRateLimited, "Slow down"},
+		{401, "", `{"error":{"message":"Incorrect API key provided","code":"invalid_api_key"}}`, ErrAuth, "Incorrect API key provided"},
+		{400, "", `{"error":{"message":"This model's maximum context length is 4096 tokens","code":"context_length_exceeded"}}`, ErrContextLength, "This model's maximum context length is 4096 tokens"},
+		{400, "", `{"error":{"code":400,"message":"the request exceeds the available context size","type":"exceed_context_size_error"}}`, ErrContextLength, "the request exceeds the available context size"},
+		{404, "", `{"error":"model \"x\" not found, try pulling it first"}`, nil, `model "x" not found, try pulling it first`},
+		{500, "", `upstream crashed`, nil, "upstream crashed"},
+	}
+	for _, c := range cases {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if c.header != "" {
+				w.Header().Set("Retry-After", c.header)
+			}
+			w.WriteHeader(c.status)
+			w.Write([]byte(c.body))
+		}))
+		client := NewOpenAIClient(srv.URL, "m")
+		client.MaxRetries = 0
+		_, err := client.Generate(context.Background(), "hi")
+		srv.Close()
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Errorf("HTTP %d: expected *APIError, got %v", c.status, err)
+			continue
+		}
+		if apiErr.StatusCode != c.status || apiErr.Message != c.message {
+			t.Errorf("HTTP %d: got %+v", c.status, apiErr)
+		}
+		if c.want != nil && !errors.Is(err, c.want) {
+			t.Errorf("HTTP %d: expected errors.Is(%v)", c.status, c.want)
+		}
+		if c.want == nil && (errors.Is(err, ErrRateLimited) || errors.Is(err, ErrAuth) || errors.Is(err, ErrContextLength)) {
+			t.Errorf("HTTP %d: unexpected kind %v", c.status, apiErr.Unwrap())
+		}
+		if c.header != "" && apiErr.RetryAfter != 7*time.Second {
+			t.Errorf("HTTP %d: RetryAfter = %v", c.status, apiErr.RetryAfter)
+		}
+	}
+
+	// Errors can also arrive inside a stream.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"a\"}}]}\n\ndata: {\"error\":{\"message\":\"Rate limit reached\"}}\n\n")
+	}))
+	defer srv.Close()
+	_, err := NewOpenAIClient(srv.URL, "m").GenerateWithOptions(context.Background(), "hi", GenerateOptions{OnToken: func(string) error { return nil }})
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Stream error = %v, want ErrRateLimited", err)
+	}
+}
+
+func TestApplyStop(t *testing.T) {
+	if got := applyStop("lex: a\nvec: b\n\nextra", []string{"\n\n", "vec:"}); got != "lex: a\n" {
+		t.Errorf("applyStop = %q", got)
+	}
+	if got := applyStop("abc", nil); got != "abc" {
+		t.Errorf("applyStop = %q", got)
+	}
+}
@@ -0,0 +1,143 @@
+package llm
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ba0f3/qmd-go/internal/config"
+)
+
+// Profile is how an embedding model expects its input. Retrieval models are trained
+// with specific query and document prefixes, and embedding text without them (or
+// with another model's) measurably lowers recall.
+type Profile struct {
+	Name string
+	config.ProfileConfig
+}
+
+// defaultProfile is used for models no profile matches: EmbeddingGemma's task
+// prefixes, the format qmd has always used.
+var defaultProfile = Profile{Name: "default", ProfileConfig: config.ProfileConfig{
+	QueryTemplate:    "task: search result | query: {query}",
+	DocumentTemplate: "title: {title} | text: {text}",
+}}
+
+const (
+	bgeInstruction  = "Represent this sentence for searching relevant passages: {query}"
+	qwenInstruction = "Instruct: Given a web search query, retrieve relevant passages that answer the query\nQuery: {query}"
+)
+
+// builtinProfiles are tried in order, so more specific matches come first (bge-m3
+// before bge, e5-mistral before e5). Limits are the models' own, capped at 8192.
+var builtinProfiles = []Profile{
+	builtin("embeddinggemma", []string{"embeddinggemma", "embedding-gemma"},
+		"task: search result | query: {query}", "title: {title} | text: {text}", true, 2048),
+	builtin("nomic", []string{"nomic-embed"}, "search_query: {query}", "search_document: {text}", true, 8192),
+	builtin("qwen3-embedding", []string{"qwen3-embedding", "qwen3-embed"}, qwenInstruction, "{text}", true, 8192),
+	builtin("gte-qwen", []string{"gte-qwen"}, qwenInstruction, "{text}", true, 8192),
+	builtin("e5-mistral", []string{"e5-mistral"}, qwenInstruction, "{text}", true, 4096),
+	builtin("e5", []string{"e5-small", "e5-base", "e5-large"}, "query: {query}", "passage: {text}", true, 512),
+	builtin("bge-m3", []string{"bge-m3"}, "{query}", "{text}", true, 8192),
+	builtin("bge-zh", []string{"bge-small-zh", "bge-base-zh", "bge-large-zh"},
+		"为这个句子生成表示以用于检索相关文章：{query}", "{text}", true, 512),
+	builtin("bge", []string{"bge-small", "bge-base", "bge-large"}, bgeInstruction, "{text}", true, 512),
+	builtin("mxbai", []string{"mxbai-embed"}, bgeInstruction, "{text}", true, 512),
+	builtin("arctic-embed2", []string{"arctic-embed2", "arctic-embed-l-v2", "arctic-embed-m-v2"},
+		"query: {query}", "{text}", true, 8192),
+	builtin("arctic-embed", []string{"arctic-embed"}, bgeInstruction, "{text}", true, 512),
+	builtin("gte", []string{"gte-small", "gte-base", "gte-large"}, "{query}", "{text}", true, 512),
+	builtin("minilm", []string{"minilm"}, "{query}", "{text}", true, 256),
+	// OpenAI's vectors are already unit length.
+	builtin("openai", []string{"text-embedding-3", "text-embedding-ada"}, "{query}", "{text}", false, 8191),
+}
+
+func builtin(name string, match []string, query, doc string, normalize bool, maxTokens int) Profile {
+	return Profile{Name: name, ProfileConfig: config.ProfileConfig{
+		Match: match, QueryTemplate: query, DocumentTemplate: doc, Normalize: normalize, MaxTokens: maxTokens,
+	}}
+}
+
+// Profiles returns the custom profiles from cfg, by name, followed by the built-in
+// ones they do not replace. This is also the order in which profiles are matched.
+func Profiles(cfg *config.Config) []Profile {
+	var out []Profile
+	custom := map[string]bool{}
+	if cfg != nil {
+		for name, p := range cfg.Profiles {
+			out = append(out, Profile{Name: name, ProfileConfig: p})
+			custom[name] = true
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	for _, p := range builtinProfiles {
+		if !custom[p.Name] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// LookupProfile returns the profile for model: the one called name if name is set
+// (a ModelConfig's profile, else QMD_EMBED_PROFILE), otherwise the first whose Match
+// is a substring of the model spec, otherwise the default.
+func LookupProfile(cfg *config.Config, name, model string) (Profile, error) {
+	if name == "" {
+		name = os.Getenv("QMD_EMBED_PROFILE")
+	}
+	profiles := Profiles(cfg)
+	if name != "" {
+		if name == defaultProfile.Name {
+			return defaultProfile, nil
+		}
+		for _, p := range profiles {
+			if p.Name == name {
+				return p, nil
+			}
+		}
+		return Profile{}, fmt.Errorf("unknown embedding profile %q", name)
+	}
+	spec := strings.ToLower(model)
+	for _, p := range profiles {
+		for _, m := range p.Match {
+			if m != "" && strings.Contains(spec, strings.ToLower(m)) {
+				return p, nil
+			}
+		}
+	}
+	return defaultProfile, nil
+}
+
+// bytesPerToken is a conservative estimate for truncating to a token limit; dense
+// scripts and code take more tokens per byte than English prose.
+const bytesPerToken = 3
+
+// truncateTokens cuts text to about maxTokens tokens at a UTF-8 boundary.
+func truncateTokens(text string, maxTokens int) string {
+	limit := maxTokens * bytesPerToken
+	if maxTokens <= 0 || len(text) <= limit {
+		return text
+	}
+	for limit > 0 && !utf8.RuneStart(text[limit]) {
+		limit--
+	}
+	return text[:limit]
+}
+
+// normalizeL2 scales v to unit length in place; a zero vector is left as is.
+func normalizeL2(v []float32) {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return
+	}
+	inv := 1 / math.Sqrt(sum)
+	for i := range v {
+		v[i] = float32(float64(v[i]) * inv)
+	}
+}
@@ -0,0 +1,95 @@
+package llm
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/ba0f3/qmd-go/internal/config"
+)
+
+func TestLookupProfile(t *testing.T) {
+	t.Setenv("QMD_EMBED_PROFILE", "")
+	for model, want := range map[string]string{
+		"nomic-embed-text": "nomic",
+		"nomic-ai/nomic-embed-text-v1.5-GGUF:nomic-embed-text-v1.5.Q8_0.gguf": "nomic",
+		"ggml-org/embeddinggemma-300M-GGUF:embeddinggemma-300M-Q8_0.gguf":     "embeddinggemma",
+		"Qwen/Qwen3-Embedding-0.6B-GGUF:Qwen3-Embedding-0.6B-Q8_0.gguf":       "qwen3-embedding",
+		"intfloat/multilingual-e5-large":                                      "e5",
+		"bge-m3":                                                              "bge-m3",
+		"BAAI/bge-small-en-v1.5":                                              "bge",
+		"BAAI/bge-large-zh-v1.5":                                              "bge-zh",
+		"mxbai-embed-large":                                                   "mxbai",
+		"snowflake-arctic-embed2":                                             "arctic-embed2",
+		"snowflake-arctic-embed:335m":                                         "arctic-embed",
+		"all-minilm":                                                          "minilm",
+		"text-embedding-3-small":                                              "openai",
+		"some-new-embedder":                                                   "default",
+	} {
+		p, err := LookupProfile(nil, "", model)
+		if err != nil || p.Name != want {
+			t.Errorf("LookupProfile(%q) = %q, %v; want %q", model, p.Name, err, want)
+		}
+	}
+
+	cfg := &config.Config{Profiles: map[string]config.ProfileConfig{
+		"house": {Match: []string{"House-Embed"}, QueryTemplate: "q: {query}", DocumentTemplate: "d: {text}"},
+		"nomic": {Match: []string{"nomic-embed"}, QueryTemplate: "{query}", DocumentTemplate: "{text}"},
+	}}
+	if p, _ := LookupProfile(cfg, "", "acme/house-embed-v2"); p.Name != "house" {
+		t.Errorf("Expected a custom profile to match, got %q", p.Name)
+	}
+	if p, _ := LookupProfile(cfg, "", "nomic-embed-text"); p.QueryTemplate != "{query}" {
+		t.Errorf("Expected the custom nomic profile to replace the built-in, got %+v", p)
+	}
+	if p, err := LookupProfile(cfg, "bge", "nomic-embed-text"); err != nil || p.Name != "bge" {
+		t.Errorf("Expected an explicit profile to win over matching, got %q, %v", p.Name, err)
+	}
+	t.Setenv("QMD_EMBED_PROFILE", "house")
+	if p, _ := LookupProfile(cfg, "", "nomic-embed-text"); p.Name != "house" {
+		t.Errorf("Expected QMD_EMBED_PROFILE to select the profile, got %q", p.Name)
+	}
+	if _, err := LookupProfile(cfg, "missing", "x"); err == nil {
+		t.Error("Expected an error for an unknown profile")
+	}
+}
+
+func TestEmbedModelProfile(t *testing.T) {
+	t.Setenv("QMD_EMBED_PROFILE", "")
+	t.Setenv("QMD_EMBED_MODEL", "")
+	cfg := &config.Config{
+		EmbedModel: "e5",
+		Models: map[string]config.ModelConfig{
+			"e5":    {Kind: "ollama", Model: "jeffh/intfloat-multilingual-e5-large:f16"},
+			"typo":  {Kind: "ollama", Model: "x", Profile: "nomc"},
+			"house": {Kind: "ollama", Model: "x", Profile: "nomic", QueryTemplate: "find: {query}"},
+		},
+	}
+	m, err := ResolveEmbedModel(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q := m.FormatQuery("auth"); q != "query: auth" {
+		t.Errorf("FormatQuery = %q", q)
+	}
+	doc := m.FormatDocument("Title", strings.Repeat("é", 2000))
+	if !strings.HasPrefix(doc, "passage: éé") || len(doc) > 512*bytesPerToken || !strings.HasSuffix(doc, "é") {
+		t.Errorf("Expected the document truncated to the model's limit at a rune boundary, got %d bytes", len(doc))
+	}
+
+	vec := []float32{3, 4}
+	m.Normalize(vec)
+	if math.Abs(float64(vec[0])-0.6) > 1e-6 || math.Abs(float64(vec[1])-0.8) > 1e-6 {
+		t.Errorf("Normalize = %v", vec)
+	}
+
+	cfg.EmbedModel = "house"
+	m, _ = ResolveEmbedModel(cfg, "")
+	if q, d := m.FormatQuery("auth"), m.FormatDocument("", "body"); q != "find: auth" || d != "search_document: body" {
+		t.Errorf("Expected config templates over the profile's, got %q and %q", q, d)
+	}
+	cfg.EmbedModel = "typo"
+	if _, err := ResolveEmbedModel(cfg, ""); err == nil || !strings.Contains(err.Error(), "nomc") {
+		t.Errorf("Expected an unknown profile error, got %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// Reranker scores documents against a query with a cross-encoder. Scores are aligned
+// with documents and lie in [0, 1], higher meaning more relevant.
+type Reranker interface {
+	Rerank(ctx context.Context, query string, documents []string) ([]float64, error)
+}
+
+// ErrNoReranker is returned by NewReranker when no reranking backend is configured.
+var ErrNoReranker = errors.New("no reranker configured (set QMD_RERANK_URL or build with -tags gguf)")
+
+// NewReranker returns a Reranker for model. QMD_RERANK_BACKEND=gguf or a GGUF model
+// spec selects the local llama_go library; QMD_RERANK_BACKEND=api or QMD_RERANK_URL
+// selects an HTTP /rerank endpoint. GGUF builds default to local, API builds to HTTP.
+func NewReranker(model string) (Reranker, error) {
+	backend := os.Getenv("QMD_RERANK_BACKEND")
+	baseURL := os.Getenv("QMD_RERANK_URL")
+	useGGUF := backend == "gguf" || isGGUFSpec(model) || (GGUFEnabled() && backend != "api" && baseURL == "")
+	if useGGUF {
+		return newPuregoReranker(model)
+	}
+	if baseURL == "" {
+		return nil, ErrNoReranker
+	}
+	return NewHTTPReranker(baseURL, model), nil
+}
+
+// HTTPReranker calls a Jina/Cohere-style rerank endpoint (POST {BaseURL}/rerank), as
+// served by llama.cpp's llama-server --reranking, Jina, Cohere, TEI and Infinity.
+type HTTPReranker struct {
+	BaseURL string
+	APIKey  string
+	Model   string
+	httpSettings
+}
+
+func NewHTTPReranker(baseURL, model string) *HTTPReranker {
+	return &HTTPReranker{
+		BaseURL:      strings.TrimSuffix(baseURL, "/"),
+		APIKey:       os.Getenv("QMD_RERANK_API_KEY"),
+		Model:        model,
+		httpSettings: defaultHTTPSettings(),
+	}
+}
+
+type rerankRequest struct {
+	Model     string   `json:"model,omitempty"`
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+	TopN      int      `json:"top_n"`
+}
+
+type rerankResponse struct {
+	Results []struct {
+		Index          int      `json:"index"`
+		RelevanceScore *float64 `json:"relevance_score"`
+		Score          *float64 `json:"score"`
+	} `json:"results"`
+}
+
+func (c *HTTPReranker) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	if len(documents) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(rerankRequest{Model: c.Model, Query: query, Documents: documents, TopN: len(documents)})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.post(ctx, c.BaseURL+"/rerank", c.APIKey, data, false, estimateTokens(query)+estimateTokens(documents...))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var res rerankResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+	scores := make([]float64, len(documents))
+	logits := false
+	for _, r := range res.Results {
+		if r.Index < 0 || r.Index >= len(documents) {
+			return nil, fmt.Errorf("rerank API returned index %d for %d documents", r.Index, len(documents))
+		}
+		switch {
+		case r.RelevanceScore != nil:
+			scores[r.Index] = *r.RelevanceScore
+		case r.Score != nil:
+			scores[r.Index] = *r.Score
+		}
+		logits = logits || scores[r.Index] < 0 || scores[r.Index] > 1
+	}
+	// Hosted APIs return probabilities; llama-server returns raw logits.
+	if logits {
+		for i, x := range scores {
+			scores[i] = sigmoid(x)
+		}
+	}
+	return scores, nil
+}
+
+func sigmoid(x float64) float64 {
+	return 1 / (1 + math.Exp(-x))
+}
@@ -0,0 +1,85 @@
+//go:build gguf
+
+package llm
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"unsafe"
+
+	"github.com/ebitengine/purego"
+)
+
+// puregoReranker scores query/document pairs with a GGUF reranker model through the
+// llama_go shared library (llama_go_rerank, rank pooling).
+type puregoReranker struct {
+	mu         sync.Mutex
+	modelPtr   unsafe.Pointer
+	freeFn     func(model unsafe.Pointer)
+	rerankFn   func(model unsafe.Pointer, query, document *byte, score *float32) int
+	getErrorFn func() string
+}
+
+func newPuregoReranker(model string) (Reranker, error) {
+	lib, err := openLlamaGo()
+	if err != nil {
+		return nil, err
+	}
+	// Libraries built before llama_go_rerank existed would make RegisterLibFunc panic.
+	if _, err := purego.Dlsym(lib, "llama_go_rerank"); err != nil {
+		return nil, fmt.Errorf("llama_go library has no llama_go_rerank; rebuild it with make build-purego")
+	}
+
+	var loadFn func(path *byte, nCtx, nGpuLayers int) unsafe.Pointer
+	r := &puregoReranker{}
+	purego.RegisterLibFunc(&loadFn, lib, "llama_go_load")
+	purego.RegisterLibFunc(&r.freeFn, lib, "llama_go_free")
+	purego.RegisterLibFunc(&r.rerankFn, lib, "llama_go_rerank")
+	purego.RegisterLibFunc(&r.getErrorFn, lib, "llama_go_get_error")
+
+	path, err := resolveModelFile(model)
+	if err != nil {
+		return nil, err
+	}
+	pathBytes := cString(path)
+	r.modelPtr = loadFn(&pathBytes[0], 0, 0) // n_ctx is sized per pair in llama_go_rerank
+	if r.modelPtr == nil {
+		if errMsg := r.getErrorFn(); errMsg != "" {
+			return nil, fmt.Errorf("load reranker model: %s", errMsg)
+		}
+		return nil, fmt.Errorf("load reranker model failed")
+	}
+	return r, nil
+}
+
+func (r *puregoReranker) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	q := cString(query)
+	scores := make([]float64, len(documents))
+	for i, doc := range documents {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		d := cString(doc)
+		var logit float32
+		if r.rerankFn(r.modelPtr, &q[0], &d[0], &logit) != 0 {
+			if errMsg := r.getErrorFn(); errMsg != "" {
+				return nil, fmt.Errorf("rerank: %s", errMsg)
+			}
+			return nil, fmt.Errorf("rerank failed")
+		}
+		scores[i] = sigmoid(float64(logit))
+	}
+	return scores, nil
+}
+
+func (r *puregoReranker) Close() error {
+	if r.modelPtr != nil {
+		r.freeFn(r.modelPtr)
+		r.modelPtr = nil
+	}
+	return nil
+}
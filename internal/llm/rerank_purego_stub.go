@@ -0,0 +1,9 @@
+//go:build !gguf
+
+package llm
+
+import "fmt"
+
+func newPuregoReranker(model string) (Reranker, error) {
+	return nil, fmt.Errorf("GGUF reranker not available: build with -tags gguf")
+}
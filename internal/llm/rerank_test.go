@@ -0,0 +1,72 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPReranker(t *testing.T) {
+	var got rerankRequest
+	var logits bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/rerank" {
+			http.NotFound(w, r)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Results come back sorted by relevance, not in input order.
+		if logits {
+			w.Write([]byte(`{"results":[{"index":1,"relevance_score":3.2},{"index":0,"relevance_score":-1.5}]}`))
+		} else {
+			w.Write([]byte(`{"results":[{"index":1,"relevance_score":0.9},{"index":0,"score":0.2}]}`))
+		}
+	}))
+	defer srv.Close()
+
+	r := NewHTTPReranker(srv.URL+"/v1/", "test-reranker")
+	scores, err := r.Rerank(context.Background(), "capital of france", []string{"Berlin is in Germany.", "Paris is the capital of France."})
+	if err != nil {
+		t.Fatalf("Rerank failed: %v", err)
+	}
+	if got.Query != "capital of france" || got.Model != "test-reranker" || len(got.Documents) != 2 || got.TopN != 2 {
+		t.Errorf("Unexpected request %+v", got)
+	}
+	if len(scores) != 2 || scores[0] != 0.2 || scores[1] != 0.9 {
+		t.Errorf("Scores = %v, want [0.2 0.9]", scores)
+	}
+
+	logits = true
+	scores, err = r.Rerank(context.Background(), "capital of france", []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("Rerank failed: %v", err)
+	}
+	if math.Abs(scores[1]-sigmoid(3.2)) > 1e-9 || scores[0] >= 0.5 || scores[1] <= scores[0] {
+		t.Errorf("Logit scores = %v, want sigmoid-normalized", scores)
+	}
+
+	if _, err := NewHTTPReranker(srv.URL, "m").Rerank(context.Background(), "q", []string{"d"}); err == nil {
+		t.Error("Expected error for missing endpoint")
+	}
+}
+
+func TestNewRerankerUnconfigured(t *testing.T) {
+	if GGUFEnabled() {
+		t.Skip("GGUF builds default to the local reranker")
+	}
+	t.Setenv("QMD_RERANK_BACKEND", "")
+	t.Setenv("QMD_RERANK_URL", "")
+	if _, err := NewReranker(DefaultRerankModel()); err != ErrNoReranker {
+		t.Errorf("NewReranker error = %v, want ErrNoReranker", err)
+	}
+	t.Setenv("QMD_RERANK_URL", "http://localhost:8080/v1")
+	if r, err := NewReranker(DefaultRerankModel()); err != nil || r == nil {
+		t.Errorf("NewReranker with QMD_RERANK_URL failed: %v", err)
+	}
+}
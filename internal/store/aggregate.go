@@ -0,0 +1,181 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ChunkAggregation is how per-chunk vector scores combine into one document score.
+type ChunkAggregation string
+
+const (
+	AggregateMax  ChunkAggregation = "max"  // best chunk only
+	AggregateMean ChunkAggregation = "mean" // mean of the best aggregateTopK chunks
+	AggregateSum  ChunkAggregation = "sum"  // sum of all matched chunks (can exceed 1)
+)
+
+// aggregateTopK is how many chunks AggregateMean averages.
+const aggregateTopK = 3
+
+// ParseChunkAggregation validates an aggregation name ("" means max).
+func ParseChunkAggregation(name string) (ChunkAggregation, error) {
+	switch ChunkAggregation(name) {
+	case "", AggregateMax:
+		return AggregateMax, nil
+	case AggregateMean, AggregateSum:
+		return ChunkAggregation(name), nil
+	}
+	return "", fmt.Errorf("unknown aggregation %q (want max, mean or sum)", name)
+}
+
+// combine folds chunk scores sorted in descending order into a document score.
+func (a ChunkAggregation) combine(scores []float64) float64 {
+	switch a {
+	case AggregateMean:
+		n := min(len(scores), aggregateTopK)
+		var sum float64
+		for _, sc := range scores[:n] {
+			sum += sc
+		}
+		return sum / float64(n)
+	case AggregateSum:
+		var sum float64
+		for _, sc := range scores {
+			sum += sc
+		}
+		return sum
+	}
+	return scores[0]
+}
+
+// splitKey splits an embedding_blobs key into content hash and chunk seq.
+func splitKey(key string) (hash string, seq int) {
+	i := strings.LastIndex(key, "_")
+	if i < 0 {
+		return key, 0
+	}
+	seq, _ = strconv.Atoi(key[i+1:])
+	return key[:i], seq
+}
+
+// documentResults groups chunk hits by content, scores each group with agg and joins
+// the groups to their active documents in collections (all when nil) meeting where,
+// best first. Each result remembers its best chunk for fillMatchedPassages.
+func (s *Store) documentResults(hits []vecHit, agg ChunkAggregation, collections []string, where Where) ([]VecSearchResult, error) {
+	if len(hits) == 0 {
+		return nil, nil
+	}
+	type group struct {
+		hash    string
+		bestSeq int
+		best    float64
+		scores  []float64
+	}
+	byHash := make(map[string]*group)
+	var groups []*group
+	for _, h := range hits {
+		hash, seq := splitKey(h.Key)
+		g := byHash[hash]
+		if g == nil {
+			g = &group{hash: hash, bestSeq: seq, best: h.Score}
+			byHash[hash] = g
+			groups = append(groups, g)
+		} else if h.Score > g.best {
+			g.bestSeq, g.best = seq, h.Score
+		}
+		g.scores = append(g.scores, h.Score)
+	}
+	hashes := make([]string, len(groups))
+	for i, g := range groups {
+		sort.Sort(sort.Reverse(sort.Float64Slice(g.scores)))
+		hashes[i] = g.hash
+	}
+
+	cond, condArgs := where.SQL()
+	if len(collections) > 0 {
+		in := `d.collection IN (?` + strings.Repeat(",?", len(collections)-1) + `)`
+		if cond != "" {
+			in += ` AND ` + cond
+		}
+		cond = in
+		args := make([]interface{}, 0, len(collections)+len(condArgs))
+		for _, c := range collections {
+			args = append(args, c)
+		}
+		condArgs = append(args, condArgs...)
+	}
+	var out []VecSearchResult
+	for len(hashes) > 0 {
+		batch := hashes[:min(len(hashes), hashBatch)]
+		hashes = hashes[len(batch):]
+		query := `
+			SELECT 'qmd://' || d.collection || '/' || d.path AS filepath,
+				d.collection || '/' || d.path AS display_path,
+				d.title, content.doc AS body, d.hash
+			FROM documents d
+			JOIN content ON content.hash = d.hash
+			WHERE d.active = 1 AND d.hash IN (?` + strings.Repeat(",?", len(batch)-1) + `)`
+		args := make([]interface{}, len(batch), len(batch)+len(condArgs))
+		for i, h := range batch {
+			args[i] = h
+		}
+		if cond != "" {
+			query += ` AND ` + cond
+			args = append(args, condArgs...)
+		}
+		rows, err := s.DB.Query(query, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var r VecSearchResult
+			if err := rows.Scan(&r.Filepath, &r.DisplayPath, &r.Title, &r.Body, &r.Hash); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			g := byHash[r.Hash]
+			r.Score = agg.combine(g.scores)
+			r.Chunks = len(g.scores)
+			r.seq = g.bestSeq
+			out = append(out, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].Filepath < out[j].Filepath
+	})
+	return out, nil
+}
+
+// fillMatchedPassages sets the offset, line range and text of each result's best chunk.
+func (s *Store) fillMatchedPassages(model string, results []VecSearchResult) error {
+	for i := range results {
+		r := &results[i]
+		err := s.DB.QueryRow(`
+			SELECT cv.pos, COALESCE(c.start_line, 0), COALESCE(c.end_line, 0), COALESCE(f.body, '')
+			FROM content_vectors cv
+			LEFT JOIN content_chunks c ON c.hash = cv.hash AND c.seq = cv.seq
+			LEFT JOIN chunks_fts f ON f.rowid = c.id
+			WHERE cv.model = ? AND cv.hash = ? AND cv.seq = ?
+		`, model, r.Hash, r.seq).Scan(&r.Pos, &r.StartLine, &r.EndLine, &r.Snippet)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if r.Snippet == "" && r.Pos < len(r.Body) {
+			r.Snippet = r.Body[r.Pos:min(len(r.Body), r.Pos+ChunkSizeChars)]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVectorSearchAggregatesChunks(t *testing.T) {
+	s, err := NewStore(tempDBPath(t))
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	defer s.Close()
+	now := time.Now()
+
+	// long.md has three chunks, each moderately close to the query; short.md has one
+	// chunk that is the single best match.
+	long := strings.Repeat("Paragraph of a long transcript.\n\n", 300)
+	chunks := ChunkDocument(long, ChunkSizeChars, ChunkOverlapChars)
+	if len(chunks) < 3 {
+		t.Fatalf("Expected at least 3 chunks, got %d", len(chunks))
+	}
+	longHash := HashContent(long)
+	s.InsertContent(longHash, long, now)
+	s.InsertDocument("col", "long.md", "Long", longHash, now, now)
+	longVecs := [][]float32{{0.8, 0.6, 0}, {0.9, 0.44, 0}, {0.7, 0.71, 0}}
+	for seq, v := range longVecs {
+		if err := s.InsertEmbedding(longHash, seq, chunks[seq].Pos, v, "test-model", now); err != nil {
+			t.Fatalf("InsertEmbedding failed: %v", err)
+		}
+	}
+	short := "A short note."
+	shortHash := HashContent(short)
+	s.InsertContent(shortHash, short, now)
+	s.InsertDocument("col", "short.md", "Short", shortHash, now, now)
+	if err := s.InsertEmbedding(shortHash, 0, 0, []float32{0.95, 0.31, 0}, "test-model", now); err != nil {
+		t.Fatalf("InsertEmbedding failed: %v", err)
+	}
+
+	query := []float32{1, 0, 0}
+	for _, tc := range []struct {
+		agg ChunkAggregation
+		top string
+	}{
+		{AggregateMax, "qmd://col/short.md"},
+		{AggregateMean, "qmd://col/short.md"},
+		{AggregateSum, "qmd://col/long.md"},
+	} {
+		for name, search := range map[string]func(string, []float32, int, ChunkAggregation, []string, Where) ([]VecSearchResult, error){
+			"ann": s.SearchVectors, "exact": s.SearchVectorsBrute,
+		} {
+			res, err := search("test-model", query, 10, tc.agg, nil, nil)
+			if err != nil {
+				t.Fatalf("%s %s: %v", name, tc.agg, err)
+			}
+			if len(res) != 2 {
+				t.Fatalf("%s %s: expected one result per document, got %d", name, tc.agg, len(res))
+			}
+			if res[0].Filepath != tc.top {
+				t.Errorf("%s %s: expected %s first, got %s", name, tc.agg, tc.top, res[0].Filepath)
+			}
+			for _, r := range res {
+				if r.Filepath != "qmd://col/long.md" {
+					continue
+				}
+				// Chunk 1 is closest to the query; its offset and text come back.
+				if r.Chunks != 3 || r.Pos != chunks[1].Pos || r.Snippet != chunks[1].Text || r.StartLine <= 1 {
+					t.Errorf("%s %s: expected best chunk 1 at pos %d, got chunks=%d pos=%d lines=%d-%d",
+						name, tc.agg, chunks[1].Pos, r.Chunks, r.Pos, r.StartLine, r.EndLine)
+				}
+			}
+		}
+	}
+
+	if _, err := ParseChunkAggregation("median"); err == nil {
+		t.Error("Expected error for unknown aggregation")
+	}
+}
+
+func TestDocumentResultsManyHits(t *testing.T) {
+	s, err := NewStore(tempDBPath(t))
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	defer s.Close()
+	now := time.Now()
+
+	// More distinct hashes than SQLite allows variables in one statement, as an exact
+	// search over a large index passes; only three are indexed documents.
+	var hits []vecHit
+	for i := 0; i < 40000; i++ {
+		hits = append(hits, vecHit{Key: fmt.Sprintf("missing%d_0", i), Score: 0.5})
+	}
+	for i, score := range []float64{0.7, 0.9, 0.8} {
+		body := fmt.Sprintf("Document %d.", i)
+		hash := HashContent(body)
+		s.InsertContent(hash, body, now)
+		s.InsertDocument("col", fmt.Sprintf("%d.md", i), body, hash, now, now)
+		hits[i*hashBatch*3] = vecHit{Key: hash + "_0", Score: score} // in different batches
+	}
+
+	res, err := s.documentResults(hits, AggregateMax, nil, nil)
+	if err != nil {
+		t.Fatalf("documentResults failed: %v", err)
+	}
+	var got []string
+	for _, r := range res {
+		got = append(got, r.DisplayPath)
+	}
+	if want := []string{"col/1.md", "col/2.md", "col/0.md"}; strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("documentResults = %v, want %v", got, want)
+	}
+}
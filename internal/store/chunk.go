@@ -1,5 +1,10 @@
 package store
 
+import (
+	"database/sql"
+	"strings"
+)
+
 // ChunkSizeChars and ChunkOverlapChars match TS defaults (~800 tokens * 4 chars, 15% overlap).
 const (
 	ChunkSizeChars    = 3200
@@ -90,3 +95,91 @@ func lastIndex(s, sep string) int {
 	}
 	return -1
 }
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// chunkLines returns the 1-based first and last line of c within content.
+func chunkLines(content string, c Chunk) (start, end int) {
+	start = 1 + strings.Count(content[:c.Pos], "\n")
+	end = start + strings.Count(strings.TrimRight(c.Text, "\n"), "\n")
+	return start, end
+}
+
+// lineChunk is a chunk with the 1-based line range it covers.
+type lineChunk struct {
+	Chunk
+	start, end int
+}
+
+// splitChunks splits content with the same boundaries embed uses.
+func splitChunks(content string) []lineChunk {
+	chunks := ChunkDocument(content, ChunkSizeChars, ChunkOverlapChars)
+	out := make([]lineChunk, len(chunks))
+	for i, c := range chunks {
+		start, end := chunkLines(content, c)
+		out[i] = lineChunk{c, start, end}
+	}
+	return out
+}
+
+// indexChunks splits content and adds each chunk to content_chunks and chunks_fts, so
+// full-text hits can point at a line range.
+func indexChunks(db execer, hash, content string) error {
+	return insertChunks(db, hash, splitChunks(content))
+}
+
+func insertChunks(db execer, hash string, chunks []lineChunk) error {
+	for seq, c := range chunks {
+		res, err := db.Exec(`INSERT OR IGNORE INTO content_chunks (hash, seq, pos, start_line, end_line) VALUES (?, ?, ?, ?, ?)`,
+			hash, seq, c.Pos, c.start, c.end)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		if _, err := db.Exec(`INSERT INTO chunks_fts (rowid, body) VALUES (?, ?)`, id, c.Text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillChunks indexes chunks for content rows that have none, such as those written
+// before content_chunks existed.
+func backfillChunks(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT hash FROM content WHERE hash NOT IN (SELECT DISTINCT hash FROM content_chunks)`)
+	if err != nil {
+		return err
+	}
+	var hashes []string
+	for rows.Next() {
+		var h string
+		if err := rows.Scan(&h); err != nil {
+			rows.Close()
+			return err
+		}
+		hashes = append(hashes, h)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, h := range hashes {
+		var doc string
+		if err := tx.QueryRow(`SELECT doc FROM content WHERE hash = ?`, h).Scan(&doc); err != nil {
+			return err
+		}
+		if err := indexChunks(tx, h, doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -4,8 +4,12 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
+	"fmt"
 	"strings"
 	"time"
+
+	"github.com/ba0f3/qmd-go/internal/frontmatter"
+	"github.com/ba0f3/qmd-go/internal/links"
 )
 
 func HashContent(content string) string {
@@ -14,17 +18,82 @@ func HashContent(content string) string {
 }
 
 func (s *Store) InsertContent(hash, content string, createdAt time.Time) error {
-	_, err := s.DB.Exec(`INSERT OR IGNORE INTO content (hash, doc, created_at) VALUES (?, ?, ?)`,
+	if added, err := insertContentRow(s.DB, hash, content, createdAt); err != nil || !added {
+		return err
+	}
+	var c Content
+	c.parseFrontMatter(content)
+	if err := insertMetadata(s.DB, hash, c.Meta); err != nil {
+		return err
+	}
+	return indexChunks(s.DB, hash, content)
+}
+
+// insertContentRow adds the content row, reporting false if the hash was already there.
+func insertContentRow(db execer, hash, content string, createdAt time.Time) (bool, error) {
+	res, err := db.Exec(`INSERT OR IGNORE INTO content (hash, doc, created_at) VALUES (?, ?, ?)`,
 		hash, content, createdAt.Format(time.RFC3339))
-	return err
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// Content is a document body with its hash, parsed front matter and chunks, ready for
+// Tx.InsertContent. Preparing it needs no database, so the indexer does it on its
+// worker goroutines and leaves only the writes to the goroutine holding the Tx.
+type Content struct {
+	Hash string
+	Body string
+	// Title is the front matter title or else the first H1, "" if there is neither.
+	Title string
+	Meta  frontmatter.Metadata
+	// MetaErr is why the front matter did not parse; the body is then indexed without it.
+	MetaErr error
+	// Links are the links in the body, for Tx.SetLinks.
+	Links  []links.Link
+	chunks []lineChunk
+}
+
+// PrepareContent parses and chunks body, whose HashContent is hash.
+func PrepareContent(hash, body string) *Content {
+	c := &Content{Hash: hash, Body: body, Links: links.Extract(body), chunks: splitChunks(body)}
+	c.parseFrontMatter(body)
+	return c
+}
+
+func (c *Content) parseFrontMatter(body string) {
+	meta, rest, err := frontmatter.Parse(body)
+	c.Meta, c.MetaErr = meta, err
+	c.Title = frontmatter.Title(meta, rest)
 }
 
 func (s *Store) InsertDocument(collection, path, title, hash string, createdAt, modifiedAt time.Time) error {
-	_, err := s.DB.Exec(`
-		INSERT INTO documents (collection, path, title, hash, created_at, modified_at, active)
-		VALUES (?, ?, ?, ?, ?, ?, 1)
-	`, collection, path, title, hash, createdAt.Format(time.RFC3339), modifiedAt.Format(time.RFC3339))
-	return err
+	return insertDocument(s.DB, collection, path, title, hash, createdAt, modifiedAt, FileStat{})
+}
+
+// insertDocument adds an active document at collection/path. A document deactivated
+// there whose content is still kept, as another document shares it, is reactivated
+// with the new values instead.
+func insertDocument(db execer, collection, path, title, hash string, createdAt, modifiedAt time.Time, st FileStat) error {
+	res, err := db.Exec(`
+		INSERT INTO documents (collection, path, title, hash, created_at, modified_at, active, size, mtime, inode)
+		VALUES (?, ?, ?, ?, ?, ?, 1, ?, ?, ?)
+		ON CONFLICT (collection, path) DO UPDATE SET
+			title = excluded.title, hash = excluded.hash, created_at = excluded.created_at,
+			modified_at = excluded.modified_at, active = 1,
+			size = excluded.size, mtime = excluded.mtime, inode = excluded.inode
+		WHERE active = 0
+	`, collection, path, title, hash, createdAt.Format(time.RFC3339), modifiedAt.Format(time.RFC3339),
+		st.Size, st.Mtime, int64(st.Inode))
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("document %s/%s is already indexed", collection, path)
+	}
+	return nil
 }
 
 type Document struct {
@@ -38,6 +107,18 @@ type Document struct {
 	Active     bool
 }
 
+// FileStat is what the indexer saw of a document's file when it last read it, so the next
+// pass can tell the file is unchanged without reading it. The zero value means unknown.
+type FileStat struct {
+	Size  int64
+	Mtime int64 // nanoseconds since the Unix epoch
+	Inode uint64
+}
+
+// Known reports whether st was recorded; documents written before stats were kept, or
+// by other callers than the indexer, have none.
+func (st FileStat) Known() bool { return st.Mtime != 0 }
+
 func (s *Store) FindActiveDocument(collection, path string) (*Document, error) {
 	row := s.DB.QueryRow(`
 		SELECT id, collection, path, title, hash, created_at, modified_at, active
@@ -59,9 +140,15 @@ func (s *Store) FindActiveDocument(collection, path string) (*Document, error) {
 	return &doc, nil
 }
 
+// UpdateDocument points a document at new content. Its file stat is cleared, as the
+// caller did not say which version of the file the content came from.
 func (s *Store) UpdateDocument(id int64, title, hash string, modifiedAt time.Time) error {
-	_, err := s.DB.Exec(`UPDATE documents SET title = ?, hash = ?, modified_at = ? WHERE id = ?`,
-		title, hash, modifiedAt.Format(time.RFC3339), id)
+	return updateDocument(s.DB, id, title, hash, modifiedAt, FileStat{})
+}
+
+func updateDocument(db execer, id int64, title, hash string, modifiedAt time.Time, st FileStat) error {
+	_, err := db.Exec(`UPDATE documents SET title = ?, hash = ?, modified_at = ?, size = ?, mtime = ?, inode = ? WHERE id = ?`,
+		title, hash, modifiedAt.Format(time.RFC3339), st.Size, st.Mtime, int64(st.Inode), id)
 	return err
 }
 
@@ -72,7 +159,14 @@ func (s *Store) UpdateDocumentTitle(id int64, title string, modifiedAt time.Time
 }
 
 func (s *Store) DeactivateDocument(collection, path string) error {
-	_, err := s.DB.Exec(`UPDATE documents SET active = 0 WHERE collection = ? AND path = ? AND active = 1`,
+	return deactivateDocument(s.DB, collection, path)
+}
+
+func deactivateDocument(db execer, collection, path string) error {
+	if err := setLinks(db, collection, path, nil); err != nil {
+		return err
+	}
+	_, err := db.Exec(`UPDATE documents SET active = 0 WHERE collection = ? AND path = ? AND active = 1`,
 		collection, path)
 	return err
 }
@@ -96,7 +190,11 @@ func (s *Store) GetActiveDocumentPaths(collection string) ([]string, error) {
 }
 
 func (s *Store) CleanupOrphanedContent() (int64, error) {
-	res, err := s.DB.Exec(`
+	return cleanupOrphanedContent(s.DB)
+}
+
+func cleanupOrphanedContent(db execer) (int64, error) {
+	res, err := db.Exec(`
 		DELETE FROM content
 		WHERE hash NOT IN (SELECT DISTINCT hash FROM documents WHERE active = 1)
 	`)
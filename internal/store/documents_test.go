@@ -79,3 +79,54 @@ func TestDocumentsCRUD(t *testing.T) {
 		t.Errorf("Expected 1 orphaned content deleted, got %d", affected)
 	}
 }
+
+func TestTxFileStats(t *testing.T) {
+	s, err := NewStore(tempDBPath(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	now := time.Now()
+
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := FileStat{Size: 3, Mtime: now.UnixNano(), Inode: 1 << 63}
+	tx.InsertContent(PrepareContent(HashContent("abc"), "abc"), now)
+	if err := tx.InsertDocument("col", "a.md", "a.md", HashContent("abc"), now, now, st); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	s.InsertContent(HashContent("x"), "x", now)
+	s.InsertDocument("col", "b.md", "b.md", HashContent("x"), now, now)
+
+	// A rolled back pass leaves nothing behind.
+	tx, err = s.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	files, err := tx.ActiveFiles("col")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := files["a.md"].Stat; got != st {
+		t.Errorf("a.md stat = %+v, want %+v", got, st)
+	}
+	if files["b.md"].Stat.Known() {
+		t.Errorf("b.md inserted without a stat has %+v", files["b.md"].Stat)
+	}
+	if err := tx.DeactivateDocument("col", "a.md"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := tx.ActiveFile("col", "a.md"); ok || err != nil {
+		t.Errorf("ActiveFile after deactivation = %v, %v", ok, err)
+	}
+	tx.Rollback()
+	if _, err := s.FindActiveDocument("col", "a.md"); err != nil {
+		t.Errorf("Rollback did not restore a.md: %v", err)
+	}
+}
@@ -4,72 +4,192 @@ import (
 	"encoding/binary"
 	"math"
 	"time"
+
+	"github.com/ba0f3/qmd-go/internal/frontmatter"
 )
 
-// GetHashesForEmbedding returns all content hashes from active documents that do not yet have embeddings.
-func (s *Store) GetHashesForEmbedding() ([]struct{ Hash, Body, Path string }, error) {
+// EmbeddingCandidate is a content hash that still needs embeddings, with one active
+// document (path and collection) that uses it. A hash used in several collections is
+// returned once per collection, since collections may embed with different models.
+type EmbeddingCandidate struct {
+	Hash       string
+	Body       string
+	Path       string
+	Title      string // the document's title, from its front matter or first heading
+	Collection string
+}
+
+// GetHashesForEmbedding returns the content hashes of active documents that have no
+// embeddings from model yet. Content shared by several documents of a collection comes
+// with the path and title of the first by path.
+func (s *Store) GetHashesForEmbedding(model string) ([]EmbeddingCandidate, error) {
+	// With MIN(), SQLite takes d.title from the row holding the smallest path.
 	rows, err := s.DB.Query(`
-		SELECT d.hash, c.doc AS body, MIN(d.path) AS path
+		SELECT d.hash, c.doc AS body, MIN(d.path) AS path, d.title, d.collection
 		FROM documents d
 		JOIN content c ON d.hash = c.hash
-		LEFT JOIN content_vectors v ON d.hash = v.hash AND v.seq = 0
+		LEFT JOIN content_vectors v ON v.model = ? AND d.hash = v.hash AND v.seq = 0
 		WHERE d.active = 1 AND v.hash IS NULL
-		GROUP BY d.hash
-	`)
+		GROUP BY d.hash, d.collection
+	`, model)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var out []struct{ Hash, Body, Path string }
+	var out []EmbeddingCandidate
 	for rows.Next() {
-		var h, body, path string
-		if err := rows.Scan(&h, &body, &path); err != nil {
+		var c EmbeddingCandidate
+		if err := rows.Scan(&c.Hash, &c.Body, &c.Path, &c.Title, &c.Collection); err != nil {
 			return nil, err
 		}
-		out = append(out, struct{ Hash, Body, Path string }{h, body, path})
+		out = append(out, c)
 	}
 	return out, rows.Err()
 }
 
-// GetHashesNeedingEmbeddingCount returns the number of unique content hashes that need embedding.
-func (s *Store) GetHashesNeedingEmbeddingCount() (int, error) {
+// GetHashesNeedingEmbeddingCount returns the number of unique content hashes that have
+// no embeddings from model.
+func (s *Store) GetHashesNeedingEmbeddingCount(model string) (int, error) {
 	var n int
 	err := s.DB.QueryRow(`
 		SELECT COUNT(DISTINCT d.hash)
 		FROM documents d
-		LEFT JOIN content_vectors v ON d.hash = v.hash AND v.seq = 0
+		LEFT JOIN content_vectors v ON v.model = ? AND d.hash = v.hash AND v.seq = 0
 		WHERE d.active = 1 AND v.hash IS NULL
-	`).Scan(&n)
+	`, model).Scan(&n)
 	return n, err
 }
 
+// ModelVectors is how many vectors one embedding model has in the index.
+type ModelVectors struct {
+	Model  string
+	Chunks int
+	Hashes int
+}
+
+// EmbeddingModels lists the models that have vectors in the index, by name.
+func (s *Store) EmbeddingModels() ([]ModelVectors, error) {
+	rows, err := s.DB.Query(`
+		SELECT model, COUNT(*), COUNT(DISTINCT hash) FROM content_vectors GROUP BY model ORDER BY model
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []ModelVectors
+	for rows.Next() {
+		var m ModelVectors
+		if err := rows.Scan(&m.Model, &m.Chunks, &m.Hashes); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
 // EnsureEmbeddingBlobTable creates the embedding_blobs table if it does not exist.
 // We use a BLOB table so Go can store/retrieve vectors without sqlite-vec.
 func (s *Store) EnsureEmbeddingBlobTable() error {
 	_, err := s.DB.Exec(`
 		CREATE TABLE IF NOT EXISTS embedding_blobs (
-			hash_seq TEXT PRIMARY KEY,
-			embedding BLOB NOT NULL
+			model TEXT NOT NULL,
+			hash_seq TEXT NOT NULL,
+			embedding BLOB NOT NULL,
+			PRIMARY KEY (model, hash_seq)
 		)
 	`)
 	return err
 }
 
-// InsertEmbedding inserts one embedding into content_vectors and embedding_blobs.
+// InsertEmbedding inserts one embedding into content_vectors and embedding_blobs and
+// adds it to the ANN index.
 func (s *Store) InsertEmbedding(hash string, seq, pos int, embedding []float32, model string, embeddedAt time.Time) error {
-	hashSeq := hash + "_" + itoa(seq)
-	blob := float32SliceToBlob(embedding)
-	_, err := s.DB.Exec(`
+	return s.InsertEmbeddings([]Embedding{{Hash: hash, Seq: seq, Pos: pos, Vector: embedding}}, model, embeddedAt)
+}
+
+// Embedding is one chunk vector for InsertEmbeddings.
+type Embedding struct {
+	Hash   string
+	Seq    int
+	Pos    int
+	Vector []float32
+}
+
+// InsertEmbeddings inserts a batch of embeddings from model in one transaction and adds
+// them to the model's ANN index. Batching avoids a commit (and fsync) per chunk.
+func (s *Store) InsertEmbeddings(batch []Embedding, model string, embeddedAt time.Time) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	keepFull, err := s.KeepFullVectors()
+	if err != nil {
+		return err
+	}
+	s.vecMu.Lock()
+	defer s.vecMu.Unlock()
+	ix, err := s.loadVectorIndex(model)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	vectors, err := tx.Prepare(`
 		INSERT OR REPLACE INTO content_vectors (hash, seq, pos, model, embedded_at)
 		VALUES (?, ?, ?, ?, ?)
-	`, hash, seq, pos, model, embeddedAt.Format(time.RFC3339))
+	`)
 	if err != nil {
 		return err
 	}
-	_, err = s.DB.Exec(`
-		INSERT OR REPLACE INTO embedding_blobs (hash_seq, embedding) VALUES (?, ?)
-	`, hashSeq, blob)
-	return err
+	defer vectors.Close()
+	blobs, err := tx.Prepare(`INSERT OR REPLACE INTO embedding_blobs (model, hash_seq, embedding) VALUES (?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer blobs.Close()
+	full, err := tx.Prepare(`INSERT OR REPLACE INTO embedding_full (model, hash_seq, embedding) VALUES (?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer full.Close()
+
+	at := embeddedAt.Format(time.RFC3339)
+	for _, e := range batch {
+		hashSeq := e.Hash + "_" + itoa(e.Seq)
+		if _, err := vectors.Exec(e.Hash, e.Seq, e.Pos, model, at); err != nil {
+			return err
+		}
+		if _, err := blobs.Exec(model, hashSeq, ix.storage.encode(e.Vector)); err != nil {
+			return err
+		}
+		if ix.storage != StorageFloat32 && keepFull {
+			if _, err := full.Exec(model, hashSeq, float32SliceToBlob(e.Vector)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Only our own writes should have moved the generation; anything else means another
+	// process touched embedding_blobs and the index must be reloaded.
+	gen, err := s.blobGeneration(model)
+	if err != nil {
+		return err
+	}
+	if gen == ix.generation+int64(len(batch)) {
+		for _, e := range batch {
+			ix.add(e.Hash+"_"+itoa(e.Seq), e.Vector)
+		}
+		ix.generation = gen
+	} else {
+		delete(s.vecs, model)
+	}
+	return nil
 }
 
 func itoa(i int) string {
@@ -108,16 +228,39 @@ func float32frombits(x uint32) float32 {
 	return math.Float32frombits(x)
 }
 
-// ClearAllEmbeddings removes all rows from content_vectors and embedding_blobs (force re-embed).
-func (s *Store) ClearAllEmbeddings() error {
-	if _, err := s.DB.Exec(`DELETE FROM content_vectors`); err != nil {
-		return err
+// DeleteModelEmbeddings removes every vector embedded with model, along with its ANN
+// index, and returns the number of chunks removed.
+func (s *Store) DeleteModelEmbeddings(model string) (int, error) {
+	s.vecMu.Lock()
+	defer s.vecMu.Unlock()
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return 0, err
 	}
-	_, err := s.DB.Exec(`DELETE FROM embedding_blobs`)
-	return err
+	defer tx.Rollback()
+	res, err := tx.Exec(`DELETE FROM content_vectors WHERE model = ?`, model)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	for _, q := range []string{
+		`DELETE FROM embedding_blobs WHERE model = ?`,
+		`DELETE FROM embedding_full WHERE model = ?`,
+		`DELETE FROM vector_index WHERE model = ?`,
+	} {
+		if _, err := tx.Exec(q, model); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	delete(s.vecs, model)
+	return int(n), nil
 }
 
-// VecSearchResult is one vector search hit.
+// VecSearchResult is one document matched by vector search. Score combines the
+// document's chunk scores; Pos, StartLine/EndLine and Snippet locate its best chunk.
 type VecSearchResult struct {
 	Filepath    string
 	DisplayPath string
@@ -125,82 +268,64 @@ type VecSearchResult struct {
 	Body        string
 	Score       float64
 	Hash        string
+	Chunks      int // number of matched chunks combined into Score
+	Pos         int // byte offset of the best chunk in Body
+	StartLine   int // 1-based line range of the best chunk (0 if unknown)
+	EndLine     int
+	Snippet     string // text of the best chunk
+	Metadata    frontmatter.Metadata
+	seq         int
 }
 
-// SearchVectorsBrute does brute-force cosine similarity search over embedding_blobs.
-// queryEmbedding must be the same dimension as stored embeddings. Returns results sorted by score descending.
-func (s *Store) SearchVectorsBrute(queryEmbedding []float32, limit int) ([]VecSearchResult, error) {
+// SearchVectorsBrute does exact brute-force cosine similarity search over the vectors
+// embedded with model, combining chunk scores per document like SearchVectors. It is
+// the reference SearchVectors is checked against (vsearch --exact).
+// queryEmbedding must come from the same model. Returns results sorted by score descending.
+func (s *Store) SearchVectorsBrute(model string, queryEmbedding []float32, limit int, agg ChunkAggregation, collections []string, where Where) ([]VecSearchResult, error) {
+	storage, err := s.VectorStorage()
+	if err != nil {
+		return nil, err
+	}
 	rows, err := s.DB.Query(`
-		SELECT eb.hash_seq, eb.embedding,
-			'qmd://' || d.collection || '/' || d.path AS filepath,
-			d.collection || '/' || d.path AS display_path,
-			d.title, content.doc AS body, d.hash
+		SELECT eb.hash_seq, eb.embedding, ef.embedding
 		FROM embedding_blobs eb
-		JOIN content_vectors cv ON cv.hash || '_' || cv.seq = eb.hash_seq
-		JOIN documents d ON d.hash = cv.hash AND d.active = 1
-		JOIN content ON content.hash = d.hash
-	`)
+		LEFT JOIN embedding_full ef ON ef.model = eb.model AND ef.hash_seq = eb.hash_seq
+		WHERE eb.model = ?
+	`, model)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	type row struct {
-		HashSeq     string
-		Embedding   []byte
-		Filepath    string
-		DisplayPath string
-		Title       string
-		Body        string
-		Hash        string
-	}
-	var rowsList []row
+	var hits []vecHit
 	for rows.Next() {
-		var r row
-		if err := rows.Scan(&r.HashSeq, &r.Embedding, &r.Filepath, &r.DisplayPath, &r.Title, &r.Body, &r.Hash); err != nil {
+		var key string
+		var blob, full []byte
+		if err := rows.Scan(&key, &blob, &full); err != nil {
 			return nil, err
 		}
-		rowsList = append(rowsList, r)
+		vec := storage.decode(blob)
+		if full != nil {
+			vec = BlobToFloat32Slice(full)
+		}
+		hits = append(hits, vecHit{Key: key, Score: cosineSimilarity(queryEmbedding, vec)})
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
+	rows.Close()
 
-	// Cosine similarity with each, then sort and limit
-	type scored struct {
-		r     row
-		score float64
+	out, err := s.documentResults(hits, agg, collections, where)
+	if err != nil {
+		return nil, err
 	}
-	scores := make([]scored, 0, len(rowsList))
-	for _, r := range rowsList {
-		vec := BlobToFloat32Slice(r.Embedding)
-		sim := cosineSimilarity(queryEmbedding, vec)
-		scores = append(scores, scored{r: r, score: sim})
+	if limit > 0 && limit < len(out) {
+		out = out[:limit]
 	}
-	// Sort descending by score
-	for i := 0; i < len(scores); i++ {
-		for j := i + 1; j < len(scores); j++ {
-			if scores[j].score > scores[i].score {
-				scores[i], scores[j] = scores[j], scores[i]
-			}
-		}
+	if err := s.fillMatchedPassages(model, out); err != nil {
+		return nil, err
 	}
-	if limit <= 0 || limit > len(scores) {
-		limit = len(scores)
-	}
-	out := make([]VecSearchResult, 0, limit)
-	for i := 0; i < limit && i < len(scores); i++ {
-		s := scores[i]
-		out = append(out, VecSearchResult{
-			Filepath:    s.r.Filepath,
-			DisplayPath: s.r.DisplayPath,
-			Title:       s.r.Title,
-			Body:        s.r.Body,
-			Score:       s.score,
-			Hash:        s.r.Hash,
-		})
-	}
-	return out, nil
+	return out, s.fillVecMetadata(out)
 }
 
 func cosineSimilarity(a, b []float32) float64 {
@@ -0,0 +1,264 @@
+package store
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// HNSW parameters. hnswM is the number of links per node above layer 0 (layer 0 keeps
+// twice as many); efConstruction/efSearch are the candidate list sizes used while
+// building and querying. Values follow the defaults from the HNSW paper.
+const (
+	hnswM              = 16
+	hnswEfConstruction = 100
+	hnswEfSearch       = 64
+)
+
+// vectorSet stores the vectors an hnswGraph navigates over, addressed by node id.
+// Similarity is "higher is closer" (cosine for float vectors).
+type vectorSet interface {
+	Len() int
+	Add(v []float32)
+	Similarity(i, j int) float32
+	Querier(q []float32) func(j int) float32
+}
+
+// float32Set keeps L2-normalized vectors so cosine similarity is a plain dot product.
+type float32Set struct {
+	vecs [][]float32
+}
+
+func (s *float32Set) Len() int                    { return len(s.vecs) }
+func (s *float32Set) Add(v []float32)             { s.vecs = append(s.vecs, normalize(v)) }
+func (s *float32Set) Similarity(i, j int) float32 { return dot(s.vecs[i], s.vecs[j]) }
+
+func (s *float32Set) Querier(q []float32) func(j int) float32 {
+	qn := normalize(q)
+	return func(j int) float32 { return dot(qn, s.vecs[j]) }
+}
+
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	out := make([]float32, len(v))
+	if sum == 0 {
+		return out
+	}
+	inv := float32(1 / math.Sqrt(sum))
+	for i, x := range v {
+		out[i] = x * inv
+	}
+	return out
+}
+
+// dot returns 0 for vectors of different dimension, like cosineSimilarity.
+func dot(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var s float32
+	for i := range a {
+		s += a[i] * b[i]
+	}
+	return s
+}
+
+// hnswGraph is a Hierarchical Navigable Small World graph (Malkov & Yashunin, 2016).
+// It is not safe for concurrent use; vectorIndex serializes access.
+type hnswGraph struct {
+	vecs     vectorSet
+	links    [][][]uint32 // node -> layer -> neighbour ids
+	entry    int          // -1 when empty
+	maxLevel int
+	rng      *rand.Rand
+}
+
+type hnswHit struct {
+	id    int
+	score float32
+}
+
+func newHNSWGraph(vecs vectorSet) *hnswGraph {
+	return &hnswGraph{vecs: vecs, entry: -1, rng: rand.New(rand.NewSource(1))}
+}
+
+func (g *hnswGraph) Len() int { return len(g.links) }
+
+func (g *hnswGraph) randomLevel() int {
+	return int(math.Floor(-math.Log(1-g.rng.Float64()) / math.Log(hnswM)))
+}
+
+func maxLinks(level int) int {
+	if level == 0 {
+		return 2 * hnswM
+	}
+	return hnswM
+}
+
+// Add appends v to the vector set, links it into the graph and returns its node id.
+func (g *hnswGraph) Add(v []float32) int {
+	id := len(g.links)
+	g.vecs.Add(v)
+	level := g.randomLevel()
+	g.links = append(g.links, make([][]uint32, level+1))
+	if g.entry < 0 {
+		g.entry, g.maxLevel = id, level
+		return id
+	}
+
+	sim := func(j int) float32 { return g.vecs.Similarity(id, j) }
+	ep := g.entry
+	for l := g.maxLevel; l > level; l-- {
+		ep = g.greedy(sim, ep, l)
+	}
+	for l := min(level, g.maxLevel); l >= 0; l-- {
+		cands := g.searchLayer(sim, ep, hnswEfConstruction, l)
+		neighbours := g.selectNeighbours(cands, hnswM)
+		g.links[id][l] = neighbours
+		for _, n := range neighbours {
+			g.connect(int(n), id, l)
+		}
+		ep = cands[0].id
+	}
+	if level > g.maxLevel {
+		g.entry, g.maxLevel = id, level
+	}
+	return id
+}
+
+// connect adds a link from n to id on layer l, pruning n's links if it has too many.
+func (g *hnswGraph) connect(n, id, l int) {
+	g.links[n][l] = append(g.links[n][l], uint32(id))
+	if len(g.links[n][l]) <= maxLinks(l) {
+		return
+	}
+	cands := make([]hnswHit, 0, len(g.links[n][l]))
+	for _, c := range g.links[n][l] {
+		cands = append(cands, hnswHit{id: int(c), score: g.vecs.Similarity(n, int(c))})
+	}
+	sort.Slice(cands, func(i, j int) bool { return cands[i].score > cands[j].score })
+	g.links[n][l] = g.selectNeighbours(cands, maxLinks(l))
+}
+
+// selectNeighbours applies the HNSW neighbour heuristic to candidates sorted by
+// descending similarity: a candidate is kept only if it is closer to the base node than
+// to every neighbour already kept, which spreads links across clusters. Pruned
+// candidates fill any remaining slots.
+func (g *hnswGraph) selectNeighbours(cands []hnswHit, m int) []uint32 {
+	out := make([]uint32, 0, m)
+	var pruned []uint32
+	for _, c := range cands {
+		if len(out) >= m {
+			break
+		}
+		keep := true
+		for _, r := range out {
+			if g.vecs.Similarity(c.id, int(r)) > c.score {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			out = append(out, uint32(c.id))
+		} else {
+			pruned = append(pruned, uint32(c.id))
+		}
+	}
+	for _, p := range pruned {
+		if len(out) >= m {
+			break
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// greedy walks layer l towards the node most similar to the target.
+func (g *hnswGraph) greedy(sim func(int) float32, ep, l int) int {
+	best := sim(ep)
+	for changed := true; changed; {
+		changed = false
+		for _, n := range g.links[ep][l] {
+			if s := sim(int(n)); s > best {
+				best, ep, changed = s, int(n), true
+			}
+		}
+	}
+	return ep
+}
+
+// searchLayer returns up to ef nodes on layer l closest to the target, best first.
+func (g *hnswGraph) searchLayer(sim func(int) float32, ep, ef, l int) []hnswHit {
+	visited := map[int]struct{}{ep: {}}
+	first := hnswHit{id: ep, score: sim(ep)}
+	cands := &hitHeap{max: true, hits: []hnswHit{first}}
+	results := &hitHeap{hits: []hnswHit{first}}
+	for cands.Len() > 0 {
+		c := heap.Pop(cands).(hnswHit)
+		if results.Len() >= ef && c.score < results.hits[0].score {
+			break
+		}
+		for _, n := range g.links[c.id][l] {
+			if _, ok := visited[int(n)]; ok {
+				continue
+			}
+			visited[int(n)] = struct{}{}
+			s := sim(int(n))
+			if results.Len() < ef || s > results.hits[0].score {
+				heap.Push(cands, hnswHit{id: int(n), score: s})
+				heap.Push(results, hnswHit{id: int(n), score: s})
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+	out := results.hits
+	sort.Slice(out, func(i, j int) bool { return out[i].score > out[j].score })
+	return out
+}
+
+// Search returns the k nodes most similar to q, best first. ef trades speed for recall.
+func (g *hnswGraph) Search(q []float32, k, ef int) []hnswHit {
+	if g.entry < 0 || k <= 0 {
+		return nil
+	}
+	if ef < k {
+		ef = k
+	}
+	sim := g.vecs.Querier(q)
+	ep := g.entry
+	for l := g.maxLevel; l > 0; l-- {
+		ep = g.greedy(sim, ep, l)
+	}
+	hits := g.searchLayer(sim, ep, ef, 0)
+	if len(hits) > k {
+		hits = hits[:k]
+	}
+	return hits
+}
+
+// hitHeap is a min-heap on score, or a max-heap when max is set.
+type hitHeap struct {
+	hits []hnswHit
+	max  bool
+}
+
+func (h *hitHeap) Len() int { return len(h.hits) }
+func (h *hitHeap) Less(i, j int) bool {
+	if h.max {
+		return h.hits[i].score > h.hits[j].score
+	}
+	return h.hits[i].score < h.hits[j].score
+}
+func (h *hitHeap) Swap(i, j int) { h.hits[i], h.hits[j] = h.hits[j], h.hits[i] }
+func (h *hitHeap) Push(x any)    { h.hits = append(h.hits, x.(hnswHit)) }
+func (h *hitHeap) Pop() any {
+	last := h.hits[len(h.hits)-1]
+	h.hits = h.hits[:len(h.hits)-1]
+	return last
+}
@@ -0,0 +1,93 @@
+package store
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func randomVectors(rng *rand.Rand, n, dim int) [][]float32 {
+	out := make([][]float32, n)
+	for i := range out {
+		v := make([]float32, dim)
+		for j := range v {
+			v[j] = float32(rng.NormFloat64())
+		}
+		out[i] = v
+	}
+	return out
+}
+
+func TestHNSWRecall(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	const n, dim, k = 3000, 32, 10
+	vecs := randomVectors(rng, n, dim)
+	g := newHNSWGraph(&float32Set{})
+	for _, v := range vecs {
+		g.Add(v)
+	}
+
+	queries := randomVectors(rng, 50, dim)
+	found, total := 0, 0
+	for _, q := range queries {
+		type scored struct {
+			id    int
+			score float64
+		}
+		exact := make([]scored, n)
+		for i, v := range vecs {
+			exact[i] = scored{i, cosineSimilarity(q, v)}
+		}
+		sort.Slice(exact, func(i, j int) bool { return exact[i].score > exact[j].score })
+		want := make(map[int]bool)
+		for _, e := range exact[:k] {
+			want[e.id] = true
+		}
+		for _, h := range g.Search(q, k, hnswEfSearch) {
+			if want[h.id] {
+				found++
+			}
+		}
+		total += k
+	}
+	recall := float64(found) / float64(total)
+	if recall < 0.9 {
+		t.Errorf("Expected recall@%d >= 0.9, got %.3f", k, recall)
+	}
+}
+
+func TestHNSWEmptyAndSingle(t *testing.T) {
+	g := newHNSWGraph(&float32Set{})
+	if hits := g.Search([]float32{1, 0}, 5, hnswEfSearch); len(hits) != 0 {
+		t.Errorf("Expected no hits on empty graph, got %v", hits)
+	}
+	g.Add([]float32{1, 0})
+	hits := g.Search([]float32{1, 0}, 5, hnswEfSearch)
+	if len(hits) != 1 || hits[0].id != 0 {
+		t.Errorf("Expected single hit for node 0, got %v", hits)
+	}
+}
+
+func TestVectorIndexMarshalRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	vecs := randomVectors(rng, 200, 8)
+	ix := newVectorIndex("m", StorageFloat32)
+	for i, v := range vecs {
+		ix.add("h"+itoa(i)+"_0", v)
+	}
+	ix.add("h5_0", vecs[5]) // replace: old node becomes a tombstone
+
+	got, err := unmarshalVectorIndex(ix.marshal(), "m", StorageFloat32)
+	if err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if got.live != ix.live || len(got.keys) != len(ix.keys) {
+		t.Fatalf("Expected %d/%d nodes, got %d/%d", ix.live, len(ix.keys), got.live, len(got.keys))
+	}
+	if got.ids["h5_0"] != ix.ids["h5_0"] {
+		t.Errorf("Replaced key maps to node %d, want %d", got.ids["h5_0"], ix.ids["h5_0"])
+	}
+	if _, err := unmarshalVectorIndex([]byte("QMDHNSW1\xff"), "m", StorageFloat32); err == nil {
+		t.Error("Expected error for truncated index")
+	}
+}
@@ -0,0 +1,255 @@
+package store
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/ba0f3/qmd-go/internal/links"
+)
+
+// DocLink is a link from a document to another file of its collection.
+type DocLink struct {
+	Collection string
+	Source     string // path of the linking document
+	links.Link
+	Resolved string // path of the document the link points to, "" if it is broken
+}
+
+// setLinks replaces the links of the active document at collection/path. They are left
+// unresolved until resolveLinks runs over the collection.
+func setLinks(db execer, collection, path string, ls []links.Link) error {
+	if _, err := db.Exec(`DELETE FROM links WHERE source_id IN
+		(SELECT id FROM documents WHERE collection = ? AND path = ? AND active = 1)`, collection, path); err != nil {
+		return err
+	}
+	for _, l := range ls {
+		if _, err := db.Exec(`
+			INSERT INTO links (source_id, kind, target, fragment, label, line, target_name)
+			SELECT id, ?, ?, ?, ?, ?, ? FROM documents WHERE collection = ? AND path = ? AND active = 1
+		`, l.Kind, l.Target, l.Fragment, l.Label, l.Line, l.Name(), collection, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// linkChanges is what was done to a collection's documents that can change where its
+// links point.
+type linkChanges struct {
+	sources map[string]bool // paths of documents whose links were set, still unresolved
+	added   map[string]bool // paths of documents added
+	removed map[string]bool // paths of documents removed
+}
+
+func newLinkChanges() *linkChanges {
+	return &linkChanges{sources: make(map[string]bool), added: make(map[string]bool), removed: make(map[string]bool)}
+}
+
+// linkRow is a link of a collection to resolve.
+type linkRow struct {
+	id     int64
+	source string
+	link   links.Link
+	old    string // target_path, "" if unresolved
+}
+
+const linkRowQuery = `
+	SELECT l.id, d.path, l.kind, l.target, COALESCE(l.target_path, '')
+	FROM links l
+	JOIN documents d ON d.id = l.source_id
+	WHERE d.collection = ? AND d.active = 1`
+
+// queryLinkRows appends the links of collection matching where to rows, skipping those
+// already in seen.
+func queryLinkRows(tx *sql.Tx, rows []linkRow, seen map[int64]bool, collection, where string, args ...interface{}) ([]linkRow, error) {
+	r, err := tx.Query(linkRowQuery+where, append([]interface{}{collection}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	for r.Next() {
+		var l linkRow
+		if err := r.Scan(&l.id, &l.source, &l.link.Kind, &l.link.Target, &l.old); err != nil {
+			return nil, err
+		}
+		if !seen[l.id] {
+			seen[l.id] = true
+			rows = append(rows, l)
+		}
+	}
+	return rows, r.Err()
+}
+
+// resolveLinks points every link of collection at the document it now resolves to, as
+// after a reparse.
+func resolveLinks(tx *sql.Tx, collection string) error {
+	rows, err := queryLinkRows(tx, nil, make(map[int64]bool), collection, "")
+	if err != nil {
+		return err
+	}
+	return updateLinkTargets(tx, collection, rows)
+}
+
+// resolveChangedLinks re-resolves the links of collection that ch can have changed: the
+// links of the documents written, the links named like an added document, and those
+// that pointed to a removed one. Any other link keeps its target, as a link only
+// changes when a file it can name appears or the file it points to goes away.
+func resolveChangedLinks(tx *sql.Tx, collection string, ch *linkChanges) error {
+	var rows []linkRow
+	seen := make(map[int64]bool)
+	var err error
+	for p := range ch.sources {
+		if rows, err = queryLinkRows(tx, rows, seen, collection, ` AND d.path = ?`, p); err != nil {
+			return err
+		}
+	}
+	for p := range ch.added {
+		for _, name := range links.Names(p) {
+			if rows, err = queryLinkRows(tx, rows, seen, collection, ` AND l.target_name = ?`, name); err != nil {
+				return err
+			}
+		}
+	}
+	for p := range ch.removed {
+		if rows, err = queryLinkRows(tx, rows, seen, collection, ` AND l.target_path = ?`, p); err != nil {
+			return err
+		}
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return updateLinkTargets(tx, collection, rows)
+}
+
+// updateLinkTargets resolves rows against the active documents of collection and
+// records the targets that changed.
+func updateLinkTargets(tx *sql.Tx, collection string, rows []linkRow) error {
+	paths, err := activePaths(tx, collection)
+	if err != nil {
+		return err
+	}
+	r := links.NewResolver(paths)
+	for _, l := range rows {
+		p, ok := r.Resolve(l.source, l.link)
+		if p == l.old {
+			continue
+		}
+		if _, err := tx.Exec(`UPDATE links SET target_path = ? WHERE id = ?`, sql.NullString{String: p, Valid: ok}, l.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func activePaths(tx *sql.Tx, collection string) ([]string, error) {
+	rows, err := tx.Query(`SELECT path FROM documents WHERE collection = ? AND active = 1`, collection)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var paths []string
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, err
+		}
+		paths = append(paths, p)
+	}
+	return paths, rows.Err()
+}
+
+const docLinkColumns = `d.collection, d.path, l.kind, l.target, l.fragment, l.label, l.line, COALESCE(l.target_path, '')`
+
+func (s *Store) queryLinks(where string, args ...interface{}) ([]DocLink, error) {
+	rows, err := s.DB.Query(`SELECT `+docLinkColumns+`
+		FROM links l
+		JOIN documents d ON d.id = l.source_id
+		WHERE d.active = 1 AND `+where+`
+		ORDER BY d.collection, d.path, l.line, l.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []DocLink
+	for rows.Next() {
+		var l DocLink
+		if err := rows.Scan(&l.Collection, &l.Source, &l.Kind, &l.Target, &l.Fragment, &l.Label, &l.Line, &l.Resolved); err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+// LinksFrom returns the links in the document at collection/path, in order.
+func (s *Store) LinksFrom(collection, path string) ([]DocLink, error) {
+	return s.queryLinks(`d.collection = ? AND d.path = ?`, collection, path)
+}
+
+// Backlinks returns the links from other documents, or from itself, that resolve to the
+// document at collection/path.
+func (s *Store) Backlinks(collection, path string) ([]DocLink, error) {
+	return s.queryLinks(`d.collection = ? AND l.target_path = ?`, collection, path)
+}
+
+// UnresolvedLinks returns the links that point to no document, in collection or in all
+// collections if it is "". Links to attachments (see links.IsAttachment) are left out.
+func (s *Store) UnresolvedLinks(collection string) ([]DocLink, error) {
+	where, args := collectionCondition(collection)
+	ls, err := s.queryLinks(`l.target_path IS NULL`+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	out := ls[:0]
+	for _, l := range ls {
+		if !links.IsAttachment(l.Target) {
+			out = append(out, l)
+		}
+	}
+	return out, nil
+}
+
+// Orphans returns the active documents no other document links to, in collection or in
+// all collections if it is "".
+func (s *Store) Orphans(collection string) ([]DocPath, error) {
+	where, args := collectionCondition(collection)
+	rows, err := s.DB.Query(`
+		SELECT
+			'qmd://' || d.collection || '/' || d.path,
+			d.collection || '/' || d.path,
+			LENGTH(content.doc),
+			d.collection,
+			d.path
+		FROM documents d
+		JOIN content ON content.hash = d.hash
+		WHERE d.active = 1`+where+`
+		AND NOT EXISTS (
+			SELECT 1 FROM links l
+			JOIN documents src ON src.id = l.source_id
+			WHERE src.active = 1 AND src.collection = d.collection AND src.id != d.id
+			AND l.target_path = d.path
+		)
+		ORDER BY d.collection, d.path
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []DocPath
+	for rows.Next() {
+		var d DocPath
+		if err := rows.Scan(&d.Filepath, &d.DisplayPath, &d.BodyLength, &d.Collection, &d.Path); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// collectionCondition restricts a query on documents d to collection, unless it is "".
+func collectionCondition(collection string) (string, []interface{}) {
+	if strings.TrimSpace(collection) == "" {
+		return "", nil
+	}
+	return ` AND d.collection = ?`, []interface{}{collection}
+}
@@ -0,0 +1,139 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLinks(t *testing.T) {
+	s, err := NewStore(tempDBPath(t))
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	defer s.Close()
+	now := time.Now()
+
+	write := func(docs map[string]string, remove ...string) {
+		t.Helper()
+		tx, err := s.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+		for path, body := range docs {
+			c := PrepareContent(HashContent(body), body)
+			if err := tx.InsertContent(c, now); err != nil {
+				t.Fatalf("InsertContent failed: %v", err)
+			}
+			if err := tx.InsertDocument("notes", path, path, c.Hash, now, now, FileStat{}); err != nil {
+				t.Fatalf("InsertDocument failed: %v", err)
+			}
+			if err := tx.SetLinks("notes", path, c.Links); err != nil {
+				t.Fatalf("SetLinks failed: %v", err)
+			}
+		}
+		for _, path := range remove {
+			if err := tx.DeactivateDocument("notes", path); err != nil {
+				t.Fatalf("DeactivateDocument failed: %v", err)
+			}
+		}
+		if err := tx.ResolveLinks("notes"); err != nil {
+			t.Fatalf("ResolveLinks failed: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(map[string]string{
+		"index.md":        "See [[Runbook|the runbook]], [[Roadmap]] and [setup](guides/setup.md#linux).\n",
+		"ops/runbook.md":  "Back to [[index]]. ![[diagram.png]]\n",
+		"guides/setup.md": "Install it.\n",
+		"lonely.md":       "Links to [[lonely]] only.\n",
+	})
+
+	from, err := s.LinksFrom("notes", "index.md")
+	if err != nil {
+		t.Fatalf("LinksFrom failed: %v", err)
+	}
+	if len(from) != 3 {
+		t.Fatalf("Expected 3 links from index.md, got %+v", from)
+	}
+	if from[0].Target != "Runbook" || from[0].Label != "the runbook" || from[0].Resolved != "ops/runbook.md" {
+		t.Errorf("Unexpected wikilink %+v", from[0])
+	}
+	if from[1].Target != "Roadmap" || from[1].Resolved != "" {
+		t.Errorf("Expected [[Roadmap]] unresolved, got %+v", from[1])
+	}
+	if from[2].Resolved != "guides/setup.md" || from[2].Fragment != "linux" {
+		t.Errorf("Unexpected markdown link %+v", from[2])
+	}
+
+	back, err := s.Backlinks("notes", "ops/runbook.md")
+	if err != nil || len(back) != 1 || back[0].Source != "index.md" {
+		t.Errorf("Expected a backlink from index.md, got %+v (%v)", back, err)
+	}
+
+	assertUnresolved := func(want ...string) {
+		t.Helper()
+		broken, err := s.UnresolvedLinks("")
+		if err != nil {
+			t.Fatalf("UnresolvedLinks failed: %v", err)
+		}
+		var got []string
+		for _, l := range broken {
+			got = append(got, l.Source+":"+l.Target)
+		}
+		if !sameSet(got, want) {
+			t.Errorf("UnresolvedLinks = %v, want %v", got, want)
+		}
+	}
+	assertOrphans := func(want ...string) {
+		t.Helper()
+		orphans, err := s.Orphans("notes")
+		if err != nil {
+			t.Fatalf("Orphans failed: %v", err)
+		}
+		var got []string
+		for _, d := range orphans {
+			got = append(got, d.Path)
+		}
+		if !sameSet(got, want) {
+			t.Errorf("Orphans = %v, want %v", got, want)
+		}
+	}
+	// The embedded image is not indexed, but it is not a broken link either.
+	assertUnresolved("index.md:Roadmap")
+	// A note linking only to itself is still an orphan.
+	assertOrphans("lonely.md")
+
+	// Adding the missing note resolves the links to it; removing one breaks the links to
+	// it and orphans the notes only it linked to.
+	write(map[string]string{"roadmap.md": "Plans.\n"}, "ops/runbook.md")
+	assertUnresolved("index.md:Runbook")
+	assertOrphans("index.md", "lonely.md")
+	if back, _ := s.Backlinks("notes", "roadmap.md"); len(back) != 1 {
+		t.Errorf("Expected a backlink to roadmap.md, got %+v", back)
+	}
+	if from, _ := s.LinksFrom("notes", "ops/runbook.md"); len(from) != 0 {
+		t.Errorf("Expected no links from a removed document, got %+v", from)
+	}
+
+	// A pass only re-resolves the links its changes can affect: a note named like a
+	// link's target, or nearer the root, takes it over, and other links are not even read
+	// (so this deliberately wrong target stays).
+	if _, err := s.DB.Exec(`UPDATE links SET target_path = 'stale.md' WHERE target = 'lonely'`); err != nil {
+		t.Fatal(err)
+	}
+	write(map[string]string{"deep/runbook.md": "Steps.\n", "other.md": "See [[deep/runbook]].\n"})
+	assertUnresolved()
+	write(map[string]string{"runbook.md": "Nearer.\n"})
+	if from, _ := s.LinksFrom("notes", "index.md"); from[0].Resolved != "runbook.md" {
+		t.Errorf("Expected [[Runbook]] to move to the nearer runbook.md, got %+v", from[0])
+	}
+	if from, _ := s.LinksFrom("notes", "other.md"); from[0].Resolved != "deep/runbook.md" {
+		t.Errorf("Expected [[deep/runbook]] to stay, got %+v", from[0])
+	}
+	if from, _ := s.LinksFrom("notes", "lonely.md"); from[0].Resolved != "stale.md" {
+		t.Errorf("Expected the unrelated link not to be re-resolved, got %+v", from[0])
+	}
+}
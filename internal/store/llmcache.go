@@ -0,0 +1,39 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// LLMCacheKey derives an llm_cache key from the parts that determine a model's output
+// (typically a task name, the model and the prompt).
+func LLMCacheKey(parts ...string) string {
+	key := ""
+	for _, p := range parts {
+		key += p + "\x00"
+	}
+	return HashContent(key)
+}
+
+// GetLLMCache returns a cached model output. ok is false on a cache miss.
+func (s *Store) GetLLMCache(key string) (result string, ok bool, err error) {
+	err = s.DB.QueryRow(`SELECT result FROM llm_cache WHERE hash = ?`, key).Scan(&result)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("read llm cache: %w", err)
+	}
+	return result, true, nil
+}
+
+// PutLLMCache stores a model output. `qmd cleanup` clears the cache.
+func (s *Store) PutLLMCache(key, result string) error {
+	_, err := s.DB.Exec(`INSERT OR REPLACE INTO llm_cache (hash, result, created_at) VALUES (?, ?, ?)`,
+		key, result, time.Now().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("write llm cache: %w", err)
+	}
+	return nil
+}
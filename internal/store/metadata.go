@@ -0,0 +1,151 @@
+package store
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ba0f3/qmd-go/internal/frontmatter"
+)
+
+// insertMetadata records the front matter of content hash, one row per value.
+func insertMetadata(db execer, hash string, meta frontmatter.Metadata) error {
+	for _, f := range meta {
+		for seq, v := range f.Values {
+			if _, err := db.Exec(`INSERT OR IGNORE INTO document_metadata (hash, key, seq, value, list) VALUES (?, ?, ?, ?, ?)`,
+				hash, f.Key, seq, v, f.List); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hashBatch bounds the hashes bound per "hash IN (...)" query, below SQLite's variable
+// limit.
+const hashBatch = 500
+
+// DocumentMetadata returns the front matter of each of hashes that has any.
+func (s *Store) DocumentMetadata(hashes []string) (map[string]frontmatter.Metadata, error) {
+	out := make(map[string]frontmatter.Metadata)
+	for len(hashes) > 0 {
+		batch := hashes[:min(len(hashes), hashBatch)]
+		hashes = hashes[len(batch):]
+		args := make([]interface{}, len(batch))
+		for i, h := range batch {
+			args[i] = h
+		}
+		rows, err := s.DB.Query(`SELECT hash, key, value, list FROM document_metadata WHERE hash IN (?`+
+			strings.Repeat(",?", len(batch)-1)+`) ORDER BY hash, rowid`, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var hash, key, value string
+			var list bool
+			if err := rows.Scan(&hash, &key, &value, &list); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			m := out[hash]
+			if n := len(m); n > 0 && m[n-1].Key == key {
+				m[n-1].Values = append(m[n-1].Values, value)
+			} else {
+				m = append(m, frontmatter.Field{Key: key, Values: []string{value}, List: list})
+			}
+			out[hash] = m
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// fillMetadata looks up the metadata of n results, given their hashes, and sets it.
+func (s *Store) fillMetadata(n int, hash func(int) string, set func(int, frontmatter.Metadata)) error {
+	hashes := make([]string, n)
+	for i := range hashes {
+		hashes[i] = hash(i)
+	}
+	meta, err := s.DocumentMetadata(hashes)
+	if err != nil {
+		return err
+	}
+	for i, h := range hashes {
+		if m, ok := meta[h]; ok {
+			set(i, m)
+		}
+	}
+	return nil
+}
+
+func (s *Store) fillVecMetadata(results []VecSearchResult) error {
+	return s.fillMetadata(len(results), func(i int) string { return results[i].Hash },
+		func(i int, m frontmatter.Metadata) { results[i].Metadata = m })
+}
+
+// MetaCondition is one test on document metadata, from a --where flag.
+type MetaCondition struct {
+	Key   string
+	Op    string // "=", "!=", "<", "<=", ">", ">=", or "" for documents that have Key
+	Value string
+}
+
+// Where is a list of metadata conditions a document must all meet.
+type Where []MetaCondition
+
+var whereExpr = regexp.MustCompile(`^\s*([A-Za-z0-9_.-]+)\s*(?:(!=|<=|>=|=|<|>)(.*))?$`)
+
+// ParseWhere parses --where expressions: key=value, key!=value, key<value (or <=, >,
+// >=), or a bare key for documents that have it. Keys are case-insensitive, as are
+// values, which compare as text: write dates as YYYY-MM-DD. A list such as tags meets
+// key=value when any of its elements does, and key!=value when none does.
+func ParseWhere(exprs []string) (Where, error) {
+	var w Where
+	for _, e := range exprs {
+		m := whereExpr.FindStringSubmatch(e)
+		if m == nil {
+			return nil, fmt.Errorf("invalid --where %q (want key=value, key!=value, key<value or key)", e)
+		}
+		w = append(w, MetaCondition{Key: strings.ToLower(m[1]), Op: m[2], Value: strings.TrimSpace(m[3])})
+	}
+	return w, nil
+}
+
+// SQL returns the conditions as a WHERE clause fragment on documents aliased d, or ""
+// if there are none.
+func (w Where) SQL() (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	for _, f := range w.filters() {
+		conds = append(conds, f.sql)
+		args = append(args, f.args...)
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+func (w Where) filters() []queryFilter {
+	var fs []queryFilter
+	for _, c := range w {
+		switch c.Op {
+		case "":
+			fs = append(fs, queryFilter{
+				sql:  `d.hash IN (SELECT hash FROM document_metadata WHERE key = ?)`,
+				args: []interface{}{c.Key},
+			})
+		case "!=":
+			fs = append(fs, queryFilter{
+				sql:  `d.hash NOT IN (SELECT hash FROM document_metadata WHERE key = ? AND value = ? COLLATE NOCASE)`,
+				args: []interface{}{c.Key, c.Value},
+			})
+		default:
+			fs = append(fs, queryFilter{
+				sql:  `d.hash IN (SELECT hash FROM document_metadata WHERE key = ? AND value ` + c.Op + ` ? COLLATE NOCASE)`,
+				args: []interface{}{c.Key, c.Value},
+			})
+		}
+	}
+	return fs
+}
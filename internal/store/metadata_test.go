@@ -0,0 +1,118 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSearchWhere(t *testing.T) {
+	s, err := NewStore(tempDBPath(t))
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	defer s.Close()
+	now := time.Now()
+
+	docs := []struct{ path, body string }{
+		{"deploy.md", "---\ntitle: Deploy\ntags: [ops, go]\nstatus: done\ndate: 2025-03-01\naliases: [shipit]\n---\nHow we release the server.\n"},
+		{"draft.md", "---\ntags: [go]\nstatus: Draft\ndate: 2024-12-01\n---\nNotes on the server rewrite.\n"},
+		{"plain.md", "The server has no front matter.\n"},
+	}
+	for i, d := range docs {
+		c := PrepareContent(HashContent(d.body), d.body)
+		tx, err := s.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.InsertContent(c, now); err != nil {
+			t.Fatalf("InsertContent failed: %v", err)
+		}
+		if err := tx.InsertDocument("col", d.path, d.path, c.Hash, now, now, FileStat{}); err != nil {
+			t.Fatalf("InsertDocument failed: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.InsertEmbedding(c.Hash, 0, 0, []float32{1, float32(i), 0}, "test-model", now); err != nil {
+			t.Fatalf("InsertEmbedding failed: %v", err)
+		}
+	}
+
+	for _, tt := range []struct {
+		where []string
+		want  []string
+	}{
+		{nil, []string{"deploy.md", "draft.md", "plain.md"}},
+		{[]string{"tags=go"}, []string{"deploy.md", "draft.md"}},
+		{[]string{"tags=GO", "status!=draft"}, []string{"deploy.md"}},
+		{[]string{"status!=done"}, []string{"draft.md", "plain.md"}},
+		{[]string{"date>=2025-01-01"}, []string{"deploy.md"}},
+		{[]string{"aliases"}, []string{"deploy.md"}},
+		{[]string{"Status = done"}, []string{"deploy.md"}},
+	} {
+		where, err := ParseWhere(tt.where)
+		if err != nil {
+			t.Fatalf("ParseWhere(%q): %v", tt.where, err)
+		}
+		fts, err := s.SearchFTS("server", 10, "", where)
+		if err != nil {
+			t.Fatalf("SearchFTS %q: %v", tt.where, err)
+		}
+		var got []string
+		for _, r := range fts {
+			got = append(got, r.DisplayPath[len("col/"):])
+		}
+		if !sameSet(got, tt.want) {
+			t.Errorf("SearchFTS where %q = %v, want %v", tt.where, got, tt.want)
+		}
+		for name, search := range map[string]func(string, []float32, int, ChunkAggregation, []string, Where) ([]VecSearchResult, error){
+			"ann": s.SearchVectors, "exact": s.SearchVectorsBrute,
+		} {
+			vec, err := search("test-model", []float32{1, 0, 0}, 10, AggregateMax, nil, where)
+			if err != nil {
+				t.Fatalf("%s %q: %v", name, tt.where, err)
+			}
+			got = got[:0]
+			for _, r := range vec {
+				got = append(got, r.DisplayPath[len("col/"):])
+			}
+			if !sameSet(got, tt.want) {
+				t.Errorf("%s where %q = %v, want %v", name, tt.where, got, tt.want)
+			}
+		}
+	}
+
+	// Aliases are searchable with the title, and results carry the front matter.
+	results, err := s.SearchFTS("title:shipit release", 10, "", nil)
+	if err != nil || len(results) != 1 || results[0].DisplayPath != "col/deploy.md" {
+		t.Fatalf("Expected deploy.md by its alias, got %v (%v)", results, err)
+	}
+	m := results[0].Metadata.Map()
+	if m["status"] != "done" || !reflect.DeepEqual(m["tags"], []string{"ops", "go"}) {
+		t.Errorf("Unexpected metadata %v", m)
+	}
+
+	for _, bad := range []string{"", "=x", "a b=c"} {
+		if _, err := ParseWhere([]string{bad}); err == nil {
+			t.Errorf("ParseWhere(%q) succeeded", bad)
+		}
+	}
+}
+
+func sameSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[string]int)
+	for _, s := range a {
+		seen[s]++
+	}
+	for _, s := range b {
+		if seen[s] == 0 {
+			return false
+		}
+		seen[s]--
+	}
+	return true
+}
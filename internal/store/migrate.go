@@ -0,0 +1,410 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrSchemaTooNew is returned by NewStore when the index was last written by a newer qmd
+// binary. Opening it would risk writing rows in a shape the newer schema does not expect.
+var ErrSchemaTooNew = errors.New("index schema is newer than this qmd binary supports")
+
+// migration upgrades the schema from version-1 to version. Each one runs in its own
+// transaction together with the schema_version row that records it.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx) error
+}
+
+// migrations is the ordered list of schema upgrades. Append new entries; never edit or
+// reorder released ones, since existing indexes have already recorded them as applied.
+var migrations = []migration{
+	{1, "initial schema", execStatements(
+		`CREATE TABLE IF NOT EXISTS content (
+			hash TEXT PRIMARY KEY,
+			doc TEXT NOT NULL,
+			created_at TEXT NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS documents (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			collection TEXT NOT NULL,
+			path TEXT NOT NULL,
+			title TEXT NOT NULL,
+			hash TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			modified_at TEXT NOT NULL,
+			active INTEGER NOT NULL DEFAULT 1,
+			FOREIGN KEY (hash) REFERENCES content(hash) ON DELETE CASCADE,
+			UNIQUE(collection, path)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_documents_collection ON documents(collection, active)`,
+		`CREATE INDEX IF NOT EXISTS idx_documents_hash ON documents(hash)`,
+		`CREATE INDEX IF NOT EXISTS idx_documents_path ON documents(path, active)`,
+		`CREATE TABLE IF NOT EXISTS llm_cache (
+			hash TEXT PRIMARY KEY,
+			result TEXT NOT NULL,
+			created_at TEXT NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS content_vectors (
+			hash TEXT NOT NULL,
+			seq INTEGER NOT NULL DEFAULT 0,
+			pos INTEGER NOT NULL DEFAULT 0,
+			model TEXT NOT NULL,
+			embedded_at TEXT NOT NULL,
+			PRIMARY KEY (hash, seq)
+		)`,
+		// FTS5 table
+		`CREATE VIRTUAL TABLE IF NOT EXISTS documents_fts USING fts5(
+			filepath, title, body,
+			tokenize='porter unicode61'
+		)`,
+		// Triggers
+		`CREATE TRIGGER IF NOT EXISTS documents_ai AFTER INSERT ON documents
+		WHEN new.active = 1
+		BEGIN
+			INSERT INTO documents_fts(rowid, filepath, title, body)
+			SELECT
+				new.id,
+				new.collection || '/' || new.path,
+				new.title,
+				(SELECT doc FROM content WHERE hash = new.hash)
+			WHERE new.active = 1;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS documents_ad AFTER DELETE ON documents BEGIN
+			DELETE FROM documents_fts WHERE rowid = old.id;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS documents_au AFTER UPDATE ON documents
+		BEGIN
+			DELETE FROM documents_fts WHERE rowid = old.id AND new.active = 0;
+			INSERT OR REPLACE INTO documents_fts(rowid, filepath, title, body)
+			SELECT
+				new.id,
+				new.collection || '/' || new.path,
+				new.title,
+				(SELECT doc FROM content WHERE hash = new.hash)
+			WHERE new.active = 1;
+		END`,
+	)},
+	{2, "vector index", execStatements(
+		`CREATE TABLE IF NOT EXISTS embedding_blobs (
+			hash_seq TEXT PRIMARY KEY,
+			embedding BLOB NOT NULL
+		)`,
+		// Bumped by triggers on every embedding_blobs change so a persisted or
+		// in-memory ANN index can tell whether it is still current.
+		`CREATE TABLE IF NOT EXISTS vector_generation (
+			id INTEGER PRIMARY KEY CHECK (id = 1),
+			generation INTEGER NOT NULL
+		)`,
+		`INSERT OR IGNORE INTO vector_generation (id, generation) VALUES (1, 0)`,
+		`CREATE TRIGGER IF NOT EXISTS embedding_blobs_ai AFTER INSERT ON embedding_blobs BEGIN
+			UPDATE vector_generation SET generation = generation + 1 WHERE id = 1;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS embedding_blobs_ad AFTER DELETE ON embedding_blobs BEGIN
+			UPDATE vector_generation SET generation = generation + 1 WHERE id = 1;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS embedding_blobs_au AFTER UPDATE ON embedding_blobs BEGIN
+			UPDATE vector_generation SET generation = generation + 1 WHERE id = 1;
+		END`,
+		// HNSW graph links (see vecindex.go); vectors themselves stay in embedding_blobs.
+		`CREATE TABLE IF NOT EXISTS vector_index (
+			id INTEGER PRIMARY KEY CHECK (id = 1),
+			generation INTEGER NOT NULL,
+			graph BLOB NOT NULL,
+			saved_at TEXT NOT NULL
+		)`,
+	)},
+	{3, "vector storage modes", execStatements(
+		`CREATE TABLE IF NOT EXISTS store_settings (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL
+		)`,
+		// Full-precision vectors for rescoring when embedding_blobs holds quantized codes.
+		`CREATE TABLE IF NOT EXISTS embedding_full (
+			hash_seq TEXT PRIMARY KEY,
+			embedding BLOB NOT NULL
+		)`,
+	)},
+	{4, "chunk full-text index", execStatements(
+		// Chunks use ChunkDocument boundaries, so seq matches content_vectors.seq.
+		`CREATE TABLE IF NOT EXISTS content_chunks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			hash TEXT NOT NULL,
+			seq INTEGER NOT NULL,
+			pos INTEGER NOT NULL,
+			start_line INTEGER NOT NULL,
+			end_line INTEGER NOT NULL,
+			FOREIGN KEY (hash) REFERENCES content(hash) ON DELETE CASCADE,
+			UNIQUE(hash, seq)
+		)`,
+		`CREATE VIRTUAL TABLE IF NOT EXISTS chunks_fts USING fts5(
+			body,
+			tokenize='porter unicode61'
+		)`,
+		`CREATE TRIGGER IF NOT EXISTS content_chunks_ad AFTER DELETE ON content_chunks BEGIN
+			DELETE FROM chunks_fts WHERE rowid = old.id;
+		END`,
+	)},
+	{5, "trigram collections", execStatements(
+		`CREATE TABLE IF NOT EXISTS collection_tokenizers (
+			collection TEXT PRIMARY KEY,
+			tokenizer TEXT NOT NULL
+		)`,
+		// Substring index over the chunks of documents in trigram collections; rowid is
+		// content_chunks.id, like chunks_fts.
+		`CREATE VIRTUAL TABLE IF NOT EXISTS chunks_trigram USING fts5(
+			body,
+			tokenize='trigram'
+		)`,
+		`DROP TRIGGER IF EXISTS content_chunks_ad`,
+		`CREATE TRIGGER content_chunks_ad AFTER DELETE ON content_chunks BEGIN
+			DELETE FROM chunks_fts WHERE rowid = old.id;
+			DELETE FROM chunks_trigram WHERE rowid = old.id;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS documents_trigram_ai AFTER INSERT ON documents
+		WHEN new.active = 1 AND EXISTS (
+			SELECT 1 FROM collection_tokenizers WHERE collection = new.collection AND tokenizer = 'trigram')
+		BEGIN
+			INSERT INTO chunks_trigram (rowid, body)
+			SELECT c.id, f.body FROM content_chunks c JOIN chunks_fts f ON f.rowid = c.id
+			WHERE c.hash = new.hash AND NOT EXISTS (SELECT 1 FROM chunks_trigram t WHERE t.rowid = c.id);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS documents_trigram_au AFTER UPDATE ON documents
+		WHEN new.active = 1 AND EXISTS (
+			SELECT 1 FROM collection_tokenizers WHERE collection = new.collection AND tokenizer = 'trigram')
+		BEGIN
+			INSERT INTO chunks_trigram (rowid, body)
+			SELECT c.id, f.body FROM content_chunks c JOIN chunks_fts f ON f.rowid = c.id
+			WHERE c.hash = new.hash AND NOT EXISTS (SELECT 1 FROM chunks_trigram t WHERE t.rowid = c.id);
+		END`,
+	)},
+	{6, "vectors per embedding model", execStatements(
+		// Vectors from different models are not comparable, so every vector table is
+		// keyed by model and each model gets its own generation counter and ANN graph.
+		// Blobs take their model from content_vectors; blobs without a row there were
+		// unreachable already and are dropped.
+		`DROP TRIGGER IF EXISTS embedding_blobs_ai`,
+		`DROP TRIGGER IF EXISTS embedding_blobs_ad`,
+		`DROP TRIGGER IF EXISTS embedding_blobs_au`,
+		`CREATE TABLE embedding_blobs_new (
+			model TEXT NOT NULL,
+			hash_seq TEXT NOT NULL,
+			embedding BLOB NOT NULL,
+			PRIMARY KEY (model, hash_seq)
+		)`,
+		`INSERT INTO embedding_blobs_new (model, hash_seq, embedding)
+		SELECT cv.model, eb.hash_seq, eb.embedding
+		FROM embedding_blobs eb
+		JOIN content_vectors cv ON cv.hash = substr(eb.hash_seq, 1, instr(eb.hash_seq, '_') - 1)
+			AND cv.seq = CAST(substr(eb.hash_seq, instr(eb.hash_seq, '_') + 1) AS INTEGER)`,
+		`DROP TABLE embedding_blobs`,
+		`ALTER TABLE embedding_blobs_new RENAME TO embedding_blobs`,
+		`CREATE TABLE embedding_full_new (
+			model TEXT NOT NULL,
+			hash_seq TEXT NOT NULL,
+			embedding BLOB NOT NULL,
+			PRIMARY KEY (model, hash_seq)
+		)`,
+		`INSERT INTO embedding_full_new (model, hash_seq, embedding)
+		SELECT eb.model, ef.hash_seq, ef.embedding
+		FROM embedding_full ef JOIN embedding_blobs eb ON eb.hash_seq = ef.hash_seq`,
+		`DROP TABLE embedding_full`,
+		`ALTER TABLE embedding_full_new RENAME TO embedding_full`,
+		`CREATE TABLE content_vectors_new (
+			hash TEXT NOT NULL,
+			seq INTEGER NOT NULL DEFAULT 0,
+			pos INTEGER NOT NULL DEFAULT 0,
+			model TEXT NOT NULL,
+			embedded_at TEXT NOT NULL,
+			PRIMARY KEY (model, hash, seq)
+		)`,
+		`INSERT INTO content_vectors_new SELECT hash, seq, pos, model, embedded_at FROM content_vectors`,
+		`DROP TABLE content_vectors`,
+		`ALTER TABLE content_vectors_new RENAME TO content_vectors`,
+		`CREATE INDEX IF NOT EXISTS idx_content_vectors_hash ON content_vectors(hash, seq)`,
+		`DROP TABLE vector_generation`,
+		`CREATE TABLE vector_generation (
+			model TEXT PRIMARY KEY,
+			generation INTEGER NOT NULL
+		)`,
+		`INSERT INTO vector_generation (model, generation)
+		SELECT model, COUNT(*) FROM embedding_blobs GROUP BY model`,
+		// No conflict clause here: the INSERT OR REPLACE that fires the trigger would
+		// override it and reset the counter.
+		`CREATE TRIGGER embedding_blobs_ai AFTER INSERT ON embedding_blobs BEGIN
+			INSERT INTO vector_generation (model, generation)
+			SELECT new.model, 0 WHERE NOT EXISTS (SELECT 1 FROM vector_generation WHERE model = new.model);
+			UPDATE vector_generation SET generation = generation + 1 WHERE model = new.model;
+		END`,
+		`CREATE TRIGGER embedding_blobs_ad AFTER DELETE ON embedding_blobs BEGIN
+			UPDATE vector_generation SET generation = generation + 1 WHERE model = old.model;
+		END`,
+		`CREATE TRIGGER embedding_blobs_au AFTER UPDATE ON embedding_blobs BEGIN
+			UPDATE vector_generation SET generation = generation + 1 WHERE model IN (old.model, new.model);
+		END`,
+		// The persisted graphs covered all models at once; they are rebuilt per model.
+		`DROP TABLE vector_index`,
+		`CREATE TABLE vector_index (
+			model TEXT PRIMARY KEY,
+			generation INTEGER NOT NULL,
+			graph BLOB NOT NULL,
+			saved_at TEXT NOT NULL
+		)`,
+	)},
+	{7, "document file stats", execStatements(
+		// What the file looked like when it was last read, so update can skip files that
+		// have not changed. NULL for documents indexed before, which are read once more.
+		`ALTER TABLE documents ADD COLUMN size INTEGER`,
+		`ALTER TABLE documents ADD COLUMN mtime INTEGER`,
+		`ALTER TABLE documents ADD COLUMN inode INTEGER`,
+	)},
+	{8, "document metadata", execStatements(
+		// Front matter of each content, flattened (see frontmatter.Metadata): one row
+		// per value, seq numbering the elements of a list. Content indexed before is
+		// parsed by Reparse, not here, so that the migration never changes.
+		`CREATE TABLE document_metadata (
+			hash TEXT NOT NULL,
+			key TEXT NOT NULL,
+			seq INTEGER NOT NULL,
+			value TEXT NOT NULL,
+			list INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (hash, key, seq),
+			FOREIGN KEY (hash) REFERENCES content(hash) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX idx_document_metadata_key ON document_metadata(key, value COLLATE NOCASE)`,
+		// Aliases are indexed with the title, so a note is found by any of its names.
+		// Metadata is written with the content, before any document points at it.
+		`DROP TRIGGER IF EXISTS documents_ai`,
+		`DROP TRIGGER IF EXISTS documents_au`,
+		`CREATE TRIGGER documents_ai AFTER INSERT ON documents
+		WHEN new.active = 1
+		BEGIN
+			INSERT INTO documents_fts(rowid, filepath, title, body)
+			SELECT
+				new.id,
+				new.collection || '/' || new.path,
+				new.title || COALESCE(' ' || (SELECT group_concat(value, ' ') FROM document_metadata
+					WHERE hash = new.hash AND key = 'aliases'), ''),
+				(SELECT doc FROM content WHERE hash = new.hash)
+			WHERE new.active = 1;
+		END`,
+		`CREATE TRIGGER documents_au AFTER UPDATE ON documents
+		BEGIN
+			DELETE FROM documents_fts WHERE rowid = old.id AND new.active = 0;
+			INSERT OR REPLACE INTO documents_fts(rowid, filepath, title, body)
+			SELECT
+				new.id,
+				new.collection || '/' || new.path,
+				new.title || COALESCE(' ' || (SELECT group_concat(value, ' ') FROM document_metadata
+					WHERE hash = new.hash AND key = 'aliases'), ''),
+				(SELECT doc FROM content WHERE hash = new.hash)
+			WHERE new.active = 1;
+		END`,
+	)},
+	{9, "document links", execStatements(
+		// Links are kept per document rather than per content, as where a relative
+		// link points depends on the path of the note it is in. target_path is the
+		// document of the same collection the link resolves to, NULL if none does;
+		// target_name is the name it calls it by (links.Link.Name), to find the links a
+		// new document can resolve. Documents indexed before get their links from Reparse.
+		`CREATE TABLE links (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			source_id INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			target TEXT NOT NULL,
+			fragment TEXT NOT NULL DEFAULT '',
+			label TEXT NOT NULL DEFAULT '',
+			line INTEGER NOT NULL,
+			target_path TEXT,
+			target_name TEXT NOT NULL,
+			FOREIGN KEY (source_id) REFERENCES documents(id) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX idx_links_source ON links(source_id)`,
+		`CREATE INDEX idx_links_target ON links(target_path)`,
+		`CREATE INDEX idx_links_name ON links(target_name)`,
+	)},
+}
+
+// LatestSchemaVersion is the schema version this binary writes.
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// execStatements returns a migration body that runs each statement in order.
+func execStatements(stmts ...string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, q := range stmts {
+			if _, err := tx.Exec(q); err != nil {
+				return fmt.Errorf("%w (query: %s)", err, q)
+			}
+		}
+		return nil
+	}
+}
+
+// SchemaVersion returns the highest migration version recorded in the index (0 for an empty file).
+func (s *Store) SchemaVersion() (int, error) {
+	var v sql.NullInt64
+	if err := s.DB.QueryRow(`SELECT MAX(version) FROM schema_version`).Scan(&v); err != nil {
+		return 0, err
+	}
+	return int(v.Int64), nil
+}
+
+// migrate brings the index up to LatestSchemaVersion. Indexes created before versioning
+// existed have no schema_version table; they start at 0 and migration 1 is written with
+// IF NOT EXISTS so it adopts their tables as-is.
+func (s *Store) migrate() error {
+	if _, err := s.DB.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TEXT NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("schema init failed: %w", err)
+	}
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return fmt.Errorf("schema init failed: %w", err)
+	}
+	if latest := LatestSchemaVersion(); current > latest {
+		return fmt.Errorf("%w: %s is at schema v%d, this binary supports up to v%d; upgrade qmd to open it",
+			ErrSchemaTooNew, s.DBPath, current, latest)
+	}
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := s.applyMigration(m); err != nil {
+			return fmt.Errorf("schema migration %d (%s) failed: %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) applyMigration(m migration) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Another process may have migrated while we waited for the write lock.
+	var applied int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM schema_version WHERE version = ?`, m.version).Scan(&applied); err != nil {
+		return err
+	}
+	if applied > 0 {
+		return nil
+	}
+	if err := m.up(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)`,
+		m.version, m.name, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,273 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+)
+
+func tempDBPath(t *testing.T) string {
+	t.Helper()
+	tmpFile, err := os.CreateTemp("", "qmd-test-*.sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Close()
+	t.Cleanup(func() { os.Remove(tmpFile.Name()) })
+	return tmpFile.Name()
+}
+
+func TestMigrateFreshIndex(t *testing.T) {
+	s, err := NewStore(tempDBPath(t))
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	defer s.Close()
+
+	v, err := s.SchemaVersion()
+	if err != nil {
+		t.Fatalf("SchemaVersion failed: %v", err)
+	}
+	if v != LatestSchemaVersion() {
+		t.Errorf("Expected schema v%d, got v%d", LatestSchemaVersion(), v)
+	}
+}
+
+func TestMigrateLegacyIndex(t *testing.T) {
+	path := tempDBPath(t)
+
+	// An index written before schema_version existed: tables only, no version rows.
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrations[0].up(tx); err != nil {
+		t.Fatalf("legacy schema: %v", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO content (hash, doc, created_at) VALUES ('h1', 'legacy body', '2024-01-01T00:00:00Z')`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec(`INSERT INTO documents (collection, path, title, hash, created_at, modified_at) VALUES ('old', 'a.md', 'A', 'h1', '2024-01-01T00:00:00Z', '2024-01-01T00:00:00Z')`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec(`INSERT INTO content (hash, doc, created_at) VALUES ('h2', ?, '2024-01-01T00:00:00Z')`,
+		"---\ntitle: Old Note\naliases: [ancient]\n---\nmore legacy text, see [[a]]\n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec(`INSERT INTO documents (collection, path, title, hash, created_at, modified_at) VALUES ('old', 'b.md', 'b.md', 'h2', '2024-01-01T00:00:00Z', '2024-01-01T00:00:00Z')`); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	s, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore on legacy index failed: %v", err)
+	}
+	defer s.Close()
+	if v, _ := s.SchemaVersion(); v != LatestSchemaVersion() {
+		t.Errorf("Expected legacy index upgraded to v%d, got v%d", LatestSchemaVersion(), v)
+	}
+	doc, err := s.FindActiveDocument("old", "a.md")
+	if err != nil {
+		t.Fatalf("legacy document lost: %v", err)
+	}
+	if doc.Title != "A" {
+		t.Errorf("Expected title 'A', got '%s'", doc.Title)
+	}
+	// Migrations only create the chunk, metadata and links tables; chunks, front matter
+	// and links are read by the reparse step qmd runs when it next opens the index. The
+	// title replaces the file name, and aliases are indexed with it.
+	var chunks int
+	if err := s.DB.QueryRow(`SELECT COUNT(*) FROM content_chunks`).Scan(&chunks); err != nil || chunks != 0 {
+		t.Errorf("Expected the migration to index no chunks, got %d (err %v)", chunks, err)
+	}
+	if doc, err := s.FindActiveDocument("old", "b.md"); err != nil || doc.Title != "b.md" {
+		t.Errorf("Expected the migration to leave b.md's title alone, got %+v (err %v)", doc, err)
+	}
+	if back, _ := s.Backlinks("old", "a.md"); len(back) != 0 {
+		t.Errorf("Expected the migration to extract no links, got %+v", back)
+	}
+	if stale, err := s.NeedsReparse(); err != nil || !stale {
+		t.Fatalf("Expected a legacy index to need reparsing, got %v (err %v)", stale, err)
+	}
+	for i := 0; i < 2; i++ { // a second run changes nothing
+		if n, err := s.Reparse(); err != nil || n != 2 {
+			t.Fatalf("Reparse = %d, %v; want 2 documents", n, err)
+		}
+	}
+	if stale, _ := s.NeedsReparse(); stale {
+		t.Error("Expected no reparse needed after Reparse")
+	}
+	if results, err := s.SearchFTS("legacy body", 5, "", nil); err != nil || len(results) != 1 || results[0].StartLine != 1 {
+		t.Errorf("Expected legacy content backfilled into chunk index, got %+v (err %v)", results, err)
+	}
+	if doc, err := s.FindActiveDocument("old", "b.md"); err != nil || doc.Title != "Old Note" {
+		t.Errorf("Expected b.md retitled from its front matter, got %+v (err %v)", doc, err)
+	}
+	results, err := s.SearchFTS("title:ancient legacy", 5, "", nil)
+	if err != nil || len(results) != 1 || results[0].Metadata.Map()["title"] != "Old Note" {
+		t.Errorf("Expected b.md by its alias with metadata, got %+v (err %v)", results, err)
+	}
+	// And so are links.
+	if back, err := s.Backlinks("old", "a.md"); err != nil || len(back) != 1 || back[0].Source != "b.md" {
+		t.Errorf("Expected the link from b.md backfilled, got %+v (err %v)", back, err)
+	}
+}
+
+func TestMigrateVectorsPerModel(t *testing.T) {
+	path := tempDBPath(t)
+
+	// A v5 index with one embedded chunk and a stray blob no content_vectors row points to.
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec(`CREATE TABLE schema_version (version INTEGER PRIMARY KEY, name TEXT NOT NULL, applied_at TEXT NOT NULL)`); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range migrations[:5] {
+		if err := m.up(tx); err != nil {
+			t.Fatalf("migration %d: %v", m.version, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_version VALUES (?, ?, '2024-01-01T00:00:00Z')`, m.version, m.name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, q := range []string{
+		`INSERT INTO content (hash, doc, created_at) VALUES ('h1', 'body', '2024-01-01T00:00:00Z')`,
+		`INSERT INTO documents (collection, path, title, hash, created_at, modified_at) VALUES ('c', 'a.md', 'A', 'h1', '2024-01-01T00:00:00Z', '2024-01-01T00:00:00Z')`,
+		`INSERT INTO content_vectors (hash, seq, pos, model, embedded_at) VALUES ('h1', 0, 0, 'nomic-embed-text', '2024-01-01T00:00:00Z')`,
+		`INSERT INTO embedding_blobs (hash_seq, embedding) VALUES ('h1_0', X'0000803F00000000')`,
+		`INSERT INTO embedding_blobs (hash_seq, embedding) VALUES ('stray_0', X'0000803F00000000')`,
+		`INSERT INTO embedding_full (hash_seq, embedding) VALUES ('h1_0', X'0000803F00000000')`,
+	} {
+		if _, err := tx.Exec(q); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	s, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	defer s.Close()
+	var blobs, full int
+	s.DB.QueryRow(`SELECT COUNT(*) FROM embedding_blobs WHERE model = 'nomic-embed-text'`).Scan(&blobs)
+	s.DB.QueryRow(`SELECT COUNT(*) FROM embedding_full WHERE model = 'nomic-embed-text'`).Scan(&full)
+	if blobs != 1 || full != 1 || !s.HasModelEmbeddings("nomic-embed-text") {
+		t.Errorf("Expected the chunk's vectors under its model, got %d blobs and %d full", blobs, full)
+	}
+	res, err := s.SearchVectors("nomic-embed-text", []float32{1, 0}, 1, AggregateMax, nil, nil)
+	if err != nil || len(res) != 1 || res[0].Filepath != "qmd://c/a.md" {
+		t.Errorf("Expected the migrated vector to be searchable, got %v (%v)", res, err)
+	}
+}
+
+func TestMigrateRunsPendingInOrder(t *testing.T) {
+	path := tempDBPath(t)
+	s, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	s.Close()
+
+	saved := migrations
+	defer func() { migrations = saved }()
+	next := LatestSchemaVersion() + 1
+	var order []int
+	migrations = append(append([]migration{}, saved...),
+		migration{next, "add note column", func(tx *sql.Tx) error {
+			order = append(order, next)
+			_, err := tx.Exec(`ALTER TABLE documents ADD COLUMN note TEXT`)
+			return err
+		}},
+		migration{next + 1, "fill note column", func(tx *sql.Tx) error {
+			order = append(order, next+1)
+			_, err := tx.Exec(`UPDATE documents SET note = 'x'`)
+			return err
+		}},
+	)
+
+	s, err = NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore with pending migrations failed: %v", err)
+	}
+	defer s.Close()
+	if len(order) != 2 || order[0] != next || order[1] != next+1 {
+		t.Errorf("Expected migrations %d,%d in order, got %v", next, next+1, order)
+	}
+	if v, _ := s.SchemaVersion(); v != next+1 {
+		t.Errorf("Expected schema v%d, got v%d", next+1, v)
+	}
+}
+
+func TestMigrateFailureRollsBack(t *testing.T) {
+	path := tempDBPath(t)
+	s, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	s.Close()
+
+	saved := migrations
+	defer func() { migrations = saved }()
+	next := LatestSchemaVersion() + 1
+	migrations = append(append([]migration{}, saved...),
+		migration{next, "broken", execStatements(
+			`CREATE TABLE half_done (id INTEGER)`,
+			`THIS IS NOT SQL`,
+		)},
+	)
+
+	if _, err := NewStore(path); err == nil {
+		t.Fatal("Expected migration error")
+	}
+
+	migrations = saved
+	s, err = NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	defer s.Close()
+	var n int
+	_ = s.DB.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'half_done'`).Scan(&n)
+	if n != 0 {
+		t.Error("Failed migration left a partial table behind")
+	}
+	if v, _ := s.SchemaVersion(); v != LatestSchemaVersion() {
+		t.Errorf("Expected schema v%d, got v%d", LatestSchemaVersion(), v)
+	}
+}
+
+func TestMigrateRefusesNewerIndex(t *testing.T) {
+	path := tempDBPath(t)
+	s, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	if _, err := s.DB.Exec(`INSERT INTO schema_version (version, name, applied_at) VALUES (?, 'from the future', '2030-01-01T00:00:00Z')`, LatestSchemaVersion()+1); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	_, err = NewStore(path)
+	if !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("Expected ErrSchemaTooNew, got %v", err)
+	}
+}
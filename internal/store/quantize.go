@@ -0,0 +1,209 @@
+package store
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// VectorStorage is how embedding_blobs stores vectors. Quantized modes are searched on
+// their codes alone, unless KeepFullVectors also keeps the full-precision vectors in
+// embedding_full to rescore the top candidates.
+type VectorStorage string
+
+const (
+	StorageFloat32 VectorStorage = "float32" // 4 bytes per dimension
+	StorageInt8    VectorStorage = "int8"    // 1 byte per dimension + 4-byte scale
+	StorageBinary  VectorStorage = "binary"  // 1 bit per dimension (sign)
+)
+
+// ParseVectorStorage validates a storage mode name ("" means float32).
+func ParseVectorStorage(name string) (VectorStorage, error) {
+	switch VectorStorage(name) {
+	case "", StorageFloat32:
+		return StorageFloat32, nil
+	case StorageInt8, StorageBinary:
+		return VectorStorage(name), nil
+	}
+	return "", fmt.Errorf("unknown vector storage %q (want float32, int8 or binary)", name)
+}
+
+// rescoreFactor is how many quantized candidates are fetched per requested result before
+// rescoring with full precision. Binary codes are coarse and need a deeper pool.
+// Without full-precision vectors there is nothing to rescore with, and the factor is 1.
+func (m VectorStorage) rescoreFactor() int {
+	switch m {
+	case StorageInt8:
+		return 4
+	case StorageBinary:
+		return 10
+	}
+	return 1
+}
+
+// encode converts a vector to its embedding_blobs representation.
+func (m VectorStorage) encode(v []float32) []byte {
+	switch m {
+	case StorageInt8:
+		scale, codes := quantizeInt8(v)
+		b := make([]byte, 4+len(codes))
+		binary.LittleEndian.PutUint32(b, math.Float32bits(scale))
+		for i, c := range codes {
+			b[4+i] = byte(c)
+		}
+		return b
+	case StorageBinary:
+		b := make([]byte, (len(v)+7)/8)
+		for i, x := range v {
+			if x > 0 {
+				b[i/8] |= 1 << (i % 8)
+			}
+		}
+		return b
+	}
+	return float32SliceToBlob(v)
+}
+
+// decode reverses encode, up to quantization error. Binary blobs decode to ±1 per bit.
+func (m VectorStorage) decode(b []byte) []float32 {
+	switch m {
+	case StorageInt8:
+		if len(b) < 4 {
+			return nil
+		}
+		scale := math.Float32frombits(binary.LittleEndian.Uint32(b))
+		out := make([]float32, len(b)-4)
+		for i, c := range b[4:] {
+			out[i] = float32(int8(c)) * scale
+		}
+		return out
+	case StorageBinary:
+		out := make([]float32, len(b)*8)
+		for i := range out {
+			if b[i/8]&(1<<(i%8)) != 0 {
+				out[i] = 1
+			} else {
+				out[i] = -1
+			}
+		}
+		return out
+	}
+	return BlobToFloat32Slice(b)
+}
+
+// newSet returns the in-memory vector store the HNSW graph navigates for this mode.
+func (m VectorStorage) newSet() vectorSet {
+	switch m {
+	case StorageInt8:
+		return &int8Set{}
+	case StorageBinary:
+		return &binarySet{}
+	}
+	return &float32Set{}
+}
+
+// quantizeInt8 maps v symmetrically onto [-127, 127]; v[i] ≈ codes[i] * scale.
+func quantizeInt8(v []float32) (scale float32, codes []int8) {
+	var maxAbs float32
+	for _, x := range v {
+		if a := float32(math.Abs(float64(x))); a > maxAbs {
+			maxAbs = a
+		}
+	}
+	codes = make([]int8, len(v))
+	if maxAbs == 0 {
+		return 0, codes
+	}
+	scale = maxAbs / 127
+	for i, x := range v {
+		codes[i] = int8(math.Round(float64(x / scale)))
+	}
+	return scale, codes
+}
+
+// int8Set stores quantized codes and their norms; the per-vector scale cancels out of
+// cosine similarity so it is not kept.
+type int8Set struct {
+	codes [][]int8
+	norms []float32
+}
+
+func (s *int8Set) Len() int { return len(s.codes) }
+
+func (s *int8Set) Add(v []float32) {
+	_, codes := quantizeInt8(v)
+	var sum int64
+	for _, c := range codes {
+		sum += int64(c) * int64(c)
+	}
+	s.codes = append(s.codes, codes)
+	s.norms = append(s.norms, float32(math.Sqrt(float64(sum))))
+}
+
+func (s *int8Set) Similarity(i, j int) float32 {
+	a, b := s.codes[i], s.codes[j]
+	if len(a) != len(b) || s.norms[i] == 0 || s.norms[j] == 0 {
+		return 0
+	}
+	var d int32
+	for k := range a {
+		d += int32(a[k]) * int32(b[k])
+	}
+	return float32(d) / (s.norms[i] * s.norms[j])
+}
+
+// Querier scores the float query against codes directly (asymmetric distance), which
+// loses less precision than quantizing the query too.
+func (s *int8Set) Querier(q []float32) func(j int) float32 {
+	qn := normalize(q)
+	return func(j int) float32 {
+		c := s.codes[j]
+		if len(c) != len(qn) || s.norms[j] == 0 {
+			return 0
+		}
+		var d float32
+		for k := range c {
+			d += qn[k] * float32(c[k])
+		}
+		return d / s.norms[j]
+	}
+}
+
+// binarySet stores sign bits; similarity is 1 - 2*hamming/bits, which tracks the angle
+// between the original vectors.
+type binarySet struct {
+	words [][]uint64
+}
+
+func (s *binarySet) Len() int { return len(s.words) }
+
+func (s *binarySet) Add(v []float32) { s.words = append(s.words, signBits(v)) }
+
+func (s *binarySet) Similarity(i, j int) float32 { return hammingSimilarity(s.words[i], s.words[j]) }
+
+func (s *binarySet) Querier(q []float32) func(j int) float32 {
+	qw := signBits(q)
+	return func(j int) float32 { return hammingSimilarity(qw, s.words[j]) }
+}
+
+func signBits(v []float32) []uint64 {
+	w := make([]uint64, (len(v)+63)/64)
+	for i, x := range v {
+		if x > 0 {
+			w[i/64] |= 1 << (i % 64)
+		}
+	}
+	return w
+}
+
+func hammingSimilarity(a, b []uint64) float32 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var d int
+	for i := range a {
+		d += bits.OnesCount64(a[i] ^ b[i])
+	}
+	return 1 - 2*float32(d)/float32(64*len(a))
+}
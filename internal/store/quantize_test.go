@@ -0,0 +1,133 @@
+package store
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestVectorStorageCodecs(t *testing.T) {
+	v := []float32{0.5, -1, 0.25, 0, 2, -0.75, 0.1, -0.1, 1.5}
+	if got := StorageFloat32.decode(StorageFloat32.encode(v)); len(got) != len(v) || got[4] != 2 {
+		t.Errorf("float32 round trip = %v", got)
+	}
+
+	b := StorageInt8.encode(v)
+	if len(b) != 4+len(v) {
+		t.Errorf("int8 blob is %d bytes, want %d", len(b), 4+len(v))
+	}
+	for i, x := range StorageInt8.decode(b) {
+		if math.Abs(float64(x-v[i])) > 2.0/127 {
+			t.Errorf("int8 decode[%d] = %f, want ~%f", i, x, v[i])
+		}
+	}
+
+	b = StorageBinary.encode(v)
+	if len(b) != 2 {
+		t.Errorf("binary blob is %d bytes, want 2", len(b))
+	}
+	for i, x := range StorageBinary.decode(b)[:len(v)] {
+		if (x > 0) != (v[i] > 0) {
+			t.Errorf("binary decode[%d] = %f, sign of %f lost", i, x, v[i])
+		}
+	}
+
+	if _, err := ParseVectorStorage("float16"); err == nil {
+		t.Error("Expected error for unknown storage mode")
+	}
+}
+
+func TestQuantizedSearchRescores(t *testing.T) {
+	for _, tc := range []struct {
+		mode     VectorStorage
+		keepFull bool
+	}{
+		{StorageInt8, false}, {StorageInt8, true}, {StorageBinary, false}, {StorageBinary, true},
+	} {
+		mode := tc.mode
+		name := string(mode)
+		if tc.keepFull {
+			name += "/keep-full"
+		}
+		t.Run(name, func(t *testing.T) {
+			s, err := NewStore(tempDBPath(t))
+			if err != nil {
+				t.Fatalf("NewStore failed: %v", err)
+			}
+			defer s.Close()
+			if err := s.SetVectorStorage(mode); err != nil {
+				t.Fatalf("SetVectorStorage failed: %v", err)
+			}
+			if err := s.SetKeepFullVectors(tc.keepFull); err != nil {
+				t.Fatalf("SetKeepFullVectors failed: %v", err)
+			}
+
+			rng := rand.New(rand.NewSource(5))
+			now := time.Now()
+			vecs := randomVectors(rng, 80, 64)
+			for i, v := range vecs {
+				body := "document number " + itoa(i)
+				hash := HashContent(body)
+				s.InsertContent(hash, body, now)
+				s.InsertDocument("col", "doc"+itoa(i)+".md", "Doc "+itoa(i), hash, now, now)
+				if err := s.InsertEmbedding(hash, 0, 0, v, "test-model", now); err != nil {
+					t.Fatalf("InsertEmbedding failed: %v", err)
+				}
+			}
+
+			var blobLen int
+			_ = s.DB.QueryRow(`SELECT LENGTH(embedding) FROM embedding_blobs LIMIT 1`).Scan(&blobLen)
+			if want := len(mode.encode(vecs[0])); blobLen != want {
+				t.Errorf("Stored blob is %d bytes, want %d", blobLen, want)
+			}
+
+			query := vecs[23]
+			ann, err := s.SearchVectors("test-model", query, 3, AggregateMax, nil, nil)
+			if err != nil {
+				t.Fatalf("SearchVectors failed: %v", err)
+			}
+			exact, err := s.SearchVectorsBrute("test-model", query, 3, AggregateMax, nil, nil)
+			if err != nil {
+				t.Fatalf("SearchVectorsBrute failed: %v", err)
+			}
+			if len(ann) != 3 || ann[0].Filepath != "qmd://col/doc23.md" || exact[0].Filepath != ann[0].Filepath {
+				t.Fatalf("Expected top hit doc23 from both searches, got ann=%v exact=%v", ann, exact)
+			}
+			// Rescored against full precision, the self-match scores exactly 1; scored on
+			// codes, it is close.
+			tolerance := 0.02
+			if tc.keepFull {
+				tolerance = 1e-5
+			}
+			if math.Abs(ann[0].Score-1) > tolerance {
+				t.Errorf("Expected self-match similarity 1 (±%g), got %f", tolerance, ann[0].Score)
+			}
+
+			// Full-precision copies are only kept on request, so the quantized index is
+			// smaller than a float32 one unless they are.
+			st, _ := s.GetStatus()
+			sizes := make(map[string]TableSize)
+			for _, ts := range st.Tables {
+				sizes[ts.Table] = ts
+			}
+			wantFull := 0
+			if tc.keepFull {
+				wantFull = len(vecs)
+			}
+			if got := sizes["embedding_full"].Rows; got != wantFull {
+				t.Errorf("embedding_full has %d rows, want %d", got, wantFull)
+			}
+			if float32Bytes := int64(len(vecs) * 4 * len(vecs[0])); !tc.keepFull && sizes["embedding_blobs"].Bytes >= float32Bytes {
+				t.Errorf("Quantized blobs take %d bytes, float32 would take %d", sizes["embedding_blobs"].Bytes, float32Bytes)
+			}
+
+			if err := s.SetVectorStorage(StorageFloat32); err == nil {
+				t.Error("Expected SetVectorStorage to refuse while embeddings exist")
+			}
+			if st.VectorStorage != mode {
+				t.Errorf("Status storage = %q, want %q", st.VectorStorage, mode)
+			}
+		})
+	}
+}
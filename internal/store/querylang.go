@@ -0,0 +1,369 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Query is a search query parsed by ParseQuery: text and title terms, compiled to FTS5
+// MATCH syntax for each tokenizer, plus SQL filters on the matched documents (alias d).
+// A query of filters alone lists the documents passing them.
+type Query struct {
+	clauses [][]queryTerm // ANDed; each clause ORs its terms
+	negated []queryTerm
+	filters []queryFilter
+}
+
+// queryTerm is a sanitized word (prefix match) or a quoted phrase, in the body or, for
+// title: terms, in the title.
+type queryTerm struct {
+	text   string
+	phrase bool
+	title  bool
+}
+
+type queryFilter struct {
+	sql  string
+	args []interface{}
+}
+
+// Match returns the FTS5 MATCH expression for the text and title terms of the query
+// against documents_fts, or "" if the query has no such terms.
+func (q *Query) Match() string {
+	return q.match(q.clauses)
+}
+
+// chunkMatch returns the MATCH expression for chunks_fts, which has no title: the
+// clauses without title terms. The others are checked by titleFilter.
+func (q *Query) chunkMatch() string {
+	return q.match(q.bodyClauses())
+}
+
+func (q *Query) match(clauses [][]queryTerm) string {
+	if len(clauses) == 0 {
+		return ""
+	}
+	var parts []string
+	for _, c := range clauses {
+		parts = append(parts, orGroup(c, unicodeTerm))
+	}
+	match := strings.Join(parts, " AND ")
+	if len(q.negated) > 0 {
+		match = "(" + match + ") NOT " + orGroup(q.negated, unicodeTerm)
+	}
+	return match
+}
+
+// bodyClauses returns the clauses that only search the body.
+func (q *Query) bodyClauses() [][]queryTerm {
+	var body [][]queryTerm
+	for _, c := range q.clauses {
+		if !hasTitleTerm(c) {
+			body = append(body, c)
+		}
+	}
+	return body
+}
+
+func hasTitleTerm(terms []queryTerm) bool {
+	for _, t := range terms {
+		if t.title {
+			return true
+		}
+	}
+	return false
+}
+
+// titleFilter restricts chunk searches to documents matching the clauses with title
+// terms, or returns ok false if there are none.
+func (q *Query) titleFilter() (f queryFilter, ok bool) {
+	var parts []string
+	for _, c := range q.clauses {
+		if hasTitleTerm(c) {
+			parts = append(parts, orGroup(c, unicodeTerm))
+		}
+	}
+	if len(parts) == 0 {
+		return queryFilter{}, false
+	}
+	return queryFilter{
+		sql:  `d.id IN (SELECT rowid FROM documents_fts WHERE documents_fts MATCH ?)`,
+		args: []interface{}{strings.Join(parts, " AND ")},
+	}, true
+}
+
+// anyTerm ORs every positive body term, for picking the chunk of a document that best
+// matches when no single chunk matches the whole query. It is "" if there are none.
+func (q *Query) anyTerm() string {
+	var all []queryTerm
+	for _, c := range q.bodyClauses() {
+		all = append(all, c...)
+	}
+	return strings.Join(mapTerms(all, unicodeTerm), " OR ")
+}
+
+// empty reports whether the query has neither terms nor filters.
+func (q *Query) empty() bool {
+	return len(q.clauses) == 0 && len(q.filters) == 0
+}
+
+// where appends the query's filters to a WHERE clause.
+func (q *Query) where(sql string, args []interface{}) (string, []interface{}) {
+	for _, f := range q.filters {
+		sql += ` AND ` + f.sql
+		args = append(args, f.args...)
+	}
+	return sql, args
+}
+
+// unicodeTerm renders a term for the unicode61 tables: words are prefix-matched.
+func unicodeTerm(t queryTerm) string {
+	s := quoteFTS(t.text)
+	if !t.phrase {
+		s += "*"
+	}
+	if t.title {
+		s = "title : " + s
+	}
+	return s
+}
+
+func quoteFTS(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+func mapTerms(terms []queryTerm, render func(queryTerm) string) []string {
+	out := make([]string, len(terms))
+	for i, t := range terms {
+		out[i] = render(t)
+	}
+	return out
+}
+
+// orGroup renders terms joined by OR, parenthesized when there is more than one.
+func orGroup(terms []queryTerm, render func(queryTerm) string) string {
+	if len(terms) == 1 {
+		return render(terms[0])
+	}
+	return "(" + strings.Join(mapTerms(terms, render), " OR ") + ")"
+}
+
+// queryToken is one lexed element of a query string.
+type queryToken struct {
+	text   string
+	field  string // title, path, collection or modified; "" for text
+	phrase bool   // text was quoted
+	negate bool   // leading '-'
+	or     bool   // bare OR operator
+}
+
+// queryFields are the field: prefixes ParseQuery understands. Other prefixes are treated
+// as ordinary text.
+var queryFields = map[string]bool{"title": true, "path": true, "collection": true, "modified": true}
+
+// ParseQuery parses the search grammar:
+//
+//	word             prefix match on a term ("auth" matches "authentication")
+//	"exact phrase"   phrase match
+//	-word -"phrase"  exclude documents containing it
+//	a OR b           either term (OR binds adjacent terms; terms are otherwise ANDed)
+//	title:foo        term or "phrase" in the title; title:a OR b also works
+//	path:journals/*  path glob, against "path" or "collection/path"; no wildcard means prefix
+//	collection:notes restrict to a collection
+//	modified:>2025-01-01  file modification date, with >, >=, <, <= or = (a bare date means that day)
+//
+// Filters can be negated with '-' too. A query without search terms lists the documents
+// passing its filters and exclusions. Unbalanced quotes run to the end of the query.
+// Free text is compiled to FTS5 syntax and filters to bound SQL parameters, so no user
+// input reaches either language unquoted.
+func ParseQuery(query string) (*Query, error) {
+	tokens := lexQuery(query)
+	q := &Query{}
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.field != "" && !searchToken(t) {
+			f, err := fieldFilter(t)
+			if err != nil {
+				return nil, err
+			}
+			if t.negate {
+				f.sql = `NOT ` + f.sql
+			}
+			q.filters = append(q.filters, f)
+			continue
+		}
+		term, ok := textTerm(t)
+		if !ok && term.title {
+			return nil, fmt.Errorf("title: needs a search term")
+		}
+		if !ok || t.or {
+			continue // stray OR with nothing to join
+		}
+		if t.negate {
+			q.negated = append(q.negated, term)
+			continue
+		}
+		clause := []queryTerm{term}
+		// Absorb "OR term" pairs into this clause.
+		for i+2 < len(tokens) && tokens[i+1].or && searchToken(tokens[i+2]) && !tokens[i+2].negate {
+			i += 2
+			if next, ok := textTerm(tokens[i]); ok {
+				clause = append(clause, next)
+			}
+		}
+		q.clauses = append(q.clauses, clause)
+	}
+
+	if len(q.negated) > 0 {
+		// Chunk searches would only drop the chunk containing an excluded term, so
+		// exclusions are also checked against the whole document.
+		q.filters = append(q.filters, queryFilter{
+			sql:  `d.id NOT IN (SELECT rowid FROM documents_fts WHERE documents_fts MATCH ?)`,
+			args: []interface{}{orGroup(q.negated, unicodeTerm)},
+		})
+	}
+	return q, nil
+}
+
+// lexQuery splits a query into tokens, honouring double quotes and field: prefixes.
+func lexQuery(query string) []queryToken {
+	rs := []rune(query)
+	var tokens []queryToken
+	i := 0
+	readQuoted := func() string {
+		// rs[i] is the opening quote.
+		i++
+		start := i
+		for i < len(rs) && rs[i] != '"' {
+			i++
+		}
+		s := string(rs[start:i])
+		if i < len(rs) {
+			i++
+		}
+		return s
+	}
+	for i < len(rs) {
+		if unicode.IsSpace(rs[i]) {
+			i++
+			continue
+		}
+		var t queryToken
+		if rs[i] == '-' && i+1 < len(rs) && !unicode.IsSpace(rs[i+1]) {
+			t.negate = true
+			i++
+		}
+		if rs[i] == '"' {
+			t.text, t.phrase = readQuoted(), true
+			tokens = append(tokens, t)
+			continue
+		}
+		start := i
+		for i < len(rs) && !unicode.IsSpace(rs[i]) && rs[i] != ':' {
+			i++
+		}
+		word := string(rs[start:i])
+		if i < len(rs) && rs[i] == ':' && queryFields[strings.ToLower(word)] {
+			t.field = strings.ToLower(word)
+			i++
+			if i < len(rs) && rs[i] == '"' {
+				t.text, t.phrase = readQuoted(), true
+				tokens = append(tokens, t)
+				continue
+			}
+			start = i
+		}
+		for i < len(rs) && !unicode.IsSpace(rs[i]) {
+			i++
+		}
+		t.text = string(rs[start:i])
+		t.or = t.field == "" && !t.negate && t.text == "OR"
+		tokens = append(tokens, t)
+	}
+	return tokens
+}
+
+// searchToken reports whether t is a search term rather than a filter: text, or a
+// title: term that is not negated. Excluded titles are filtered, as chunk tables have no
+// title to exclude them by.
+func searchToken(t queryToken) bool {
+	return t.field == "" || t.field == "title" && !t.negate
+}
+
+// textTerm converts a text or title: token to a term: quoted phrases are kept as typed,
+// bare words are sanitized. ok is false if nothing searchable remains.
+func textTerm(t queryToken) (term queryTerm, ok bool) {
+	title := t.field == "title"
+	if t.phrase {
+		return queryTerm{text: t.text, phrase: true, title: title}, strings.TrimSpace(t.text) != ""
+	}
+	sanitized := SanitizeFTS5Term(t.text)
+	return queryTerm{text: sanitized, title: title}, sanitized != ""
+}
+
+// fieldFilter compiles a field: token to a SQL condition on documents d.
+func fieldFilter(t queryToken) (queryFilter, error) {
+	switch t.field {
+	case "title":
+		term, ok := textTerm(t)
+		if !ok {
+			return queryFilter{}, fmt.Errorf("title: needs a search term")
+		}
+		return queryFilter{
+			sql:  `d.id IN (SELECT rowid FROM documents_fts WHERE documents_fts MATCH ?)`,
+			args: []interface{}{unicodeTerm(term)},
+		}, nil
+	case "path":
+		glob := t.text
+		if !strings.ContainsAny(glob, "*?[") {
+			glob += "*"
+		}
+		return queryFilter{
+			sql:  `(d.path GLOB ? OR d.collection || '/' || d.path GLOB ?)`,
+			args: []interface{}{glob, glob},
+		}, nil
+	case "collection":
+		return queryFilter{sql: `d.collection = ?`, args: []interface{}{t.text}}, nil
+	case "modified":
+		return modifiedFilter(t.text)
+	}
+	return queryFilter{}, fmt.Errorf("unknown field %q", t.field)
+}
+
+// docModified is when a document's file was last modified, in Unix nanoseconds: the
+// mtime the indexer recorded, or for documents without a file stat the time they were
+// last written to the index.
+const docModified = `(CASE WHEN d.mtime > 0 THEN d.mtime ELSE CAST(strftime('%s', d.modified_at) AS INTEGER) * 1000000000 END)`
+
+// modifiedFilter compiles ">2025-01-01" style comparisons. Dates are local days.
+func modifiedFilter(v string) (queryFilter, error) {
+	op := "="
+	for _, candidate := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(v, candidate) {
+			op, v = candidate, v[len(candidate):]
+			break
+		}
+	}
+	day, err := time.ParseInLocation("2006-01-02", v, time.Local)
+	if err != nil {
+		return queryFilter{}, fmt.Errorf("invalid modified date %q (want YYYY-MM-DD)", v)
+	}
+	start := day.UnixNano()
+	next := day.AddDate(0, 0, 1).UnixNano()
+	switch op {
+	case ">":
+		return queryFilter{sql: docModified + ` >= ?`, args: []interface{}{next}}, nil
+	case ">=":
+		return queryFilter{sql: docModified + ` >= ?`, args: []interface{}{start}}, nil
+	case "<":
+		return queryFilter{sql: docModified + ` < ?`, args: []interface{}{start}}, nil
+	case "<=":
+		return queryFilter{sql: docModified + ` < ?`, args: []interface{}{next}}, nil
+	}
+	return queryFilter{
+		sql:  `(` + docModified + ` >= ? AND ` + docModified + ` < ?)`,
+		args: []interface{}{start, next},
+	}, nil
+}
@@ -0,0 +1,124 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	cases := []struct {
+		query string
+		match string
+		nf    int // number of SQL filters
+	}{
+		{"auth flow", `"auth"* AND "flow"*`, 0},
+		{`"exact phrase" here`, `"exact phrase" AND "here"*`, 0},
+		{"a OR b c", `("a"* OR "b"*) AND "c"*`, 0},
+		{"deploy -staging -\"dry run\"", `("deploy"*) NOT ("staging"* OR "dry run")`, 1},
+		{"notes title:weekly collection:journal", `"notes"* AND title : "weekly"*`, 1},
+		{`title:"weekly review" OR title:standup`, `(title : "weekly review" OR title : "standup"*)`, 0},
+		{"notes -title:draft", `"notes"*`, 1},
+		{"collection:notes", "", 1},
+		{"-only", "", 1},
+		{"x path:journals/* modified:>2025-01-01 -collection:archive", `"x"*`, 3},
+		{`say "unterminated`, `"say"* AND "unterminated"`, 0},
+		{`quote "a""b"`, `"quote"* AND "a" AND "b"`, 0},
+		{"OR lonely", `"lonely"*`, 0},
+		{"http://example", `"httpexample"*`, 0},
+		{"", "", 0},
+	}
+	for _, c := range cases {
+		q, err := ParseQuery(c.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) failed: %v", c.query, err)
+			continue
+		}
+		if q.Match() != c.match || len(q.filters) != c.nf {
+			t.Errorf("ParseQuery(%q) = %q with %d filters, want %q with %d", c.query, q.Match(), len(q.filters), c.match, c.nf)
+		}
+	}
+
+	for _, bad := range []string{"title:", "x title:!!", "x modified:>yesterday"} {
+		if _, err := ParseQuery(bad); err == nil {
+			t.Errorf("ParseQuery(%q): expected error", bad)
+		}
+	}
+}
+
+func TestSearchFTSQueryLanguage(t *testing.T) {
+	s, err := NewStore(tempDBPath(t))
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	defer s.Close()
+
+	old := time.Date(2024, 6, 1, 12, 0, 0, 0, time.Local)
+	recent := time.Date(2025, 3, 1, 12, 0, 0, 0, time.Local)
+	docs := []struct {
+		collection, path, title, body string
+		modified                      time.Time
+	}{
+		{"notes", "journals/2025-03-01.md", "Weekly review", "Shipped the release pipeline today.", recent},
+		{"notes", "projects/pipeline.md", "Pipeline design", "The release pipeline runs nightly.", old},
+		{"archive", "journals/2024-06-01.md", "Weekly review", "Release was delayed by the pipeline.", old},
+	}
+	for _, d := range docs {
+		hash := HashContent(d.body)
+		s.InsertContent(hash, d.body, d.modified)
+		s.InsertDocument(d.collection, d.path, d.title, hash, d.modified, d.modified)
+	}
+
+	cases := []struct {
+		query string
+		want  []string
+	}{
+		{"pipeline", []string{"notes/journals/2025-03-01.md", "notes/projects/pipeline.md", "archive/journals/2024-06-01.md"}},
+		{`"release pipeline"`, []string{"notes/journals/2025-03-01.md", "notes/projects/pipeline.md"}},
+		{"pipeline -nightly -delayed", []string{"notes/journals/2025-03-01.md"}},
+		{"shipped OR delayed", []string{"notes/journals/2025-03-01.md", "archive/journals/2024-06-01.md"}},
+		{"pipeline title:weekly", []string{"notes/journals/2025-03-01.md", "archive/journals/2024-06-01.md"}},
+		{"title:weekly", []string{"notes/journals/2025-03-01.md", "archive/journals/2024-06-01.md"}},
+		{"title:design OR title:weekly collection:notes", []string{"notes/journals/2025-03-01.md", "notes/projects/pipeline.md"}},
+		{"pipeline -title:weekly", []string{"notes/projects/pipeline.md"}},
+		{"collection:notes", []string{"notes/journals/2025-03-01.md", "notes/projects/pipeline.md"}},
+		{"path:journals/* -delayed", []string{"notes/journals/2025-03-01.md"}},
+		{"pipeline path:journals/*", []string{"notes/journals/2025-03-01.md", "archive/journals/2024-06-01.md"}},
+		{"pipeline path:notes/projects", []string{"notes/projects/pipeline.md"}},
+		{"pipeline collection:archive", []string{"archive/journals/2024-06-01.md"}},
+		{"pipeline -collection:archive modified:>2025-01-01", []string{"notes/journals/2025-03-01.md"}},
+		{"pipeline modified:2024-06-01", []string{"notes/projects/pipeline.md", "archive/journals/2024-06-01.md"}},
+	}
+	for _, c := range cases {
+		results, err := s.SearchFTS(c.query, 10, "", nil)
+		if err != nil {
+			t.Errorf("SearchFTS(%q) failed: %v", c.query, err)
+			continue
+		}
+		got := make(map[string]bool)
+		for _, r := range results {
+			got[r.DisplayPath] = true
+		}
+		if len(got) != len(c.want) {
+			t.Errorf("SearchFTS(%q) returned %v, want %v", c.query, got, c.want)
+			continue
+		}
+		for _, w := range c.want {
+			if !got[w] {
+				t.Errorf("SearchFTS(%q) missing %s (got %v)", c.query, w, got)
+			}
+		}
+	}
+
+	// A query of filters alone lists documents, most recently modified first, with their
+	// first chunk as the snippet.
+	results, err := s.SearchFTS("collection:notes", 10, "", nil)
+	if err != nil || len(results) != 2 {
+		t.Fatalf("SearchFTS(collection:notes) = %+v, %v", results, err)
+	}
+	if r := results[0]; r.DisplayPath != "notes/journals/2025-03-01.md" || r.Snippet == "" || r.StartLine != 1 {
+		t.Errorf("Expected the recent journal with its first chunk first, got %+v", r)
+	}
+	if results, _ := s.SearchFTS("", 10, "notes", nil); len(results) != 0 {
+		t.Errorf("Expected an empty query to find nothing, got %d results", len(results))
+	}
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"path"
+	"strconv"
+
+	"github.com/ba0f3/qmd-go/internal/links"
+)
+
+// contentParseVersion identifies what the indexer derives from content: chunks, front
+// matter metadata, titles and links. Bump it when a parser change alters what would be
+// stored, so that content indexed before is re-derived when qmd next opens the index.
+// Migrations only create the tables, since they must never change once released.
+//
+// Version 2 indexes the chunks of content written before content_chunks existed.
+const contentParseVersion = 2
+
+// NeedsReparse reports whether content was indexed by a qmd that derived less or
+// differently from it than this one does (see Reparse).
+func (s *Store) NeedsReparse() (bool, error) {
+	v, err := s.getSetting(settingParseVersion)
+	if err != nil {
+		return false, err
+	}
+	n, _ := strconv.Atoi(v)
+	return n < contentParseVersion, nil
+}
+
+// Reparse re-derives the front matter metadata, title and links of every active document
+// from its stored content, the way the indexer now would, indexes the chunks of content
+// that has none, and records contentParseVersion.
+// It rewrites everything in one transaction, so running it again changes nothing. It
+// returns the number of documents.
+func (s *Store) Reparse() (int, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"document_metadata", "links"} {
+		if _, err := tx.Exec(`DELETE FROM ` + table); err != nil {
+			return 0, err
+		}
+	}
+	rows, err := tx.Query(`SELECT hash, doc FROM content`)
+	if err != nil {
+		return 0, err
+	}
+	parsed := make(map[string]*Content)
+	for rows.Next() {
+		var hash, doc string
+		if err := rows.Scan(&hash, &doc); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		c := &Content{Hash: hash, Links: links.Extract(doc)}
+		c.parseFrontMatter(doc)
+		parsed[hash] = c
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	for _, c := range parsed {
+		if err := insertMetadata(tx, c.Hash, c.Meta); err != nil {
+			return 0, err
+		}
+	}
+	if err := backfillChunks(tx); err != nil {
+		return 0, err
+	}
+
+	type doc struct {
+		id               int64
+		collection, path string
+		hash             string
+	}
+	var docs []doc
+	rows, err = tx.Query(`SELECT id, collection, path, hash FROM documents WHERE active = 1 ORDER BY collection, path`)
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var d doc
+		if err := rows.Scan(&d.id, &d.collection, &d.path, &d.hash); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		docs = append(docs, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	// Every document is rewritten, so its documents_fts row picks up its title and
+	// aliases through documents_au, and documents_trigram_au adds backfilled chunks of
+	// trigram collections to chunks_trigram.
+	for _, d := range docs {
+		title := path.Base(d.path)
+		if c := parsed[d.hash]; c != nil && c.Title != "" {
+			title = c.Title
+		}
+		if _, err := tx.Exec(`UPDATE documents SET title = ? WHERE id = ?`, title, d.id); err != nil {
+			return 0, err
+		}
+		if c := parsed[d.hash]; c != nil {
+			if err := setLinks(tx, d.collection, d.path, c.Links); err != nil {
+				return 0, err
+			}
+		}
+	}
+	for i, d := range docs {
+		if i == 0 || docs[i-1].collection != d.collection {
+			if err := resolveLinks(tx, d.collection); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if _, err := tx.Exec(`INSERT OR REPLACE INTO store_settings (key, value) VALUES (?, ?)`,
+		settingParseVersion, strconv.Itoa(contentParseVersion)); err != nil {
+		return 0, err
+	}
+	return len(docs), tx.Commit()
+}
@@ -1,12 +1,18 @@
 package store
 
 import (
-	"fmt"
+	"database/sql"
 	"math"
-	"regexp"
+	"sort"
 	"strings"
+	"unicode"
+
+	"github.com/ba0f3/qmd-go/internal/frontmatter"
 )
 
+// SearchResult is one full-text hit. Body is the whole document; Snippet is the
+// best-matching chunk and StartLine/EndLine its 1-based line range in Body (0 when the
+// document has no indexed chunks).
 type SearchResult struct {
 	Filepath       string
 	DisplayPath    string
@@ -16,53 +22,258 @@ type SearchResult struct {
 	Score          float64
 	Source         string
 	CollectionName string
+	Snippet        string
+	StartLine      int
+	EndLine        int
+	Metadata       frontmatter.Metadata
 }
 
+// SanitizeFTS5Term keeps the letters, digits, combining marks and apostrophes of term,
+// lowercased, in any script. Everything else (punctuation, FTS5 syntax) is dropped.
 func SanitizeFTS5Term(term string) string {
-	reg := regexp.MustCompile(`[^a-zA-Z0-9']`)
-	return strings.ToLower(reg.ReplaceAllString(term, ""))
+	var b strings.Builder
+	for _, r := range term {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) || r == '\'' {
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
 }
 
+// BuildFTS5Query returns the FTS5 MATCH expression for the text part of query (see
+// ParseQuery), or "" if it has none or does not parse.
 func BuildFTS5Query(query string) string {
-	terms := strings.Fields(query)
-	var validTerms []string
-	for _, t := range terms {
-		sanitized := SanitizeFTS5Term(t)
-		if len(sanitized) > 0 {
-			validTerms = append(validTerms, fmt.Sprintf(`"%s"*`, sanitized))
-		}
-	}
-	if len(validTerms) == 0 {
+	q, err := ParseQuery(query)
+	if err != nil {
 		return ""
 	}
-	return strings.Join(validTerms, " AND ")
+	return q.Match()
 }
 
-func (s *Store) SearchFTS(query string, limit int, collectionFilter string) ([]SearchResult, error) {
-	ftsQuery := BuildFTS5Query(query)
-	if ftsQuery == "" {
+// bm25Score maps an FTS5 bm25() value (negative, lower is better) to 0-1, higher is better.
+func bm25Score(raw float64) float64 {
+	absScore := math.Abs(raw)
+	return 1.0 / (1.0 + math.Exp(-(absScore-5.0)/3.0))
+}
+
+// SearchFTS parses query with ParseQuery, ranks chunks (content_chunks) by BM25 and
+// returns each document's best chunk with its line range. Trigram collections are also
+// searched by substring (see Tokenizer). Documents that only match when
+// terms from different chunks are combined, or whose title terms match, are appended
+// afterwards from the whole-document index, scored no higher than the last chunk hit.
+// A query without terms lists the documents passing its filters, most recently
+// modified first. Only documents meeting where are returned; results carry their
+// metadata.
+func (s *Store) SearchFTS(query string, limit int, collectionFilter string, where Where) ([]SearchResult, error) {
+	q, err := ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if q.empty() {
 		return []SearchResult{}, nil
 	}
+	if collectionFilter != "" {
+		q.filters = append(q.filters, queryFilter{sql: `d.collection = ?`, args: []interface{}{collectionFilter}})
+	}
+	q.filters = append(q.filters, where.filters()...)
 
+	var results []SearchResult
+	if q.chunkMatch() != "" {
+		if results, err = s.searchChunkTables(q, limit); err != nil {
+			return nil, err
+		}
+		// Body terms in trigram collections are only matched by substring, so the
+		// whole-document index below completes unicode61 collections only.
+		q.filters = append(q.filters, unicodeCollections)
+	}
+	if len(results) < limit {
+		seen := make(map[string]bool, len(results))
+		for _, r := range results {
+			seen[r.Filepath] = true
+		}
+		var docs []SearchResult
+		if q.Match() != "" {
+			docs, err = s.searchDocumentsFTS(q, limit+len(results))
+		} else {
+			docs, err = s.listDocuments(q, limit)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range docs {
+			if len(results) >= limit {
+				break
+			}
+			if seen[r.Filepath] {
+				continue
+			}
+			if n := len(results); n > 0 && r.Score > results[n-1].Score {
+				r.Score = results[n-1].Score
+			}
+			if err := s.bestChunk(&r, q.anyTerm()); err != nil {
+				return nil, err
+			}
+			results = append(results, r)
+		}
+	}
+	for i := range results {
+		if err := s.DB.QueryRow(`SELECT doc FROM content WHERE hash = ?`, results[i].Hash).Scan(&results[i].Body); err != nil {
+			return nil, err
+		}
+	}
+	err = s.fillMetadata(len(results), func(i int) string { return results[i].Hash },
+		func(i int, m frontmatter.Metadata) { results[i].Metadata = m })
+	return results, err
+}
+
+// unicodeCollections keeps documents of collections without the trigram tokenizer. Each
+// collection is searched with its own tokenizer only, so substring exclusions in
+// trigram collections are not undone by a unicode61 hit on the same document.
+var unicodeCollections = queryFilter{
+	sql: `d.collection NOT IN (SELECT collection FROM collection_tokenizers WHERE tokenizer = 'trigram')`,
+}
+
+// searchChunkTables ranks the chunks of unicode61 and trigram collections, each with
+// its own table, for a query with body terms.
+func (s *Store) searchChunkTables(q *Query, limit int) ([]SearchResult, error) {
+	conds := append([]queryFilter(nil), q.filters...)
+	if f, ok := q.titleFilter(); ok {
+		conds = append(conds, f)
+	}
+	trigram, err := s.searchTrigram(q, conds, limit)
+	if err != nil {
+		return nil, err
+	}
+	results, err := s.searchChunks("chunks_fts", q.chunkMatch(), append(conds, unicodeCollections), limit)
+	if err != nil {
+		return nil, err
+	}
+	return mergeResults(results, trigram, limit), nil
+}
+
+// searchChunks returns up to limit documents whose best chunk in table (chunks_fts or
+// chunks_trigram, aliased t) matches, best first. match may be "" when conds alone
+// select the chunks; such hits are unranked. Body is left empty for the caller to fill.
+func (s *Store) searchChunks(table, match string, conds []queryFilter, limit int) ([]SearchResult, error) {
+	score, where := `bm25(`+table+`)`, `t.`+table+` MATCH ?`
+	var args []interface{}
+	if match == "" {
+		score, where = `0`, `1`
+	} else {
+		args = append(args, match)
+	}
+	query := `
+		SELECT
+			'qmd://' || d.collection || '/' || d.path as filepath,
+			d.collection || '/' || d.path as display_path,
+			d.title,
+			d.hash,
+			` + score + ` as bm25_score,
+			d.collection,
+			t.body,
+			c.start_line,
+			c.end_line
+		FROM ` + table + ` t
+		JOIN content_chunks c ON c.id = t.rowid
+		JOIN documents d ON d.hash = c.hash AND d.active = 1
+		WHERE ` + where
+	for _, f := range conds {
+		query += ` AND ` + f.sql
+		args = append(args, f.args...)
+	}
+	query += ` ORDER BY bm25_score ASC, c.id LIMIT ?`
+
+	// Several chunks of one document can outrank the next document, so fetch more
+	// chunk rows until limit distinct documents are found or matches run out.
+	for k := limit*3 + 10; ; k *= 2 {
+		rows, err := s.DB.Query(query, append(args, k)...)
+		if err != nil {
+			return nil, err
+		}
+		var results []SearchResult
+		seen := make(map[string]bool)
+		n := 0
+		for rows.Next() {
+			n++
+			var r SearchResult
+			var raw float64
+			if err := rows.Scan(&r.Filepath, &r.DisplayPath, &r.Title, &r.Hash, &raw, &r.CollectionName,
+				&r.Snippet, &r.StartLine, &r.EndLine); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if seen[r.Filepath] || len(results) >= limit {
+				continue
+			}
+			seen[r.Filepath] = true
+			r.Score = bm25Score(raw)
+			r.Source = "fts"
+			results = append(results, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		if len(results) >= limit || n < k {
+			return results, nil
+		}
+	}
+}
+
+// searchTrigram searches chunks_trigram within trigram collections, for documents
+// meeting filters. It returns nil without querying when no collection uses the trigram
+// tokenizer.
+func (s *Store) searchTrigram(q *Query, filters []queryFilter, limit int) ([]SearchResult, error) {
+	var any int
+	if err := s.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM collection_tokenizers WHERE tokenizer = 'trigram')`).Scan(&any); err != nil || any == 0 {
+		return nil, err
+	}
+	match, likes := q.trigramMatch()
+	conds := append([]queryFilter{{
+		sql: `d.collection IN (SELECT collection FROM collection_tokenizers WHERE tokenizer = 'trigram')`,
+	}}, filters...)
+	return s.searchChunks("chunks_trigram", match, append(conds, likes...), limit)
+}
+
+// mergeResults combines two ranked lists, keeping the higher-scoring hit per document.
+func mergeResults(a, b []SearchResult, limit int) []SearchResult {
+	if len(b) == 0 {
+		return a
+	}
+	idx := make(map[string]int, len(a))
+	for i, r := range a {
+		idx[r.Filepath] = i
+	}
+	for _, r := range b {
+		if i, ok := idx[r.Filepath]; !ok {
+			idx[r.Filepath] = len(a)
+			a = append(a, r)
+		} else if r.Score > a[i].Score {
+			a[i] = r
+		}
+	}
+	sort.SliceStable(a, func(i, j int) bool { return a[i].Score > a[j].Score })
+	if len(a) > limit {
+		a = a[:limit]
+	}
+	return a
+}
+
+// searchDocumentsFTS ranks whole documents (documents_fts). Body is left empty.
+func (s *Store) searchDocumentsFTS(q *Query, limit int) ([]SearchResult, error) {
 	sql := `
 		SELECT
 			'qmd://' || d.collection || '/' || d.path as filepath,
 			d.collection || '/' || d.path as display_path,
 			d.title,
-			content.doc as body,
 			d.hash,
 			bm25(documents_fts, 10.0, 1.0) as bm25_score,
 			d.collection
 		FROM documents_fts f
 		JOIN documents d ON d.id = f.rowid
-		JOIN content ON content.hash = d.hash
 		WHERE documents_fts MATCH ? AND d.active = 1
 	`
-	args := []interface{}{ftsQuery}
-	if collectionFilter != "" {
-		sql += ` AND d.collection = ?`
-		args = append(args, collectionFilter)
-	}
+	sql, args := q.where(sql, []interface{}{q.Match()})
 	sql += ` ORDER BY bm25_score ASC LIMIT ?`
 	args = append(args, limit)
 
@@ -75,16 +286,79 @@ func (s *Store) SearchFTS(query string, limit int, collectionFilter string) ([]S
 	var results []SearchResult
 	for rows.Next() {
 		var r SearchResult
-		var bm25Score float64
-		if err := rows.Scan(&r.Filepath, &r.DisplayPath, &r.Title, &r.Body, &r.Hash, &bm25Score, &r.CollectionName); err != nil {
+		var raw float64
+		if err := rows.Scan(&r.Filepath, &r.DisplayPath, &r.Title, &r.Hash, &raw, &r.CollectionName); err != nil {
+			return nil, err
+		}
+		r.Score = bm25Score(raw)
+		r.Source = "fts"
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// listDocuments returns the documents meeting the filters of a query without terms,
+// most recently modified first. They are unranked: Score is 0. Body is left empty.
+func (s *Store) listDocuments(q *Query, limit int) ([]SearchResult, error) {
+	sql := `
+		SELECT
+			'qmd://' || d.collection || '/' || d.path as filepath,
+			d.collection || '/' || d.path as display_path,
+			d.title,
+			d.hash,
+			d.collection
+		FROM documents d
+		WHERE d.active = 1
+	`
+	sql, args := q.where(sql, nil)
+	sql += ` ORDER BY ` + docModified + ` DESC, d.collection, d.path LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.DB.Query(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var r SearchResult
+		if err := rows.Scan(&r.Filepath, &r.DisplayPath, &r.Title, &r.Hash, &r.CollectionName); err != nil {
 			return nil, err
 		}
-		// Normalize BM25 (negative, lower is better)
-		// Map to 0-1 where higher is better using sigmoid-ish logic from original
-		absScore := math.Abs(bm25Score)
-		r.Score = 1.0 / (1.0 + math.Exp(-(absScore-5.0)/3.0))
 		r.Source = "fts"
 		results = append(results, r)
 	}
-	return results, nil
+	return results, rows.Err()
+}
+
+// bestChunk fills r's snippet and line range with the chunk of r.Hash that best matches
+// ftsQuery, or with its first chunk if ftsQuery is "". r is left unchanged if no chunk
+// matches.
+func (s *Store) bestChunk(r *SearchResult, ftsQuery string) error {
+	var row *sql.Row
+	if ftsQuery == "" {
+		row = s.DB.QueryRow(`
+			SELECT f.body, c.start_line, c.end_line
+			FROM content_chunks c
+			JOIN chunks_fts f ON f.rowid = c.id
+			WHERE c.hash = ?
+			ORDER BY c.seq
+			LIMIT 1
+		`, r.Hash)
+	} else {
+		row = s.DB.QueryRow(`
+			SELECT f.body, c.start_line, c.end_line
+			FROM chunks_fts f
+			JOIN content_chunks c ON c.id = f.rowid
+			WHERE chunks_fts MATCH ? AND c.hash = ?
+			ORDER BY bm25(chunks_fts) ASC
+			LIMIT 1
+		`, ftsQuery, r.Hash)
+	}
+	err := row.Scan(&r.Snippet, &r.StartLine, &r.EndLine)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	return err
 }
@@ -2,6 +2,7 @@ package store
 
 import (
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -32,7 +33,7 @@ func TestSearchFTS(t *testing.T) {
 	s.InsertDocument("testcol", "apple.md", "Apple Doc", hash2, now, now)
 
 	// Search for "banana"
-	results, err := s.SearchFTS("banana", 10, "")
+	results, err := s.SearchFTS("banana", 10, "", nil)
 	if err != nil {
 		t.Fatalf("SearchFTS failed: %v", err)
 	}
@@ -44,7 +45,7 @@ func TestSearchFTS(t *testing.T) {
 	}
 
 	// Search for "test"
-	results, err = s.SearchFTS("test", 10, "")
+	results, err = s.SearchFTS("test", 10, "", nil)
 	if err != nil {
 		t.Fatalf("SearchFTS failed: %v", err)
 	}
@@ -52,3 +53,57 @@ func TestSearchFTS(t *testing.T) {
 		t.Errorf("Expected 2 results, got %d", len(results))
 	}
 }
+
+func TestSearchFTSChunkLines(t *testing.T) {
+	s, err := NewStore(tempDBPath(t))
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	defer s.Close()
+
+	// ~200 lines of filler with "zeppelin" near the end and "walrus" at the start,
+	// so the two terms land in different chunks.
+	var b strings.Builder
+	b.WriteString("The walrus opens the transcript.\n")
+	for i := 0; i < 200; i++ {
+		b.WriteString("Line of ordinary filler text for the transcript body.\n")
+	}
+	b.WriteString("Finally the zeppelin arrives.\n")
+	body := b.String()
+	now := time.Now()
+	hash := HashContent(body)
+	s.InsertContent(hash, body, now)
+	s.InsertDocument("col", "transcript.md", "Transcript", hash, now, now)
+
+	results, err := s.SearchFTS("zeppelin", 10, "", nil)
+	if err != nil {
+		t.Fatalf("SearchFTS failed: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("Expected 1 result, got %d", len(results))
+	}
+	r := results[0]
+	if r.StartLine <= 1 || r.EndLine != 202 {
+		t.Errorf("Expected chunk ending at line 202, got lines %d-%d", r.StartLine, r.EndLine)
+	}
+	if !strings.Contains(r.Snippet, "zeppelin") || len(r.Snippet) >= len(body) {
+		t.Errorf("Expected snippet to be the matching chunk, got %d bytes", len(r.Snippet))
+	}
+	if r.Body != body {
+		t.Error("Expected Body to hold the full document")
+	}
+	// Chunks may start mid-line; the first snippet line is then a suffix of StartLine.
+	first := strings.SplitN(r.Snippet, "\n", 2)[0]
+	if line := strings.Split(body, "\n")[r.StartLine-1]; !strings.HasSuffix(line, first) {
+		t.Errorf("Snippet does not start on line %d (%q vs %q)", r.StartLine, line, first)
+	}
+
+	// Terms split across chunks still match via the whole-document index.
+	results, err = s.SearchFTS("walrus zeppelin", 10, "", nil)
+	if err != nil {
+		t.Fatalf("SearchFTS failed: %v", err)
+	}
+	if len(results) != 1 || results[0].StartLine == 0 {
+		t.Fatalf("Expected cross-chunk match with a line range, got %+v", results)
+	}
+}
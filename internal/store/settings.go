@@ -0,0 +1,78 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Keys in the store_settings table.
+const (
+	settingVectorStorage   = "vector_storage"
+	settingKeepFullVectors = "vector_keep_full"
+	settingParseVersion    = "content_parse_version"
+)
+
+// getSetting returns the stored value for key, or "" if unset.
+func (s *Store) getSetting(key string) (string, error) {
+	var v string
+	err := s.DB.QueryRow(`SELECT value FROM store_settings WHERE key = ?`, key).Scan(&v)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return v, err
+}
+
+func (s *Store) setSetting(key, value string) error {
+	_, err := s.DB.Exec(`INSERT OR REPLACE INTO store_settings (key, value) VALUES (?, ?)`, key, value)
+	return err
+}
+
+// VectorStorage returns how this index stores embeddings (float32 unless changed).
+func (s *Store) VectorStorage() (VectorStorage, error) {
+	v, err := s.getSetting(settingVectorStorage)
+	if err != nil {
+		return "", err
+	}
+	return ParseVectorStorage(v)
+}
+
+// SetVectorStorage changes the storage mode. Existing vectors are not converted, so the
+// mode can only change while the index has no embeddings (clear them first).
+func (s *Store) SetVectorStorage(mode VectorStorage) error {
+	current, err := s.VectorStorage()
+	if err != nil {
+		return err
+	}
+	if current == mode {
+		return nil
+	}
+	if s.HasEmbeddings() {
+		return fmt.Errorf("index already holds %s embeddings; re-embed with --force to switch to %s", current, mode)
+	}
+	if err := s.setSetting(settingVectorStorage, string(mode)); err != nil {
+		return err
+	}
+	return s.resetVectorIndex()
+}
+
+// KeepFullVectors reports whether quantized storage also keeps a full-precision copy of
+// each vector in embedding_full to rescore the top candidates. Off unless enabled: the
+// copy costs 4 bytes per dimension, more than the codes it backs.
+func (s *Store) KeepFullVectors() (bool, error) {
+	v, err := s.getSetting(settingKeepFullVectors)
+	return v == "1", err
+}
+
+// SetKeepFullVectors turns the full-precision copies on or off. Turning them on applies
+// to vectors embedded from then on (re-embed with --force to cover the rest); turning
+// them off deletes the existing copies.
+func (s *Store) SetKeepFullVectors(keep bool) error {
+	if !keep {
+		if _, err := s.DB.Exec(`DELETE FROM embedding_full`); err != nil {
+			return err
+		}
+		_, err := s.DB.Exec(`DELETE FROM store_settings WHERE key = ?`, settingKeepFullVectors)
+		return err
+	}
+	return s.setSetting(settingKeepFullVectors, "1")
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -12,6 +13,9 @@ import (
 type Store struct {
 	DB     *sql.DB
 	DBPath string
+
+	vecMu sync.Mutex
+	vecs  map[string]*vectorIndex // ANN index per embedding model, loaded on first use
 }
 
 func GetDefaultDbPath(indexName string) (string, error) {
@@ -47,8 +51,9 @@ func NewStore(dbPath string) (*Store, error) {
 		}
 	}
 
-	// Enable WAL mode via DSN
-	dsn := fmt.Sprintf("file:%s?_journal_mode=WAL&_foreign_keys=on", dbPath)
+	// Enable WAL mode via DSN. Write transactions take the lock up front so two
+	// processes migrating the same index serialize instead of failing mid-upgrade.
+	dsn := fmt.Sprintf("file:%s?_journal_mode=WAL&_foreign_keys=on&_busy_timeout=5000&_txlock=immediate", dbPath)
 	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, err
@@ -59,7 +64,7 @@ func NewStore(dbPath string) (*Store, error) {
 	}
 
 	s := &Store{DB: db, DBPath: dbPath}
-	if err := s.initSchema(); err != nil {
+	if err := s.migrate(); err != nil {
 		db.Close()
 		return nil, err
 	}
@@ -67,16 +72,42 @@ func NewStore(dbPath string) (*Store, error) {
 	return s, nil
 }
 
+// Close persists the ANN index if it changed and closes the database.
 func (s *Store) Close() error {
-	return s.DB.Close()
+	saveErr := s.SaveVectorIndex()
+	if err := s.DB.Close(); err != nil {
+		return err
+	}
+	return saveErr
 }
 
 // Status holds index status for the status command.
 type Status struct {
-	DBPath      string
-	DocCount    int
-	VectorCount int
-	Collections []CollectionStatus
+	DBPath        string
+	SchemaVersion int
+	DocCount      int
+	VectorCount   int
+	VectorStorage VectorStorage
+	KeepFull      bool // quantized storage also keeps full-precision vectors
+	Tables        []TableSize
+	Collections   []CollectionStatus
+}
+
+// TableSize is how much a table stores: the bytes of its rows' values, without SQLite's
+// page and index overhead.
+type TableSize struct {
+	Table string
+	Rows  int
+	Bytes int64
+}
+
+// sizedTables are the tables qmd status reports, with the expression summing the bytes
+// of a row.
+var sizedTables = []struct{ table, bytes string }{
+	{"content", `LENGTH(hash) + LENGTH(CAST(doc AS BLOB))`},
+	{"embedding_blobs", `LENGTH(model) + LENGTH(hash_seq) + LENGTH(embedding)`},
+	{"embedding_full", `LENGTH(model) + LENGTH(hash_seq) + LENGTH(embedding)`},
+	{"vector_index", `LENGTH(model) + LENGTH(graph)`},
 }
 
 // CollectionStatus is per-collection stats.
@@ -89,10 +120,23 @@ type CollectionStatus struct {
 // GetStatus returns index path, document count, vector count, and per-collection stats.
 func (s *Store) GetStatus() (*Status, error) {
 	st := &Status{DBPath: s.DBPath}
+	if v, err := s.SchemaVersion(); err == nil {
+		st.SchemaVersion = v
+	}
 	if err := s.DB.QueryRow(`SELECT COUNT(*) FROM documents WHERE active = 1`).Scan(&st.DocCount); err != nil {
 		return nil, err
 	}
 	_ = s.DB.QueryRow(`SELECT COUNT(*) FROM content_vectors`).Scan(&st.VectorCount)
+	if m, err := s.VectorStorage(); err == nil {
+		st.VectorStorage = m
+	}
+	st.KeepFull, _ = s.KeepFullVectors()
+	for _, t := range sizedTables {
+		ts := TableSize{Table: t.table}
+		if err := s.DB.QueryRow(`SELECT COUNT(*), COALESCE(SUM(`+t.bytes+`), 0) FROM `+t.table).Scan(&ts.Rows, &ts.Bytes); err == nil {
+			st.Tables = append(st.Tables, ts)
+		}
+	}
 
 	rows, err := s.DB.Query(`
 		SELECT collection, COUNT(*) as cnt, MAX(modified_at) as last_modified
@@ -117,80 +161,3 @@ func (s *Store) GetStatus() (*Status, error) {
 	}
 	return st, rows.Err()
 }
-
-func (s *Store) initSchema() error {
-	queries := []string{
-		`CREATE TABLE IF NOT EXISTS content (
-			hash TEXT PRIMARY KEY,
-			doc TEXT NOT NULL,
-			created_at TEXT NOT NULL
-		)`,
-		`CREATE TABLE IF NOT EXISTS documents (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			collection TEXT NOT NULL,
-			path TEXT NOT NULL,
-			title TEXT NOT NULL,
-			hash TEXT NOT NULL,
-			created_at TEXT NOT NULL,
-			modified_at TEXT NOT NULL,
-			active INTEGER NOT NULL DEFAULT 1,
-			FOREIGN KEY (hash) REFERENCES content(hash) ON DELETE CASCADE,
-			UNIQUE(collection, path)
-		)`,
-		`CREATE INDEX IF NOT EXISTS idx_documents_collection ON documents(collection, active)`,
-		`CREATE INDEX IF NOT EXISTS idx_documents_hash ON documents(hash)`,
-		`CREATE INDEX IF NOT EXISTS idx_documents_path ON documents(path, active)`,
-		`CREATE TABLE IF NOT EXISTS llm_cache (
-			hash TEXT PRIMARY KEY,
-			result TEXT NOT NULL,
-			created_at TEXT NOT NULL
-		)`,
-		`CREATE TABLE IF NOT EXISTS content_vectors (
-			hash TEXT NOT NULL,
-			seq INTEGER NOT NULL DEFAULT 0,
-			pos INTEGER NOT NULL DEFAULT 0,
-			model TEXT NOT NULL,
-			embedded_at TEXT NOT NULL,
-			PRIMARY KEY (hash, seq)
-		)`,
-		// FTS5 table
-		`CREATE VIRTUAL TABLE IF NOT EXISTS documents_fts USING fts5(
-			filepath, title, body,
-			tokenize='porter unicode61'
-		)`,
-		// Triggers
-		`CREATE TRIGGER IF NOT EXISTS documents_ai AFTER INSERT ON documents
-		WHEN new.active = 1
-		BEGIN
-			INSERT INTO documents_fts(rowid, filepath, title, body)
-			SELECT
-				new.id,
-				new.collection || '/' || new.path,
-				new.title,
-				(SELECT doc FROM content WHERE hash = new.hash)
-			WHERE new.active = 1;
-		END`,
-		`CREATE TRIGGER IF NOT EXISTS documents_ad AFTER DELETE ON documents BEGIN
-			DELETE FROM documents_fts WHERE rowid = old.id;
-		END`,
-		`CREATE TRIGGER IF NOT EXISTS documents_au AFTER UPDATE ON documents
-		BEGIN
-			DELETE FROM documents_fts WHERE rowid = old.id AND new.active = 0;
-			INSERT OR REPLACE INTO documents_fts(rowid, filepath, title, body)
-			SELECT
-				new.id,
-				new.collection || '/' || new.path,
-				new.title,
-				(SELECT doc FROM content WHERE hash = new.hash)
-			WHERE new.active = 1;
-		END`,
-	}
-
-	for _, query := range queries {
-		if _, err := s.DB.Exec(query); err != nil {
-			return fmt.Errorf("schema init failed: %w (query: %s)", err, query)
-		}
-	}
-
-	return nil
-}
@@ -29,3 +29,25 @@ func TestNewStore(t *testing.T) {
 		}
 	}
 }
+
+func TestLLMCache(t *testing.T) {
+	s, err := NewStore(tempDBPath(t))
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	defer s.Close()
+
+	key := LLMCacheKey("expand", "model", "prompt")
+	if key == LLMCacheKey("expand", "modelprompt") {
+		t.Error("Expected cache key parts to be delimited")
+	}
+	if _, ok, err := s.GetLLMCache(key); ok || err != nil {
+		t.Fatalf("Expected cache miss, got ok=%v err=%v", ok, err)
+	}
+	if err := s.PutLLMCache(key, "lex: x"); err != nil {
+		t.Fatalf("PutLLMCache failed: %v", err)
+	}
+	if got, ok, _ := s.GetLLMCache(key); !ok || got != "lex: x" {
+		t.Errorf("GetLLMCache = %q, %v", got, ok)
+	}
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Tokenizer selects the full-text index a collection is searched with. Every chunk is
+// in chunks_fts (unicode61); trigram collections additionally fill chunks_trigram, which
+// matches substrings and so works for CJK and other text written without spaces.
+type Tokenizer string
+
+const (
+	TokenizerUnicode Tokenizer = "unicode61"
+	TokenizerTrigram Tokenizer = "trigram"
+)
+
+// ParseTokenizer validates a tokenizer name ("" means unicode61).
+func ParseTokenizer(name string) (Tokenizer, error) {
+	switch Tokenizer(name) {
+	case "", TokenizerUnicode:
+		return TokenizerUnicode, nil
+	case TokenizerTrigram:
+		return TokenizerTrigram, nil
+	}
+	return "", fmt.Errorf("unknown tokenizer %q (want unicode61 or trigram)", name)
+}
+
+// CollectionTokenizer returns the tokenizer recorded for a collection.
+func (s *Store) CollectionTokenizer(collection string) (Tokenizer, error) {
+	var name string
+	err := s.DB.QueryRow(`SELECT tokenizer FROM collection_tokenizers WHERE collection = ?`, collection).Scan(&name)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	return ParseTokenizer(name)
+}
+
+// SetCollectionTokenizer records a collection's tokenizer. Switching to trigram indexes
+// the collection's existing chunks; switching back drops trigram rows no other trigram
+// collection needs. New documents are kept in sync by triggers on documents.
+func (s *Store) SetCollectionTokenizer(collection string, tok Tokenizer) error {
+	if tok == TokenizerUnicode {
+		if _, err := s.DB.Exec(`DELETE FROM collection_tokenizers WHERE collection = ?`, collection); err != nil {
+			return err
+		}
+		_, err := s.DB.Exec(`
+			DELETE FROM chunks_trigram WHERE rowid NOT IN (
+				SELECT c.id FROM content_chunks c
+				JOIN documents d ON d.hash = c.hash AND d.active = 1
+				JOIN collection_tokenizers ct ON ct.collection = d.collection AND ct.tokenizer = 'trigram'
+			)`)
+		return err
+	}
+	if _, err := s.DB.Exec(`INSERT OR REPLACE INTO collection_tokenizers (collection, tokenizer) VALUES (?, ?)`,
+		collection, string(tok)); err != nil {
+		return err
+	}
+	_, err := s.DB.Exec(`
+		INSERT INTO chunks_trigram (rowid, body)
+		SELECT DISTINCT c.id, f.body
+		FROM documents d
+		JOIN content_chunks c ON c.hash = d.hash
+		JOIN chunks_fts f ON f.rowid = c.id
+		WHERE d.collection = ? AND d.active = 1
+			AND NOT EXISTS (SELECT 1 FROM chunks_trigram t WHERE t.rowid = c.id)
+	`, collection)
+	return err
+}
+
+// trigramMinChars is the shortest substring the trigram index can match. Shorter terms
+// (common in CJK, e.g. two-character words) are matched with LIKE instead, which scans.
+const trigramMinChars = 3
+
+// trigramMatch compiles the body clauses of q for chunks_trigram (alias t): a MATCH
+// expression for clauses whose terms have at least trigramMinChars characters, and LIKE
+// conditions for the rest. Exclusions apply to the whole document. match is "" when every clause needs LIKE.
+func (q *Query) trigramMatch() (match string, likes []queryFilter) {
+	long := func(terms []queryTerm) bool {
+		for _, t := range terms {
+			if utf8.RuneCountInString(t.text) < trigramMinChars {
+				return false
+			}
+		}
+		return true
+	}
+	var clauses []string
+	for _, c := range q.bodyClauses() {
+		if long(c) {
+			clauses = append(clauses, orGroup(c, trigramTerm))
+		} else {
+			likes = append(likes, likeGroup(c))
+		}
+	}
+	for _, t := range q.negated {
+		likes = append(likes, queryFilter{
+			sql: `NOT EXISTS (SELECT 1 FROM content_chunks nc JOIN chunks_trigram nt ON nt.rowid = nc.id
+				WHERE nc.hash = d.hash AND nt.body LIKE ? ESCAPE '\')`,
+			args: []interface{}{"%" + escapeLike(t.text) + "%"},
+		})
+	}
+	return strings.Join(clauses, " AND "), likes
+}
+
+// trigramTerm renders a term for chunks_trigram, where every term is a substring match.
+func trigramTerm(t queryTerm) string { return quoteFTS(t.text) }
+
+// likeGroup ORs substring LIKE conditions on t.body.
+func likeGroup(terms []queryTerm) queryFilter {
+	var f queryFilter
+	parts := make([]string, len(terms))
+	for i, t := range terms {
+		parts[i] = `t.body LIKE ? ESCAPE '\'`
+		f.args = append(f.args, "%"+escapeLike(t.text)+"%")
+	}
+	f.sql = "(" + strings.Join(parts, " OR ") + ")"
+	return f
+}
+
+func escapeLike(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `%`, `\%`)
+	return strings.ReplaceAll(s, `_`, `\_`)
+}
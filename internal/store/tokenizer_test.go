@@ -0,0 +1,93 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSanitizeFTS5TermUnicode(t *testing.T) {
+	cases := map[string]string{
+		"Straße!":    "straße",
+		"Tiếng":      "tiếng",
+		"東京タワー。":     "東京タワー",
+		"don't":      "don't",
+		"AND(\"x\")": "andx",
+	}
+	for in, want := range cases {
+		if got := SanitizeFTS5Term(in); got != want {
+			t.Errorf("SanitizeFTS5Term(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSearchFTSTrigram(t *testing.T) {
+	s, err := NewStore(tempDBPath(t))
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	defer s.Close()
+	if err := s.SetCollectionTokenizer("ja", TokenizerTrigram); err != nil {
+		t.Fatalf("SetCollectionTokenizer failed: %v", err)
+	}
+
+	now := time.Now()
+	docs := []struct{ collection, path, body string }{
+		{"ja", "tokyo.md", "東京タワーは東京都港区にある電波塔です。"},
+		{"ja", "kyoto.md", "京都には多くの寺院があります。"},
+		{"de", "strasse.md", "Die Hauptstraße führt durch die Altstadt."},
+		{"en", "tokyo.md", "東京タワー appears here as one unsegmented token."},
+	}
+	for _, d := range docs {
+		hash := HashContent(d.body)
+		s.InsertContent(hash, d.body, now)
+		s.InsertDocument(d.collection, d.path, d.path, hash, now, now)
+	}
+
+	cases := []struct {
+		query string
+		want  []string
+	}{
+		{"電波塔", []string{"ja/tokyo.md"}},    // substring inside a trigram chunk
+		{"寺院", []string{"ja/kyoto.md"}},     // two characters: LIKE fallback
+		{"京都 -港区", []string{"ja/kyoto.md"}}, // 東京都 contains 京都 but is excluded
+		{"hauptstraße", []string{"de/strasse.md"}},
+		{"東京タワー", []string{"ja/tokyo.md", "en/tokyo.md"}},
+		{"タワー", []string{"ja/tokyo.md"}}, // unicode61 cannot match mid-token
+		{"東京 -電波塔", []string{"en/tokyo.md"}},
+	}
+	for _, c := range cases {
+		results, err := s.SearchFTS(c.query, 10, "", nil)
+		if err != nil {
+			t.Errorf("SearchFTS(%q) failed: %v", c.query, err)
+			continue
+		}
+		got := make(map[string]bool)
+		for _, r := range results {
+			got[r.DisplayPath] = true
+		}
+		if len(got) != len(c.want) {
+			t.Errorf("SearchFTS(%q) returned %v, want %v", c.query, got, c.want)
+			continue
+		}
+		for _, w := range c.want {
+			if !got[w] {
+				t.Errorf("SearchFTS(%q) missing %s (got %v)", c.query, w, got)
+			}
+		}
+	}
+
+	if tok, _ := s.CollectionTokenizer("ja"); tok != TokenizerTrigram {
+		t.Errorf("CollectionTokenizer(ja) = %q, want trigram", tok)
+	}
+	if err := s.SetCollectionTokenizer("ja", TokenizerUnicode); err != nil {
+		t.Fatalf("SetCollectionTokenizer failed: %v", err)
+	}
+	var n int
+	_ = s.DB.QueryRow(`SELECT COUNT(*) FROM chunks_trigram`).Scan(&n)
+	if n != 0 {
+		t.Errorf("Expected trigram rows to be dropped, %d remain", n)
+	}
+	if results, _ := s.SearchFTS("電波塔", 10, "", nil); len(results) != 0 {
+		t.Errorf("Expected no substring hits after switching to unicode61, got %d", len(results))
+	}
+}
@@ -0,0 +1,157 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/ba0f3/qmd-go/internal/links"
+)
+
+// Tx writes documents within one transaction. The indexer runs a whole collection pass
+// through it, so the pass is atomic and costs one commit rather than one per file.
+//
+// The transaction holds the index's write lock: until Commit or Rollback, writes through
+// the Store from the same process wait on it, so use the Tx for everything in between.
+type Tx struct {
+	tx    *sql.Tx
+	links map[string]*linkChanges // by collection, until ResolveLinks
+}
+
+func (s *Store) Begin() (*Tx, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{tx: tx, links: make(map[string]*linkChanges)}, nil
+}
+
+func (t *Tx) linkChanges(collection string) *linkChanges {
+	ch := t.links[collection]
+	if ch == nil {
+		ch = newLinkChanges()
+		t.links[collection] = ch
+	}
+	return ch
+}
+
+func (t *Tx) Commit() error { return t.tx.Commit() }
+
+// Rollback abandons the transaction; after Commit it is a no-op, so it can be deferred.
+func (t *Tx) Rollback() error {
+	if err := t.tx.Rollback(); err != nil && err != sql.ErrTxDone {
+		return err
+	}
+	return nil
+}
+
+// IndexedFile is an active document as the indexer last recorded it.
+type IndexedFile struct {
+	ID   int64
+	Hash string
+	Stat FileStat
+}
+
+const indexedFileColumns = `id, path, hash, COALESCE(size, 0), COALESCE(mtime, 0), COALESCE(inode, 0)`
+
+func scanIndexedFile(sc interface{ Scan(...any) error }) (string, IndexedFile, error) {
+	var f IndexedFile
+	var path string
+	var inode int64
+	err := sc.Scan(&f.ID, &path, &f.Hash, &f.Stat.Size, &f.Stat.Mtime, &inode)
+	f.Stat.Inode = uint64(inode)
+	return path, f, err
+}
+
+// ActiveFiles returns the active documents of a collection by path.
+func (t *Tx) ActiveFiles(collection string) (map[string]IndexedFile, error) {
+	rows, err := t.tx.Query(`SELECT `+indexedFileColumns+` FROM documents WHERE collection = ? AND active = 1`, collection)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	files := make(map[string]IndexedFile)
+	for rows.Next() {
+		path, f, err := scanIndexedFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files[path] = f
+	}
+	return files, rows.Err()
+}
+
+// ActiveFile returns the active document at path; ok is false if there is none.
+func (t *Tx) ActiveFile(collection, path string) (f IndexedFile, ok bool, err error) {
+	row := t.tx.QueryRow(`SELECT `+indexedFileColumns+` FROM documents WHERE collection = ? AND path = ? AND active = 1`,
+		collection, path)
+	if _, f, err = scanIndexedFile(row); err == sql.ErrNoRows {
+		return f, false, nil
+	}
+	return f, err == nil, err
+}
+
+func (t *Tx) InsertContent(c *Content, createdAt time.Time) error {
+	if added, err := insertContentRow(t.tx, c.Hash, c.Body, createdAt); err != nil || !added {
+		return err
+	}
+	if err := insertMetadata(t.tx, c.Hash, c.Meta); err != nil {
+		return err
+	}
+	return insertChunks(t.tx, c.Hash, c.chunks)
+}
+
+func (t *Tx) InsertDocument(collection, path, title, hash string, createdAt, modifiedAt time.Time, st FileStat) error {
+	if err := insertDocument(t.tx, collection, path, title, hash, createdAt, modifiedAt, st); err != nil {
+		return err
+	}
+	t.linkChanges(collection).added[path] = true
+	return nil
+}
+
+func (t *Tx) UpdateDocument(id int64, title, hash string, modifiedAt time.Time, st FileStat) error {
+	return updateDocument(t.tx, id, title, hash, modifiedAt, st)
+}
+
+// SetFileStat records a new stat for a document whose content did not change, such as
+// a file that was only touched.
+func (t *Tx) SetFileStat(id int64, st FileStat) error {
+	_, err := t.tx.Exec(`UPDATE documents SET size = ?, mtime = ?, inode = ? WHERE id = ?`,
+		st.Size, st.Mtime, int64(st.Inode), id)
+	return err
+}
+
+func (t *Tx) DeactivateDocument(collection, path string) error {
+	if err := deactivateDocument(t.tx, collection, path); err != nil {
+		return err
+	}
+	t.linkChanges(collection).removed[path] = true
+	return nil
+}
+
+// SetLinks replaces the links of the active document at collection/path, such as with
+// the Links of its new Content. Call ResolveLinks once the collection's documents are
+// written.
+func (t *Tx) SetLinks(collection, path string, ls []links.Link) error {
+	if err := setLinks(t.tx, collection, path, ls); err != nil {
+		return err
+	}
+	t.linkChanges(collection).sources[path] = true
+	return nil
+}
+
+// ResolveLinks points the links of collection that the documents added, removed and
+// given links through this Tx can affect at the documents they now resolve to. The
+// rest of the collection's links are not read, so a pass that changed a few files
+// costs a few lookups however large the collection is.
+func (t *Tx) ResolveLinks(collection string) error {
+	ch := t.links[collection]
+	if ch == nil {
+		return nil
+	}
+	delete(t.links, collection)
+	return resolveChangedLinks(t.tx, collection, ch)
+}
+
+func (t *Tx) CleanupOrphanedContent() (int64, error) {
+	return cleanupOrphanedContent(t.tx)
+}
@@ -0,0 +1,457 @@
+package store
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// vectorIndexMagic prefixes the serialized graph so a format change is detected as
+// "rebuild" instead of being decoded as garbage.
+const vectorIndexMagic = "QMDHNSW1"
+
+// vectorIndex is the in-memory ANN index over one model's rows in embedding_blobs. Only
+// the graph links are persisted (vector_index table); vectors are reloaded from
+// embedding_blobs. generation is the model's embedding_blobs generation the index
+// reflects, so writes from other processes are noticed and trigger a rebuild, while
+// writes for other models (say a migration in progress) leave it alone.
+type vectorIndex struct {
+	model      string
+	storage    VectorStorage
+	graph      *hnswGraph
+	keys       []string // node id -> hash_seq
+	ids        map[string]int
+	deleted    []bool
+	live       int
+	generation int64
+	dirty      bool
+}
+
+func newVectorIndex(model string, storage VectorStorage) *vectorIndex {
+	return &vectorIndex{model: model, storage: storage, graph: newHNSWGraph(storage.newSet()), ids: make(map[string]int)}
+}
+
+// add inserts or replaces the vector stored under key. Replaced nodes stay in the graph
+// for navigation but are never returned.
+func (ix *vectorIndex) add(key string, vec []float32) {
+	if old, ok := ix.ids[key]; ok && !ix.deleted[old] {
+		ix.deleted[old] = true
+		ix.live--
+	}
+	id := ix.graph.Add(vec)
+	ix.keys = append(ix.keys, key)
+	ix.deleted = append(ix.deleted, false)
+	ix.ids[key] = id
+	ix.live++
+	ix.dirty = true
+}
+
+// search returns up to k live keys closest to q with their cosine similarity (as
+// approximated by the storage mode's codes).
+func (ix *vectorIndex) search(q []float32, k int) []vecHit {
+	want := k + (len(ix.keys) - ix.live)
+	hits := ix.graph.Search(q, want, max(want, hnswEfSearch))
+	out := make([]vecHit, 0, k)
+	for _, h := range hits {
+		if ix.deleted[h.id] {
+			continue
+		}
+		out = append(out, vecHit{Key: ix.keys[h.id], Score: float64(h.score)})
+		if len(out) >= k {
+			break
+		}
+	}
+	return out
+}
+
+// tooFragmented reports whether replaced nodes dominate the graph and it should be rebuilt.
+func (ix *vectorIndex) tooFragmented() bool {
+	dead := len(ix.keys) - ix.live
+	return dead > 1000 && dead > ix.live
+}
+
+type vecHit struct {
+	Key   string
+	Score float64
+}
+
+func (ix *vectorIndex) marshal() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(vectorIndexMagic)
+	var tmp [binary.MaxVarintLen64]byte
+	putUvarint := func(v uint64) {
+		n := binary.PutUvarint(tmp[:], v)
+		buf.Write(tmp[:n])
+	}
+	g := ix.graph
+	putUvarint(uint64(len(ix.keys)))
+	putUvarint(uint64(g.entry + 1))
+	putUvarint(uint64(g.maxLevel))
+	for id, key := range ix.keys {
+		putUvarint(uint64(len(key)))
+		buf.WriteString(key)
+		if ix.deleted[id] {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+		putUvarint(uint64(len(g.links[id])))
+		for _, layer := range g.links[id] {
+			putUvarint(uint64(len(layer)))
+			for _, n := range layer {
+				putUvarint(uint64(n))
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+var errBadVectorIndex = errors.New("corrupt vector index")
+
+// unmarshalVectorIndex decodes the graph links; vectors must then be re-added to the
+// graph's vectorSet in node order.
+func unmarshalVectorIndex(data []byte, model string, storage VectorStorage) (*vectorIndex, error) {
+	if !bytes.HasPrefix(data, []byte(vectorIndexMagic)) {
+		return nil, errBadVectorIndex
+	}
+	r := bytes.NewReader(data[len(vectorIndexMagic):])
+	var readErr error
+	next := func() int {
+		v, err := binary.ReadUvarint(r)
+		if err != nil && readErr == nil {
+			readErr = errBadVectorIndex
+		}
+		return int(v)
+	}
+	ix := newVectorIndex(model, storage)
+	n := next()
+	ix.graph.entry = next() - 1
+	ix.graph.maxLevel = next()
+	if readErr != nil || n > len(data) {
+		return nil, errBadVectorIndex
+	}
+	ix.keys = make([]string, n)
+	ix.deleted = make([]bool, n)
+	ix.graph.links = make([][][]uint32, n)
+	for id := 0; id < n && readErr == nil; id++ {
+		keyLen := next()
+		if keyLen > r.Len() {
+			return nil, errBadVectorIndex
+		}
+		key := make([]byte, keyLen)
+		if _, err := io.ReadFull(r, key); err != nil {
+			return nil, errBadVectorIndex
+		}
+		flag, err := r.ReadByte()
+		if err != nil {
+			return nil, errBadVectorIndex
+		}
+		ix.keys[id] = string(key)
+		ix.deleted[id] = flag == 1
+		if !ix.deleted[id] {
+			ix.ids[ix.keys[id]] = id
+			ix.live++
+		}
+		layers := make([][]uint32, next())
+		for l := range layers {
+			layer := make([]uint32, next())
+			for i := range layer {
+				nb := next()
+				if nb >= n {
+					return nil, errBadVectorIndex
+				}
+				layer[i] = uint32(nb)
+			}
+			layers[l] = layer
+		}
+		ix.graph.links[id] = layers
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+	return ix, nil
+}
+
+// blobGeneration returns model's embedding_blobs change counter maintained by triggers.
+func (s *Store) blobGeneration(model string) (int64, error) {
+	var gen int64
+	err := s.DB.QueryRow(`SELECT COALESCE((SELECT generation FROM vector_generation WHERE model = ?), 0)`, model).Scan(&gen)
+	return gen, err
+}
+
+// loadVectorIndex returns model's ANN index, reusing the in-memory copy when it is
+// current, else the persisted graph, else rebuilding from embedding_blobs. Caller holds
+// s.vecMu.
+func (s *Store) loadVectorIndex(model string) (*vectorIndex, error) {
+	gen, err := s.blobGeneration(model)
+	if err != nil {
+		return nil, err
+	}
+	storage, err := s.VectorStorage()
+	if err != nil {
+		return nil, err
+	}
+	if ix := s.vecs[model]; ix != nil && ix.generation == gen && ix.storage == storage && !ix.tooFragmented() {
+		return ix, nil
+	}
+	ix, err := s.readPersistedVectorIndex(model, gen, storage)
+	if err != nil || ix == nil || ix.tooFragmented() {
+		if ix, err = s.rebuildVectorIndex(model, storage); err != nil {
+			return nil, err
+		}
+		if err := s.saveVectorIndex(ix); err != nil {
+			return nil, err
+		}
+	}
+	if s.vecs == nil {
+		s.vecs = make(map[string]*vectorIndex)
+	}
+	s.vecs[model] = ix
+	return ix, nil
+}
+
+// readPersistedVectorIndex returns nil when no graph was saved for model at generation gen.
+func (s *Store) readPersistedVectorIndex(model string, gen int64, storage VectorStorage) (*vectorIndex, error) {
+	var data []byte
+	var savedGen int64
+	err := s.DB.QueryRow(`SELECT generation, graph FROM vector_index WHERE model = ?`, model).Scan(&savedGen, &data)
+	if err == sql.ErrNoRows || (err == nil && savedGen != gen) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ix, err := unmarshalVectorIndex(data, model, storage)
+	if err != nil {
+		return nil, err
+	}
+	vecs := make([][]float32, len(ix.keys))
+	rows, err := s.DB.Query(`SELECT hash_seq, embedding FROM embedding_blobs WHERE model = ?`, model)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	found := 0
+	for rows.Next() {
+		var key string
+		var blob []byte
+		if err := rows.Scan(&key, &blob); err != nil {
+			return nil, err
+		}
+		if id, ok := ix.ids[key]; ok {
+			vecs[id] = storage.decode(blob)
+			found++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if found != ix.live {
+		return nil, nil
+	}
+	for _, v := range vecs {
+		// Replaced nodes have no blob any more; they keep an empty vector and only
+		// serve as graph waypoints until the next rebuild.
+		ix.graph.vecs.Add(v)
+	}
+	ix.generation = gen
+	return ix, nil
+}
+
+// rebuildVectorIndex builds a fresh graph from model's rows in embedding_blobs.
+func (s *Store) rebuildVectorIndex(model string, storage VectorStorage) (*vectorIndex, error) {
+	gen, err := s.blobGeneration(model)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.DB.Query(`SELECT hash_seq, embedding FROM embedding_blobs WHERE model = ? ORDER BY hash_seq`, model)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ix := newVectorIndex(model, storage)
+	for rows.Next() {
+		var key string
+		var blob []byte
+		if err := rows.Scan(&key, &blob); err != nil {
+			return nil, err
+		}
+		ix.add(key, storage.decode(blob))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// A concurrent writer may have added rows while we read; leave the index marked
+	// stale so the next search rebuilds instead of missing them.
+	if after, err := s.blobGeneration(model); err != nil || after != gen {
+		gen = -1
+	}
+	ix.generation = gen
+	return ix, nil
+}
+
+// saveVectorIndex persists the graph links if ix still matches embedding_blobs.
+func (s *Store) saveVectorIndex(ix *vectorIndex) error {
+	gen, err := s.blobGeneration(ix.model)
+	if err != nil {
+		return err
+	}
+	if ix.generation != gen {
+		return nil
+	}
+	_, err = s.DB.Exec(`INSERT OR REPLACE INTO vector_index (model, generation, graph, saved_at) VALUES (?, ?, ?, ?)`,
+		ix.model, gen, ix.marshal(), time.Now().Format(time.RFC3339))
+	if err == nil {
+		ix.dirty = false
+	}
+	return err
+}
+
+// SaveVectorIndex writes the in-memory ANN indexes to the database if they changed.
+// Close calls it; long-running writers may call it to checkpoint.
+func (s *Store) SaveVectorIndex() error {
+	s.vecMu.Lock()
+	defer s.vecMu.Unlock()
+	for _, ix := range s.vecs {
+		if !ix.dirty {
+			continue
+		}
+		if err := s.saveVectorIndex(ix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HasEmbeddings reports whether any chunk has been embedded, with any model.
+func (s *Store) HasEmbeddings() bool {
+	var n int
+	_ = s.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM embedding_blobs)`).Scan(&n)
+	return n > 0
+}
+
+// HasModelEmbeddings reports whether any chunk has been embedded with model.
+func (s *Store) HasModelEmbeddings(model string) bool {
+	var n int
+	_ = s.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM embedding_blobs WHERE model = ?)`, model).Scan(&n)
+	return n > 0
+}
+
+// SearchVectors returns the documents most similar to queryEmbedding using model's HNSW
+// index, one result per active document with its chunk scores combined by agg (only
+// chunks the graph search retrieved are combined). Only vectors embedded with model are
+// searched, so queryEmbedding must come from it. Results match SearchVectorsBrute up
+// to the approximation of the graph search. With quantized storage the graph is
+// searched on codes; if KeepFullVectors is on, the candidates are then rescored against
+// full-precision vectors.
+// Only documents of collections (all when nil) meeting where are returned, before limit
+// is applied; results carry their metadata.
+func (s *Store) SearchVectors(model string, queryEmbedding []float32, limit int, agg ChunkAggregation, collections []string, where Where) ([]VecSearchResult, error) {
+	keepFull, err := s.KeepFullVectors()
+	if err != nil {
+		return nil, err
+	}
+	s.vecMu.Lock()
+	ix, err := s.loadVectorIndex(model)
+	if err != nil {
+		s.vecMu.Unlock()
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = ix.live
+	}
+	// Blobs of deactivated documents stay in the graph until cleanup, long documents
+	// contribute many chunks and collections and where may filter out documents, so
+	// over-fetch and widen the search until enough active documents turn up.
+	var out []VecSearchResult
+	factor := 1
+	if keepFull {
+		factor = ix.storage.rescoreFactor()
+	}
+	for k := limit*2 + 10; ; k *= 2 {
+		hits := ix.search(queryEmbedding, k*factor)
+		s.vecMu.Unlock()
+		exhausted := len(hits) < k*factor
+		if factor > 1 {
+			if hits, err = s.rescoreHits(model, queryEmbedding, hits); err != nil {
+				break
+			}
+			if len(hits) > k {
+				hits = hits[:k]
+			}
+		}
+		out, err = s.documentResults(hits, agg, collections, where)
+		if err != nil || len(out) >= limit || exhausted {
+			break
+		}
+		s.vecMu.Lock()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	if err := s.fillMatchedPassages(model, out); err != nil {
+		return nil, err
+	}
+	return out, s.fillVecMetadata(out)
+}
+
+// rescoreHits replaces approximate scores with exact cosine similarity computed from
+// embedding_full, and re-sorts. Hits without a full-precision vector keep their score.
+func (s *Store) rescoreHits(model string, query []float32, hits []vecHit) ([]vecHit, error) {
+	if len(hits) == 0 {
+		return hits, nil
+	}
+	args := make([]interface{}, len(hits)+1)
+	args[0] = model
+	for i, h := range hits {
+		args[i+1] = h.Key
+	}
+	rows, err := s.DB.Query(`SELECT hash_seq, embedding FROM embedding_full WHERE model = ? AND hash_seq IN (?`+
+		strings.Repeat(",?", len(hits)-1)+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	exact := make(map[string]float64, len(hits))
+	for rows.Next() {
+		var key string
+		var blob []byte
+		if err := rows.Scan(&key, &blob); err != nil {
+			return nil, err
+		}
+		exact[key] = cosineSimilarity(query, BlobToFloat32Slice(blob))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	out := make([]vecHit, len(hits))
+	for i, h := range hits {
+		if sc, ok := exact[h.Key]; ok {
+			h.Score = sc
+		}
+		out[i] = h
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Score > out[j].Score })
+	return out, nil
+}
+
+// resetVectorIndex drops the in-memory and persisted ANN indexes of every model.
+func (s *Store) resetVectorIndex() error {
+	s.vecMu.Lock()
+	defer s.vecMu.Unlock()
+	s.vecs = nil
+	_, err := s.DB.Exec(`DELETE FROM vector_index`)
+	if err != nil {
+		return fmt.Errorf("reset vector index: %w", err)
+	}
+	return nil
+}
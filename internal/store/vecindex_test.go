@@ -0,0 +1,251 @@
+package store
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSearchVectorsMatchesBrute(t *testing.T) {
+	path := tempDBPath(t)
+	s, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+
+	rng := rand.New(rand.NewSource(11))
+	now := time.Now()
+	vecs := randomVectors(rng, 60, 16)
+	for i, v := range vecs {
+		body := "document number " + itoa(i)
+		hash := HashContent(body)
+		s.InsertContent(hash, body, now)
+		s.InsertDocument("col", "doc"+itoa(i)+".md", "Doc "+itoa(i), hash, now, now)
+		if err := s.InsertEmbedding(hash, 0, 0, v, "test-model", now); err != nil {
+			t.Fatalf("InsertEmbedding failed: %v", err)
+		}
+	}
+
+	query := vecs[17]
+	ann, err := s.SearchVectors("test-model", query, 5, AggregateMax, nil, nil)
+	if err != nil {
+		t.Fatalf("SearchVectors failed: %v", err)
+	}
+	exact, err := s.SearchVectorsBrute("test-model", query, 5, AggregateMax, nil, nil)
+	if err != nil {
+		t.Fatalf("SearchVectorsBrute failed: %v", err)
+	}
+	if len(ann) != 5 || ann[0].Filepath != exact[0].Filepath || ann[0].Filepath != "qmd://col/doc17.md" {
+		t.Fatalf("Expected top hit qmd://col/doc17.md from both searches, got ann=%v exact=%v", ann, exact)
+	}
+
+	// Persisted graph is reused after reopening.
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	s, err = NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	defer s.Close()
+	var saved int
+	_ = s.DB.QueryRow(`SELECT COUNT(*) FROM vector_index`).Scan(&saved)
+	if saved != 1 {
+		t.Fatal("Expected persisted vector index after Close")
+	}
+	ann, err = s.SearchVectors("test-model", query, 1, AggregateMax, nil, nil)
+	if err != nil || len(ann) != 1 || ann[0].Filepath != "qmd://col/doc17.md" {
+		t.Fatalf("Expected doc17 after reload, got %v (err %v)", ann, err)
+	}
+
+	// A write that bypasses the index (another process) is picked up by a rebuild.
+	body := "written elsewhere"
+	hash := HashContent(body)
+	s.InsertContent(hash, body, now)
+	s.InsertDocument("col", "elsewhere.md", "Elsewhere", hash, now, now)
+	if _, err := s.DB.Exec(`INSERT INTO embedding_blobs (model, hash_seq, embedding) VALUES (?, ?, ?)`,
+		"test-model", hash+"_0", float32SliceToBlob([]float32{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16})); err != nil {
+		t.Fatal(err)
+	}
+	ann, err = s.SearchVectors("test-model", []float32{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}, 1, AggregateMax, nil, nil)
+	if err != nil || len(ann) != 1 || ann[0].Filepath != "qmd://col/elsewhere.md" {
+		t.Fatalf("Expected externally written vector to be found, got %v (err %v)", ann, err)
+	}
+}
+
+func TestSearchVectorsSkipsInactive(t *testing.T) {
+	s, err := NewStore(tempDBPath(t))
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	defer s.Close()
+
+	now := time.Now()
+	for i, v := range [][]float32{{1, 0}, {0.9, 0.1}} {
+		body := "doc " + itoa(i)
+		hash := HashContent(body)
+		s.InsertContent(hash, body, now)
+		s.InsertDocument("col", "d"+itoa(i)+".md", "D", hash, now, now)
+		s.InsertEmbedding(hash, 0, 0, v, "m", now)
+	}
+	s.DeactivateDocument("col", "d0.md")
+
+	res, err := s.SearchVectors("m", []float32{1, 0}, 1, AggregateMax, nil, nil)
+	if err != nil {
+		t.Fatalf("SearchVectors failed: %v", err)
+	}
+	if len(res) != 1 || res[0].Filepath != "qmd://col/d1.md" {
+		t.Errorf("Expected only the active document, got %v", res)
+	}
+}
+
+func TestSearchVectorsCollections(t *testing.T) {
+	s, err := NewStore(tempDBPath(t))
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	defer s.Close()
+
+	// Every document of "near" ranks above every document of "far".
+	now := time.Now()
+	for i := 0; i < 40; i++ {
+		col, v := "near", []float32{1, float32(i) / 100}
+		if i%4 == 0 {
+			col, v = "far", []float32{float32(i) / 100, 1}
+		}
+		body := "doc " + itoa(i)
+		hash := HashContent(body)
+		s.InsertContent(hash, body, now)
+		s.InsertDocument(col, "d"+itoa(i)+".md", "D", hash, now, now)
+		s.InsertEmbedding(hash, 0, 0, v, "m", now)
+	}
+
+	for name, search := range map[string]func(string, []float32, int, ChunkAggregation, []string, Where) ([]VecSearchResult, error){
+		"ann": s.SearchVectors, "exact": s.SearchVectorsBrute,
+	} {
+		res, err := search("m", []float32{1, 0}, 5, AggregateMax, []string{"far"}, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(res) != 5 {
+			t.Errorf("%s: expected 5 results from far, got %d", name, len(res))
+		}
+		for _, r := range res {
+			if !strings.HasPrefix(r.Filepath, "qmd://far/") {
+				t.Errorf("%s: result %s is not in far", name, r.Filepath)
+			}
+		}
+	}
+}
+
+func TestInsertEmbeddingsBatch(t *testing.T) {
+	s, err := NewStore(tempDBPath(t))
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	defer s.Close()
+
+	rng := rand.New(rand.NewSource(3))
+	now := time.Now()
+	vecs := randomVectors(rng, 40, 16)
+	var batch []Embedding
+	for i, v := range vecs {
+		body := "document number " + itoa(i)
+		hash := HashContent(body)
+		s.InsertContent(hash, body, now)
+		s.InsertDocument("col", "doc"+itoa(i)+".md", "Doc "+itoa(i), hash, now, now)
+		batch = append(batch, Embedding{Hash: hash, Vector: v})
+	}
+	// Warm the in-memory index so the batch is added to it incrementally.
+	if _, err := s.SearchVectors("test-model", vecs[0], 1, AggregateMax, nil, nil); err != nil {
+		t.Fatalf("SearchVectors failed: %v", err)
+	}
+	if err := s.InsertEmbeddings(batch[:25], "test-model", now); err != nil {
+		t.Fatalf("InsertEmbeddings failed: %v", err)
+	}
+	if err := s.InsertEmbeddings(batch[25:], "test-model", now); err != nil {
+		t.Fatalf("InsertEmbeddings failed: %v", err)
+	}
+	if s.vecs["test-model"] == nil || s.vecs["test-model"].live != len(vecs) {
+		t.Fatalf("Expected the in-memory index to hold all %d vectors", len(vecs))
+	}
+
+	var n int
+	_ = s.DB.QueryRow(`SELECT COUNT(*) FROM content_vectors`).Scan(&n)
+	if n != len(vecs) {
+		t.Errorf("content_vectors has %d rows, want %d", n, len(vecs))
+	}
+	res, err := s.SearchVectors("test-model", vecs[31], 1, AggregateMax, nil, nil)
+	if err != nil || len(res) != 1 || res[0].Filepath != "qmd://col/doc31.md" {
+		t.Errorf("Expected doc31, got %v (%v)", res, err)
+	}
+}
+
+func TestVectorsPerModel(t *testing.T) {
+	s, err := NewStore(tempDBPath(t))
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	defer s.Close()
+
+	now := time.Now()
+	var hashes []string
+	for i := 0; i < 3; i++ {
+		body := "doc " + itoa(i)
+		hash := HashContent(body)
+		s.InsertContent(hash, body, now)
+		s.InsertDocument("col", "d"+itoa(i)+".md", "D", hash, now, now)
+		hashes = append(hashes, hash)
+	}
+	// "old" has 2-d vectors for every document; "new" has 3-d vectors for one so far.
+	for i, v := range [][]float32{{1, 0}, {0, 1}, {0.7, 0.7}} {
+		if err := s.InsertEmbedding(hashes[i], 0, 0, v, "old", now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.SearchVectors("old", []float32{1, 0}, 1, AggregateMax, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	oldIndex := s.vecs["old"]
+	if err := s.InsertEmbedding(hashes[1], 0, 0, []float32{0, 0, 1}, "new", now); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := s.SearchVectors("old", []float32{1, 0}, 3, AggregateMax, nil, nil)
+	if err != nil || len(res) != 3 || res[0].Filepath != "qmd://col/d0.md" {
+		t.Errorf("Expected all three documents from the old model, got %v (%v)", res, err)
+	}
+	if s.vecs["old"] != oldIndex {
+		t.Error("Writing vectors for another model rebuilt the old model's index")
+	}
+	for name, search := range map[string]func(string, []float32, int, ChunkAggregation, []string, Where) ([]VecSearchResult, error){
+		"ann": s.SearchVectors, "exact": s.SearchVectorsBrute,
+	} {
+		res, err = search("new", []float32{0, 0, 1}, 3, AggregateMax, nil, nil)
+		if err != nil || len(res) != 1 || res[0].Filepath != "qmd://col/d1.md" {
+			t.Errorf("%s: expected only the new model's vector, got %v (%v)", name, res, err)
+		}
+	}
+
+	if missing, _ := s.GetHashesForEmbedding("new"); len(missing) != 2 {
+		t.Errorf("Expected two documents without new vectors, got %d", len(missing))
+	}
+	if missing, _ := s.GetHashesForEmbedding("old"); len(missing) != 0 {
+		t.Errorf("Expected no documents without old vectors, got %d", len(missing))
+	}
+	models, err := s.EmbeddingModels()
+	if err != nil || len(models) != 2 || models[0].Model != "new" || models[1].Chunks != 3 {
+		t.Errorf("EmbeddingModels = %+v, %v", models, err)
+	}
+
+	if n, err := s.DeleteModelEmbeddings("old"); err != nil || n != 3 {
+		t.Fatalf("DeleteModelEmbeddings = %d, %v", n, err)
+	}
+	if s.HasModelEmbeddings("old") || !s.HasModelEmbeddings("new") {
+		t.Error("Expected only the new model's vectors to remain")
+	}
+	if res, _ := s.SearchVectors("old", []float32{1, 0}, 3, AggregateMax, nil, nil); len(res) != 0 {
+		t.Errorf("Expected no results from a deleted model, got %v", res)
+	}
+}
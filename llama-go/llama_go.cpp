@@ -136,6 +136,222 @@ int llama_go_embed(LlamaGoModel model, const char* text, float* embedding, int m
     }
 }
 
+// Build the reranker prompt: the model's "rerank" chat template with {query} and
+// {document} substituted when it has one (Qwen3-Reranker), otherwise the
+// cross-encoder layout [BOS] query [EOS] [SEP] document [EOS] (bge-reranker).
+static bool rerank_tokens(const llama_model* m, const llama_vocab* vocab, const char* query,
+                          const char* document, std::vector<llama_token>& out) {
+    auto tokenize = [&](const std::string& text, bool add_special, bool parse_special) {
+        std::vector<llama_token> toks;
+        int n = llama_tokenize(vocab, text.c_str(), (int32_t)text.size(), nullptr, 0, add_special, parse_special);
+        if (n < 0) {
+            toks.resize(-n);
+            n = llama_tokenize(vocab, text.c_str(), (int32_t)text.size(), toks.data(), (int32_t)toks.size(), add_special, parse_special);
+        }
+        toks.resize(n < 0 ? 0 : n);
+        return toks;
+    };
+
+    const char* tmpl = llama_model_chat_template(m, "rerank");
+    if (tmpl) {
+        std::string prompt = tmpl;
+        auto replace = [&prompt](const std::string& key, const std::string& value) {
+            size_t pos = prompt.find(key);
+            if (pos != std::string::npos) {
+                prompt.replace(pos, key.size(), value);
+            }
+        };
+        replace("{query}", query);
+        replace("{document}", document);
+        out = tokenize(prompt, false, true);
+        return !out.empty();
+    }
+
+    std::vector<llama_token> q = tokenize(query, false, false);
+    std::vector<llama_token> d = tokenize(document, false, false);
+    llama_token bos = llama_vocab_bos(vocab);
+    llama_token eos = llama_vocab_eos(vocab);
+    llama_token sep = llama_vocab_sep(vocab);
+    out.clear();
+    if (bos != LLAMA_TOKEN_NULL) out.push_back(bos);
+    out.insert(out.end(), q.begin(), q.end());
+    if (eos != LLAMA_TOKEN_NULL) out.push_back(eos);
+    if (sep != LLAMA_TOKEN_NULL) out.push_back(sep);
+    out.insert(out.end(), d.begin(), d.end());
+    if (eos != LLAMA_TOKEN_NULL) out.push_back(eos);
+    return !q.empty() && !d.empty();
+}
+
+int llama_go_rerank(LlamaGoModel model, const char* query, const char* document, float* score) {
+    if (!model || !query || !document || !score) {
+        set_error("invalid parameters");
+        return -1;
+    }
+
+    try {
+        llama_model* m = reinterpret_cast<llama_model*>(model);
+
+        const llama_vocab* vocab = llama_model_get_vocab(m);
+        if (!vocab) {
+            set_error("failed to get vocab");
+            return -1;
+        }
+
+        std::vector<llama_token> tokens;
+        if (!rerank_tokens(m, vocab, query, document, tokens)) {
+            set_error("tokenization failed");
+            return -1;
+        }
+
+        // Rank pooling reduces the sequence to a single relevance logit.
+        llama_context_params ctx_params = llama_context_default_params();
+        ctx_params.embeddings = true;
+        ctx_params.pooling_type = LLAMA_POOLING_TYPE_RANK;
+        ctx_params.n_ctx = (uint32_t)tokens.size();
+        ctx_params.n_batch = (uint32_t)tokens.size();
+        ctx_params.n_ubatch = (uint32_t)tokens.size();
+
+        llama_context* ctx = llama_init_from_model(m, ctx_params);
+        if (!ctx) {
+            set_error("failed to create context");
+            return -1;
+        }
+
+        int n_tokens = (int)tokens.size();
+        llama_batch batch = llama_batch_init(n_tokens, 0, 1);
+        batch.n_tokens = n_tokens;
+        for (int i = 0; i < n_tokens; i++) {
+            batch.token[i] = tokens[i];
+            batch.pos[i] = i;
+            batch.n_seq_id[i] = 1;
+            batch.seq_id[i][0] = 0;
+            batch.logits[i] = 1;  // pooling reads every position
+        }
+
+        if (llama_decode(ctx, batch) < 0) {
+            llama_batch_free(batch);
+            llama_free(ctx);
+            set_error("decode failed");
+            return -1;
+        }
+        llama_batch_free(batch);
+
+        const float* emb = llama_get_embeddings_seq(ctx, 0);
+        if (!emb) {
+            llama_free(ctx);
+            set_error("model does not produce rerank scores (not a reranker?)");
+            return -1;
+        }
+        *score = emb[0];
+
+        llama_free(ctx);
+        return 0;
+    } catch (const std::exception& e) {
+        set_error(e.what());
+        return -1;
+    } catch (...) {
+        set_error("unknown exception during rerank");
+        return -1;
+    }
+}
+
+int llama_go_generate(LlamaGoModel model, const char* system, const char* prompt, float temperature,
+                      char* out, int out_size, int max_tokens) {
+    if (!model || !prompt || !out || out_size <= 0 || max_tokens <= 0) {
+        set_error("invalid parameters");
+        return -1;
+    }
+
+    try {
+        llama_model* m = reinterpret_cast<llama_model*>(model);
+
+        const llama_vocab* vocab = llama_model_get_vocab(m);
+        if (!vocab) {
+            set_error("failed to get vocab");
+            return -1;
+        }
+
+        // Wrap the prompt as a user turn; fall back to the raw prompt without a template.
+        std::string text = system && *system ? std::string(system) + "\n\n" + prompt : std::string(prompt);
+        const char* tmpl = llama_model_chat_template(m, nullptr);
+        if (tmpl) {
+            std::vector<llama_chat_message> msgs;
+            if (system && *system) {
+                msgs.push_back({"system", system});
+            }
+            msgs.push_back({"user", prompt});
+            std::vector<char> buf(text.size() + 512);
+            int n = llama_chat_apply_template(tmpl, msgs.data(), msgs.size(), true, buf.data(), (int32_t)buf.size());
+            if (n > (int)buf.size()) {
+                buf.resize(n);
+                n = llama_chat_apply_template(tmpl, msgs.data(), msgs.size(), true, buf.data(), (int32_t)buf.size());
+            }
+            if (n > 0) {
+                text.assign(buf.data(), n);
+            }
+        }
+
+        int n_prompt = -llama_tokenize(vocab, text.c_str(), (int32_t)text.size(), nullptr, 0, true, true);
+        std::vector<llama_token> tokens(n_prompt > 0 ? n_prompt : 0);
+        if (n_prompt <= 0 ||
+            llama_tokenize(vocab, text.c_str(), (int32_t)text.size(), tokens.data(), (int32_t)tokens.size(), true, true) < 0) {
+            set_error("tokenization failed");
+            return -1;
+        }
+
+        llama_context_params ctx_params = llama_context_default_params();
+        ctx_params.n_ctx = (uint32_t)(n_prompt + max_tokens);
+        ctx_params.n_batch = (uint32_t)n_prompt;
+        llama_context* ctx = llama_init_from_model(m, ctx_params);
+        if (!ctx) {
+            set_error("failed to create context");
+            return -1;
+        }
+        llama_sampler* smpl = llama_sampler_chain_init(llama_sampler_chain_default_params());
+        if (temperature > 0) {
+            llama_sampler_chain_add(smpl, llama_sampler_init_temp(temperature));
+            llama_sampler_chain_add(smpl, llama_sampler_init_dist(LLAMA_DEFAULT_SEED));
+        } else {
+            llama_sampler_chain_add(smpl, llama_sampler_init_greedy());
+        }
+
+        std::string reply;
+        llama_batch batch = llama_batch_get_one(tokens.data(), (int32_t)tokens.size());
+        llama_token tok;
+        for (int i = 0; i < max_tokens; i++) {
+            if (llama_decode(ctx, batch) != 0) {
+                llama_sampler_free(smpl);
+                llama_free(ctx);
+                set_error("decode failed");
+                return -1;
+            }
+            tok = llama_sampler_sample(smpl, ctx, -1);
+            if (llama_vocab_is_eog(vocab, tok)) {
+                break;
+            }
+            char piece[256];
+            int n = llama_token_to_piece(vocab, tok, piece, sizeof(piece), 0, false);
+            if (n > 0) {
+                reply.append(piece, n);
+            }
+            batch = llama_batch_get_one(&tok, 1);
+        }
+        llama_sampler_free(smpl);
+        llama_free(ctx);
+
+        int n = (int)reply.size() < out_size - 1 ? (int)reply.size() : out_size - 1;
+        std::memcpy(out, reply.data(), n);
+        out[n] = '\0';
+        return n;
+    } catch (const std::exception& e) {
+        set_error(e.what());
+        return -1;
+    } catch (...) {
+        set_error("unknown exception during generation");
+        return -1;
+    }
+}
+
 const char* llama_go_get_error(void) {
     return g_last_error.c_str();
 }
@@ -20,6 +20,19 @@ void llama_go_free(LlamaGoModel model);
 // embedding must be pre-allocated with at least max_dims floats.
 int llama_go_embed(LlamaGoModel model, const char* text, float* embedding, int max_dims);
 
+// Score how relevant document is to query with a reranker model (e.g. Qwen3-Reranker,
+// bge-reranker). Writes the raw relevance logit to score; higher is more relevant.
+// Returns 0 on success, -1 on error.
+int llama_go_rerank(LlamaGoModel model, const char* query, const char* document, float* score);
+
+// Generate a reply to prompt, sent as a user message (after an optional system
+// message; system may be NULL) through the model's chat template. temperature <= 0
+// samples greedily. Generates at most max_tokens tokens and writes the NUL-terminated
+// reply to out (truncated to out_size). Returns the reply length in bytes, or -1 on
+// error.
+int llama_go_generate(LlamaGoModel model, const char* system, const char* prompt, float temperature,
+                      char* out, int out_size, int max_tokens);
+
 // Get last error message (thread-local)
 const char* llama_go_get_error(void);
 
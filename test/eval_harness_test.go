@@ -60,20 +60,62 @@ var evalQueries = []evalQuery{
 	{"beta program 47 bugs", "product-launch", difficultyHard, "Specific number recall"},
 }
 
-func findEvalDocsDir(t *testing.T) string {
+// multilingualQueries run against test/eval-docs-i18n, indexed as a trigram collection;
+// those for space-separated languages (German and Vietnamese) also run against the same
+// documents in a default unicode61 collection. Unlike evalQueries they must all hit:
+// each is a keyword that appears in its document.
+var multilingualQueries = []evalQuery{
+	{"Verspätung", "de-bahnreise", difficultyEasy, "German umlaut"},
+	{"fahrradabteil", "de-bahnreise", difficultyEasy, "German compound, lowercase"},
+	{"Gepäck", "de-bahnreise", difficultyEasy, "German heading"},
+	{"Entschädigung Fahrpreis", "de-bahnreise", difficultyMedium, "German umlaut and a second term"},
+	{"München", "de-bahnreise", difficultyMedium, "German umlaut in the title"},
+	{"nước dùng", "vi-nau-pho", difficultyEasy, "Vietnamese diacritics"},
+	{"phở bò", "vi-nau-pho", difficultyEasy, "Vietnamese title words"},
+	{"linh hồn", "vi-nau-pho", difficultyMedium, "Vietnamese stacked diacritics"},
+	{"新幹線", "ja-shinkansen", difficultyEasy, "Japanese word inside a sentence"},
+	{"払い戻し", "ja-shinkansen", difficultyMedium, "Japanese mixed kana/kanji"},
+	{"荷物", "ja-shinkansen", difficultyMedium, "Two-character Japanese word"},
+	{"乌龙茶", "zh-chaye", difficultyEasy, "Chinese word inside a sentence"},
+	{"龙井", "zh-chaye", difficultyMedium, "Two-character Chinese word"},
+	{"绿茶 -咖啡", "zh-chaye", difficultyHard, "Chinese exclusion of an absent term"},
+}
+
+func findEvalDocsDir(t *testing.T, name string) string {
 	cwd, err := os.Getwd()
 	if err != nil {
 		t.Fatalf("getwd: %v", err)
 	}
-	for _, base := range []string{filepath.Join(cwd, "test", "eval-docs"), filepath.Join(cwd, "eval-docs")} {
+	for _, base := range []string{filepath.Join(cwd, "test", name), filepath.Join(cwd, name)} {
 		if info, err := os.Stat(base); err == nil && info.IsDir() {
 			return base
 		}
 	}
-	t.Fatalf("eval-docs directory not found from %q; run tests from repo root", cwd)
+	t.Fatalf("%s directory not found from %q; run tests from repo root", name, cwd)
 	return ""
 }
 
+// openEvalStore opens a temporary index, skipping the test when FTS5 is unavailable.
+func openEvalStore(t *testing.T) *store.Store {
+	tmpFile, err := os.CreateTemp("", "qmd-eval-*.sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbPath := tmpFile.Name()
+	tmpFile.Close()
+	t.Cleanup(func() { os.Remove(dbPath) })
+
+	s, err := store.NewStore(dbPath)
+	if err != nil {
+		if strings.Contains(err.Error(), "no such module: fts5") {
+			t.Skip("sqlite3 built without FTS5; skip eval harness")
+		}
+		t.Fatalf("NewStore: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
 type difficultyStats struct {
 	total, hit1, hit3, hit5 int
 }
@@ -107,26 +149,10 @@ func firstMatchingRank(results []store.SearchResult, expectedDoc string) int {
 }
 
 func TestEvalHarnessSearch(t *testing.T) {
-	evalDocsDir := findEvalDocsDir(t)
-
-	tmpFile, err := os.CreateTemp("", "qmd-eval-*.sqlite")
-	if err != nil {
-		t.Fatal(err)
-	}
-	dbPath := tmpFile.Name()
-	tmpFile.Close()
-	defer os.Remove(dbPath)
+	evalDocsDir := findEvalDocsDir(t, "eval-docs")
+	s := openEvalStore(t)
 
-	s, err := store.NewStore(dbPath)
-	if err != nil {
-		if strings.Contains(err.Error(), "no such module: fts5") {
-			t.Skip("sqlite3 built without FTS5; skip eval harness")
-		}
-		t.Fatalf("NewStore: %v", err)
-	}
-	defer s.Close()
-
-	err = indexer.IndexFiles(s, evalCollection, evalDocsDir, "**/*.md")
+	err := indexer.IndexFiles(s, evalCollection, evalDocsDir, "**/*.md", indexer.Options{})
 	if err != nil {
 		t.Fatalf("IndexFiles: %v", err)
 	}
@@ -139,7 +165,7 @@ func TestEvalHarnessSearch(t *testing.T) {
 
 	t.Log("=== Evaluating SEARCH mode ===")
 	for _, q := range evalQueries {
-		results, err := s.SearchFTS(q.query, 5, "")
+		results, err := s.SearchFTS(q.query, 5, "", nil)
 		if err != nil {
 			t.Logf("SearchFTS %q: %v", q.query, err)
 			stats[q.difficulty].add(-1)
@@ -199,3 +225,42 @@ func TestEvalHarnessSearch(t *testing.T) {
 	}
 	t.Logf("Overall: Hit@1=%d%% Hit@3=%d%%", overall1, overall3)
 }
+
+func TestEvalHarnessMultilingual(t *testing.T) {
+	docsDir := findEvalDocsDir(t, "eval-docs-i18n")
+	s := openEvalStore(t)
+
+	// The same documents in both kinds of collection: trigram for every language, and
+	// unicode61, which needs the query sanitized into words, for the spaced ones.
+	const trigram, unicode61 = "eval-i18n-trigram", "eval-i18n-unicode61"
+	if err := s.SetCollectionTokenizer(trigram, store.TokenizerTrigram); err != nil {
+		t.Fatalf("SetCollectionTokenizer: %v", err)
+	}
+	for _, collection := range []string{trigram, unicode61} {
+		if err := indexer.IndexFiles(s, collection, docsDir, "**/*.md", indexer.Options{}); err != nil {
+			t.Fatalf("IndexFiles %s: %v", collection, err)
+		}
+	}
+
+	for _, collection := range []string{trigram, unicode61} {
+		hits, total := 0, 0
+		for _, q := range multilingualQueries {
+			if collection == unicode61 && !strings.HasPrefix(q.expectedDoc, "de-") && !strings.HasPrefix(q.expectedDoc, "vi-") {
+				continue
+			}
+			total++
+			results, err := s.SearchFTS(q.query, 5, collection, nil)
+			if err != nil {
+				t.Errorf("%s: SearchFTS %q: %v", collection, q.query, err)
+				continue
+			}
+			rank := firstMatchingRank(results, q.expectedDoc)
+			if rank != 1 {
+				t.Errorf("%s: [%s] %q (%s): expected %s at rank 1, got %d", collection, q.difficulty, q.query, q.description, q.expectedDoc, rank)
+				continue
+			}
+			hits++
+		}
+		t.Logf("Multilingual (%s): Hit@1=%d/%d", collection, hits, total)
+	}
+}